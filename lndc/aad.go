@@ -0,0 +1,60 @@
+package lndc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAADMismatch is returned by ReadMessageWithAAD when the next message
+// wasn't written with the expected associated data. The message is dropped,
+// and the connection remains usable.
+var ErrAADMismatch = errors.New("lndc: message associated data mismatch")
+
+// WriteMessageWithAAD writes msg to the connection as a single message,
+// binding the associated data aad to it within the AEAD construction. aad
+// isn't sent, so the remote peer must read the message with
+// ReadMessageWithAAD and the same aad, allowing the message to be bound to
+// context both sides already track, such as a sequence number. As msg can't
+// be split, it must fit within a single message: 65535 bytes, less a byte for
+// its frame type if frames are in use, unless ExtendedLength was negotiated.
+// An empty aad binds nothing, as if the message were written by Write.
+func (c *Conn) WriteMessageWithAAD(msg, aad []byte) error {
+	if len(msg) > c.maxPayload() {
+		return fmt.Errorf("lndc: message of %d bytes exceeds the max "+
+			"payload of %d", len(msg), c.maxPayload())
+	}
+
+	c.armWriteDeadline()
+	c.teeWrite(msg)
+
+	// The whole message must fit within the remote peer's flow control
+	// window, as it can't be split.
+	if err := c.acquireAllCredits(len(msg)); err != nil {
+		return err
+	}
+
+	if c.framed {
+		msg = c.dataFrame(msg)
+	}
+
+	return c.writeMessageAD(msg, aad)
+}
+
+// ReadMessageWithAAD reads the next message from the connection, as
+// ReadNextMessage does, ensuring that it was written by WriteMessageWithAAD
+// with the same aad. ErrAADMismatch is returned if it wasn't.
+func (c *Conn) ReadMessageWithAAD(aad []byte) ([]byte, error) {
+	if err := c.waitReadsResumed(); err != nil {
+		return nil, err
+	}
+
+	c.armReadDeadline()
+	msg, err := c.readMessageAD(aad)
+	if err != nil {
+		return nil, err
+	}
+	c.teeRead(msg)
+	c.consumed(len(msg))
+
+	return msg, nil
+}
@@ -0,0 +1,129 @@
+package lndc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seqAD returns the associated data binding a message to sequence number
+// seq.
+func seqAD(seq uint64) []byte {
+	var ad [8]byte
+	binary.BigEndian.PutUint64(ad[:], seq)
+	return ad[:]
+}
+
+func TestMessageWithAAD(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		options []func(*Config)
+	}{
+		{"legacy", nil},
+		{"framed", []func(*Config){WithFlowWindow(1 << 16)}},
+	} {
+		listener, pkh := newTestListener(t, test.options...)
+		local, remote := dialAndAccept(t, listener, pkh, test.options...)
+
+		msg := []byte("bound to its sequence number")
+		for i := uint64(1); i <= 3; i++ {
+			go remote.WriteMessageWithAAD(msg, seqAD(i))
+
+			got, err := local.ReadMessageWithAAD(seqAD(i))
+			if err != nil {
+				t.Fatalf("%s: unable to read message %d: %v",
+					test.name, i, err)
+			}
+			if !bytes.Equal(got, msg) {
+				t.Fatalf("%s: expected %q, got %q", test.name,
+					msg, got)
+			}
+		}
+
+		// A message read with other associated data than it was
+		// written with is rejected.
+		go remote.WriteMessageWithAAD(msg, seqAD(4))
+		if _, err := local.ReadMessageWithAAD(seqAD(5)); err !=
+			ErrAADMismatch {
+
+			t.Fatalf("%s: expected %v, got %v", test.name,
+				ErrAADMismatch, err)
+		}
+
+		// As is one written without any, while the connection remains
+		// usable.
+		go remote.Write(msg)
+		if _, err := local.ReadMessageWithAAD(seqAD(5)); err !=
+			ErrAADMismatch {
+
+			t.Fatalf("%s: expected %v, got %v", test.name,
+				ErrAADMismatch, err)
+		}
+		roundTrip(t, local, remote)
+
+		local.Close()
+		remote.Close()
+		listener.Close()
+	}
+}
+
+func TestMessageWithAADFlowWindow(t *testing.T) {
+	const window = 1024
+
+	listener, pkh := newTestListener(t, WithFlowWindow(window))
+	defer listener.Close()
+
+	reader, writer := dialAndAccept(t, listener, pkh,
+		WithFlowWindow(window))
+	defer reader.Close()
+	defer writer.Close()
+
+	// The writer must keep reading in order to receive credits.
+	go io.Copy(ioutil.Discard, writer)
+
+	// A message larger than the whole window could never be credited,
+	// so is refused at once rather than blocking forever.
+	err := writer.WriteMessageWithAAD(make([]byte, 2*window), seqAD(1))
+	if err == nil || !strings.HasPrefix(err.Error(),
+		ErrExceedsFlowWindow.Error()) {
+
+		t.Fatalf("expected %v, got %v", ErrExceedsFlowWindow, err)
+	}
+
+	// Fill most of the window, so that a message which would otherwise
+	// fit has to wait for credits, and times out.
+	if _, err := writer.Write(make([]byte, 600)); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	writer.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	err = writer.WriteMessageWithAAD(make([]byte, 600), seqAD(1))
+	expectTimeout(t, err)
+	writer.SetWriteDeadline(time.Time{})
+
+	// The timed out message held on to none of the window, so once the
+	// data written is read, a message filling the whole window can be
+	// sent.
+	if _, err := io.ReadFull(reader, make([]byte, 600)); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	msg := bytes.Repeat([]byte{1}, window)
+	writeErr := make(chan error, 1)
+	go func() {
+		writer.SetWriteDeadline(time.Now().Add(time.Second))
+		writeErr <- writer.WriteMessageWithAAD(msg, seqAD(2))
+	}()
+	got, err := reader.ReadMessageWithAAD(seqAD(2))
+	if err != nil {
+		t.Fatalf("unable to read message: %v", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("message corrupted")
+	}
+	if err := <-writeErr; err != nil {
+		t.Fatalf("unable to write message: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package lndc
+
+import (
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/cpu"
+)
+
+// cryptoFeatures returns the names of the CPU features detected which
+// accelerate the cipher suites, along with whether they're enough for AES-GCM
+// to be accelerated.
+func cryptoFeatures() ([]string, bool) {
+	var features []string
+	add := func(has bool, name string) {
+		if has {
+			features = append(features, name)
+		}
+	}
+
+	switch runtime.GOARCH {
+	case "amd64", "386":
+		add(cpu.X86.HasAES, "AES-NI")
+		add(cpu.X86.HasPCLMULQDQ, "PCLMULQDQ")
+		add(cpu.X86.HasSSSE3, "SSSE3")
+		add(cpu.X86.HasAVX2, "AVX2")
+		return features, cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ
+
+	case "arm64":
+		add(cpu.ARM64.HasAES, "AES")
+		add(cpu.ARM64.HasPMULL, "PMULL")
+		add(cpu.ARM64.HasASIMD, "ASIMD")
+		return features, cpu.ARM64.HasAES && cpu.ARM64.HasPMULL
+
+	case "s390x":
+		add(cpu.S390X.HasAESGCM, "KMA-GCM")
+		add(cpu.S390X.HasVX, "VX")
+		return features, cpu.S390X.HasAESGCM
+	}
+
+	return nil, false
+}
+
+// CryptoAcceleration describes the CPU features detected which accelerate the
+// cipher suites, and which suite they make the faster choice, so that the
+// expected throughput can be logged at startup. It's purely diagnostic.
+func CryptoAcceleration() string {
+	features, aesAccelerated := cryptoFeatures()
+
+	desc := "no crypto acceleration detected"
+	if len(features) > 0 {
+		desc = strings.Join(features, ", ")
+	}
+	if aesAccelerated {
+		return desc + "; " + CipherSuiteAESGCM + " is accelerated"
+	}
+
+	return desc + "; " + CipherSuiteChaChaPoly + " is the faster suite"
+}
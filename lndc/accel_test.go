@@ -0,0 +1,24 @@
+package lndc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCryptoAcceleration(t *testing.T) {
+	desc := CryptoAcceleration()
+	if desc == "" {
+		t.Fatalf("expected a description of crypto acceleration")
+	}
+
+	// Whatever was detected, the faster suite is named.
+	_, aesAccelerated := cryptoFeatures()
+	suite := CipherSuiteChaChaPoly
+	if aesAccelerated {
+		suite = CipherSuiteAESGCM
+	}
+	if !strings.Contains(desc, suite) {
+		t.Fatalf("expected %q to name %s", desc, suite)
+	}
+	t.Logf("crypto acceleration: %s", desc)
+}
@@ -0,0 +1,42 @@
+package lndc
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LastRead returns when a message was last read from the connection, or when
+// the connection was established if none has been.
+func (c *Conn) LastRead() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastRead))
+}
+
+// LastWrite returns when a message was last written to the connection, or
+// when the connection was established if none has been.
+func (c *Conn) LastWrite() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastWrite))
+}
+
+// LastActivity returns the later of LastRead and LastWrite. Control frames,
+// such as flow control credits, count as activity, though the messages of
+// the handshake don't.
+func (c *Conn) LastActivity() time.Time {
+	return time.Unix(0, c.lastActiveNanos())
+}
+
+// IdleConns returns a snapshot of the established connections produced by
+// this listener which have neither been read from nor written to for at
+// least idle, ordered by sequence number. Unlike ReadTimeout, it leaves the
+// connections open for the caller to report on or close as it sees fit.
+func (l *Listener) IdleConns(idle time.Duration) []*Conn {
+	cutoff := time.Now().Add(-idle).UnixNano()
+
+	var conns []*Conn
+	for _, conn := range l.Conns() {
+		if conn.lastActiveNanos() <= cutoff {
+			conns = append(conns, conn)
+		}
+	}
+
+	return conns
+}
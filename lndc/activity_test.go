@@ -0,0 +1,66 @@
+package lndc
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestConnLastActivity(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	established := local.LastActivity()
+	if established.IsZero() || time.Since(established) > time.Minute {
+		t.Fatalf("unexpected activity at establishment: %v", established)
+	}
+
+	// An idle connection's activity stays put.
+	time.Sleep(50 * time.Millisecond)
+	if !local.LastActivity().Equal(established) {
+		t.Fatalf("activity moved while idle")
+	}
+	if idle := listener.IdleConns(50 * time.Millisecond); len(idle) != 1 ||
+		idle[0] != local {
+
+		t.Fatalf("expected the conn to be idle, got %v", idle)
+	}
+
+	// A write moves the last write, but not the last read.
+	lastRead := local.LastRead()
+	if _, err := local.Write([]byte("ping")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	if !local.LastWrite().After(established) {
+		t.Fatalf("last write didn't move on write")
+	}
+	if !local.LastRead().Equal(lastRead) {
+		t.Fatalf("last read moved on write")
+	}
+
+	// A read moves the last read.
+	time.Sleep(10 * time.Millisecond)
+	lastWrite := local.LastWrite()
+	readExactly(t, remote, "ping")
+	if _, err := remote.Write([]byte("pong")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(local, buf); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if !local.LastRead().After(lastWrite) {
+		t.Fatalf("last read didn't move on read")
+	}
+	if !local.LastActivity().Equal(local.LastRead()) {
+		t.Fatalf("expected activity to be the last read")
+	}
+
+	if idle := listener.IdleConns(time.Minute); len(idle) != 0 {
+		t.Fatalf("expected no idle conns, got %d", len(idle))
+	}
+}
@@ -0,0 +1,202 @@
+package lndc
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// adversarialBehavior is a way in which an adversarialConn misbehaves
+// towards the listener it connects to.
+type adversarialBehavior int
+
+const (
+	// sendMalformedAct sends an act one whose MAC doesn't verify.
+	sendMalformedAct adversarialBehavior = iota
+
+	// truncateAct sends half of a valid act one, then hangs up.
+	truncateAct
+
+	// stallHandshake connects, then never sends anything.
+	stallHandshake
+
+	// sendOversizedFrame completes the handshake, then announces a
+	// message larger than any the listener accepts.
+	sendOversizedFrame
+
+	// replayActs replays the acts recorded from an earlier successful
+	// handshake with the listener.
+	replayActs
+)
+
+// String returns the name of the behavior.
+func (b adversarialBehavior) String() string {
+	return [...]string{"malformed act", "truncated act", "stalled handshake",
+		"oversized frame", "replayed acts"}[b]
+}
+
+// recordingConn records every write made to the wrapped connection.
+type recordingConn struct {
+	net.Conn
+
+	mtx    sync.Mutex
+	writes [][]byte
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.mtx.Lock()
+	c.writes = append(c.writes, append([]byte(nil), b...))
+	c.mtx.Unlock()
+
+	return c.Conn.Write(b)
+}
+
+// adversarialConn is a peer which connects to a listener over TCP and then
+// misbehaves in the manner of its behavior.
+type adversarialConn struct {
+	net.Conn
+
+	behavior adversarialBehavior
+}
+
+// dialAdversary connects to the listener, whose static key hashes to pkh,
+// and carries out the passed behavior. The listener must have been created
+// with ExtendedLength for sendOversizedFrame to succeed.
+func dialAdversary(t *testing.T, listener *Listener, pkh string,
+	behavior adversarialBehavior) *adversarialConn {
+
+	addr := listener.Addr().String()
+
+	// Acts to replay are recorded from an honest handshake, which the
+	// listener accepts.
+	var replay [][]byte
+	if behavior == replayActs {
+		raw, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("unable to dial listener: %v", err)
+		}
+		recorder := &recordingConn{Conn: raw}
+		honest, err := Upgrade(recorder, newKey(t), pkh)
+		if err != nil {
+			t.Fatalf("unable to record handshake: %v", err)
+		}
+		honest.Close()
+		acceptConn(t, listener).Close()
+		replay = recorder.writes
+	}
+
+	if behavior == sendOversizedFrame {
+		conn, err := Dial(newKey(t), addr, pkh, net.Dial,
+			WithExtendedLength())
+		if err != nil {
+			t.Fatalf("unable to dial listener: %v", err)
+		}
+		if !conn.noise.extendedLength {
+			t.Fatalf("expected extended lengths to be negotiated")
+		}
+
+		var header [extendedLengthHeaderSize]byte
+		binary.BigEndian.PutUint32(header[:], MaxExtendedMessageLength+1)
+		cipherHeader := conn.noise.sendCipher.Encrypt(nil, nil, header[:])
+		if _, err := conn.conn.Write(cipherHeader); err != nil {
+			t.Fatalf("unable to write header: %v", err)
+		}
+
+		return &adversarialConn{Conn: conn.conn, behavior: behavior}
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	a := &adversarialConn{Conn: conn, behavior: behavior}
+
+	switch behavior {
+	case sendMalformedAct, truncateAct:
+		machine := NewNoiseMachine(true, newKey(t))
+		act, err := machine.GenActOne()
+		if err != nil {
+			t.Fatalf("unable to generate act one: %v", err)
+		}
+		if behavior == sendMalformedAct {
+			act[ActOneSize-1] ^= 0xff
+			conn.Write(act[:])
+		} else {
+			conn.Write(act[:ActOneSize/2])
+			conn.Close()
+		}
+
+	case replayActs:
+		for _, act := range replay {
+			conn.Write(act)
+		}
+	}
+
+	return a
+}
+
+func TestListenerAdversarialPeers(t *testing.T) {
+	behaviors := []adversarialBehavior{sendMalformedAct, truncateAct,
+		stallHandshake, sendOversizedFrame, replayActs}
+
+	for _, behavior := range behaviors {
+		behavior := behavior
+		t.Run(behavior.String(), func(t *testing.T) {
+			listener, pkh := newTestListener(t,
+				WithExtendedLength())
+			defer listener.Close()
+
+			adversary := dialAdversary(t, listener, pkh, behavior)
+			defer adversary.Close()
+
+			switch behavior {
+			case stallHandshake:
+				// The stalled handshake holds a slot without
+				// holding up anyone else.
+				local, remote := dialAndAccept(t, listener, pkh)
+				local.Close()
+				remote.Close()
+
+			case sendOversizedFrame:
+				// The handshake succeeds, but reading the
+				// frame fails without allocating for it.
+				conn := acceptConn(t, listener)
+				defer conn.Close()
+				_, err := conn.Read(make([]byte, 1))
+				if err == nil || !strings.Contains(err.Error(),
+					"exceeding the max") {
+
+					t.Fatalf("expected oversized message to be "+
+						"rejected, got %v", err)
+				}
+
+			default:
+				if _, err := listener.Accept(); err == nil {
+					t.Fatalf("expected the %v to be rejected",
+						behavior)
+				}
+
+				// Honest peers are still served afterwards.
+				local, remote := dialAndAccept(t, listener, pkh)
+				roundTrip(t, local, remote)
+				local.Close()
+				remote.Close()
+			}
+
+			// Closing the listener aborts any handshake left
+			// running, so that none of its goroutines leak.
+			listener.Close()
+			deadline := time.Now().Add(5 * time.Second)
+			for listener.ActiveHandshakeGoroutines() != 0 {
+				if time.Now().After(deadline) {
+					t.Fatalf("%d handshake goroutines leaked",
+						listener.ActiveHandshakeGoroutines())
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
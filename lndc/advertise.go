@@ -0,0 +1,139 @@
+package lndc
+
+import (
+	"bytes"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// torV3Suffix is the top level domain of all onion service addresses.
+	torV3Suffix = ".onion"
+
+	// torV3HostLen is the length of a torv3 onion service address less
+	// its suffix: the base32 encoding of the service's 32-byte public
+	// key, a 2-byte checksum and a version byte.
+	torV3HostLen = 56
+
+	// torV3Version is the version byte of torv3 onion service addresses.
+	torV3Version = 3
+)
+
+// ErrInvalidAdvertisedAddr is returned when an advertised address is neither
+// a valid clearnet nor torv3 onion service address.
+var ErrInvalidAdvertisedAddr = errors.New("lndc: invalid advertised address")
+
+// torBase32 is the lower case base32 alphabet used within onion addresses.
+var torBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567")
+
+// validateAdvertisedAddr ensures addr is either a clearnet IP address or a
+// torv3 onion service address, along with a port, e.g. "203.0.113.7:2448"
+// or "<56 characters>.onion:2448".
+func validateAdvertisedAddr(addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%v %q: %v", ErrInvalidAdvertisedAddr, addr, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return fmt.Errorf("%v %q: bad port", ErrInvalidAdvertisedAddr, addr)
+	}
+
+	if strings.HasSuffix(host, torV3Suffix) {
+		if err := validateTorV3(strings.TrimSuffix(host, torV3Suffix)); err != nil {
+			return fmt.Errorf("%v %q: %v", ErrInvalidAdvertisedAddr,
+				addr, err)
+		}
+		return nil
+	}
+
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("%v %q: host is neither an IP nor onion "+
+			"address", ErrInvalidAdvertisedAddr, addr)
+	}
+
+	return nil
+}
+
+// validateTorV3 checks the host of a torv3 onion service address, less its
+// suffix, verifying its length, version and checksum.
+func validateTorV3(host string) error {
+	if len(host) != torV3HostLen {
+		return fmt.Errorf("onion host must be %d characters, got %d",
+			torV3HostLen, len(host))
+	}
+
+	raw, err := torBase32.DecodeString(host)
+	if err != nil {
+		return fmt.Errorf("onion host isn't base32: %v", err)
+	}
+	pubKey, checksum, version := raw[:32], raw[32:34], raw[34]
+	if version != torV3Version {
+		return fmt.Errorf("unsupported onion version %d", version)
+	}
+
+	// The checksum is the first two bytes of
+	// SHA3-256(".onion checksum" || pubkey || version).
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pubKey)
+	h.Write([]byte{version})
+	if !bytes.Equal(h.Sum(nil)[:2], checksum) {
+		return errors.New("onion checksum mismatch")
+	}
+
+	return nil
+}
+
+// offerAdvertisedAddr offers the initiator's advertised address.
+func offerAdvertisedAddr(c *Conn, cfg *Config) []byte {
+	if cfg.AdvertisedAddr == "" {
+		return nil
+	}
+
+	return []byte(cfg.AdvertisedAddr)
+}
+
+// answerAdvertisedAddr records the initiator's advertised address, if any,
+// and answers with the responder's own.
+func answerAdvertisedAddr(c *Conn, cfg *Config, offer []byte) ([]byte, error) {
+	if err := c.setRemoteAdvertisedAddr(offer); err != nil {
+		return nil, err
+	}
+
+	return offerAdvertisedAddr(c, cfg), nil
+}
+
+// acceptAdvertisedAddr records the responder's advertised address, if any.
+func acceptAdvertisedAddr(c *Conn, cfg *Config, answer []byte) error {
+	return c.setRemoteAdvertisedAddr(answer)
+}
+
+// setRemoteAdvertisedAddr validates and records the address advertised by the
+// remote peer, if it sent one.
+func (c *Conn) setRemoteAdvertisedAddr(addr []byte) error {
+	if addr == nil {
+		return nil
+	}
+	if err := validateAdvertisedAddr(string(addr)); err != nil {
+		return err
+	}
+	c.remoteAdvertisedAddr = string(addr)
+
+	return nil
+}
+
+// RemoteAdvertisedAddr returns the address, either clearnet or torv3 onion,
+// at which the remote peer advertised it can be reached. This allows a peer
+// behind Tor, for which the address of the connection is meaningless, to be
+// reconnected to. An empty string is returned if the peer didn't advertise
+// an address.
+func (c *Conn) RemoteAdvertisedAddr() string {
+	return c.remoteAdvertisedAddr
+}
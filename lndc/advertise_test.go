@@ -0,0 +1,104 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// testOnionHost is a well formed torv3 onion service host.
+const testOnionHost = "aaaqeayeaudaocajbifqydiob4ibceqtcqkrmfyydenbwha5dyp3kead.onion"
+
+func TestValidateAdvertisedAddr(t *testing.T) {
+	tests := []struct {
+		addr  string
+		valid bool
+	}{
+		{"203.0.113.7:2448", true},
+		{"[2001:db8::1]:2448", true},
+		{testOnionHost + ":2448", true},
+		{"203.0.113.7", false},
+		{"203.0.113.7:0", false},
+		{"203.0.113.7:65536", false},
+		{"example.com:2448", false},
+		// A torv2 address is too short.
+		{"expyuzz4wqqyqhjn.onion:2448", false},
+		// One character too long.
+		{"a" + testOnionHost + ":2448", false},
+		// Not base32.
+		{"1" + testOnionHost[1:] + ":2448", false},
+		// A corrupted checksum.
+		{"b" + testOnionHost[1:] + ":2448", false},
+	}
+
+	for _, test := range tests {
+		err := validateAdvertisedAddr(test.addr)
+		if test.valid && err != nil {
+			t.Fatalf("expected %q to be valid, got %v", test.addr, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("expected %q to be invalid", test.addr)
+		}
+	}
+}
+
+func TestAdvertisedAddrExchange(t *testing.T) {
+	const clearnet = "203.0.113.7:2448"
+	onion := testOnionHost + ":9735"
+
+	listener, pkh := newTestListener(t, WithAdvertisedAddr(clearnet))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh,
+		WithAdvertisedAddr(onion))
+	defer local.Close()
+	defer remote.Close()
+
+	if local.RemoteAdvertisedAddr() != onion {
+		t.Fatalf("expected listener to learn %q, got %q", onion,
+			local.RemoteAdvertisedAddr())
+	}
+	if remote.RemoteAdvertisedAddr() != clearnet {
+		t.Fatalf("expected dialer to learn %q, got %q", clearnet,
+			remote.RemoteAdvertisedAddr())
+	}
+	roundTrip(t, local, remote)
+
+	// A dialer without an advertised address learns nothing, and neither
+	// does the listener.
+	local, remote = dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+	if local.RemoteAdvertisedAddr() != "" || remote.RemoteAdvertisedAddr() != "" {
+		t.Fatalf("expected no advertised addresses")
+	}
+}
+
+func TestMalformedAdvertisedAddr(t *testing.T) {
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	if _, err := NewListener(localPriv, 0,
+		WithAdvertisedAddr("notanonion.onion:9735")); err == nil {
+
+		t.Fatalf("expected a malformed advertised address to be refused")
+	}
+
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	// Bypass the dialer's own validation to send a malformed address,
+	// which the listener must refuse.
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	cfg := &Config{AdvertisedAddr: "s" + testOnionHost[1:] + ":9735"}
+	go upgrade(conn, localPriv, pkh, 0, cfg)
+
+	if _, err := listener.Accept(); err == nil {
+		t.Fatalf("expected handshake with a malformed address to fail")
+	}
+}
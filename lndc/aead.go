@@ -0,0 +1,78 @@
+package lndc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// CipherSuiteChaChaPoly is the ChaCha20-Poly1305 AEAD. This is the
+	// cipher suite used during the handshake itself, and for all
+	// messages unless another suite is negotiated. It is considerably
+	// faster than AES-GCM on hardware without AES acceleration.
+	CipherSuiteChaChaPoly = "chacha20poly1305"
+
+	// CipherSuiteAESGCM is AES-256 in Galois/Counter mode, which is the
+	// faster choice on hardware with AES acceleration.
+	CipherSuiteAESGCM = "aes256gcm"
+)
+
+// cipherSuites maps the name of each supported cipher suite to a function
+// which instantiates its AEAD given a 32-byte key. Each AEAD must accept
+// 12-byte nonces and produce macSize byte tags.
+var cipherSuites = map[string]func(key []byte) (cipher.AEAD, error){
+	CipherSuiteChaChaPoly: chacha20poly1305.New,
+	CipherSuiteAESGCM: func(key []byte) (cipher.AEAD, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return cipher.NewGCM(block)
+	},
+}
+
+// newAEAD instantiates the AEAD of the named cipher suite with the passed
+// key. An empty suite selects the default, CipherSuiteChaChaPoly.
+func newAEAD(suite string, key []byte) (cipher.AEAD, error) {
+	if suite == "" {
+		suite = CipherSuiteChaChaPoly
+	}
+
+	newCipher, ok := cipherSuites[suite]
+	if !ok {
+		return nil, fmt.Errorf("unknown cipher suite %q", suite)
+	}
+
+	return newCipher(key)
+}
+
+// switchSuite moves the cipherState over to the named cipher suite. So that
+// no key is ever used with more than one AEAD, the new key is derived from
+// the current one by an HKDF invocation with the suite's name as the info,
+// and the nonce starts afresh.
+func (c *cipherState) switchSuite(suite string) {
+	var nextKey [32]byte
+
+	oldKey := c.secretKey
+	h := hkdf.New(sha256.New, oldKey[:], c.salt[:], []byte(suite))
+	h.Read(nextKey[:])
+
+	c.suite = suite
+	c.InitializeKey(nextKey)
+}
+
+// CipherSuite returns the name of the cipher suite used to encrypt messages
+// sent over the connection.
+func (c *Conn) CipherSuite() string {
+	if c.noise.sendCipher.suite == "" {
+		return CipherSuiteChaChaPoly
+	}
+
+	return c.noise.sendCipher.suite
+}
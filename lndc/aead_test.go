@@ -0,0 +1,132 @@
+package lndc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// newTestListener creates a listener on a random port with the passed
+// options, returning it along with the lit address of its static key.
+func newTestListener(t testing.TB, options ...func(*Config)) (*Listener, string) {
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	listener, err := NewListener(localPriv, 0, options...)
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+
+	return listener, pkhOf(localPriv)
+}
+
+// roundTrip writes a message in each direction across the pair of
+// connections, asserting that it's received intact.
+func roundTrip(t testing.TB, a, b *Conn) {
+	for i, pair := range [][2]*Conn{{a, b}, {b, a}} {
+		msg := bytes.Repeat([]byte{byte(i + 1)}, 100)
+		if _, err := pair[0].Write(msg); err != nil {
+			t.Fatalf("unable to write message: %v", err)
+		}
+
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(pair[1], got); err != nil {
+			t.Fatalf("unable to read message: %v", err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("message mismatch: expected %x, got %x", msg, got)
+		}
+	}
+}
+
+func TestCipherSuites(t *testing.T) {
+	tests := []struct {
+		name     string
+		listener []string
+		dialer   []string
+		expected string
+	}{
+		{
+			name:     "default",
+			expected: CipherSuiteChaChaPoly,
+		},
+		{
+			name:     "chacha",
+			listener: []string{CipherSuiteChaChaPoly, CipherSuiteAESGCM},
+			dialer:   []string{CipherSuiteChaChaPoly},
+			expected: CipherSuiteChaChaPoly,
+		},
+		{
+			name:     "aes",
+			listener: []string{CipherSuiteChaChaPoly, CipherSuiteAESGCM},
+			dialer:   []string{CipherSuiteAESGCM, CipherSuiteChaChaPoly},
+			expected: CipherSuiteAESGCM,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listener, pkh := newTestListener(t,
+				WithCipherSuites(test.listener...))
+			defer listener.Close()
+
+			local, remote := dialAndAccept(t, listener, pkh,
+				WithCipherSuites(test.dialer...))
+			defer local.Close()
+			defer remote.Close()
+
+			for _, conn := range []*Conn{local, remote} {
+				if conn.CipherSuite() != test.expected {
+					t.Fatalf("expected cipher suite %v, got %v",
+						test.expected, conn.CipherSuite())
+				}
+			}
+
+			// Send enough messages to force a key rotation, so
+			// that the rotated keys are also exercised.
+			for i := 0; i < keyRotationInterval/2+1; i++ {
+				roundTrip(t, local, remote)
+			}
+		})
+	}
+}
+
+func TestCipherSuiteFallback(t *testing.T) {
+	// A listener without any configured cipher suites only supports the
+	// default, so a dialer preferring AES-GCM should fall back to it.
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh,
+		WithCipherSuites(CipherSuiteAESGCM))
+	defer local.Close()
+	defer remote.Close()
+
+	if local.noise.Version() != ExtendedHandshakeVersion {
+		t.Fatalf("expected handshake version %v, got %v",
+			ExtendedHandshakeVersion, local.noise.Version())
+	}
+	for _, conn := range []*Conn{local, remote} {
+		if conn.CipherSuite() != CipherSuiteChaChaPoly {
+			t.Fatalf("expected fallback to %v, got %v",
+				CipherSuiteChaChaPoly, conn.CipherSuite())
+		}
+	}
+	roundTrip(t, local, remote)
+}
+
+func TestUnknownCipherSuite(t *testing.T) {
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	_, err = NewListener(localPriv, 0, WithCipherSuites("rot13"))
+	if err == nil {
+		t.Fatalf("expected listener with unknown cipher suite to fail")
+	}
+}
@@ -0,0 +1,66 @@
+package lndc
+
+import (
+	"net"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// AuditRecord describes the outcome of a handshake carried out by a
+// listener.
+type AuditRecord struct {
+	// Time is when the handshake finished.
+	Time time.Time
+
+	// ListenerID and Seq identify the connection, matching its log
+	// lines.
+	ListenerID string
+	Seq        uint64
+
+	// RemotePub is the identity the remote peer authenticated as, which
+	// is the root of its certificate if it presented one. It's nil if
+	// the handshake failed before the peer sent its static key.
+	RemotePub *koblitz.PublicKey
+
+	// RemoteAddr is the address the connection was made from.
+	RemoteAddr net.Addr
+
+	// HandshakeDuration is the time taken by the handshake, and
+	// HandshakeCryptoTime the part of it spent computing the handshake
+	// rather than waiting on the network.
+	HandshakeDuration   time.Duration
+	HandshakeCryptoTime time.Duration
+
+	// Err is the reason the connection was rejected, or nil if it was
+	// accepted.
+	Err error
+}
+
+// AuditSink receives a record of every connection accepted or rejected by a
+// listener, keeping an audit trail apart from the general log. Connections
+// aborted as the listener is closed aren't recorded.
+type AuditSink interface {
+	// Audit is called from the handshake goroutine as each handshake
+	// finishes, so it should return promptly.
+	Audit(record AuditRecord)
+}
+
+// audit writes the outcome of the handshake which produced conn to the
+// configured AuditSink, if any.
+func (l *Listener) audit(conn *Conn, err error) {
+	if l.cfg.AuditSink == nil {
+		return
+	}
+
+	l.cfg.AuditSink.Audit(AuditRecord{
+		Time:                time.Now(),
+		ListenerID:          l.id,
+		Seq:                 conn.seq,
+		RemotePub:           conn.RemoteIdentity(),
+		RemoteAddr:          conn.RemoteAddr(),
+		HandshakeDuration:   conn.handshakeDuration,
+		HandshakeCryptoTime: conn.HandshakeCryptoTime(),
+		Err:                 err,
+	})
+}
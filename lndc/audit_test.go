@@ -0,0 +1,109 @@
+package lndc
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/mit-dci/lit/btcutil/chaincfg/chainhash"
+)
+
+// captureSink is an AuditSink which records every record written to it.
+type captureSink struct {
+	mtx     sync.Mutex
+	records []AuditRecord
+}
+
+func (s *captureSink) Audit(record AuditRecord) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.records = append(s.records, record)
+}
+
+// last returns the most recently written record.
+func (s *captureSink) last(t *testing.T) AuditRecord {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if len(s.records) == 0 {
+		t.Fatalf("no audit records written")
+	}
+	return s.records[len(s.records)-1]
+}
+
+func TestAuditSink(t *testing.T) {
+	mainnet := chainhash.DoubleHashH([]byte("mainnet"))
+	testnet := chainhash.DoubleHashH([]byte("testnet"))
+
+	sink := &captureSink{}
+	listener, pkh := newTestListener(t, WithAuditSink(sink),
+		WithChainHash(&mainnet))
+	defer listener.Close()
+
+	// An accepted connection is recorded along with its peer's identity.
+	key := newKey(t)
+	local, remote := dialAndAcceptWithKey(t, listener, pkh, key)
+	defer local.Close()
+	defer remote.Close()
+
+	record := sink.last(t)
+	if record.Err != nil {
+		t.Fatalf("expected an accepted record, got %v", record.Err)
+	}
+	if record.RemotePub == nil || !record.RemotePub.IsEqual(key.PubKey()) {
+		t.Fatalf("expected the dialer's key to be recorded")
+	}
+	if record.RemoteAddr.String() != remote.LocalAddr().String() {
+		t.Fatalf("expected remote addr %v, got %v",
+			remote.LocalAddr(), record.RemoteAddr)
+	}
+	if record.ListenerID != listener.ID() || record.Seq != local.Seq() {
+		t.Fatalf("record doesn't identify the conn")
+	}
+	if record.HandshakeDuration != local.HandshakeDuration() ||
+		record.Time.IsZero() {
+
+		t.Fatalf("record is missing its timing")
+	}
+
+	// As is one rejected after the peer authenticated.
+	key = newKey(t)
+	dialErr := make(chan error, 1)
+	go func() {
+		_, err := Dial(key, listener.Addr().String(), pkh, net.Dial,
+			WithChainHash(&testnet))
+		dialErr <- err
+	}()
+	if _, err := listener.Accept(); err != ErrChainMismatch {
+		t.Fatalf("expected %v, got %v", ErrChainMismatch, err)
+	}
+	<-dialErr
+
+	record = sink.last(t)
+	if record.Err != ErrChainMismatch {
+		t.Fatalf("expected a rejected record, got %v", record.Err)
+	}
+	if record.RemotePub == nil || !record.RemotePub.IsEqual(key.PubKey()) {
+		t.Fatalf("expected the dialer's key to be recorded")
+	}
+
+	// And one rejected before the peer sent its key.
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	if _, err := conn.Write([]byte{HandshakeVersion}); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	conn.Close()
+	if _, err := listener.Accept(); err != ErrShortActOne {
+		t.Fatalf("expected %v, got %v", ErrShortActOne, err)
+	}
+
+	record = sink.last(t)
+	if record.Err != ErrShortActOne || record.RemotePub != nil {
+		t.Fatalf("expected an unauthenticated rejected record, got "+
+			"%+v", record)
+	}
+}
@@ -0,0 +1,60 @@
+package lndc
+
+import (
+	"net"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// PeerInfo describes an authenticated remote peer, along with what it sent
+// through the extensions of the handshake, for an Authorizer to decide on.
+type PeerInfo struct {
+	// Pub is the identity the peer authenticated as, which is the root
+	// of its certificate if it presented one.
+	Pub *koblitz.PublicKey
+
+	// RemoteAddr is the address the connection was made from.
+	RemoteAddr net.Addr
+
+	// AdvertisedAddr is the address at which the peer advertised it can
+	// be reached, or empty if it didn't advertise one.
+	AdvertisedAddr string
+
+	// Header is the header the peer sent through its LocalHeader, or nil
+	// if it didn't send one.
+	Header []byte
+
+	// Certificate is the certificate the peer presented, or nil if it
+	// authenticated with its static key alone.
+	Certificate *Certificate
+
+	// ChannelProof is the channel proof the peer presented, or nil if
+	// it didn't present one.
+	ChannelProof *ChannelProof
+}
+
+// Authorizer is consulted by a listener once a peer has been authenticated
+// and the hello messages of the handshake exchanged, allowing peers to be
+// accepted or refused based on more than their identity and IP.
+type Authorizer interface {
+	// Authorize returns a non-nil error, which the handshake fails with,
+	// if the peer should be refused.
+	Authorize(peer PeerInfo) error
+}
+
+// authorize consults the configured Authorizer, if any, about the peer of an
+// inbound connection.
+func (c *Config) authorize(conn *Conn) error {
+	if c.Authorizer == nil {
+		return nil
+	}
+
+	return c.Authorizer.Authorize(PeerInfo{
+		Pub:            conn.RemoteIdentity(),
+		RemoteAddr:     conn.RemoteAddr(),
+		AdvertisedAddr: conn.RemoteAdvertisedAddr(),
+		Header:         conn.RemoteHeader(),
+		Certificate:    conn.RemoteCertificate(),
+		ChannelProof:   conn.RemoteChannelProof(),
+	})
+}
@@ -0,0 +1,61 @@
+package lndc
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// authorizerFunc adapts a function to an Authorizer.
+type authorizerFunc func(peer PeerInfo) error
+
+func (f authorizerFunc) Authorize(peer PeerInfo) error {
+	return f(peer)
+}
+
+func TestAuthorizerAdvertisedAddr(t *testing.T) {
+	errNoOnions := errors.New("onion peers not accepted")
+
+	var seen PeerInfo
+	listener, pkh := newTestListener(t, WithAuthorizer(authorizerFunc(
+		func(peer PeerInfo) error {
+			seen = peer
+			if strings.Contains(peer.AdvertisedAddr, ".onion") {
+				return errNoOnions
+			}
+			return nil
+		},
+	)))
+	defer listener.Close()
+
+	// A peer advertising a clearnet address is let through, with the
+	// authorizer shown its identity and address.
+	key := newKey(t)
+	local, remote := dialAndAcceptWithKey(t, listener, pkh, key,
+		WithAdvertisedAddr("203.0.113.7:2448"))
+	defer local.Close()
+	defer remote.Close()
+	if seen.AdvertisedAddr != "203.0.113.7:2448" ||
+		!seen.Pub.IsEqual(key.PubKey()) ||
+		seen.RemoteAddr.String() != remote.LocalAddr().String() {
+
+		t.Fatalf("authorizer shown %+v", seen)
+	}
+
+	// One advertising an onion address is refused.
+	key = newKey(t)
+	dialErr := make(chan error, 1)
+	go func() {
+		conn, err := Dial(key, listener.Addr().String(), pkh, net.Dial,
+			WithAdvertisedAddr(testOnionHost+":2448"))
+		if err == nil {
+			conn.Close()
+		}
+		dialErr <- err
+	}()
+	if _, err := listener.Accept(); err != errNoOnions {
+		t.Fatalf("expected %v, got %v", errNoOnions, err)
+	}
+	<-dialErr
+}
@@ -0,0 +1,71 @@
+package lndc
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// BanList is consulted by a listener to turn away banned peers. The store of
+// bans is left to the caller, and may be keyed by either public key or IP
+// address, with any expiry of bans handled by the implementation.
+type BanList interface {
+	// IsBanned reports whether the peer should be refused. It's first
+	// called with a nil pub as soon as a connection arrives, so that a
+	// banned IP is refused before any handshake work is carried out,
+	// and then again with the peer's identity once it has been
+	// authenticated. ip is nil if the connection's remote address isn't
+	// an IP address.
+	IsBanned(pub *koblitz.PublicKey, ip net.IP) bool
+}
+
+// ErrBanned is returned when a connection is refused as the BanList reports
+// the peer as banned.
+type ErrBanned struct {
+	// Pub is the identity of the banned peer, or nil if it was refused
+	// by IP before being authenticated.
+	Pub *koblitz.PublicKey
+
+	// IP is the address of the banned peer.
+	IP net.IP
+}
+
+// Error returns a description of the banned peer.
+func (e ErrBanned) Error() string {
+	if e.Pub != nil {
+		return fmt.Sprintf("lndc: peer %x at %v is banned",
+			e.Pub.SerializeCompressed(), e.IP)
+	}
+
+	return fmt.Sprintf("lndc: peer at %v is banned", e.IP)
+}
+
+// remoteIP returns the IP address of addr, or nil if it has none.
+func remoteIP(addr net.Addr) net.IP {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
+
+// checkBanned returns ErrBanned if the configured BanList reports the peer
+// as banned.
+func (c *Config) checkBanned(pub *koblitz.PublicKey, addr net.Addr) error {
+	if c.BanList == nil {
+		return nil
+	}
+
+	ip := remoteIP(addr)
+	if c.BanList.IsBanned(pub, ip) {
+		return ErrBanned{Pub: pub, IP: ip}
+	}
+
+	return nil
+}
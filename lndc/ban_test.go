@@ -0,0 +1,90 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// testBanList bans a fixed set of IPs and public keys.
+type testBanList struct {
+	ips  []net.IP
+	pubs []*koblitz.PublicKey
+}
+
+func (b *testBanList) IsBanned(pub *koblitz.PublicKey, ip net.IP) bool {
+	if pub == nil {
+		for _, banned := range b.ips {
+			if banned.Equal(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, banned := range b.pubs {
+		if banned.IsEqual(pub) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestBanByIP(t *testing.T) {
+	recorder := &transcriptRecorder{}
+	bans := &testBanList{ips: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}}
+	listener, pkh := newTestListener(t, WithBanList(bans),
+		WithTranscriptHook(recorder.hook))
+	defer listener.Close()
+
+	dialErr := make(chan error, 1)
+	go func() {
+		_, err := Dial(newKey(t), listener.Addr().String(), pkh,
+			net.Dial)
+		dialErr <- err
+	}()
+
+	_, err := listener.Accept()
+	banned, ok := err.(ErrBanned)
+	if !ok {
+		t.Fatalf("expected ErrBanned, got %T: %v", err, err)
+	}
+	if banned.Pub != nil || !banned.IP.IsLoopback() {
+		t.Fatalf("unexpected ban: %v", banned)
+	}
+	if err := <-dialErr; err == nil {
+		t.Fatalf("expected banned dial to fail")
+	}
+
+	// The IP was refused before even act one was read.
+	recorder.mtx.Lock()
+	defer recorder.mtx.Unlock()
+	if len(recorder.records) != 0 {
+		t.Fatalf("expected no handshake acts, got %d", len(recorder.records))
+	}
+}
+
+func TestBanByPubKey(t *testing.T) {
+	bannedKey := newKey(t)
+	bans := &testBanList{pubs: []*koblitz.PublicKey{bannedKey.PubKey()}}
+	listener, pkh := newTestListener(t, WithBanList(bans))
+	defer listener.Close()
+
+	// Other peers are unaffected.
+	local, remote := dialAndAccept(t, listener, pkh)
+	local.Close()
+	remote.Close()
+
+	go Dial(bannedKey, listener.Addr().String(), pkh, net.Dial)
+
+	_, err := listener.Accept()
+	banned, ok := err.(ErrBanned)
+	if !ok {
+		t.Fatalf("expected ErrBanned, got %T: %v", err, err)
+	}
+	if banned.Pub == nil || !banned.Pub.IsEqual(bannedKey.PubKey()) {
+		t.Fatalf("expected ban of the dialer's key, got %v", banned)
+	}
+}
@@ -0,0 +1,107 @@
+package lndc
+
+import (
+	"net"
+	"sync"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// BanSet is a BanList held in memory, to which bans by public key or IP can
+// be added and removed while the listener consulting it runs. Its bans are
+// saved and restored along with the rest of the listener's state by
+// Listener.SaveState and LoadState. A BanSet is safe for concurrent use.
+type BanSet struct {
+	mtx  sync.RWMutex
+	pubs map[[33]byte]*koblitz.PublicKey
+	ips  map[string]net.IP
+}
+
+// A compile-time assertion to ensure that BanSet meets the BanList interface.
+var _ BanList = (*BanSet)(nil)
+
+// NewBanSet returns an empty BanSet.
+func NewBanSet() *BanSet {
+	return &BanSet{
+		pubs: make(map[[33]byte]*koblitz.PublicKey),
+		ips:  make(map[string]net.IP),
+	}
+}
+
+// pubKey returns the key under which the bans of pub are held.
+func pubKey(pub *koblitz.PublicKey) [33]byte {
+	var key [33]byte
+	copy(key[:], pub.SerializeCompressed())
+
+	return key
+}
+
+// Ban bans the peer with the passed identity.
+func (s *BanSet) Ban(pub *koblitz.PublicKey) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.pubs[pubKey(pub)] = pub
+}
+
+// Unban lifts the ban of the peer with the passed identity, if any.
+func (s *BanSet) Unban(pub *koblitz.PublicKey) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.pubs, pubKey(pub))
+}
+
+// BanIP bans all peers connecting from ip.
+func (s *BanSet) BanIP(ip net.IP) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.ips[ip.String()] = ip
+}
+
+// UnbanIP lifts the ban of ip, if any.
+func (s *BanSet) UnbanIP(ip net.IP) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.ips, ip.String())
+}
+
+// IsBanned reports whether either the peer's identity or its IP is banned.
+//
+// Part of the BanList interface.
+func (s *BanSet) IsBanned(pub *koblitz.PublicKey, ip net.IP) bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if ip != nil {
+		if _, ok := s.ips[ip.String()]; ok {
+			return true
+		}
+	}
+	if pub != nil {
+		if _, ok := s.pubs[pubKey(pub)]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bans returns the banned identities and IPs.
+func (s *BanSet) Bans() ([]*koblitz.PublicKey, []net.IP) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	pubs := make([]*koblitz.PublicKey, 0, len(s.pubs))
+	for _, pub := range s.pubs {
+		pubs = append(pubs, pub)
+	}
+	ips := make([]net.IP, 0, len(s.ips))
+	for _, ip := range s.ips {
+		ips = append(ips, ip)
+	}
+
+	return pubs, ips
+}
@@ -0,0 +1,97 @@
+package lndc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Dial, without any connection being attempted,
+// when the handshakes with the remote peer have failed too many times in a
+// row and its CircuitBreaker's cooldown hasn't yet elapsed.
+var ErrCircuitOpen = errors.New("lndc: circuit open for peer after " +
+	"repeated handshake failures")
+
+// CircuitBreaker tracks the consecutive handshake failures with each remote
+// peer, keyed by the hash of its static public key. Once the failures with a
+// peer reach a threshold, the circuit opens and all further dials to the peer
+// fail fast with ErrCircuitOpen until a cooldown elapses. After the cooldown
+// a dial is let through: if its handshake succeeds the circuit closes again,
+// otherwise it reopens for another cooldown. A single CircuitBreaker can be
+// shared by any number of dials via the CircuitBreaker option.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mtx   sync.Mutex
+	peers map[string]*circuit
+}
+
+// circuit is the state of a CircuitBreaker for a single peer.
+type circuit struct {
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker returns a CircuitBreaker which opens the circuit for a
+// peer after threshold consecutive handshake failures, keeping it open for
+// cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		peers:     make(map[string]*circuit),
+	}
+}
+
+// allow returns ErrCircuitOpen if the circuit for the peer with the passed
+// public key hash is open.
+func (b *CircuitBreaker) allow(remotePKH string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	c, ok := b.peers[remotePKH]
+	if !ok || c.failures < b.threshold {
+		return nil
+	}
+	if time.Since(c.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+
+	return nil
+}
+
+// record registers the outcome of a handshake with the peer with the passed
+// public key hash.
+func (b *CircuitBreaker) record(remotePKH string, err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if err == nil {
+		delete(b.peers, remotePKH)
+		return
+	}
+
+	c, ok := b.peers[remotePKH]
+	if !ok {
+		c = &circuit{}
+		b.peers[remotePKH] = c
+	}
+	c.failures++
+	if c.failures >= b.threshold {
+		c.openedAt = time.Now()
+	}
+}
+
+// Failures returns the number of consecutive handshake failures with the peer
+// with the passed public key hash.
+func (b *CircuitBreaker) Failures(remotePKH string) int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if c, ok := b.peers[remotePKH]; ok {
+		return c.failures
+	}
+
+	return 0
+}
@@ -0,0 +1,86 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const (
+		threshold = 3
+		cooldown  = 100 * time.Millisecond
+	)
+
+	// A peer which hangs up straight away fails every handshake.
+	broken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer broken.Close()
+	go func() {
+		for {
+			conn, err := broken.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	breaker := NewCircuitBreaker(threshold, cooldown)
+	dial := func(addr string) error {
+		conn, err := Dial(localPriv, addr, pkh, net.Dial,
+			WithCircuitBreaker(breaker))
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < threshold; i++ {
+		err := dial(broken.Addr().String())
+		if err == nil || err == ErrCircuitOpen {
+			t.Fatalf("expected handshake %d to fail, got %v", i, err)
+		}
+	}
+	if breaker.Failures(pkh) != threshold {
+		t.Fatalf("expected %d failures, got %d", threshold,
+			breaker.Failures(pkh))
+	}
+
+	// Now that the circuit is open, even dialing the healthy listener
+	// fails fast.
+	if err := dial(listener.Addr().String()); err != ErrCircuitOpen {
+		t.Fatalf("expected %v, got %v", ErrCircuitOpen, err)
+	}
+
+	// Once the cooldown has elapsed a dial is let through, and its
+	// success closes the circuit.
+	time.Sleep(cooldown)
+	if err := dial(listener.Addr().String()); err != nil {
+		t.Fatalf("expected dial after cooldown to succeed: %v", err)
+	}
+	if breaker.Failures(pkh) != 0 {
+		t.Fatalf("expected failures to be reset, got %d",
+			breaker.Failures(pkh))
+	}
+}
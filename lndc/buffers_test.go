@@ -0,0 +1,66 @@
+package lndc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSmallBuffersGrow(t *testing.T) {
+	listener, pkh := newTestListener(t, WithSmallBuffers())
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh, WithSmallBuffers())
+	defer local.Close()
+	defer remote.Close()
+
+	if len(local.noise.nextCipherText) > 2*smallBufferSize ||
+		len(remote.noise.nextSendText) > 2*smallBufferSize {
+
+		t.Fatalf("expected small buffers after the handshake, got %d "+
+			"and %d bytes", len(local.noise.nextCipherText),
+			len(remote.noise.nextSendText))
+	}
+	roundTrip(t, local, remote)
+
+	// A message spanning several full size messages grows the buffers
+	// to fit.
+	msg := bytes.Repeat([]byte("grow"), 100000)
+	go remote.Write(msg)
+
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(local, got); err != nil {
+		t.Fatalf("unable to read message: %v", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("message mismatch after growing buffers")
+	}
+	if len(local.noise.nextCipherText) < local.noise.maxMessageLength() {
+		t.Fatalf("expected receive buffer to grow, got %d bytes",
+			len(local.noise.nextCipherText))
+	}
+}
+
+// benchmarkIdleConns reports the memory allocated to establish connections
+// which only exchange small messages.
+func benchmarkIdleConns(b *testing.B, options ...func(*Config)) {
+	listener, pkh := newTestListener(b, options...)
+	defer listener.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		local, remote := dialAndAccept(b, listener, pkh, options...)
+		roundTrip(b, local, remote)
+		local.Close()
+		remote.Close()
+	}
+}
+
+func BenchmarkIdleConnsFullBuffers(b *testing.B) {
+	benchmarkIdleConns(b, WithFlowWindow(1024))
+}
+
+func BenchmarkIdleConnsSmallBuffers(b *testing.B) {
+	benchmarkIdleConns(b, WithFlowWindow(1024), WithSmallBuffers())
+}
@@ -0,0 +1,224 @@
+package lndc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/lnutil"
+)
+
+var (
+	// ErrCertificateExpired is returned when the remote peer presents a
+	// certificate whose expiry has passed.
+	ErrCertificateExpired = errors.New("lndc: certificate expired")
+
+	// ErrInvalidCertificate is returned when the remote peer presents a
+	// certificate which can't be parsed, isn't signed by the root key it
+	// names, or doesn't authorize the key used for the handshake.
+	ErrInvalidCertificate = errors.New("lndc: invalid certificate")
+)
+
+// certDomain separates the digest signed for a certificate from any other
+// use of the root key.
+var certDomain = []byte("lndc session certificate")
+
+// Certificate delegates the authority of a node's long-term root key to a
+// short-lived session key, allowing an ephemeral worker holding only the
+// session key to complete handshakes on the node's behalf without exposing
+// the root key. The worker uses the session key as its static key and
+// presents the certificate via the Certificate option, after which the remote
+// peer treats it as the root identity.
+type Certificate struct {
+	// Root is the long-term static key delegating its authority.
+	Root *koblitz.PublicKey
+
+	// Key is the session key which is authorized to act as Root.
+	Key *koblitz.PublicKey
+
+	// Expiry is the time after which the certificate is no longer valid.
+	Expiry time.Time
+
+	// Signature is Root's signature over the certificate.
+	Signature *koblitz.Signature
+}
+
+// NewCertificate creates a certificate signed by root which authorizes key to
+// complete handshakes on its behalf until expiry.
+func NewCertificate(root *koblitz.PrivateKey, key *koblitz.PublicKey,
+	expiry time.Time) (*Certificate, error) {
+
+	cert := &Certificate{
+		Root:   root.PubKey(),
+		Key:    key,
+		Expiry: time.Unix(expiry.Unix(), 0),
+	}
+
+	sig, err := root.Sign(cert.digest())
+	if err != nil {
+		return nil, err
+	}
+	cert.Signature = sig
+
+	return cert, nil
+}
+
+// digest returns the hash signed by the certificate's root key.
+func (c *Certificate) digest() []byte {
+	var expiry [8]byte
+	binary.BigEndian.PutUint64(expiry[:], uint64(c.Expiry.Unix()))
+
+	h := sha256.New()
+	h.Write(certDomain)
+	h.Write(c.Root.SerializeCompressed())
+	h.Write(c.Key.SerializeCompressed())
+	h.Write(expiry[:])
+
+	return h.Sum(nil)
+}
+
+// Verify checks that the certificate is signed by its root key, authorizes
+// key and hasn't expired as of now.
+func (c *Certificate) Verify(key *koblitz.PublicKey, now time.Time) error {
+	if !c.Signature.Verify(c.digest(), c.Root) {
+		return fmt.Errorf("%v: bad signature", ErrInvalidCertificate)
+	}
+	if !c.Key.IsEqual(key) {
+		return fmt.Errorf("%v: certificate is for another key",
+			ErrInvalidCertificate)
+	}
+	if !now.Before(c.Expiry) {
+		return ErrCertificateExpired
+	}
+
+	return nil
+}
+
+// encode serializes the certificate as the root and session keys in
+// compressed form, the 8-byte big endian expiry as a unix timestamp, and
+// finally the DER encoded signature.
+func (c *Certificate) encode() []byte {
+	var buf bytes.Buffer
+	buf.Write(c.Root.SerializeCompressed())
+	buf.Write(c.Key.SerializeCompressed())
+
+	var expiry [8]byte
+	binary.BigEndian.PutUint64(expiry[:], uint64(c.Expiry.Unix()))
+	buf.Write(expiry[:])
+	buf.Write(c.Signature.Serialize())
+
+	return buf.Bytes()
+}
+
+// decodeCertificate parses a certificate serialized by encode.
+func decodeCertificate(b []byte) (*Certificate, error) {
+	if len(b) < 33+33+8 {
+		return nil, ErrInvalidCertificate
+	}
+
+	root, err := koblitz.ParsePubKey(b[:33], koblitz.S256())
+	if err != nil {
+		return nil, ErrInvalidCertificate
+	}
+	key, err := koblitz.ParsePubKey(b[33:66], koblitz.S256())
+	if err != nil {
+		return nil, ErrInvalidCertificate
+	}
+	expiry := int64(binary.BigEndian.Uint64(b[66:74]))
+	sig, err := koblitz.ParseDERSignature(b[74:], koblitz.S256())
+	if err != nil {
+		return nil, ErrInvalidCertificate
+	}
+
+	return &Certificate{
+		Root:      root,
+		Key:       key,
+		Expiry:    time.Unix(expiry, 0),
+		Signature: sig,
+	}, nil
+}
+
+// offerCertificate presents the initiator's certificate, if it has one.
+func offerCertificate(c *Conn, cfg *Config) []byte {
+	if cfg.Certificate == nil {
+		return nil
+	}
+
+	return cfg.Certificate.encode()
+}
+
+// answerCertificate verifies the initiator's certificate, if it presented
+// one, and presents the responder's own.
+func answerCertificate(c *Conn, cfg *Config, offer []byte) ([]byte, error) {
+	if err := c.verifyCertificate(offer); err != nil {
+		return nil, err
+	}
+
+	return offerCertificate(c, cfg), nil
+}
+
+// acceptCertificate verifies the responder's certificate, if it presented
+// one. If the responder's static key didn't match the expected identity, a
+// certificate chaining to that identity is required.
+func acceptCertificate(c *Conn, cfg *Config, answer []byte) error {
+	if err := c.verifyCertificate(answer); err != nil {
+		return err
+	}
+
+	if c.delegatedPKH == "" {
+		return nil
+	}
+	if c.remoteCert == nil {
+		return fmt.Errorf("Remote PKH doesn't match and no certificate " +
+			"was presented")
+	}
+
+	var root [33]byte
+	copy(root[:], c.remoteCert.Root.SerializeCompressed())
+	if lnutil.LitAdrFromPubkey(root) != c.delegatedPKH {
+		return fmt.Errorf("%v: certificate root doesn't match %s",
+			ErrInvalidCertificate, c.delegatedPKH)
+	}
+
+	return nil
+}
+
+// verifyCertificate checks that a certificate presented by the remote peer
+// authorizes the static key it used for the handshake, and records it.
+func (c *Conn) verifyCertificate(b []byte) error {
+	if b == nil {
+		return nil
+	}
+
+	cert, err := decodeCertificate(b)
+	if err != nil {
+		return err
+	}
+	if err := cert.Verify(c.noise.remoteStatic, time.Now()); err != nil {
+		return err
+	}
+	c.remoteCert = cert
+
+	return nil
+}
+
+// RemoteIdentity returns the long-term identity of the remote peer. This is
+// the root key of the certificate it presented if it's a delegated session
+// key, and otherwise its static key.
+func (c *Conn) RemoteIdentity() *koblitz.PublicKey {
+	if c.remoteCert != nil {
+		return c.remoteCert.Root
+	}
+
+	return c.RemotePub()
+}
+
+// RemoteCertificate returns the certificate presented by the remote peer, or
+// nil if it didn't present one.
+func (c *Conn) RemoteCertificate() *Certificate {
+	return c.remoteCert
+}
@@ -0,0 +1,141 @@
+package lndc
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// newKey generates a fresh private key.
+func newKey(t *testing.T) *koblitz.PrivateKey {
+	priv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	return priv
+}
+
+// delegatedListener creates a listener whose static key is a session key
+// delegated by cert.
+func delegatedListener(t *testing.T, worker *koblitz.PrivateKey,
+	cert *Certificate) *Listener {
+
+	listener, err := NewListener(worker, 0, WithCertificate(cert))
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+
+	return listener
+}
+
+func TestCertificateValid(t *testing.T) {
+	root, worker := newKey(t), newKey(t)
+	cert, err := NewCertificate(root, worker.PubKey(),
+		time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+
+	listener := delegatedListener(t, worker, cert)
+	defer listener.Close()
+
+	// Without accepting certificates, the mismatched static key is
+	// refused as before.
+	_, err = Dial(newKey(t), listener.Addr().String(), pkhOf(root),
+		net.Dial)
+	if err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Fatalf("expected PKH mismatch, got %v", err)
+	}
+	if _, err := listener.Accept(); err == nil {
+		t.Fatalf("expected the aborted handshake to be rejected")
+	}
+
+	// A dialer which is itself delegated is also verified by the
+	// listener.
+	dialerRoot, dialerWorker := newKey(t), newKey(t)
+	dialerCert, err := NewCertificate(dialerRoot, dialerWorker.PubKey(),
+		time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+
+	local, remote := dialAndAcceptWithKey(t, listener, pkhOf(root),
+		dialerWorker, WithAcceptCertificates(),
+		WithCertificate(dialerCert))
+	defer local.Close()
+	defer remote.Close()
+
+	if !remote.RemoteIdentity().IsEqual(root.PubKey()) {
+		t.Fatalf("dialer didn't learn the listener's root identity")
+	}
+	if !remote.RemotePub().IsEqual(worker.PubKey()) {
+		t.Fatalf("expected the session key as the static key")
+	}
+	if !local.RemoteIdentity().IsEqual(dialerRoot.PubKey()) {
+		t.Fatalf("listener didn't learn the dialer's root identity")
+	}
+	roundTrip(t, local, remote)
+}
+
+func TestCertificateExpired(t *testing.T) {
+	root, worker := newKey(t), newKey(t)
+	cert, err := NewCertificate(root, worker.PubKey(),
+		time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+
+	listener := delegatedListener(t, worker, cert)
+	defer listener.Close()
+
+	_, err = Dial(newKey(t), listener.Addr().String(), pkhOf(root),
+		net.Dial, WithAcceptCertificates())
+	if err != ErrCertificateExpired {
+		t.Fatalf("expected %v, got %v", ErrCertificateExpired, err)
+	}
+}
+
+func TestCertificateWrongSigner(t *testing.T) {
+	root, worker, impostor := newKey(t), newKey(t), newKey(t)
+
+	// A certificate naming root, but signed by another key.
+	cert, err := NewCertificate(impostor, worker.PubKey(),
+		time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	cert.Root = root.PubKey()
+
+	listener := delegatedListener(t, worker, cert)
+	defer listener.Close()
+
+	_, err = Dial(newKey(t), listener.Addr().String(), pkhOf(root),
+		net.Dial, WithAcceptCertificates())
+	if err == nil || !strings.Contains(err.Error(),
+		ErrInvalidCertificate.Error()) {
+
+		t.Fatalf("expected an invalid certificate, got %v", err)
+	}
+
+	// A validly signed certificate from a different root doesn't prove
+	// the expected identity either.
+	cert, err = NewCertificate(impostor, worker.PubKey(),
+		time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	listener = delegatedListener(t, worker, cert)
+	defer listener.Close()
+
+	_, err = Dial(newKey(t), listener.Addr().String(), pkhOf(root),
+		net.Dial, WithAcceptCertificates())
+	if err == nil || !strings.Contains(err.Error(),
+		ErrInvalidCertificate.Error()) {
+
+		t.Fatalf("expected an invalid certificate, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package lndc
+
+import (
+	"errors"
+
+	"github.com/mit-dci/lit/btcutil/chaincfg/chainhash"
+)
+
+// ErrChainMismatch is returned when the remote peer is running on a chain
+// other than the one set by ChainHash.
+var ErrChainMismatch = errors.New("lndc: peer is on a different chain")
+
+// offerChainHash offers the initiator's chain hash, if it has one.
+func offerChainHash(c *Conn, cfg *Config) []byte {
+	if cfg.ChainHash == nil {
+		return nil
+	}
+
+	return cfg.ChainHash[:]
+}
+
+// answerChainHash records the initiator's chain hash, if any, and answers
+// with the responder's own. Any mismatch is only acted upon by
+// verifyChainHash, once the answer has been sent.
+func answerChainHash(c *Conn, cfg *Config, offer []byte) ([]byte, error) {
+	if err := acceptChainHash(c, cfg, offer); err != nil {
+		return nil, err
+	}
+
+	return offerChainHash(c, cfg), nil
+}
+
+// acceptChainHash records the remote peer's chain hash, if it sent one.
+func acceptChainHash(c *Conn, cfg *Config, hash []byte) error {
+	if hash == nil {
+		return nil
+	}
+	if len(hash) != chainhash.HashSize {
+		return ErrMalformedHello
+	}
+
+	c.remoteChainHash = new(chainhash.Hash)
+	copy(c.remoteChainHash[:], hash)
+
+	return nil
+}
+
+// verifyChainHash ensures both sides are running on the same chain. Peers
+// that don't send a chain hash are assumed to be compatible.
+func verifyChainHash(c *Conn, cfg *Config) error {
+	if cfg.ChainHash == nil || c.remoteChainHash == nil {
+		return nil
+	}
+	if !cfg.ChainHash.IsEqual(c.remoteChainHash) {
+		cfg.log().Warnf("lndc peer %v is on chain %v, expected %v",
+			c.RemoteAddr(), c.remoteChainHash, cfg.ChainHash)
+		return ErrChainMismatch
+	}
+
+	return nil
+}
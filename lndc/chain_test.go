@@ -0,0 +1,55 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mit-dci/lit/btcutil/chaincfg/chainhash"
+)
+
+func TestChainHashMatch(t *testing.T) {
+	chain := chainhash.DoubleHashH([]byte("mainnet"))
+
+	listener, pkh := newTestListener(t, WithChainHash(&chain))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh, WithChainHash(&chain))
+	defer local.Close()
+	defer remote.Close()
+	roundTrip(t, local, remote)
+
+	// A peer which doesn't send a chain hash is let through.
+	local, remote = dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+	roundTrip(t, local, remote)
+}
+
+func TestChainHashMismatch(t *testing.T) {
+	mainnet := chainhash.DoubleHashH([]byte("mainnet"))
+	testnet := chainhash.DoubleHashH([]byte("testnet"))
+
+	listener, pkh := newTestListener(t, WithChainHash(&mainnet))
+	defer listener.Close()
+
+	dialErr := make(chan error, 1)
+	key := newKey(t)
+	go func() {
+		conn, err := Dial(key, listener.Addr().String(), pkh,
+			net.Dial, WithChainHash(&testnet))
+		if err == nil {
+			conn.Close()
+		}
+		dialErr <- err
+	}()
+
+	// Both sides reject the other.
+	if _, err := listener.Accept(); err != ErrChainMismatch {
+		t.Fatalf("expected listener to fail with %v, got %v",
+			ErrChainMismatch, err)
+	}
+	if err := <-dialErr; err != ErrChainMismatch {
+		t.Fatalf("expected dialer to fail with %v, got %v",
+			ErrChainMismatch, err)
+	}
+}
@@ -0,0 +1,207 @@
+package lndc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mit-dci/lit/btcutil/chaincfg/chainhash"
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/wire"
+)
+
+var (
+	// ErrChannelProofRequired is returned when a listener requiring
+	// proof of channel funds is dialed by a peer which presents none.
+	ErrChannelProofRequired = errors.New("lndc: channel proof required")
+
+	// ErrInvalidChannelProof is returned when the remote peer presents a
+	// channel proof which can't be parsed, isn't signed by the identity
+	// it names, or names an identity other than the peer's own.
+	ErrInvalidChannelProof = errors.New("lndc: invalid channel proof")
+)
+
+// channelProofDomain separates the digest signed for a channel proof from any
+// other use of the identity key.
+var channelProofDomain = []byte("lndc channel proof")
+
+// ChannelProof is a statement, signed by a node's identity key, that the node
+// has funds committed to the channel funded by an on-chain outpoint. Requiring
+// dialers to present one, via RequireChannelProof, raises the cost of
+// spinning up throwaway identities. The signature only proves that the claim
+// is the node's own: whether the outpoint truly funds a channel with the node
+// is left to the verification callback, which has access to the chain.
+type ChannelProof struct {
+	// Pub is the identity of the node making the claim.
+	Pub *koblitz.PublicKey
+
+	// Outpoint is the funding outpoint of the channel.
+	Outpoint wire.OutPoint
+
+	// Capacity is the capacity of the channel in satoshis.
+	Capacity int64
+
+	// Signature is Pub's signature over the proof.
+	Signature *koblitz.Signature
+}
+
+// NewChannelProof creates a proof signed by identity claiming the channel
+// funded by outpoint with the passed capacity.
+func NewChannelProof(identity *koblitz.PrivateKey, outpoint wire.OutPoint,
+	capacity int64) (*ChannelProof, error) {
+
+	proof := &ChannelProof{
+		Pub:      identity.PubKey(),
+		Outpoint: outpoint,
+		Capacity: capacity,
+	}
+	sig, err := identity.Sign(proof.digest())
+	if err != nil {
+		return nil, err
+	}
+	proof.Signature = sig
+
+	return proof, nil
+}
+
+// digest returns the hash signed by the proof's identity key.
+func (p *ChannelProof) digest() []byte {
+	h := sha256.New()
+	h.Write(channelProofDomain)
+	h.Write(p.encodeClaim())
+
+	return h.Sum(nil)
+}
+
+// encodeClaim serializes everything within the proof but its signature: the
+// identity in compressed form, the outpoint's hash and 4-byte big endian
+// index and then the 8-byte big endian capacity.
+func (p *ChannelProof) encodeClaim() []byte {
+	var buf bytes.Buffer
+	buf.Write(p.Pub.SerializeCompressed())
+	buf.Write(p.Outpoint.Hash[:])
+
+	var index [4]byte
+	binary.BigEndian.PutUint32(index[:], p.Outpoint.Index)
+	buf.Write(index[:])
+
+	var capacity [8]byte
+	binary.BigEndian.PutUint64(capacity[:], uint64(p.Capacity))
+	buf.Write(capacity[:])
+
+	return buf.Bytes()
+}
+
+// Verify checks that the proof is signed by the identity it names.
+func (p *ChannelProof) Verify() error {
+	if !p.Signature.Verify(p.digest(), p.Pub) {
+		return fmt.Errorf("%v: bad signature", ErrInvalidChannelProof)
+	}
+
+	return nil
+}
+
+// encode serializes the proof's claim, followed by its DER encoded
+// signature.
+func (p *ChannelProof) encode() []byte {
+	return append(p.encodeClaim(), p.Signature.Serialize()...)
+}
+
+// channelClaimSize is the size of a proof's encoded claim.
+const channelClaimSize = 33 + chainhash.HashSize + 4 + 8
+
+// decodeChannelProof parses a proof serialized by encode.
+func decodeChannelProof(b []byte) (*ChannelProof, error) {
+	if len(b) < channelClaimSize {
+		return nil, ErrInvalidChannelProof
+	}
+
+	pub, err := koblitz.ParsePubKey(b[:33], koblitz.S256())
+	if err != nil {
+		return nil, ErrInvalidChannelProof
+	}
+	var outpoint wire.OutPoint
+	copy(outpoint.Hash[:], b[33:33+chainhash.HashSize])
+	b = b[33+chainhash.HashSize:]
+	outpoint.Index = binary.BigEndian.Uint32(b[:4])
+	capacity := int64(binary.BigEndian.Uint64(b[4:12]))
+	sig, err := koblitz.ParseDERSignature(b[12:], koblitz.S256())
+	if err != nil {
+		return nil, ErrInvalidChannelProof
+	}
+
+	return &ChannelProof{
+		Pub:       pub,
+		Outpoint:  outpoint,
+		Capacity:  capacity,
+		Signature: sig,
+	}, nil
+}
+
+// offerChannelProof presents the initiator's channel proof, if it has one.
+func offerChannelProof(c *Conn, cfg *Config) []byte {
+	if cfg.ChannelProof == nil {
+		return nil
+	}
+
+	return cfg.ChannelProof.encode()
+}
+
+// answerChannelProof records the initiator's channel proof, if it presented
+// one. Whether it's required and acceptable is only decided by
+// checkChannelProof, once the peer's identity is settled. The responder
+// never presents a proof of its own.
+func answerChannelProof(c *Conn, cfg *Config, offer []byte) ([]byte, error) {
+	if offer == nil {
+		return nil, nil
+	}
+
+	proof, err := decodeChannelProof(offer)
+	if err != nil {
+		return nil, err
+	}
+	c.remoteChannelProof = proof
+
+	return nil, nil
+}
+
+// acceptChannelProof ensures the responder didn't present a channel proof,
+// which it has no business doing.
+func acceptChannelProof(c *Conn, cfg *Config, answer []byte) error {
+	if answer != nil {
+		return ErrMalformedHello
+	}
+
+	return nil
+}
+
+// checkChannelProof ensures that the peer of an inbound connection presented
+// a valid channel proof for its own identity if one is required, consulting
+// the configured verification callback about the channel it claims.
+func (c *Config) checkChannelProof(conn *Conn) error {
+	if c.ChannelProofVerifier == nil {
+		return nil
+	}
+
+	proof := conn.remoteChannelProof
+	if proof == nil {
+		return ErrChannelProofRequired
+	}
+	if err := proof.Verify(); err != nil {
+		return err
+	}
+	if !proof.Pub.IsEqual(conn.RemoteIdentity()) {
+		return fmt.Errorf("%v: proof is for another identity",
+			ErrInvalidChannelProof)
+	}
+
+	return c.ChannelProofVerifier(proof)
+}
+
+// RemoteChannelProof returns the channel proof presented by the remote peer,
+// or nil if it didn't present one.
+func (c *Conn) RemoteChannelProof() *ChannelProof {
+	return c.remoteChannelProof
+}
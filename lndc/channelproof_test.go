@@ -0,0 +1,133 @@
+package lndc
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/wire"
+)
+
+// errUnknownChannel is returned by the test verifier for channels it doesn't
+// know of.
+var errUnknownChannel = errors.New("unknown channel")
+
+// proofListener creates a listener requiring a channel proof for the funding
+// outpoint known to it.
+func proofListener(t *testing.T, known wire.OutPoint) (*Listener, string) {
+	return newTestListener(t, WithRequireChannelProof(
+		func(proof *ChannelProof) error {
+			if proof.Outpoint != known {
+				return errUnknownChannel
+			}
+			return nil
+		},
+	))
+}
+
+// acceptProof dials the listener with key, presenting proof if non-nil, and
+// returns the error the listener fails the handshake with, if any.
+func acceptProof(t *testing.T, listener *Listener, pkh string,
+	key *koblitz.PrivateKey, proof *ChannelProof) error {
+
+	options := make([]func(*Config), 0, 1)
+	if proof != nil {
+		options = append(options, WithChannelProof(proof))
+	}
+
+	dialed := make(chan *Conn, 1)
+	go func() {
+		conn, _ := Dial(key, listener.Addr().String(), pkh, net.Dial,
+			options...)
+		dialed <- conn
+	}()
+
+	conn, err := listener.Accept()
+	if err == nil {
+		conn.Close()
+	}
+	if remote := <-dialed; remote != nil {
+		remote.Close()
+	}
+
+	return err
+}
+
+func TestChannelProofValid(t *testing.T) {
+	outpoint := wire.OutPoint{Index: 1}
+	outpoint.Hash[0] = 0xaa
+	listener, pkh := proofListener(t, outpoint)
+	defer listener.Close()
+
+	key := newKey(t)
+	proof, err := NewChannelProof(key, outpoint, 100000)
+	if err != nil {
+		t.Fatalf("unable to create channel proof: %v", err)
+	}
+
+	local, remote := dialAndAcceptWithKey(t, listener, pkh, key,
+		WithChannelProof(proof))
+	defer local.Close()
+	defer remote.Close()
+
+	got := local.RemoteChannelProof()
+	if got == nil || got.Outpoint != outpoint || got.Capacity != 100000 ||
+		!got.Pub.IsEqual(key.PubKey()) {
+
+		t.Fatalf("unexpected channel proof: %+v", got)
+	}
+	roundTrip(t, local, remote)
+}
+
+func TestChannelProofRejected(t *testing.T) {
+	outpoint := wire.OutPoint{Index: 1}
+	outpoint.Hash[0] = 0xaa
+	listener, pkh := proofListener(t, outpoint)
+	defer listener.Close()
+
+	key, other := newKey(t), newKey(t)
+	forged, err := NewChannelProof(key, outpoint, 100000)
+	if err != nil {
+		t.Fatalf("unable to create channel proof: %v", err)
+	}
+	forged.Capacity = 1000000
+	borrowed, err := NewChannelProof(other, outpoint, 100000)
+	if err != nil {
+		t.Fatalf("unable to create channel proof: %v", err)
+	}
+	unknown, err := NewChannelProof(key, wire.OutPoint{}, 100000)
+	if err != nil {
+		t.Fatalf("unable to create channel proof: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		proof    *ChannelProof
+		expected error
+	}{
+		{"missing", nil, ErrChannelProofRequired},
+		{"bad signature", forged, ErrInvalidChannelProof},
+		{"another identity", borrowed, ErrInvalidChannelProof},
+		{"unknown channel", unknown, errUnknownChannel},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			err := acceptProof(t, listener, pkh, key, test.proof)
+			if err == nil ||
+				!strings.Contains(err.Error(), test.expected.Error()) {
+
+				t.Fatalf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+
+	// Listeners which don't require a proof don't mind its absence.
+	plain, plainPKH := newTestListener(t)
+	defer plain.Close()
+	if err := acceptProof(t, plain, plainPKH, key, nil); err != nil {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+}
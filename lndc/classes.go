@@ -0,0 +1,143 @@
+package lndc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// ErrClassFull is returned when an authenticated connection is refused
+// because the listener already holds the MaxConns established connections
+// allowed to the peer's class.
+var ErrClassFull = errors.New("lndc listener has reached its maximum " +
+	"number of connections for the peer's class")
+
+// ErrClassRateLimited is returned when an authenticated connection is
+// refused because its peer's class has used up its allowance of new
+// connections.
+var ErrClassRateLimited = errors.New("lndc listener is accepting " +
+	"connections for the peer's class too quickly")
+
+// ClassLimits are the limits a listener applies to all of the peers of a
+// class, as assigned by Classify, together.
+type ClassLimits struct {
+	// MaxConns caps the number of established connections the listener
+	// will hold at once with peers of the class. Zero means there is no
+	// limit.
+	MaxConns int
+
+	// Rate, if non-zero, caps the number of new connections per second
+	// the listener will admit from peers of the class, averaged over
+	// time. Up to Burst connections, or one if Burst is zero, may be
+	// admitted at once after a quiet period.
+	Rate  float64
+	Burst int
+}
+
+// classBucket is the token bucket enforcing the Rate of a class, holding the
+// number of connections which may still be admitted.
+type classBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill tops up the bucket for the time elapsed until now, up to the
+// class's burst, returning whether a connection may be admitted.
+func (b *classBucket) refill(limits ClassLimits, now time.Time) bool {
+	burst := float64(limits.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * limits.Rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+
+	return b.tokens >= 1
+}
+
+// WithClassify is a functional option that sets the function a listener uses to
+// assign each authenticated peer to a class, along with the limits applied
+// to the peers of each class. Peers of a class without limits are only
+// bound by the listener's other caps.
+func WithClassify(classify func(pub *koblitz.PublicKey) string,
+	limits map[string]ClassLimits) func(*Config) {
+
+	return func(c *Config) {
+		c.Classify = classify
+		c.ClassLimits = limits
+	}
+}
+
+// checkClass returns ErrClassFull or ErrClassRateLimited should the limits of
+// the class assigned to conn not allow another connection. The limits are
+// only checked; the connection is counted against them by countClass once
+// it's admitted.
+//
+// NOTE: This method must be called with connMtx held.
+func (l *Listener) checkClass(conn *Conn, now time.Time) error {
+	if l.cfg.Classify == nil {
+		return nil
+	}
+
+	limits, ok := l.cfg.ClassLimits[conn.class]
+	if !ok {
+		return nil
+	}
+
+	if limits.MaxConns > 0 && l.perClass[conn.class] >= limits.MaxConns {
+		return ErrClassFull
+	}
+	if limits.Rate > 0 {
+		bucket := l.classBuckets[conn.class]
+		if bucket == nil {
+			bucket = &classBucket{}
+			l.classBuckets[conn.class] = bucket
+		}
+		if !bucket.refill(limits, now) {
+			return ErrClassRateLimited
+		}
+	}
+
+	return nil
+}
+
+// countClass counts the admitted conn against the limits of its class.
+//
+// NOTE: This method must be called with connMtx held.
+func (l *Listener) countClass(conn *Conn) {
+	if l.cfg.Classify == nil {
+		return
+	}
+
+	l.perClass[conn.class]++
+	if bucket := l.classBuckets[conn.class]; bucket != nil {
+		bucket.tokens--
+	}
+}
+
+// uncountClass releases the count of conn against its class's MaxConns.
+//
+// NOTE: This method must be called with connMtx held.
+func (l *Listener) uncountClass(conn *Conn) {
+	if l.cfg.Classify == nil {
+		return
+	}
+
+	if l.perClass[conn.class]--; l.perClass[conn.class] == 0 {
+		delete(l.perClass, conn.class)
+	}
+}
+
+// Class returns the class assigned to the remote peer by the accepting
+// listener's Classify function, or an empty string if there is none.
+func (c *Conn) Class() string {
+	return c.class
+}
@@ -0,0 +1,141 @@
+package lndc
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// dialRefused dials the listener with key, returning the error its Accept
+// refuses the connection with.
+func dialRefused(t *testing.T, listener *Listener, pkh string,
+	key *koblitz.PrivateKey) error {
+
+	dialed := make(chan struct{})
+	go func() {
+		defer close(dialed)
+		conn, err := Dial(key, listener.Addr().String(), pkh, net.Dial)
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	defer func() { <-dialed }()
+
+	conn, err := listener.Accept()
+	if err == nil {
+		conn.Close()
+		t.Fatalf("expected the connection to be refused")
+	}
+
+	return err
+}
+
+func TestListenerClassLimits(t *testing.T) {
+	var mtx sync.Mutex
+	premium := make(map[[33]byte]bool)
+	classify := func(pub *koblitz.PublicKey) string {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if premium[pubKey(pub)] {
+			return "premium"
+		}
+		return "free"
+	}
+	listener, pkh := newTestListener(t, WithClassify(classify,
+		map[string]ClassLimits{
+			"premium": {MaxConns: 3},
+			"free":    {MaxConns: 1},
+		}))
+	defer listener.Close()
+
+	premiumKeys := make([]*koblitz.PrivateKey, 4)
+	for i := range premiumKeys {
+		premiumKeys[i] = newKey(t)
+		premium[pubKey(premiumKeys[i].PubKey())] = true
+	}
+
+	// The free class's single slot is shared by all free peers.
+	freeLocal, freeRemote := dialAndAccept(t, listener, pkh)
+	defer freeRemote.Close()
+	if freeLocal.Class() != "free" {
+		t.Fatalf("expected class free, got %q", freeLocal.Class())
+	}
+	if err := dialRefused(t, listener, pkh, newKey(t)); err != ErrClassFull {
+		t.Fatalf("expected %v, got %v", ErrClassFull, err)
+	}
+
+	// While the premium class fills up independently.
+	for _, key := range premiumKeys[:3] {
+		local, remote := dialAndAcceptWithKey(t, listener, pkh, key)
+		defer local.Close()
+		defer remote.Close()
+		if local.Class() != "premium" {
+			t.Fatalf("expected class premium, got %q", local.Class())
+		}
+	}
+	err := dialRefused(t, listener, pkh, premiumKeys[3])
+	if err != ErrClassFull {
+		t.Fatalf("expected %v, got %v", ErrClassFull, err)
+	}
+
+	// Once the free peer leaves, another may take its place.
+	freeLocal.Close()
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+}
+
+func TestListenerClassRate(t *testing.T) {
+	classify := func(*koblitz.PublicKey) string { return "free" }
+	listener, pkh := newTestListener(t, WithClassify(classify,
+		map[string]ClassLimits{
+			"free": {Rate: 0.001, Burst: 2},
+		}))
+	defer listener.Close()
+
+	for i := 0; i < 2; i++ {
+		local, remote := dialAndAccept(t, listener, pkh)
+		defer local.Close()
+		defer remote.Close()
+	}
+	err := dialRefused(t, listener, pkh, newKey(t))
+	if err != ErrClassRateLimited {
+		t.Fatalf("expected %v, got %v", ErrClassRateLimited, err)
+	}
+}
+
+func TestClassBucket(t *testing.T) {
+	limits := ClassLimits{Rate: 2, Burst: 3}
+	start := time.Now()
+
+	var bucket classBucket
+	for i := 0; i < 3; i++ {
+		if !bucket.refill(limits, start) {
+			t.Fatalf("connection %d of the burst refused", i)
+		}
+		bucket.tokens--
+	}
+	if bucket.refill(limits, start) {
+		t.Fatalf("connection beyond the burst admitted")
+	}
+
+	// Half a second later, a single connection is allowed at a rate of
+	// two a second.
+	if !bucket.refill(limits, start.Add(500*time.Millisecond)) {
+		t.Fatalf("bucket didn't refill")
+	}
+	bucket.tokens--
+	if bucket.refill(limits, start.Add(500*time.Millisecond)) {
+		t.Fatalf("bucket refilled too quickly")
+	}
+
+	// But no more than the burst accumulates.
+	bucket.refill(limits, start.Add(time.Hour))
+	if bucket.tokens != 3 {
+		t.Fatalf("expected the bucket capped at 3, got %v", bucket.tokens)
+	}
+}
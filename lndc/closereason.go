@@ -0,0 +1,141 @@
+package lndc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	// ErrLocalClose is the CloseReason of a connection closed locally
+	// without any read or write having failed first.
+	ErrLocalClose = errors.New("lndc: connection closed locally")
+
+	// ErrPeerClose is the CloseReason of a connection which the remote
+	// peer closed, reset or announced it was going away from.
+	ErrPeerClose = errors.New("lndc: connection closed by peer")
+
+	// ErrReadTimeout is the CloseReason of a connection closed once a
+	// read from it timed out.
+	ErrReadTimeout = errors.New("lndc: connection read timed out")
+
+	// ErrWriteTimeout is the CloseReason of a connection closed once a
+	// write to it timed out.
+	ErrWriteTimeout = errors.New("lndc: connection write timed out")
+
+	// ErrProtocol is the CloseReason of a connection over which the
+	// remote peer sent a message which couldn't be authenticated or
+	// violated the protocol.
+	ErrProtocol = errors.New("lndc: protocol error on connection")
+
+	// ErrNetworkFailure is the CloseReason of a connection whose
+	// underlying connection failed for any other reason.
+	ErrNetworkFailure = errors.New("lndc: connection failed")
+)
+
+// CloseReason returns why the connection was closed, or failed such that it
+// can no longer be used, as one of ErrLocalClose, ErrPeerClose,
+// ErrReadTimeout, ErrWriteTimeout, ErrProtocol or ErrNetworkFailure. The
+// first failure of a read or write is the reason, even if the connection was
+// closed locally after it. A timeout only counts if the connection is closed
+// before any later read or write succeeds, as the connection is still usable
+// after one. nil is returned while the connection is open and hasn't failed.
+func (c *Conn) CloseReason() error {
+	c.closeMtx.Lock()
+	defer c.closeMtx.Unlock()
+
+	return c.closeReason
+}
+
+// closeReasonFor classifies err, returned by a read if write is false and
+// otherwise a write, as a CloseReason, or returns nil if the connection can
+// still be used after it.
+func closeReasonFor(err error, write bool) error {
+	switch err.(type) {
+	case ErrPeerGoingAway, ErrMaintenance, ErrRedirect:
+		return ErrPeerClose
+	case ErrDraining:
+		return nil
+	}
+
+	switch {
+	case err == ErrAADMismatch || err == ErrWriteClosed ||
+		err == ErrWouldBlock || err == errConnClosed:
+
+		return nil
+
+	case err == io.EOF || err == io.ErrUnexpectedEOF,
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, syscall.ECONNABORTED):
+
+		return ErrPeerClose
+	}
+
+	if netErr, ok := err.(net.Error); ok {
+		if !netErr.Timeout() {
+			return ErrNetworkFailure
+		}
+		if write {
+			return ErrWriteTimeout
+		}
+		return ErrReadTimeout
+	}
+
+	return ErrProtocol
+}
+
+// recordFailure records err, returned by a read if write is false and
+// otherwise a write, as the reason the connection can no longer be used,
+// unless a reason has already been recorded. A timeout is only held pending
+// until the next read or write succeeds.
+func (c *Conn) recordFailure(err error, write bool) {
+	reason := closeReasonFor(err, write)
+	if reason == nil {
+		return
+	}
+
+	c.closeMtx.Lock()
+	defer c.closeMtx.Unlock()
+
+	if c.closeReason != nil {
+		return
+	}
+	if reason == ErrReadTimeout || reason == ErrWriteTimeout {
+		c.pendingTimeout = reason
+		atomic.StoreInt32(&c.timedOut, 1)
+		return
+	}
+	c.closeReason = reason
+}
+
+// clearTimeout forgets any pending timeout, as a read or write has since
+// succeeded.
+func (c *Conn) clearTimeout() {
+	if atomic.LoadInt32(&c.timedOut) == 0 {
+		return
+	}
+
+	c.closeMtx.Lock()
+	c.pendingTimeout = nil
+	atomic.StoreInt32(&c.timedOut, 0)
+	c.closeMtx.Unlock()
+}
+
+// recordClose records the reason for the connection being closed locally,
+// which is any pending timeout and otherwise ErrLocalClose, unless a failure
+// has already been recorded.
+func (c *Conn) recordClose() {
+	c.closeMtx.Lock()
+	defer c.closeMtx.Unlock()
+
+	if c.closeReason != nil {
+		return
+	}
+	c.closeReason = c.pendingTimeout
+	if c.closeReason == nil {
+		c.closeReason = ErrLocalClose
+	}
+}
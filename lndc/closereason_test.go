@@ -0,0 +1,143 @@
+package lndc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCloseReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []func(*Config)
+		trigger  func(t *testing.T, local, remote *Conn)
+		expected error
+	}{
+		{
+			name:     "local close",
+			trigger:  func(t *testing.T, local, remote *Conn) {},
+			expected: ErrLocalClose,
+		},
+		{
+			name: "peer close",
+			trigger: func(t *testing.T, local, remote *Conn) {
+				remote.Close()
+				if _, err := local.Read(make([]byte, 1)); err == nil {
+					t.Fatalf("expected read to fail")
+				}
+			},
+			expected: ErrPeerClose,
+		},
+		{
+			name: "peer going away",
+			options: []func(*Config){
+				WithFlowWindow(1 << 16),
+			},
+			trigger: func(t *testing.T, local, remote *Conn) {
+				remote.CloseWithReason(1, "bye")
+				_, err := local.Read(make([]byte, 1))
+				if _, ok := err.(ErrPeerGoingAway); !ok {
+					t.Fatalf("expected ErrPeerGoingAway, got %v", err)
+				}
+			},
+			expected: ErrPeerClose,
+		},
+		{
+			name: "read timeout",
+			trigger: func(t *testing.T, local, remote *Conn) {
+				local.SetReadDeadline(time.Now().Add(
+					10 * time.Millisecond))
+				if _, err := local.Read(make([]byte, 1)); err == nil {
+					t.Fatalf("expected read to time out")
+				}
+
+				// The connection is still usable after a
+				// timeout.
+				if reason := local.CloseReason(); reason != nil {
+					t.Fatalf("unexpected reason %v", reason)
+				}
+			},
+			expected: ErrReadTimeout,
+		},
+		{
+			name: "write timeout",
+			options: []func(*Config){
+				WithFlowWindow(1024),
+			},
+			trigger: func(t *testing.T, local, remote *Conn) {
+				local.SetWriteDeadline(time.Now().Add(
+					50 * time.Millisecond))
+				_, err := local.Write(make([]byte, 4096))
+				if err == nil {
+					t.Fatalf("expected write to time out")
+				}
+			},
+			expected: ErrWriteTimeout,
+		},
+		{
+			name: "protocol error",
+			trigger: func(t *testing.T, local, remote *Conn) {
+				garbage := bytes.Repeat([]byte{0xff}, 64)
+				if _, err := remote.conn.Write(garbage); err != nil {
+					t.Fatalf("unable to write: %v", err)
+				}
+				if _, err := local.Read(make([]byte, 1)); err == nil {
+					t.Fatalf("expected read to fail")
+				}
+			},
+			expected: ErrProtocol,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			listener, pkh := newTestListener(t, test.options...)
+			defer listener.Close()
+
+			local, remote := dialAndAccept(t, listener, pkh,
+				test.options...)
+			defer remote.Close()
+
+			if reason := local.CloseReason(); reason != nil {
+				t.Fatalf("unexpected reason while open: %v", reason)
+			}
+
+			test.trigger(t, local, remote)
+			local.Close()
+
+			if reason := local.CloseReason(); reason != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected,
+					reason)
+			}
+		})
+	}
+}
+
+func TestCloseReasonTimeoutForgotten(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer remote.Close()
+
+	local.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := local.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected read to time out")
+	}
+
+	// A read succeeding after the timeout means it wasn't the reason.
+	local.SetReadDeadline(time.Time{})
+	if _, err := remote.Write([]byte("ping")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	if _, err := io.ReadFull(local, make([]byte, 4)); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+
+	local.Close()
+	if reason := local.CloseReason(); reason != ErrLocalClose {
+		t.Fatalf("expected ErrLocalClose, got %v", reason)
+	}
+}
@@ -0,0 +1,880 @@
+package lndc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+
+	"github.com/mit-dci/lit/btcutil/chaincfg/chainhash"
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// Config houses the optional parameters which tune the behaviour of the lndc
+// Listener and dialer. The zero value is valid and yields the default
+// behaviour of the package. A Config is built up by passing a set of
+// functional options to NewListener or Dial.
+type Config struct {
+	// Curve pins the curve that the remote peer's ephemeral key must lie
+	// on. Any act proposing a key of a different type is rejected with
+	// ErrCurveMismatch. If empty, CurveSecp256k1 is used, which is also
+	// the only curve currently supported.
+	Curve string
+
+	// ListenerID is a stable identifier for a listener which is included
+	// in all of its log lines and on every Conn it produces. If left
+	// empty, a random identifier is generated when the listener is
+	// created.
+	ListenerID string
+
+	// TranscriptHook, if set, is called with a copy of the raw bytes of
+	// each act of the handshake as they're sent or received.
+	//
+	// NOTE: The transcript exposes handshake material and is intended
+	// only for debugging protocol interop. It is disabled by default.
+	TranscriptHook func(act int, dir Direction, data []byte)
+
+	// ReconnectBackoff is the initial delay a ConnManager waits before
+	// redialing a peer after a failed attempt or a dropped connection.
+	// The delay doubles after each consecutive failure up to
+	// MaxReconnectBackoff. If zero, defaultReconnectBackoff is used.
+	ReconnectBackoff time.Duration
+
+	// MaxReconnectBackoff caps the delay between reconnection attempts
+	// made by a ConnManager. If zero, defaultMaxReconnectBackoff is used.
+	MaxReconnectBackoff time.Duration
+
+	// SessionBuffer caps the number of bytes of outbound messages a
+	// Session buffers while its peer is being reconnected. If zero,
+	// defaultSessionBuffer is used.
+	SessionBuffer int
+
+	// MaxConns caps the number of established connections a listener
+	// will hold at once. Zero means there is no limit.
+	MaxConns int
+
+	// MaxConnsPerPeer caps the number of established connections a
+	// listener will hold at once with any single peer, as identified by
+	// its public key. Any more are refused with ErrTooManyConns. Zero
+	// means there is no limit.
+	MaxConnsPerPeer int
+
+	// MaxConnsPerIP caps the number of connections a listener will hold
+	// at once from any single IP, counting both those carrying out the
+	// handshake and those established. Any more are closed as soon as
+	// they're accepted from the network. Zero means there is no limit.
+	MaxConnsPerIP int
+
+	// MaxQueuedPerIP caps the number of connections from any single IP
+	// which may wait at once for a listener to start their handshakes.
+	// Any more are closed as soon as they're accepted from the network.
+	// Zero means there is no limit beyond that on all waiting
+	// connections. Peers reached through Tor or a reverse proxy all
+	// appear to come from the same IP, so mustn't be capped this way.
+	MaxQueuedPerIP int
+
+	// OverflowPolicy governs which established connection, if any, a
+	// listener at MaxConns evicts to make room for a new one. The
+	// default, OverflowReject, only evicts a connection the new one
+	// outranks by Priority.
+	OverflowPolicy OverflowPolicy
+
+	// Priority, if set, ranks each authenticated peer by its static
+	// public key. When a listener is at MaxConns, a new connection with
+	// a higher priority than an established one evicts the lowest
+	// priority connection rather than being refused.
+	Priority func(pub *koblitz.PublicKey) int
+
+	// Classify, if set, assigns each authenticated peer to a class by its
+	// identity, such as to offer premium peers more connections than
+	// free ones. The peers of each class listed in ClassLimits are held
+	// to its limits together, independently of the other classes.
+	Classify    func(pub *koblitz.PublicKey) string
+	ClassLimits map[string]ClassLimits
+
+	// AcceptFilter, if set, is consulted by a listener as soon as each
+	// connection is accepted, before any of its bytes are read or a
+	// handshake slot is spent on it. Connections from addresses for
+	// which it returns false are closed at once. It's called from the
+	// listener's accept loop, so it must be quick.
+	AcceptFilter func(remoteAddr net.Addr) bool
+
+	// ReputationCheck, if set, scores the IP of each connection a
+	// listener accepts, such as by querying a reputation feed, before
+	// the handshake begins. Connections scored below MinReputation are
+	// refused. Should the check fail, or not answer within
+	// ReputationTimeout, the connection is let through. If
+	// ReputationTimeout is zero, defaultReputationTimeout is used.
+	ReputationCheck   func(ip net.IP) (score int, err error)
+	MinReputation     int
+	ReputationTimeout time.Duration
+
+	// Logger receives all of the log lines emitted by a listener or
+	// dialer. If nil, lines are passed to lit's logging package.
+	Logger Logger
+
+	// VerbosePeers, if set, selects the peers whose connections log a
+	// detailed trace of their handshake and traffic at the info level,
+	// so that a suspicious peer can be followed without the log lines of
+	// every other connection.
+	VerbosePeers *VerboseSet
+
+	// SlowHandshakeThreshold, if non-zero, causes a warning to be logged
+	// for every handshake which takes longer than the threshold to
+	// complete.
+	SlowHandshakeThreshold time.Duration
+
+	// ReadTimeout and WriteTimeout are the default rolling timeouts
+	// applied to every established connection. Each read from or write
+	// to the network is given a fresh deadline of the timeout from that
+	// moment, so only an inactive connection times out. Zero disables
+	// the respective timeout. Both can be overridden per connection via
+	// SetReadTimeout and SetWriteTimeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// CipherSuites lists the cipher suites which may be used to encrypt
+	// messages once the handshake is complete, in order of preference.
+	// When dialing, setting this causes the suites to be offered to the
+	// responder, which selects the first it also supports. A listener
+	// selects only from its own CipherSuites, or just
+	// CipherSuiteChaChaPoly if none are set. Whenever no common suite is
+	// found, CipherSuiteChaChaPoly is used.
+	CipherSuites []string
+
+	// AdvertisedAddr, if set, is the address at which this node can be
+	// reached, which is sent to the remote peer over the encrypted
+	// channel once the handshake is complete. It must be of the form
+	// host:port, where host is either an IP address or a torv3 onion
+	// service address. It's only exchanged over the extended handshake,
+	// which a dialer setting this offers, so a listener's address only
+	// reaches dialers which have an extension of their own configured.
+	AdvertisedAddr string
+
+	// CircuitBreaker, if set, is consulted by Dial before connecting to
+	// a peer and records the outcome of each handshake, so that a peer
+	// whose handshakes keep failing isn't dialed repeatedly.
+	CircuitBreaker *CircuitBreaker
+
+	// MemoryGuard, if set, has a listener refuse new connections while
+	// memory pressure is above the guard's threshold.
+	MemoryGuard *MemoryGuard
+
+	// ConnRegistry, if set, records the connections established by
+	// listeners, dials and upgrades, so that duplicate connections with a
+	// peer are closed.
+	ConnRegistry *ConnRegistry
+
+	// FlowWindow, if non-zero, is the number of bytes the remote peer
+	// may send before the application has read them. Once the window is
+	// full the remote peer's writes block until enough of the data has
+	// been read for credits to be returned to it, so that a fast sender
+	// can't overwhelm a slow reader. Flow control only applies when both
+	// sides support the extended handshake.
+	//
+	// NOTE: Credits are processed as part of reading from a connection,
+	// so a side which writes must keep reading for its writes to be
+	// unblocked.
+	FlowWindow uint32
+
+	// Certificate, if set, is presented to the remote peer to prove that
+	// the static key used for the handshake is authorized to act on
+	// behalf of the certificate's root key.
+	Certificate *Certificate
+
+	// AcceptCertificates allows a dialer to complete a handshake with a
+	// responder whose static key doesn't hash to the expected address,
+	// so long as it presents a valid Certificate from the key that does.
+	// Certificates presented to a listener are always verified.
+	AcceptCertificates bool
+
+	// Nagle enables Nagle's algorithm on every TCP connection established
+	// by a listener or dialer, by turning off TCP_NODELAY. Go disables
+	// Nagle's algorithm by default, which suits the small latency
+	// sensitive messages of the lightning protocol, while coalescing
+	// writes may instead suit bulk transfers. It can be changed per
+	// connection via SetNoDelay.
+	Nagle bool
+
+	// ProofOfWork, if non-zero, is the number of leading zero bits of the
+	// hashcash style proof of work attached to act one. A dialer computes
+	// a proof of this difficulty, while a listener refuses any act one
+	// without a proof of at least this difficulty before carrying out
+	// any ECDH operation. It may be at most MaxProofOfWork.
+	ProofOfWork uint8
+
+	// MinPeerVersion, if non-zero, is the lowest handshake version
+	// accepted from a remote peer, so that peers too old to support
+	// the extended handshake can be phased out. A handshake with an
+	// older peer is abandoned with ErrClientTooOld once the peer has
+	// been authenticated. It may be at most ExtendedHandshakeVersion.
+	MinPeerVersion byte
+
+	// LegacyFallback, if set, allows a dialer whose offer of the extended
+	// handshake is refused by the remote peer closing the connection
+	// without a word, as peers predating it do, to redial once offering
+	// only the original version, without any of the extensions. As a
+	// listener refusing a peer for any other reason may close the
+	// connection the same way, it's never done while MinPeerVersion
+	// requires the extended handshake, nor while an extension guarding
+	// the connection's security, such as ChainHash, SequenceNumbers,
+	// CipherSuites, certificates or channel proofs, is configured.
+	LegacyFallback bool
+
+	// BanList, if set, is consulted by a listener to refuse banned
+	// peers, both by IP before the handshake and by identity once the
+	// peer has been authenticated.
+	BanList BanList
+
+	// FailureResponse governs whether a listener tells a dialer why its
+	// handshake was refused before closing the connection. The default,
+	// FailureSilent, closes the connection without a word.
+	FailureResponse FailureResponse
+
+	// InsecureExportKeys allows the symmetric keys of each connection to
+	// be exported via ExportKeys. It's only available in binaries built
+	// with the lit_keyexport tag. See InsecureExportKeys.
+	InsecureExportKeys bool
+
+	// ExtendedLength allows messages of up to MaxExtendedMessageLength
+	// bytes to be sent without being split, by prefixing each with a
+	// 4-byte rather than a 2-byte length. It only takes effect if both
+	// sides enable it and support the extended handshake, otherwise the
+	// 2-byte prefix is kept.
+	ExtendedLength bool
+
+	// SmallBuffers starts each connection with small buffers for
+	// encrypting and decrypting messages, grown on demand up to the size
+	// of the largest message, rather than allocating them in full up
+	// front. This saves memory when many mostly idle peers, which only
+	// exchange small messages, are connected.
+	SmallBuffers bool
+
+	// SequenceNumbers numbers each message of application data, so that
+	// any message lost or repeated through a bug in framing fails the
+	// read with ErrSequenceGap rather than going unnoticed. Each message
+	// then spends 8 bytes of its payload on the number. It only takes
+	// effect if both sides enable it and support the extended handshake.
+	SequenceNumbers bool
+
+	// LocalHeader, if set, is sent to the remote peer during the
+	// handshake for it to read through RemoteHeader, allowing protocols
+	// built on lndc to exchange supported versions or the like before
+	// any other messages. It may be at most MaxHeaderLength bytes, and
+	// is only exchanged if both sides support the extended handshake.
+	LocalHeader []byte
+
+	// ChainHash, if set, is the genesis hash of the chain the local node
+	// is running on. It's exchanged with the remote peer during the
+	// handshake, which fails with ErrChainMismatch on both sides if the
+	// peer is running on a different chain. Peers which don't send a
+	// chain hash, including those without support for the extended
+	// handshake, are assumed to be on the same chain.
+	ChainHash *chainhash.Hash
+
+	// ChannelProof, if set, is presented by a dialer to prove that it
+	// has funds committed to a channel, for listeners which require it.
+	ChannelProof *ChannelProof
+
+	// ChannelProofVerifier, if set, requires each peer dialing a
+	// listener to present a ChannelProof for its identity, which is
+	// refused unless the callback returns nil. The callback is expected
+	// to check the claimed channel against the chain.
+	ChannelProofVerifier func(proof *ChannelProof) error
+
+	// CompletionHook, if set, is notified by a listener as each
+	// handshake completes. It's intended for tests only.
+	CompletionHook CompletionHook
+
+	// AuditSink, if set, receives a record of every connection accepted
+	// or rejected by a listener.
+	AuditSink AuditSink
+
+	// DialStats, if set, collects the outcomes of the connections made by
+	// Dial.
+	DialStats *DialStats
+
+	// Authorizer, if set, decides whether a listener accepts each peer
+	// once it has been authenticated.
+	Authorizer Authorizer
+
+	// MaxHandshakes caps the number of handshakes a listener carries out
+	// concurrently. Further connections wait for a free slot, with the
+	// slots shared fairly between source IPs. If zero, defaultHandshakes
+	// is used.
+	MaxHandshakes int
+
+	// HandshakeCost, if set, estimates how many of the MaxHandshakes
+	// slots the handshake with the peer at remoteAddr takes, so that the
+	// cap reflects what handshakes cost rather than their number. It's
+	// called from the listener's dispatch loop before the handshake
+	// starts, so it must be quick. Costs are clamped to between one and
+	// MaxHandshakes. If nil, every handshake takes a single slot.
+	HandshakeCost func(remoteAddr net.Addr) int
+
+	// HandshakesPerCPU, if set and MaxHandshakes isn't, derives the cap
+	// on concurrent handshakes from the machine, as this many per
+	// GOMAXPROCS when the listener is created.
+	HandshakesPerCPU int
+
+	// HandshakeRTTMultiple, if set, scales the read timeout a dialer
+	// applies during the handshake to this multiple of the time it took
+	// to connect, so that the timeout adapts to the latency of the link.
+	// The timeout is bounded by HandshakeTimeoutFloor and
+	// HandshakeTimeoutCeiling, which if zero default to
+	// defaultHandshakeTimeoutFloor and defaultHandshakeTimeoutCeiling.
+	HandshakeRTTMultiple    int
+	HandshakeTimeoutFloor   time.Duration
+	HandshakeTimeoutCeiling time.Duration
+
+	// DebugTee, if set, copies the decrypted traffic of a sample of a
+	// listener's accepted connections to a debug sink. It's only
+	// available in binaries built with the lit_insecure tag.
+	DebugTee *DebugTee
+
+	// powSeen holds the proofs of work recently received by a listener.
+	powSeen proofCache
+}
+
+// Direction describes whether a piece of handshake data was sent to or
+// received from the remote peer.
+type Direction uint8
+
+const (
+	// DirectionSent marks data which was written to the remote peer.
+	DirectionSent Direction = iota
+
+	// DirectionReceived marks data which was read from the remote peer.
+	DirectionReceived
+)
+
+// String returns a human readable description of the direction.
+func (d Direction) String() string {
+	switch d {
+	case DirectionSent:
+		return "sent"
+	case DirectionReceived:
+		return "received"
+	default:
+		return "unknown"
+	}
+}
+
+// newConfig returns a Config with all of the passed options applied.
+func newConfig(options ...func(*Config)) *Config {
+	cfg := &Config{}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return cfg
+}
+
+// configLimit is a limit of a Config which mustn't be negative, named for the
+// error reporting it.
+type configLimit struct {
+	name  string
+	value int
+}
+
+// validate ensures the configuration can be used by a listener or dialer.
+func (c *Config) validate() error {
+	if c.Curve != "" && c.Curve != CurveSecp256k1 {
+		return fmt.Errorf("unsupported lndc curve %q, only %q is "+
+			"supported", c.Curve, CurveSecp256k1)
+	}
+
+	if c.InsecureExportKeys && !keyExportBuild {
+		return errKeyExportBuild
+	}
+
+	for _, suite := range c.CipherSuites {
+		if suite == CipherSuiteInsecureNull && !insecureBuild {
+			return errInsecureBuild
+		}
+		if _, ok := cipherSuites[suite]; !ok {
+			return fmt.Errorf("unknown lndc cipher suite %q", suite)
+		}
+	}
+
+	if c.ProofOfWork > MaxProofOfWork {
+		return fmt.Errorf("lndc proof of work difficulty %d exceeds "+
+			"the maximum of %d", c.ProofOfWork, MaxProofOfWork)
+	}
+
+	limits := []configLimit{
+		{"session buffer", c.SessionBuffer},
+		{"max conns", c.MaxConns},
+		{"max conns per peer", c.MaxConnsPerPeer},
+		{"max conns per IP", c.MaxConnsPerIP},
+		{"max queued per IP", c.MaxQueuedPerIP},
+		{"max handshakes", c.MaxHandshakes},
+		{"handshakes per CPU", c.HandshakesPerCPU},
+		{"handshake RTT multiple", c.HandshakeRTTMultiple},
+	}
+	for class, classLimits := range c.ClassLimits {
+		if classLimits.Rate < 0 {
+			return fmt.Errorf("lndc class %q rate %v is negative", class,
+				classLimits.Rate)
+		}
+		limits = append(limits,
+			configLimit{fmt.Sprintf("class %q max conns", class),
+				classLimits.MaxConns},
+			configLimit{fmt.Sprintf("class %q burst", class),
+				classLimits.Burst})
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			return fmt.Errorf("lndc %s %d is negative", limit.name,
+				limit.value)
+		}
+	}
+
+	if c.MinPeerVersion > ExtendedHandshakeVersion {
+		return fmt.Errorf("lndc minimum peer version %d exceeds the "+
+			"highest supported version %d", c.MinPeerVersion,
+			ExtendedHandshakeVersion)
+	}
+
+	if c.DebugTee != nil {
+		if err := c.DebugTee.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateHeader(c.LocalHeader); err != nil {
+		return err
+	}
+
+	if c.AdvertisedAddr != "" {
+		if err := validateAdvertisedAddr(c.AdvertisedAddr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WithCurve is a functional option that pins the curve accepted for the remote
+// peer's ephemeral key.
+func WithCurve(curve string) func(*Config) {
+	return func(c *Config) {
+		c.Curve = curve
+	}
+}
+
+// WithListenerID is a functional option that sets the identifier of a listener
+// used to correlate its log lines. The function closure returned by this
+// function can be passed into NewListener as an option parameter.
+func WithListenerID(id string) func(*Config) {
+	return func(c *Config) {
+		c.ListenerID = id
+	}
+}
+
+// WithTranscriptHook is a functional option that registers a hook which is
+// handed a copy of every act of the handshake. This exposes handshake
+// material, so it should only ever be used while debugging.
+func WithTranscriptHook(
+	hook func(act int, dir Direction, data []byte)) func(*Config) {
+
+	return func(c *Config) {
+		c.TranscriptHook = hook
+	}
+}
+
+// transcript passes a copy of an act's bytes to the TranscriptHook if one is
+// registered.
+func (c *Config) transcript(act int, dir Direction, data []byte) {
+	if c.TranscriptHook == nil {
+		return
+	}
+
+	c.TranscriptHook(act, dir, append([]byte(nil), data...))
+}
+
+// WithReconnectBackoff is a functional option that sets the initial and maximum
+// delay between the reconnection attempts of a ConnManager.
+func WithReconnectBackoff(initial, max time.Duration) func(*Config) {
+	return func(c *Config) {
+		c.ReconnectBackoff = initial
+		c.MaxReconnectBackoff = max
+	}
+}
+
+// WithSessionBuffer is a functional option that caps the number of bytes of
+// outbound messages a Session buffers while reconnecting.
+func WithSessionBuffer(n int) func(*Config) {
+	return func(c *Config) {
+		c.SessionBuffer = n
+	}
+}
+
+// WithMaxConns is a functional option that caps the number of established
+// connections held by a listener.
+func WithMaxConns(n int) func(*Config) {
+	return func(c *Config) {
+		c.MaxConns = n
+	}
+}
+
+// WithMaxConnsPerPeer is a functional option that caps the number of
+// established connections held by a listener with any single peer.
+func WithMaxConnsPerPeer(n int) func(*Config) {
+	return func(c *Config) {
+		c.MaxConnsPerPeer = n
+	}
+}
+
+// WithMaxConnsPerIP is a functional option that caps the number of connections
+// held by a listener from any single IP.
+func WithMaxConnsPerIP(n int) func(*Config) {
+	return func(c *Config) {
+		c.MaxConnsPerIP = n
+	}
+}
+
+// WithMaxQueuedPerIP is a functional option that caps the number of connections
+// from any single IP waiting for a listener to start their handshakes.
+func WithMaxQueuedPerIP(n int) func(*Config) {
+	return func(c *Config) {
+		c.MaxQueuedPerIP = n
+	}
+}
+
+// WithOverflowPolicy is a functional option that sets the policy governing
+// which connection a listener at MaxConns evicts for a new one.
+func WithOverflowPolicy(policy OverflowPolicy) func(*Config) {
+	return func(c *Config) {
+		c.OverflowPolicy = policy
+	}
+}
+
+// WithPriority is a functional option that sets the function used to rank peers
+// when a listener is at its connection cap.
+func WithPriority(priority func(pub *koblitz.PublicKey) int) func(*Config) {
+	return func(c *Config) {
+		c.Priority = priority
+	}
+}
+
+// WithAcceptFilter is a functional option that sets the function a listener
+// consults to drop connections as soon as they're accepted.
+func WithAcceptFilter(filter func(remoteAddr net.Addr) bool) func(*Config) {
+	return func(c *Config) {
+		c.AcceptFilter = filter
+	}
+}
+
+// WithReputationCheck is a functional option that sets the function a listener
+// consults to score the IP of each connection, refusing those scored below
+// min.
+func WithReputationCheck(check func(ip net.IP) (score int, err error),
+	min int) func(*Config) {
+
+	return func(c *Config) {
+		c.ReputationCheck = check
+		c.MinReputation = min
+	}
+}
+
+// WithReputationTimeout is a functional option that sets how long a listener
+// waits for the ReputationCheck of each connection.
+func WithReputationTimeout(timeout time.Duration) func(*Config) {
+	return func(c *Config) {
+		c.ReputationTimeout = timeout
+	}
+}
+
+// WithLogger is a functional option that redirects the log lines of a
+// listener or dialer to the passed Logger.
+func WithLogger(logger Logger) func(*Config) {
+	return func(c *Config) {
+		c.Logger = logger
+	}
+}
+
+// WithVerbosePeers is a functional option that sets the peers whose connections
+// log a detailed trace.
+func WithVerbosePeers(peers *VerboseSet) func(*Config) {
+	return func(c *Config) {
+		c.VerbosePeers = peers
+	}
+}
+
+// WithSlowHandshakeThreshold is a functional option that sets the duration
+// above which a handshake is logged as being slow.
+func WithSlowHandshakeThreshold(threshold time.Duration) func(*Config) {
+	return func(c *Config) {
+		c.SlowHandshakeThreshold = threshold
+	}
+}
+
+// WithTimeouts is a functional option that sets the default rolling read and
+// write timeouts applied to established connections.
+func WithTimeouts(read, write time.Duration) func(*Config) {
+	return func(c *Config) {
+		c.ReadTimeout = read
+		c.WriteTimeout = write
+	}
+}
+
+// WithCipherSuites is a functional option that sets the cipher suites which may
+// be negotiated for a connection, in order of preference.
+func WithCipherSuites(suites ...string) func(*Config) {
+	return func(c *Config) {
+		c.CipherSuites = suites
+	}
+}
+
+// WithAdvertisedAddr is a functional option that sets the address, clearnet or
+// torv3 onion, advertised to remote peers once the handshake is complete.
+func WithAdvertisedAddr(addr string) func(*Config) {
+	return func(c *Config) {
+		c.AdvertisedAddr = addr
+	}
+}
+
+// WithCircuitBreaker is a functional option that sets the CircuitBreaker
+// guarding the peers dialed with it.
+func WithCircuitBreaker(breaker *CircuitBreaker) func(*Config) {
+	return func(c *Config) {
+		c.CircuitBreaker = breaker
+	}
+}
+
+// WithMemoryGuard is a functional option that sets the MemoryGuard consulted
+// by a listener before taking on each new connection.
+func WithMemoryGuard(guard *MemoryGuard) func(*Config) {
+	return func(c *Config) {
+		c.MemoryGuard = guard
+	}
+}
+
+// WithConnRegistry is a functional option that sets the ConnRegistry within
+// which established connections are recorded.
+func WithConnRegistry(registry *ConnRegistry) func(*Config) {
+	return func(c *Config) {
+		c.ConnRegistry = registry
+	}
+}
+
+// WithFlowWindow is a functional option that sets the receive window advertised
+// to the remote peer for flow control.
+func WithFlowWindow(window uint32) func(*Config) {
+	return func(c *Config) {
+		c.FlowWindow = window
+	}
+}
+
+// WithCertificate is a functional option that sets the certificate presented
+// to remote peers to delegate a root identity to the local static key.
+func WithCertificate(cert *Certificate) func(*Config) {
+	return func(c *Config) {
+		c.Certificate = cert
+	}
+}
+
+// WithAcceptCertificates is a functional option that allows a dialer to accept
+// a responder authenticated by a certificate rather than its static key.
+func WithAcceptCertificates() func(*Config) {
+	return func(c *Config) {
+		c.AcceptCertificates = true
+	}
+}
+
+// WithNoDelay is a functional option that sets whether TCP_NODELAY is set on
+// the TCP connections of a listener or dialer. Passing false enables Nagle's
+// algorithm.
+func WithNoDelay(noDelay bool) func(*Config) {
+	return func(c *Config) {
+		c.Nagle = !noDelay
+	}
+}
+
+// WithProofOfWork is a functional option that sets the difficulty of the proof
+// of work a dialer attaches to act one, or a listener requires of it.
+func WithProofOfWork(difficulty uint8) func(*Config) {
+	return func(c *Config) {
+		c.ProofOfWork = difficulty
+	}
+}
+
+// WithExtendedLength is a functional option that offers 4-byte length prefixes
+// to the remote peer, allowing messages larger than 65535 bytes.
+func WithExtendedLength() func(*Config) {
+	return func(c *Config) {
+		c.ExtendedLength = true
+	}
+}
+
+// WithSmallBuffers is a functional option that starts each connection with
+// small message buffers, which are grown on demand.
+func WithSmallBuffers() func(*Config) {
+	return func(c *Config) {
+		c.SmallBuffers = true
+	}
+}
+
+// WithSequenceNumbers is a functional option that offers to number each message
+// of application data sent to and received from the remote peer.
+func WithSequenceNumbers() func(*Config) {
+	return func(c *Config) {
+		c.SequenceNumbers = true
+	}
+}
+
+// WithLocalHeader is a functional option that sets the header sent to the
+// remote peer during the handshake.
+func WithLocalHeader(header []byte) func(*Config) {
+	return func(c *Config) {
+		c.LocalHeader = header
+	}
+}
+
+// WithChainHash is a functional option that sets the genesis hash of the chain
+// which remote peers must be running on.
+func WithChainHash(hash *chainhash.Hash) func(*Config) {
+	return func(c *Config) {
+		c.ChainHash = hash
+	}
+}
+
+// WithChannelProof is a functional option that sets the channel proof a
+// dialer presents to listeners requiring one.
+func WithChannelProof(proof *ChannelProof) func(*Config) {
+	return func(c *Config) {
+		c.ChannelProof = proof
+	}
+}
+
+// WithRequireChannelProof is a functional option that requires peers dialing a
+// listener to present a channel proof accepted by verify.
+func WithRequireChannelProof(verify func(*ChannelProof) error) func(*Config) {
+	return func(c *Config) {
+		c.ChannelProofVerifier = verify
+	}
+}
+
+// WithCompletionHook is a functional option that sets the hook notified by a
+// listener as each handshake completes.
+func WithCompletionHook(hook CompletionHook) func(*Config) {
+	return func(c *Config) {
+		c.CompletionHook = hook
+	}
+}
+
+// WithAuditSink is a functional option that sets the sink receiving a record
+// of every connection accepted or rejected by a listener.
+func WithAuditSink(sink AuditSink) func(*Config) {
+	return func(c *Config) {
+		c.AuditSink = sink
+	}
+}
+
+// WithDialStats is a functional option that sets the DialStats updated by
+// Dial.
+func WithDialStats(stats *DialStats) func(*Config) {
+	return func(c *Config) {
+		c.DialStats = stats
+	}
+}
+
+// WithAuthorizer is a functional option that sets the Authorizer deciding
+// whether a listener accepts each authenticated peer.
+func WithAuthorizer(authorizer Authorizer) func(*Config) {
+	return func(c *Config) {
+		c.Authorizer = authorizer
+	}
+}
+
+// WithMaxHandshakes is a functional option that caps the number of handshakes a
+// listener carries out concurrently.
+func WithMaxHandshakes(n int) func(*Config) {
+	return func(c *Config) {
+		c.MaxHandshakes = n
+	}
+}
+
+// WithHandshakeCost is a functional option that sets the function estimating
+// how many handshake slots each handshake with a listener takes.
+func WithHandshakeCost(cost func(remoteAddr net.Addr) int) func(*Config) {
+	return func(c *Config) {
+		c.HandshakeCost = cost
+	}
+}
+
+// WithHandshakesPerCPU is a functional option that caps the number of
+// handshakes a listener carries out concurrently at n per GOMAXPROCS.
+func WithHandshakesPerCPU(n int) func(*Config) {
+	return func(c *Config) {
+		c.HandshakesPerCPU = n
+	}
+}
+
+// WithAdaptiveHandshakeTimeout is a functional option that scales a dialer's
+// handshake read timeout to multiple times the time taken to connect,
+// bounded by floor and ceiling. A zero floor or ceiling selects the default.
+func WithAdaptiveHandshakeTimeout(multiple int, floor,
+	ceiling time.Duration) func(*Config) {
+
+	return func(c *Config) {
+		c.HandshakeRTTMultiple = multiple
+		c.HandshakeTimeoutFloor = floor
+		c.HandshakeTimeoutCeiling = ceiling
+	}
+}
+
+// maxHandshakes returns the number of handshakes a listener may carry out
+// concurrently.
+func (c *Config) maxHandshakes() int {
+	switch {
+	case c.MaxHandshakes != 0:
+		return c.MaxHandshakes
+
+	case c.HandshakesPerCPU != 0:
+		return c.HandshakesPerCPU * runtime.GOMAXPROCS(0)
+
+	default:
+		return defaultHandshakes
+	}
+}
+
+// WithBanList is a functional option that sets the BanList consulted by a
+// listener.
+func WithBanList(bans BanList) func(*Config) {
+	return func(c *Config) {
+		c.BanList = bans
+	}
+}
+
+// WithFailureResponse is a functional option that sets whether a listener
+// hints to a dialer why its handshake was refused.
+func WithFailureResponse(response FailureResponse) func(*Config) {
+	return func(c *Config) {
+		c.FailureResponse = response
+	}
+}
+
+// handshakeDone logs a warning if a handshake with the peer at addr took
+// longer than the configured SlowHandshakeThreshold.
+func (c *Config) handshakeDone(addr net.Addr, elapsed time.Duration) {
+	if c.SlowHandshakeThreshold == 0 || elapsed <= c.SlowHandshakeThreshold {
+		return
+	}
+
+	c.log().Warnf("lndc: slow handshake with %v took %v", addr, elapsed)
+}
+
+// newListenerID generates a short random identifier for a listener which
+// wasn't configured with one.
+func newListenerID() string {
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "lndc"
+	}
+
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,51 @@
+package lndc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+func TestConfigNegativeLimits(t *testing.T) {
+	classify := func(*koblitz.PublicKey) string { return "peers" }
+	tests := []struct {
+		option func(*Config)
+		limit  string
+	}{
+		{WithSessionBuffer(-1), "session buffer"},
+		{WithMaxConns(-1), "max conns"},
+		{WithMaxConnsPerPeer(-1), "max conns per peer"},
+		{WithMaxConnsPerIP(-1), "max conns per IP"},
+		{WithMaxQueuedPerIP(-1), "max queued per IP"},
+		{WithMaxHandshakes(-1), "max handshakes"},
+		{WithHandshakesPerCPU(-1), "handshakes per CPU"},
+		{WithAdaptiveHandshakeTimeout(-1, 0, 0), "handshake RTT multiple"},
+		{WithClassify(classify, map[string]ClassLimits{
+			"peers": {MaxConns: -1},
+		}), `class "peers" max conns`},
+		{WithClassify(classify, map[string]ClassLimits{
+			"peers": {Burst: -1},
+		}), `class "peers" burst`},
+		{WithClassify(classify, map[string]ClassLimits{
+			"peers": {Rate: -1},
+		}), `class "peers" rate`},
+	}
+	for _, test := range tests {
+		_, err := NewListener(newKey(t), 0, test.option)
+		if err == nil || !strings.HasPrefix(err.Error(),
+			"lndc "+test.limit+" -1 is negative") {
+
+			t.Fatalf("%s: expected a negative limit error, got %v",
+				test.limit, err)
+		}
+	}
+
+	// Zero still means each limit is unset.
+	listener, err := NewListener(newKey(t), 0, WithMaxConns(0),
+		WithMaxHandshakes(0), WithMaxQueuedPerIP(0))
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	listener.Close()
+}
@@ -0,0 +1,198 @@
+package lndc
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mit-dci/lit/btcutil/chaincfg/chainhash"
+)
+
+// configJSON is the form in which a Config is marshaled to JSON. It holds
+// only the plain settings of a Config: the callbacks, keys and other
+// components such as Logger, BanList and Certificate can't be marshaled, so
+// must be set programmatically.
+type configJSON struct {
+	Curve                   string          `json:"curve,omitempty"`
+	ListenerID              string          `json:"listener_id,omitempty"`
+	ReconnectBackoff        duration        `json:"reconnect_backoff,omitempty"`
+	MaxReconnectBackoff     duration        `json:"max_reconnect_backoff,omitempty"`
+	SessionBuffer           int             `json:"session_buffer,omitempty"`
+	MaxConns                int             `json:"max_conns,omitempty"`
+	MaxConnsPerPeer         int             `json:"max_conns_per_peer,omitempty"`
+	MaxConnsPerIP           int             `json:"max_conns_per_ip,omitempty"`
+	MaxQueuedPerIP          int             `json:"max_queued_per_ip,omitempty"`
+	MinReputation           int             `json:"min_reputation,omitempty"`
+	ReputationTimeout       duration        `json:"reputation_timeout,omitempty"`
+	OverflowPolicy          OverflowPolicy  `json:"overflow_policy,omitempty"`
+	FailureResponse         FailureResponse `json:"failure_response,omitempty"`
+	SlowHandshakeThreshold  duration        `json:"slow_handshake_threshold,omitempty"`
+	ReadTimeout             duration        `json:"read_timeout,omitempty"`
+	WriteTimeout            duration        `json:"write_timeout,omitempty"`
+	CipherSuites            []string        `json:"cipher_suites,omitempty"`
+	AdvertisedAddr          string          `json:"advertised_addr,omitempty"`
+	FlowWindow              uint32          `json:"flow_window,omitempty"`
+	AcceptCertificates      bool            `json:"accept_certificates,omitempty"`
+	Nagle                   bool            `json:"nagle,omitempty"`
+	ProofOfWork             uint8           `json:"proof_of_work,omitempty"`
+	MinPeerVersion          byte            `json:"min_peer_version,omitempty"`
+	LegacyFallback          bool            `json:"legacy_fallback,omitempty"`
+	InsecureExportKeys      bool            `json:"insecure_export_keys,omitempty"`
+	ExtendedLength          bool            `json:"extended_length,omitempty"`
+	SmallBuffers            bool            `json:"small_buffers,omitempty"`
+	SequenceNumbers         bool            `json:"sequence_numbers,omitempty"`
+	LocalHeader             []byte          `json:"local_header,omitempty"`
+	ChainHash               string          `json:"chain_hash,omitempty"`
+	MaxHandshakes           int             `json:"max_handshakes,omitempty"`
+	HandshakesPerCPU        int             `json:"handshakes_per_cpu,omitempty"`
+	HandshakeRTTMultiple    int             `json:"handshake_rtt_multiple,omitempty"`
+	HandshakeTimeoutFloor   duration        `json:"handshake_timeout_floor,omitempty"`
+	HandshakeTimeoutCeiling duration        `json:"handshake_timeout_ceiling,omitempty"`
+}
+
+// duration is a time.Duration marshaled as a string such as "1m30s".
+type duration time.Duration
+
+// MarshalJSON encodes the duration as a string.
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration from a string.
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+
+	return nil
+}
+
+// toJSON returns the marshalable settings of the Config.
+func (c *Config) toJSON() configJSON {
+	j := configJSON{
+		Curve:                   c.Curve,
+		ListenerID:              c.ListenerID,
+		ReconnectBackoff:        duration(c.ReconnectBackoff),
+		MaxReconnectBackoff:     duration(c.MaxReconnectBackoff),
+		SessionBuffer:           c.SessionBuffer,
+		MaxConns:                c.MaxConns,
+		MaxConnsPerPeer:         c.MaxConnsPerPeer,
+		MaxConnsPerIP:           c.MaxConnsPerIP,
+		MaxQueuedPerIP:          c.MaxQueuedPerIP,
+		MinReputation:           c.MinReputation,
+		ReputationTimeout:       duration(c.ReputationTimeout),
+		OverflowPolicy:          c.OverflowPolicy,
+		FailureResponse:         c.FailureResponse,
+		SlowHandshakeThreshold:  duration(c.SlowHandshakeThreshold),
+		ReadTimeout:             duration(c.ReadTimeout),
+		WriteTimeout:            duration(c.WriteTimeout),
+		CipherSuites:            c.CipherSuites,
+		AdvertisedAddr:          c.AdvertisedAddr,
+		FlowWindow:              c.FlowWindow,
+		AcceptCertificates:      c.AcceptCertificates,
+		Nagle:                   c.Nagle,
+		ProofOfWork:             c.ProofOfWork,
+		MinPeerVersion:          c.MinPeerVersion,
+		LegacyFallback:          c.LegacyFallback,
+		InsecureExportKeys:      c.InsecureExportKeys,
+		ExtendedLength:          c.ExtendedLength,
+		SmallBuffers:            c.SmallBuffers,
+		SequenceNumbers:         c.SequenceNumbers,
+		LocalHeader:             c.LocalHeader,
+		MaxHandshakes:           c.MaxHandshakes,
+		HandshakesPerCPU:        c.HandshakesPerCPU,
+		HandshakeRTTMultiple:    c.HandshakeRTTMultiple,
+		HandshakeTimeoutFloor:   duration(c.HandshakeTimeoutFloor),
+		HandshakeTimeoutCeiling: duration(c.HandshakeTimeoutCeiling),
+	}
+	if c.ChainHash != nil {
+		j.ChainHash = c.ChainHash.String()
+	}
+
+	return j
+}
+
+// apply copies the settings, other than the chain hash which is left to the
+// caller to decode, onto the passed Config, leaving its other fields
+// untouched.
+func (j configJSON) apply(c *Config) {
+	c.Curve = j.Curve
+	c.ListenerID = j.ListenerID
+	c.ReconnectBackoff = time.Duration(j.ReconnectBackoff)
+	c.MaxReconnectBackoff = time.Duration(j.MaxReconnectBackoff)
+	c.SessionBuffer = j.SessionBuffer
+	c.MaxConns = j.MaxConns
+	c.MaxConnsPerPeer = j.MaxConnsPerPeer
+	c.MaxConnsPerIP = j.MaxConnsPerIP
+	c.MaxQueuedPerIP = j.MaxQueuedPerIP
+	c.MinReputation = j.MinReputation
+	c.ReputationTimeout = time.Duration(j.ReputationTimeout)
+	c.OverflowPolicy = j.OverflowPolicy
+	c.FailureResponse = j.FailureResponse
+	c.SlowHandshakeThreshold = time.Duration(j.SlowHandshakeThreshold)
+	c.ReadTimeout = time.Duration(j.ReadTimeout)
+	c.WriteTimeout = time.Duration(j.WriteTimeout)
+	c.CipherSuites = j.CipherSuites
+	c.AdvertisedAddr = j.AdvertisedAddr
+	c.FlowWindow = j.FlowWindow
+	c.AcceptCertificates = j.AcceptCertificates
+	c.Nagle = j.Nagle
+	c.ProofOfWork = j.ProofOfWork
+	c.MinPeerVersion = j.MinPeerVersion
+	c.LegacyFallback = j.LegacyFallback
+	c.InsecureExportKeys = j.InsecureExportKeys
+	c.ExtendedLength = j.ExtendedLength
+	c.SmallBuffers = j.SmallBuffers
+	c.SequenceNumbers = j.SequenceNumbers
+	c.LocalHeader = j.LocalHeader
+	c.MaxHandshakes = j.MaxHandshakes
+	c.HandshakesPerCPU = j.HandshakesPerCPU
+	c.HandshakeRTTMultiple = j.HandshakeRTTMultiple
+	c.HandshakeTimeoutFloor = time.Duration(j.HandshakeTimeoutFloor)
+	c.HandshakeTimeoutCeiling = time.Duration(j.HandshakeTimeoutCeiling)
+}
+
+// MarshalJSON encodes the plain settings of the Config as JSON. Callbacks,
+// keys and components such as Logger aren't included.
+func (c *Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.toJSON())
+}
+
+// UnmarshalJSON decodes the plain settings of the Config from JSON, leaving
+// the callbacks, keys and components such as Logger which can't be encoded
+// as they were. Those must be set programmatically.
+func (c *Config) UnmarshalJSON(b []byte) error {
+	var j configJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	var chainHash *chainhash.Hash
+	if j.ChainHash != "" {
+		var err error
+		chainHash, err = chainhash.NewHashFromStr(j.ChainHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	j.apply(c)
+	c.ChainHash = chainHash
+
+	return nil
+}
+
+// WithConfig is a functional option that copies the plain settings of base,
+// such as a Config loaded from a JSON file, leaving callbacks, keys and
+// components such as Logger to be set by further options.
+func WithConfig(base *Config) func(*Config) {
+	return func(c *Config) {
+		base.toJSON().apply(c)
+		c.ChainHash = base.ChainHash
+	}
+}
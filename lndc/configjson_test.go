@@ -0,0 +1,70 @@
+package lndc
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mit-dci/lit/btcutil/chaincfg/chainhash"
+)
+
+func TestConfigJSON(t *testing.T) {
+	chain := chainhash.DoubleHashH([]byte("regtest"))
+	cfg := newConfig(
+		WithReconnectBackoff(2*time.Second, time.Minute),
+		WithTimeouts(30*time.Second, 1500*time.Millisecond),
+		WithMaxConns(64),
+		WithCipherSuites(CipherSuiteAESGCM, CipherSuiteChaChaPoly),
+		WithFlowWindow(1<<20),
+		WithProofOfWork(12),
+		WithLocalHeader([]byte("v1")),
+		WithChainHash(&chain),
+		WithMaxHandshakes(50),
+		WithLogger(&captureLogger{}),
+	)
+
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("unable to marshal config: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"read_timeout":"30s"`) {
+		t.Fatalf("expected durations to be encoded as strings: %s",
+			encoded)
+	}
+
+	var decoded Config
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unable to unmarshal config: %v", err)
+	}
+
+	// The plain settings survive, while the logger must be set
+	// programmatically.
+	if !reflect.DeepEqual(decoded.toJSON(), cfg.toJSON()) ||
+		!decoded.ChainHash.IsEqual(&chain) {
+
+		t.Fatalf("expected %+v, got %+v", cfg.toJSON(),
+			decoded.toJSON())
+	}
+	if decoded.Logger != nil {
+		t.Fatalf("logger shouldn't be decoded")
+	}
+
+	// The decoded config can be applied to a listener alongside options
+	// wiring in the rest.
+	listener, _ := newTestListener(t, WithConfig(&decoded),
+		WithLogger(&captureLogger{}))
+	defer listener.Close()
+	if listener.cfg.ReadTimeout != 30*time.Second ||
+		listener.cfg.MaxHandshakes != 50 {
+
+		t.Fatalf("decoded settings weren't applied to the listener")
+	}
+
+	// Malformed durations are rejected.
+	err = json.Unmarshal([]byte(`{"read_timeout":"soon"}`), &decoded)
+	if err == nil {
+		t.Fatalf("expected a malformed duration to be rejected")
+	}
+}
@@ -2,15 +2,14 @@ package lndc
 
 import (
 	"bytes"
-	"fmt"
-	"io"
-	"math"
+	"errors"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/mit-dci/lit/btcutil/chaincfg/chainhash"
 	"github.com/mit-dci/lit/crypto/koblitz"
-	"github.com/mit-dci/lit/lnutil"
-	"github.com/mit-dci/lit/logging"
 )
 
 // Conn is an implementation of net.Conn which enforces an authenticated key
@@ -20,11 +19,197 @@ import (
 // along with an encrypted length-prefix. See the Machine struct for
 // additional details w.r.t to the handshake and encryption scheme.
 type Conn struct {
+	// sendNonce and recvNonce are snapshots of the sending and receiving
+	// ciphers' nonces taken after each message is written or read. They
+	// must only be accessed atomically and are kept first to guarantee
+	// 64-bit alignment.
+	sendNonce uint64
+	recvNonce uint64
+
+	// lastRead and lastWrite are when a message was last read from and
+	// written to the connection respectively, in nanoseconds since the
+	// epoch. They must only be accessed atomically.
+	lastRead  int64
+	lastWrite int64
+
+	// readTimeout and writeTimeout hold the rolling timeouts, in
+	// nanoseconds, applied before each read from or write to the
+	// underlying connection. They must only be accessed atomically.
+	readTimeout  int64
+	writeTimeout int64
+
 	conn net.Conn
 
 	noise *Machine
 
+	// deadlineMtx guards readDeadline and writeDeadline, the deadlines
+	// last set explicitly by the caller. These are restored when a
+	// rolling timeout is disabled. readDeadlineSet, if non-nil, is
+	// closed the next time the read deadline is set, waking any read
+	// waiting on it while reads are paused.
+	deadlineMtx     sync.Mutex
+	readDeadline    time.Time
+	writeDeadline   time.Time
+	readDeadlineSet chan struct{}
+
 	readBuf bytes.Buffer
+
+	// readScratch is the buffer ReadMessageInto decrypts messages into,
+	// which is kept to fit the largest read so far. heldMessage is a
+	// message read into it which didn't fit the caller's buffer, held
+	// for the next call.
+	readScratch []byte
+	heldMessage []byte
+
+	// listenerID and seq identify the listener which accepted this
+	// connection and the sequence number it was handed. Both are zero
+	// valued for connections created via Dial.
+	listenerID string
+	seq        uint64
+
+	// handshakeDuration is the time taken to carry out the handshake,
+	// and establishedAt the time at which it completed.
+	handshakeDuration time.Duration
+	establishedAt     time.Time
+
+	// priority is the value assigned to the remote peer by the accepting
+	// listener's Priority function.
+	priority int
+
+	// class is the class assigned to the remote peer by the accepting
+	// listener's Classify function.
+	class string
+
+	// suite is the cipher suite negotiated through the hello messages of
+	// an extended handshake, if any.
+	suite string
+
+	// remoteAdvertisedAddr is the address the remote peer advertised
+	// through the hello messages of an extended handshake, if any.
+	remoteAdvertisedAddr string
+
+	// remoteCert is the certificate presented by the remote peer, if
+	// any. delegatedPKH is set by a dialer when the responder's static
+	// key didn't match the expected identity, which must then be proven
+	// by the responder's certificate.
+	remoteCert   *Certificate
+	delegatedPKH string
+
+	// remoteHeader is the header sent by the remote peer during the
+	// handshake, if any.
+	remoteHeader []byte
+
+	// remoteChainHash is the chain hash sent by the remote peer during
+	// the handshake, if any.
+	remoteChainHash *chainhash.Hash
+
+	// remoteChannelProof is the channel proof presented by the remote
+	// peer during the handshake, if any.
+	remoteChannelProof *ChannelProof
+
+	// owned is set while a goroutine has claimed ownership of the
+	// connection through TakeOwnership. It must only be accessed
+	// atomically.
+	owned int32
+
+	// tee, if set, receives a copy of the plaintext read from and
+	// written to the connection.
+	tee *DebugTee
+
+	// logger is the Logger of the Config the connection was created
+	// with, to which its trace is logged should its peer be flagged in
+	// verbosePeers.
+	logger       Logger
+	verbosePeers *VerboseSet
+
+	// framed is set once frames have been negotiated through the hello
+	// messages of an extended handshake, after which every message is
+	// prefixed with its frame type.
+	framed bool
+
+	// sequenced is set once both sides have agreed to number each data
+	// frame. sendSeq, guarded by writeMtx, is the sequence number of the
+	// next data frame written, and recvSeq that expected of the next
+	// read.
+	sequenced bool
+	sendSeq   uint64
+	recvSeq   uint64
+
+	// keysExportable is set if the connection was created with
+	// InsecureExportKeys.
+	keysExportable bool
+
+	// localPub is the local static public key of a connection created
+	// by ImportConn, whose Machine doesn't hold the private key.
+	localPub *koblitz.PublicKey
+
+	// extendedLength is set while the hello messages are exchanged if
+	// both sides agree to 4-byte length prefixes.
+	extendedLength bool
+
+	// writeMtx serializes the messages written by Write with control
+	// frames, such as the credits returned as data is read. It also guards pendingWrite, the
+	// remainder of a message which TryWrite couldn't write in full, and
+	// writeClosed, set once CloseWrite has been called.
+	writeMtx     sync.Mutex
+	pendingWrite []byte
+	writeClosed  bool
+
+	// readEOF is set once the remote peer has closed its writing side
+	// with a frameEnd frame.
+	readEOF bool
+
+	// flowMtx guards the flow control state. sendCredits is the number of
+	// bytes the remote peer's receive window has room for, and
+	// sendWindow the size of that window as advertised during the
+	// handshake. They're only enforced if sendLimited is set, while
+	// creditSignal is notified
+	// whenever credits arrive. recvWindow is our own receive window,
+	// recvOutstanding the bytes received but not yet credited back to
+	// the remote peer, and recvConsumed those which have been handed to
+	// the application in the meantime.
+	flowMtx         sync.Mutex
+	sendCredits     uint32
+	sendWindow      uint32
+	sendLimited     bool
+	creditSignal    chan struct{}
+	recvWindow      uint32
+	recvOutstanding uint32
+	recvConsumed    uint32
+
+	// pendingCredit, also guarded by flowMtx, is credit consumed but not
+	// yet sent to the remote peer, and creditWriters the number of
+	// writers which will send it before they're done.
+	pendingCredit uint32
+	creditWriters int
+
+	// queueMtx guards sendQueue, which is created on the first call to
+	// WritePriority.
+	queueMtx  sync.Mutex
+	sendQueue *sendQueue
+
+	// valuesMtx guards values, the values attached to the connection
+	// through SetValue.
+	valuesMtx sync.Mutex
+	values    map[interface{}]interface{}
+
+	// pauseMtx guards readsPaused, which is set while reads are paused
+	// via PauseReads, and readsResumed, which is closed once they're
+	// resumed.
+	pauseMtx     sync.Mutex
+	readsPaused  bool
+	readsResumed chan struct{}
+
+	// closeMtx guards closed and closeHooks, the latter being a set of
+	// callbacks executed once the connection is closed, along with
+	// closeReason and pendingTimeout. timedOut is set, atomically, while
+	// pendingTimeout holds the timeout of the last read or write.
+	closeMtx       sync.Mutex
+	closed         bool
+	closeHooks     []func()
+	closeReason    error
+	pendingTimeout error
+	timedOut       int32
 }
 
 // A compile-time assertion to ensure that Conn meets the net.Conn interface.
@@ -33,89 +218,309 @@ var _ net.Conn = (*Conn)(nil)
 // Dial attempts to establish an encrypted+authenticated connection with the
 // remote peer located at address which has remotePub as its long-term static
 // public key. In the case of a handshake failure, the connection is closed and
-// a non-nil error is returned.
+// a non-nil error is returned. The last parameter is a set of variadic
+// functional options used to tune the dialer's Config.
+//
+// Should the remote peer close the connection without answering an offer of
+// the extended handshake, as peers predating it do, it's redialed once
+// offering only the original version if allowed by LegacyFallback.
 func Dial(localPriv *koblitz.PrivateKey, ipAddr string, remotePKH string,
-	dialer func(string, string) (net.Conn, error)) (*Conn, error) {
+	dialer func(string, string) (net.Conn, error),
+	options ...func(*Config)) (*Conn, error) {
+
+	if err := validateStaticKey(localPriv); err != nil {
+		return nil, err
+	}
+	cfg := newConfig(options...)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.CircuitBreaker != nil {
+		if err := cfg.CircuitBreaker.allow(remotePKH); err != nil {
+			return nil, err
+		}
+	}
+
 	var conn net.Conn
 	var err error
+	connectStart := time.Now()
 	conn, err = dialer("tcp", ipAddr)
-	logging.Info("ipAddr is ", ipAddr)
+	rtt := time.Since(connectStart)
+	cfg.log().Infof("ipAddr is %s", ipAddr)
 	if err != nil {
+		if cfg.DialStats != nil {
+			cfg.DialStats.record(nil, err)
+		}
 		return nil, err
 	}
 
-	b := &Conn{
-		conn:  conn,
-		noise: NewNoiseMachine(true, localPriv),
+	b, err := upgrade(conn, localPriv, remotePKH, rtt, cfg)
+	if refusal, ok := err.(offerRefusedError); ok {
+		err = refusal.err
+
+		// The peer may predate the extended handshake, so if allowed,
+		// redial offering only the original version, foregoing the
+		// extensions.
+		if cfg.canFallBack() {
+			cfg.log().Warnf("lndc: %s refused handshake version %d, "+
+				"retrying with version %d", ipAddr,
+				ExtendedHandshakeVersion, HandshakeVersion)
+
+			connectStart = time.Now()
+			conn, err = dialer("tcp", ipAddr)
+			if err == nil {
+				b, err = upgrade(conn, localPriv, remotePKH,
+					time.Since(connectStart), cfg,
+					MaxHandshakeVersion(HandshakeVersion))
+			}
+		}
+	}
+	if cfg.CircuitBreaker != nil {
+		cfg.CircuitBreaker.record(remotePKH, err)
+	}
+	if cfg.DialStats != nil {
+		cfg.DialStats.record(b, err)
 	}
 
-	// Initiate the handshake by sending the first act to the receiver.
-	actOne, err := b.noise.GenActOne()
-	if err != nil {
-		b.conn.Close()
-		return nil, err
+	return b, err
+}
+
+// newConn wraps the passed connection and noise machine in a Conn, applying
+// the defaults specified within cfg.
+func newConn(conn net.Conn, noise *Machine, cfg *Config) *Conn {
+	c := &Conn{
+		conn:           conn,
+		noise:          noise,
+		readTimeout:    int64(cfg.ReadTimeout),
+		writeTimeout:   int64(cfg.WriteTimeout),
+		keysExportable: cfg.InsecureExportKeys,
+		logger:         cfg.log(),
+		verbosePeers:   cfg.VerbosePeers,
 	}
-	if _, err := conn.Write(actOne[:]); err != nil {
-		b.conn.Close()
-		return nil, err
+	c.touch()
+
+	// Connections which aren't over TCP have no Nagle's algorithm to
+	// enable, so the error is ignored.
+	if cfg.Nagle {
+		c.SetNoDelay(false)
 	}
 
-	// We'll ensure that we get ActTwo from the remote peer in a timely
-	// manner. If they don't respond within 1s, then we'll kill the
-	// connection.
-	conn.SetReadDeadline(time.Now().Add(handshakeReadTimeout))
+	return c
+}
 
-	// If the first act was successful (we know that address is actually
-	// remotePub), then read the second act after which we'll be able to
-	// send our static public key to the remote peer with strong forward
-	// secrecy.
-	var actTwo [ActTwoSize]byte
-	if _, err := io.ReadFull(conn, actTwo[:]); err != nil {
-		b.conn.Close()
-		return nil, err
+// ErrNotTCP is returned when a TCP specific setting is applied to a Conn
+// which doesn't wrap a TCP connection.
+var ErrNotTCP = errors.New("lndc: underlying connection isn't TCP")
+
+// SetNoDelay controls whether the operating system should delay packet
+// transmission in hopes of sending fewer packets (Nagle's algorithm) on the
+// underlying TCP connection. The default is true (no delay), unless the
+// connection was created with the Nagle option set. ErrNotTCP is returned if
+// the connection doesn't wrap a *net.TCPConn.
+func (c *Conn) SetNoDelay(noDelay bool) error {
+	tcpConn, ok := c.conn.(*net.TCPConn)
+	if !ok {
+		return ErrNotTCP
 	}
-	s, err := b.noise.RecvActTwo(actTwo)
-	if err != nil {
-		b.conn.Close()
-		return nil, err
+
+	return tcpConn.SetNoDelay(noDelay)
+}
+
+// Reset prepares a pooled Conn for reuse with a new session, so that it
+// wraps conn and noise as if it were newly allocated. The passed Machine is
+// expected to have already completed its handshake over conn. All state of
+// the prior session is discarded: buffered plaintext and the key material of
+// the prior Machine are zeroed, and all counters, deadlines and timeouts are
+// cleared. The prior underlying connection isn't closed, and any close hooks
+// registered against it are dropped without being run.
+//
+// NOTE: Reset must not be called concurrently with any other method.
+func (c *Conn) Reset(conn net.Conn, noise *Machine) {
+	if c.noise != nil && c.noise != noise {
+		c.noise.wipe()
 	}
 
-	logging.Info("Received pubkey", s)
-	if lnutil.LitAdrFromPubkey(s) != remotePKH {
-		return nil, fmt.Errorf("Remote PKH doesn't match. Quitting!")
+	buf := c.readBuf.Bytes()
+	buf = buf[:cap(buf)]
+	for i := range buf {
+		buf[i] = 0
+	}
+	c.readBuf.Reset()
+	for i := range c.readScratch {
+		c.readScratch[i] = 0
 	}
-	logging.Infof("Received PKH %s matches", lnutil.LitAdrFromPubkey(s))
+	c.heldMessage = nil
+
+	atomic.StoreUint64(&c.sendNonce, 0)
+	atomic.StoreUint64(&c.recvNonce, 0)
+	c.touch()
+	atomic.StoreInt64(&c.readTimeout, 0)
+	atomic.StoreInt64(&c.writeTimeout, 0)
+	c.keysExportable = false
+	c.localPub = nil
+
+	c.conn = conn
+	c.noise = noise
+
+	c.deadlineMtx.Lock()
+	c.readDeadline = time.Time{}
+	c.writeDeadline = time.Time{}
+	c.readDeadlineSet = nil
+	c.deadlineMtx.Unlock()
+
+	c.listenerID = ""
+	c.seq = 0
+	c.handshakeDuration = 0
+	c.establishedAt = time.Time{}
+	c.priority = 0
+	c.class = ""
+	c.suite = ""
+	c.remoteAdvertisedAddr = ""
+	c.remoteCert = nil
+	c.delegatedPKH = ""
+	c.tee = nil
+	c.logger = nil
+	c.verbosePeers = nil
+
+	c.flowMtx.Lock()
+	c.framed = false
+	c.extendedLength = false
+	c.sequenced = false
+	c.sendSeq = 0
+	c.recvSeq = 0
+	c.remoteHeader = nil
+	c.remoteChainHash = nil
+	c.remoteChannelProof = nil
+	c.pendingWrite = nil
+	c.writeClosed = false
+	c.readEOF = false
+	atomic.StoreInt32(&c.owned, 0)
+	c.sendCredits = 0
+	c.sendWindow = 0
+	c.sendLimited = false
+	c.creditSignal = nil
+	c.recvWindow = 0
+	c.recvOutstanding = 0
+	c.recvConsumed = 0
+	c.pendingCredit = 0
+	c.flowMtx.Unlock()
+
+	c.closeMtx.Lock()
+	c.closed = false
+	c.closeHooks = nil
+	c.closeReason = nil
+	c.pendingTimeout = nil
+	atomic.StoreInt32(&c.timedOut, 0)
+	c.closeMtx.Unlock()
+
+	// Close hooks are dropped without being run, so the send queue must
+	// be stopped explicitly.
+	c.stopSendQueue()
+
+	c.valuesMtx.Lock()
+	c.values = nil
+	c.valuesMtx.Unlock()
+
+	c.pauseMtx.Lock()
+	c.readsPaused = false
+	c.readsResumed = nil
+	c.pauseMtx.Unlock()
+
+	c.snapshotNonces()
+}
 
-	// Finally, complete the handshake by sending over our encrypted static
-	// key and execute the final ECDH operation.
-	actThree, err := b.noise.GenActThree()
-	if err != nil {
-		b.conn.Close()
-		return nil, err
+// SetReadTimeout sets a rolling timeout which is applied as a fresh read
+// deadline each time the connection reads from the network, so that a
+// connection which receives nothing within the timeout fails rather than
+// hanging forever. A zero value disables the rolling timeout, after which
+// only deadlines set explicitly via SetReadDeadline apply.
+func (c *Conn) SetReadTimeout(d time.Duration) {
+	atomic.StoreInt64(&c.readTimeout, int64(d))
+	if d == 0 {
+		c.deadlineMtx.Lock()
+		c.conn.SetReadDeadline(c.readDeadline)
+		c.deadlineMtx.Unlock()
 	}
-	if _, err := conn.Write(actThree[:]); err != nil {
-		b.conn.Close()
-		return nil, err
+}
+
+// SetWriteTimeout sets a rolling timeout which is applied as a fresh write
+// deadline before each write to the network. A zero value disables the
+// rolling timeout, after which only deadlines set explicitly via
+// SetWriteDeadline apply.
+func (c *Conn) SetWriteTimeout(d time.Duration) {
+	atomic.StoreInt64(&c.writeTimeout, int64(d))
+	if d == 0 {
+		c.deadlineMtx.Lock()
+		c.conn.SetWriteDeadline(c.writeDeadline)
+		c.deadlineMtx.Unlock()
 	}
+}
 
-	// We'll reset the deadline as it's no longer critical beyond the
-	// initial handshake.
-	conn.SetReadDeadline(time.Time{})
+// armReadDeadline refreshes the read deadline of the underlying connection
+// if a rolling read timeout is set, without extending it past any deadline
+// set explicitly via SetReadDeadline.
+func (c *Conn) armReadDeadline() {
+	if d := time.Duration(atomic.LoadInt64(&c.readTimeout)); d > 0 {
+		c.deadlineMtx.Lock()
+		c.conn.SetReadDeadline(earliestDeadline(c.readDeadline, d))
+		c.deadlineMtx.Unlock()
+	}
+}
 
-	return b, nil
+// armWriteDeadline refreshes the write deadline of the underlying connection
+// if a rolling write timeout is set, without extending it past any deadline
+// set explicitly via SetWriteDeadline.
+func (c *Conn) armWriteDeadline() {
+	if d := time.Duration(atomic.LoadInt64(&c.writeTimeout)); d > 0 {
+		c.deadlineMtx.Lock()
+		c.conn.SetWriteDeadline(earliestDeadline(c.writeDeadline, d))
+		c.deadlineMtx.Unlock()
+	}
+}
+
+// earliestDeadline returns the earlier of the explicit deadline t and one
+// the rolling timeout d from now, so that neither can loosen the other. A
+// zero t or d imposes no deadline of its own.
+func earliestDeadline(t time.Time, d time.Duration) time.Time {
+	if d <= 0 {
+		return t
+	}
+
+	rolling := time.Now().Add(d)
+	if t.IsZero() || rolling.Before(t) {
+		return rolling
+	}
+
+	return t
 }
 
 // ReadNextMessage uses the connection in a message-oriented instructing it to
 // read the next _full_ message with the lndc stream. This function will
 // block until the read succeeds.
 func (c *Conn) ReadNextMessage() ([]byte, error) {
-	return c.noise.ReadMessage(c.conn)
+	if err := c.waitReadsResumed(); err != nil {
+		return nil, err
+	}
+
+	c.armReadDeadline()
+	msg, err := c.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	c.teeRead(msg)
+	c.consumed(len(msg))
+
+	return msg, nil
 }
 
 // Read reads data from the connection.  Read can be made to time out and
 // return an Error with Timeout() == true after a fixed time limit; see
 // SetDeadline and SetReadDeadline.
 //
+// Messages are only read from the socket and decrypted as Read is called,
+// with at most a single decrypted message buffered, so a slow reader applies
+// TCP backpressure to the remote peer rather than buffering its messages.
+//
 // Part of the net.Conn interface.
 func (c *Conn) Read(b []byte) (n int, err error) {
 	// In order to reconcile the differences between the record abstraction
@@ -123,8 +528,12 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 	// maintain an intermediate read buffer. If this buffer becomes
 	// depleted, then we read the next record, and feed it into the
 	// buffer. Otherwise, we read directly from the buffer.
+	if err := c.waitReadsResumed(); err != nil {
+		return 0, err
+	}
 	if c.readBuf.Len() == 0 {
-		plaintext, err := c.noise.ReadMessage(c.conn)
+		c.armReadDeadline()
+		plaintext, err := c.readMessage()
 		if err != nil {
 			return 0, err
 		}
@@ -134,7 +543,11 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 		}
 	}
 
-	return c.readBuf.Read(b)
+	n, _ = c.readBuf.Read(b)
+	c.teeRead(b[:n])
+	c.consumed(n)
+
+	return n, nil
 }
 
 // Write writes data to the connection.  Write can be made to time out and
@@ -143,15 +556,19 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 //
 // Part of the net.Conn interface.
 func (c *Conn) Write(b []byte) (n int, err error) {
+	c.armWriteDeadline()
+	c.teeWrite(b)
+
 	// If the message doesn't require any chunking, then we can go ahead
 	// with a single write.
-	if len(b) <= math.MaxUint16 {
-		return len(b), c.noise.WriteMessage(c.conn, b)
+	if !c.framed && len(b) <= c.maxPayload() {
+		return len(b), c.writeMessage(b)
 	}
 
 	// If we need to split the message into fragments, then we'll write
-	// chunks which maximize usage of the available payload.
-	chunkSize := math.MaxUint16
+	// chunks which maximize usage of the available payload, as far as the
+	// remote peer's flow control window allows.
+	chunkSize := c.maxPayload()
 
 	bytesToWrite := len(b)
 	bytesWritten := 0
@@ -162,10 +579,20 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 			chunkSize = len(b) - bytesWritten
 		}
 
+		size, err := c.acquireCredits(chunkSize)
+		if err != nil {
+			return bytesWritten, err
+		}
+
 		// Slice off the next chunk to be written based on our running
 		// counter and next chunk size.
-		chunk := b[bytesWritten : bytesWritten+chunkSize]
-		if err := c.noise.WriteMessage(c.conn, chunk); err != nil {
+		chunk := b[bytesWritten : bytesWritten+size]
+		if c.framed {
+			err = c.writeMessage(c.dataFrame(chunk))
+		} else {
+			err = c.writeMessage(chunk)
+		}
+		if err != nil {
 			return bytesWritten, err
 		}
 
@@ -175,12 +602,101 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 	return bytesWritten, nil
 }
 
+// snapshotNonces records the current nonce of the sending cipher so that it
+// can be inspected without racing with writes.
+func (c *Conn) snapshotNonces() {
+	atomic.StoreUint64(&c.sendNonce, c.noise.sendCipher.nonce)
+}
+
+// snapshotRecvNonce records the current nonce of the receiving cipher so
+// that it can be inspected without racing with reads.
+func (c *Conn) snapshotRecvNonce() {
+	atomic.StoreUint64(&c.recvNonce, c.noise.recvCipher.nonce)
+}
+
+// SendNonce returns the nonce the sending cipher will use for the next
+// message written. Nonces count up from zero under each key, and the key is
+// rotated once keyRotationInterval nonces have been used, so a nonce is never
+// reused however long the connection lives.
+func (c *Conn) SendNonce() uint64 {
+	return atomic.LoadUint64(&c.sendNonce)
+}
+
+// RecvNonce returns the nonce the receiving cipher expects for the next
+// message read, which is reset alongside the key as with SendNonce.
+func (c *Conn) RecvNonce() uint64 {
+	return atomic.LoadUint64(&c.recvNonce)
+}
+
+// MessagesUntilRekey returns the number of messages which can be written to
+// the connection before the sending key is next rotated. Each message
+// consumes two nonces, one for its length prefix and one for its body, and
+// the key is rotated every keyRotationInterval nonces. Writes larger than
+// the maximum payload size are split into several messages.
+func (c *Conn) MessagesUntilRekey() int {
+	nonce := atomic.LoadUint64(&c.sendNonce)
+	return int(keyRotationInterval-nonce) / 2
+}
+
+// BytesUntilRekey returns the maximum number of plaintext bytes which can be
+// written to the connection before the sending key is next rotated. Keys are
+// rotated by message count rather than volume, so this assumes every
+// remaining message carries a full payload.
+func (c *Conn) BytesUntilRekey() int {
+	return c.MessagesUntilRekey() * c.noise.maxMessageLength()
+}
+
 // Close closes the connection.  Any blocked Read or Write operations will be
 // unblocked and return errors.
 //
 // Part of the net.Conn interface.
 func (c *Conn) Close() error {
-	return c.conn.Close()
+	c.recordClose()
+	err := c.conn.Close()
+
+	c.closeMtx.Lock()
+	hooks := c.closeHooks
+	alreadyClosed := c.closed
+	c.closed = true
+	c.closeHooks = nil
+	c.closeMtx.Unlock()
+
+	if c.framed {
+		c.wakeWriters()
+	}
+	c.ResumeReads()
+
+	if !alreadyClosed {
+		c.tracef("closed: %v", c.CloseReason())
+		for _, hook := range hooks {
+			hook()
+		}
+	}
+
+	return err
+}
+
+// isClosed reports whether the connection has been closed.
+func (c *Conn) isClosed() bool {
+	c.closeMtx.Lock()
+	defer c.closeMtx.Unlock()
+
+	return c.closed
+}
+
+// onClose registers a callback which is executed once the connection has
+// been closed. If the connection is already closed, the callback is executed
+// immediately.
+func (c *Conn) onClose(hook func()) {
+	c.closeMtx.Lock()
+	if !c.closed {
+		c.closeHooks = append(c.closeHooks, hook)
+		c.closeMtx.Unlock()
+		return
+	}
+	c.closeMtx.Unlock()
+
+	hook()
 }
 
 // LocalAddr returns the local network address.
@@ -203,24 +719,45 @@ func (c *Conn) RemoteAddr() net.Addr {
 //
 // Part of the net.Conn interface.
 func (c *Conn) SetDeadline(t time.Time) error {
-	return c.conn.SetDeadline(t)
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return c.SetWriteDeadline(t)
 }
 
 // SetReadDeadline sets the deadline for future Read calls.  A zero value for t
-// means Read will not time out.
+// means Read will not time out. If a rolling read timeout is set, such as
+// the default of the listener which accepted the connection, the earlier of
+// the two applies, so that the timeout can be tightened but not loosened.
 //
 // Part of the net.Conn interface.
 func (c *Conn) SetReadDeadline(t time.Time) error {
-	return c.conn.SetReadDeadline(t)
+	c.deadlineMtx.Lock()
+	defer c.deadlineMtx.Unlock()
+
+	c.readDeadline = t
+	if c.readDeadlineSet != nil {
+		close(c.readDeadlineSet)
+		c.readDeadlineSet = nil
+	}
+	d := time.Duration(atomic.LoadInt64(&c.readTimeout))
+	return c.conn.SetReadDeadline(earliestDeadline(t, d))
 }
 
 // SetWriteDeadline sets the deadline for future Write calls.  Even if write
 // times out, it may return n > 0, indicating that some of the data was
-// successfully written.  A zero value for t means Write will not time out.
+// successfully written.  A zero value for t means Write will not time out. As
+// with SetReadDeadline, a rolling write timeout can't be loosened by t.
 //
 // Part of the net.Conn interface.
 func (c *Conn) SetWriteDeadline(t time.Time) error {
-	return c.conn.SetWriteDeadline(t)
+	c.deadlineMtx.Lock()
+	defer c.deadlineMtx.Unlock()
+
+	c.writeDeadline = t
+	d := time.Duration(atomic.LoadInt64(&c.writeTimeout))
+	return c.conn.SetWriteDeadline(earliestDeadline(t, d))
 }
 
 // RemotePub returns the remote peer's static public key.
@@ -230,5 +767,48 @@ func (c *Conn) RemotePub() *koblitz.PublicKey {
 
 // LocalPub returns the local peer's static public key.
 func (c *Conn) LocalPub() *koblitz.PublicKey {
+	if c.localPub != nil {
+		return c.localPub
+	}
+
 	return c.noise.localStatic.PubKey()
 }
+
+// HandshakeDuration returns the time taken to carry out the handshake which
+// established this connection.
+func (c *Conn) HandshakeDuration() time.Duration {
+	return c.handshakeDuration
+}
+
+// HandshakeCryptoTime returns the part of HandshakeDuration spent computing
+// the handshake, such as its ECDH operations, rather than waiting on the
+// network or the remote peer.
+func (c *Conn) HandshakeCryptoTime() time.Duration {
+	return c.noise.cryptoTime
+}
+
+// EstablishedAt returns the time at which the handshake which established
+// this connection completed, from when it was usable.
+func (c *Conn) EstablishedAt() time.Time {
+	return c.establishedAt
+}
+
+// established records the completion of the handshake begun at start.
+func (c *Conn) established(start time.Time) {
+	c.establishedAt = time.Now()
+	c.handshakeDuration = c.establishedAt.Sub(start)
+	c.touch()
+}
+
+// ListenerID returns the identifier of the listener which accepted this
+// connection, or an empty string if the connection was dialed.
+func (c *Conn) ListenerID() string {
+	return c.listenerID
+}
+
+// Seq returns the per-listener sequence number assigned to this connection
+// when it was accepted. Sequence numbers start at one and are never reused
+// by a listener, dialed connections always report zero.
+func (c *Conn) Seq() uint64 {
+	return c.seq
+}
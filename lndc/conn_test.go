@@ -0,0 +1,390 @@
+package lndc
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// expectTimeout asserts that err is a net.Error reporting a timeout.
+func expectTimeout(t *testing.T, err error) {
+	netErr, ok := err.(net.Error)
+	if !ok {
+		t.Fatalf("expected a net.Error, got %T: %v", err, err)
+	}
+	if !netErr.Timeout() {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestConnReadTimeout(t *testing.T) {
+	localConn, remoteConn, cleanUp, err := establishTestConnection(false)
+	if err != nil {
+		t.Fatalf("unable to establish test connection: %v", err)
+	}
+	defer cleanUp()
+	local := localConn.(*Conn)
+	remote := remoteConn.(*Conn)
+
+	buf := make([]byte, 64)
+	remote.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = remote.Read(buf)
+	expectTimeout(t, err)
+
+	// Feed a frame onto the wire a few bytes at a time, timing out part
+	// way through both the header and the body. Retrying the read once
+	// the rest arrives must still yield the message.
+	msg := []byte("resumable after timeouts")
+	var frame bytes.Buffer
+	if err := local.noise.WriteMessage(&frame, msg); err != nil {
+		t.Fatalf("unable to encode frame: %v", err)
+	}
+	raw := frame.Bytes()
+	cuts := []int{0, 10, lengthHeaderSize + macSize + 5, len(raw)}
+
+	for i := 1; i < len(cuts); i++ {
+		if _, err := local.conn.Write(raw[cuts[i-1]:cuts[i]]); err != nil {
+			t.Fatalf("unable to write partial frame: %v", err)
+		}
+		if i == len(cuts)-1 {
+			break
+		}
+
+		remote.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, err = remote.Read(buf)
+		expectTimeout(t, err)
+	}
+
+	remote.SetReadDeadline(time.Time{})
+	n, err := remote.Read(buf)
+	if err != nil {
+		t.Fatalf("unable to read after retry: %v", err)
+	}
+	if !bytes.Equal(buf[:n], msg) {
+		t.Fatalf("expected %q, got %q", msg, buf[:n])
+	}
+}
+
+func TestConnUntilRekey(t *testing.T) {
+	localConn, remoteConn, cleanUp, err := establishTestConnection(false)
+	if err != nil {
+		t.Fatalf("unable to establish test connection: %v", err)
+	}
+	defer cleanUp()
+	local := localConn.(*Conn)
+
+	const messagesPerKey = keyRotationInterval / 2
+	if local.MessagesUntilRekey() != messagesPerKey {
+		t.Fatalf("expected %d messages until rekey, got %d",
+			messagesPerKey, local.MessagesUntilRekey())
+	}
+
+	// Drain everything written on the remote end so that writes never
+	// block.
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			if _, err := remoteConn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	msg := []byte("ping")
+	lastMessages := local.MessagesUntilRekey()
+	lastBytes := local.BytesUntilRekey()
+	for i := 0; i < messagesPerKey-1; i++ {
+		if _, err := local.Write(msg); err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+
+		messages, byteCount := local.MessagesUntilRekey(),
+			local.BytesUntilRekey()
+		if messages != lastMessages-1 || byteCount >= lastBytes {
+			t.Fatalf("counters didn't decrement: %d/%d -> %d/%d",
+				lastMessages, lastBytes, messages, byteCount)
+		}
+		lastMessages, lastBytes = messages, byteCount
+	}
+	if lastMessages != 1 {
+		t.Fatalf("expected a single message until rekey, got %d",
+			lastMessages)
+	}
+
+	// The next message triggers the rotation, after which the counters
+	// return to their initial values.
+	if _, err := local.Write(msg); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	if local.MessagesUntilRekey() != messagesPerKey {
+		t.Fatalf("expected counters to reset after rekey, got %d",
+			local.MessagesUntilRekey())
+	}
+}
+
+func TestConnDeadlineComposesWithTimeout(t *testing.T) {
+	listener, pkh := newTestListener(t,
+		WithTimeouts(100*time.Millisecond, 0))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	// A later deadline doesn't loosen the listener's timeout, which
+	// still fires first.
+	local.SetReadDeadline(time.Now().Add(time.Minute))
+	start := time.Now()
+	_, err := local.Read(make([]byte, 64))
+	expectTimeout(t, err)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("read took %v, expected the listener's timeout to "+
+			"apply", elapsed)
+	}
+
+	// An earlier deadline tightens it.
+	local.SetReadTimeout(time.Minute)
+	local.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	start = time.Now()
+	_, err = local.Read(make([]byte, 64))
+	expectTimeout(t, err)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("read took %v, expected the earlier deadline to "+
+			"apply", elapsed)
+	}
+}
+
+func TestConnInheritsReadTimeout(t *testing.T) {
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	listener, err := NewListener(localPriv, 0,
+		WithTimeouts(50*time.Millisecond, 0))
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkhOf(localPriv))
+	defer local.Close()
+	defer remote.Close()
+
+	// With the timeout inherited from the listener, an idle read fails.
+	buf := make([]byte, 64)
+	start := time.Now()
+	_, err = local.Read(buf)
+	expectTimeout(t, err)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("read took %v to time out", elapsed)
+	}
+
+	// The timeout is rolling, so a peer that keeps writing within it
+	// keeps the connection alive.
+	for i := 0; i < 3; i++ {
+		time.Sleep(25 * time.Millisecond)
+		if _, err := remote.Write([]byte("keepalive")); err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+		if _, err := local.Read(buf); err != nil {
+			t.Fatalf("read within the rolling timeout failed: %v", err)
+		}
+	}
+
+	// Once overridden, a read may wait longer than the default.
+	local.SetReadTimeout(0)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		remote.Write([]byte("late"))
+	}()
+	if _, err := local.Read(buf); err != nil {
+		t.Fatalf("read after overriding the timeout failed: %v", err)
+	}
+
+	// The dialer wasn't configured with a timeout.
+	if remote.readTimeout != 0 {
+		t.Fatalf("dialed conn shouldn't inherit the listener's timeout")
+	}
+}
+
+func TestConnReset(t *testing.T) {
+	// Establish a first session with a rolling timeout, close hook and
+	// some buffered plaintext which hasn't been read yet.
+	pooled, firstPeer, _, _ := upgradePipe(t)
+	defer firstPeer.Close()
+
+	pooled.SetReadTimeout(time.Minute)
+	hookRan := false
+	pooled.onClose(func() { hookRan = true })
+
+	go firstPeer.Write([]byte("first session"))
+	buf := make([]byte, 5)
+	if _, err := pooled.Read(buf); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if pooled.readBuf.Len() == 0 {
+		t.Fatalf("expected unread plaintext to be buffered")
+	}
+	firstConn, firstNoise := pooled.conn, pooled.noise
+	defer firstConn.Close()
+
+	// Reuse the pooled Conn for the initiator's side of a fresh session.
+	second, secondPeer, _, _ := upgradePipe(t)
+	defer secondPeer.Close()
+	pooled.Reset(second.conn, second.noise)
+
+	// Nothing of the prior session may remain.
+	if pooled.readBuf.Len() != 0 {
+		t.Fatalf("buffered plaintext survived the reset")
+	}
+	if pooled.readTimeout != 0 || pooled.MessagesUntilRekey() !=
+		keyRotationInterval/2 {
+
+		t.Fatalf("counters survived the reset")
+	}
+	var zero [32]byte
+	for _, key := range [][32]byte{
+		firstNoise.sendCipher.secretKey, firstNoise.recvCipher.secretKey,
+		firstNoise.sendCipher.salt, firstNoise.recvCipher.salt,
+		firstNoise.chainingKey, firstNoise.tempKey,
+	} {
+		if key != zero {
+			t.Fatalf("prior session key material wasn't zeroed")
+		}
+	}
+
+	// The pooled Conn now speaks the second session.
+	msg := []byte("second session")
+	go secondPeer.Write(msg)
+	got := make([]byte, len(msg))
+	if _, err := pooled.Read(got); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("expected %q, got %q", msg, got)
+	}
+
+	go pooled.Write(msg)
+	if _, err := secondPeer.Read(got); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("expected %q, got %q", msg, got)
+	}
+
+	// Closing the reset Conn mustn't run the prior session's hooks.
+	pooled.Close()
+	if hookRan {
+		t.Fatalf("prior session's close hook ran")
+	}
+}
+
+func TestConnSlowReaderBackpressure(t *testing.T) {
+	localConn, remoteConn, cleanUp, err := establishTestConnection(false)
+	if err != nil {
+		t.Fatalf("unable to establish test connection: %v", err)
+	}
+	defer cleanUp()
+	local := localConn.(*Conn)
+	remote := remoteConn.(*Conn)
+
+	// A reader consuming a byte at a time holds at most the message it's
+	// part way through.
+	chunk := bytes.Repeat([]byte("slow"), 1024)
+	buf := make([]byte, 1)
+	remote.Write(chunk)
+	if _, err := local.Read(buf); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if local.readBuf.Len() != len(chunk)-1 {
+		t.Fatalf("expected a single message buffered, got %d bytes",
+			local.readBuf.Len())
+	}
+
+	// Once the socket buffers are full the peer's writes block, rather
+	// than its messages piling up on our side.
+	remote.SetWriteDeadline(time.Now().Add(500 * time.Millisecond))
+	written := 0
+	for {
+		n, err := remote.Write(chunk)
+		written += n
+		if err != nil {
+			expectTimeout(t, err)
+			break
+		}
+		if written > 1<<30 {
+			t.Fatalf("peer's writes never blocked")
+		}
+	}
+	if local.readBuf.Len() != len(chunk)-1 {
+		t.Fatalf("messages were buffered while the reader was idle")
+	}
+}
+
+func TestConnNonces(t *testing.T) {
+	localConn, remoteConn, cleanUp, err := establishTestConnection(false)
+	if err != nil {
+		t.Fatalf("unable to establish test connection: %v", err)
+	}
+	defer cleanUp()
+	local := localConn.(*Conn)
+	remote := remoteConn.(*Conn)
+
+	// Send enough messages for the keys to be rotated several times. The
+	// nonces on either side must track one another, and never reach the
+	// rotation interval, at which the next key starts again from zero.
+	msg := []byte("nonce")
+	buf := make([]byte, len(msg))
+	rotations := 0
+	for i := 0; i < 3*keyRotationInterval/2; i++ {
+		if _, err := local.Write(msg); err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+		if _, err := remote.Read(buf); err != nil {
+			t.Fatalf("unable to read: %v", err)
+		}
+
+		sent, received := local.SendNonce(), remote.RecvNonce()
+		if sent != received {
+			t.Fatalf("send nonce %d doesn't match receive nonce %d",
+				sent, received)
+		}
+		if sent >= keyRotationInterval {
+			t.Fatalf("nonce %d reached the rotation interval", sent)
+		}
+		if sent == 0 {
+			rotations++
+		}
+	}
+	if rotations < 2 {
+		t.Fatalf("expected the keys to be rotated, got %d rotations",
+			rotations)
+	}
+}
+
+func TestConnEstablishedAt(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	before := time.Now()
+	local, remote := dialAndAccept(t, listener, pkh)
+	after := time.Now()
+	defer local.Close()
+	defer remote.Close()
+
+	for _, conn := range []*Conn{local, remote} {
+		established := conn.EstablishedAt()
+		if established.Before(before) || established.After(after) {
+			t.Fatalf("expected conn established between %v and %v, "+
+				"got %v", before, after, established)
+		}
+		if established.Add(-conn.HandshakeDuration()).Before(before) {
+			t.Fatalf("handshake of %v ending at %v began before the "+
+				"dial at %v", conn.HandshakeDuration(), established,
+				before)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package lndc
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/lnutil"
+)
+
+const (
+	// defaultReconnectBackoff is the initial delay between reconnection
+	// attempts made by a ConnManager.
+	defaultReconnectBackoff = time.Second
+
+	// defaultMaxReconnectBackoff is the largest delay between
+	// reconnection attempts made by a ConnManager.
+	defaultMaxReconnectBackoff = time.Minute
+
+	// connStateBuffer is the number of state transitions buffered on a
+	// ConnManager's state channel before new transitions are dropped.
+	connStateBuffer = 16
+)
+
+// ConnState describes the state of the connection maintained by a
+// ConnManager.
+type ConnState uint8
+
+const (
+	// StateConnecting means the manager is dialing the peer.
+	StateConnecting ConnState = iota
+
+	// StateConnected means the manager holds a live connection.
+	StateConnected
+
+	// StateFailed means the last attempt to reach the peer at every known
+	// address failed. The manager will retry after backing off.
+	StateFailed
+
+	// StateStopped means the manager has been stopped and will no longer
+	// reconnect.
+	StateStopped
+)
+
+// String returns a human readable description of the connection state.
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateFailed:
+		return "failed"
+	case StateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnManager maintains a live lndc connection to a single peer identified by
+// its static public key. Whenever the connection is dropped the manager
+// redials the peer, trying each of its known addresses in turn and backing
+// off exponentially between failed rounds.
+//
+// A connection is considered dropped once it has been closed. Callers reading
+// from the connection should close it upon any read error, as is done
+// throughout lit, so that the manager can replace it.
+type ConnManager struct {
+	localStatic *koblitz.PrivateKey
+	remotePub   *koblitz.PublicKey
+	remotePKH   string
+	addrs       []string
+	dialer      func(string, string) (net.Conn, error)
+	options     []func(*Config)
+	cfg         *Config
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// mtx guards conn and state, along with changed, which is closed and
+	// replaced on every transition.
+	mtx     sync.Mutex
+	conn    *Conn
+	state   ConnState
+	changed chan struct{}
+
+	states chan ConnState
+
+	started sync.Once
+	stopped sync.Once
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewConnManager creates a new ConnManager for the peer with the passed
+// static public key, reachable at any of addrs. The manager doesn't dial the
+// peer until Start is called. Any options are passed along to Dial on each
+// connection attempt.
+func NewConnManager(localStatic *koblitz.PrivateKey,
+	remotePub *koblitz.PublicKey, addrs []string,
+	dialer func(string, string) (net.Conn, error),
+	options ...func(*Config)) (*ConnManager, error) {
+
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses to reach peer at")
+	}
+
+	var idPub [33]byte
+	copy(idPub[:], remotePub.SerializeCompressed())
+
+	cfg := newConfig(options...)
+	m := &ConnManager{
+		localStatic: localStatic,
+		remotePub:   remotePub,
+		remotePKH:   lnutil.LitAdrFromPubkey(idPub),
+		addrs:       append([]string(nil), addrs...),
+		dialer:      dialer,
+		options:     options,
+		cfg:         cfg,
+		minBackoff:  cfg.ReconnectBackoff,
+		maxBackoff:  cfg.MaxReconnectBackoff,
+		states:      make(chan ConnState, connStateBuffer),
+		changed:     make(chan struct{}),
+		quit:        make(chan struct{}),
+	}
+	if m.minBackoff <= 0 {
+		m.minBackoff = defaultReconnectBackoff
+	}
+	if m.maxBackoff <= 0 {
+		m.maxBackoff = defaultMaxReconnectBackoff
+	}
+	if m.maxBackoff < m.minBackoff {
+		m.maxBackoff = m.minBackoff
+	}
+
+	return m, nil
+}
+
+// Start launches the goroutine which connects to the peer and keeps it
+// connected.
+func (m *ConnManager) Start() {
+	m.started.Do(func() {
+		m.wg.Add(1)
+		go m.connectionLoop()
+	})
+}
+
+// Stop closes the current connection, if any, and stops the manager from
+// reconnecting. It blocks until the manager's goroutine has exited.
+func (m *ConnManager) Stop() {
+	m.stopped.Do(func() {
+		close(m.quit)
+	})
+	m.wg.Wait()
+}
+
+// Conn returns the current live connection to the peer, or nil if the
+// manager is not currently connected.
+func (m *ConnManager) Conn() *Conn {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return m.conn
+}
+
+// State returns the current state of the managed connection.
+func (m *ConnManager) State() ConnState {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return m.state
+}
+
+// States returns a channel over which every state transition of the manager
+// is delivered. Transitions are dropped if the channel's buffer is full, so
+// consumers that fall behind should consult State for the current value.
+func (m *ConnManager) States() <-chan ConnState {
+	return m.states
+}
+
+// setState records a new state, and the connection that goes along with it,
+// notifying any listener of the transition.
+func (m *ConnManager) setState(state ConnState, conn *Conn) {
+	m.mtx.Lock()
+	m.state = state
+	m.conn = conn
+	close(m.changed)
+	m.changed = make(chan struct{})
+	m.mtx.Unlock()
+
+	select {
+	case m.states <- state:
+	default:
+	}
+}
+
+// nextConn blocks until the manager holds a live connection other than prev,
+// returning it, or nil if quit is closed or the manager is stopped first.
+func (m *ConnManager) nextConn(prev *Conn, quit <-chan struct{}) *Conn {
+	for {
+		m.mtx.Lock()
+		conn, state, changed := m.conn, m.state, m.changed
+		m.mtx.Unlock()
+
+		if conn != nil && conn != prev {
+			return conn
+		}
+		if state == StateStopped {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-quit:
+			return nil
+		}
+	}
+}
+
+// connectionLoop dials the peer and waits for the resulting connection to be
+// dropped before dialing it again.
+//
+// NOTE: This method must be run as a goroutine.
+func (m *ConnManager) connectionLoop() {
+	defer m.wg.Done()
+
+	backoff := m.minBackoff
+	for {
+		m.setState(StateConnecting, nil)
+
+		conn, err := m.dial()
+		if err != nil {
+			m.cfg.log().Infof("lndc: unable to reach peer %s: %v, "+
+				"retrying in %v", m.remotePKH, err, backoff)
+			m.setState(StateFailed, nil)
+
+			if !m.wait(backoff) {
+				m.setState(StateStopped, nil)
+				return
+			}
+
+			backoff *= 2
+			if backoff > m.maxBackoff {
+				backoff = m.maxBackoff
+			}
+			continue
+		}
+		backoff = m.minBackoff
+
+		dropped := make(chan struct{})
+		conn.onClose(func() { close(dropped) })
+		m.setState(StateConnected, conn)
+
+		select {
+		case <-dropped:
+			m.cfg.log().Infof("lndc: connection to peer %s dropped",
+				m.remotePKH)
+		case <-m.quit:
+			conn.Close()
+			m.setState(StateStopped, nil)
+			return
+		}
+
+		// Wait out the minimum backoff before redialing so that a
+		// peer which drops us immediately isn't hammered.
+		m.setState(StateConnecting, nil)
+		if !m.wait(m.minBackoff) {
+			m.setState(StateStopped, nil)
+			return
+		}
+	}
+}
+
+// dial attempts to connect to the peer at each of its addresses in turn,
+// returning the first connection successfully established.
+func (m *ConnManager) dial() (*Conn, error) {
+	var err error
+	for _, addr := range m.addrs {
+		select {
+		case <-m.quit:
+			return nil, errListenerClosed
+		default:
+		}
+
+		var conn *Conn
+		conn, err = Dial(m.localStatic, addr, m.remotePKH, m.dialer,
+			m.options...)
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
+
+// wait blocks for the passed duration, returning false if the manager was
+// stopped in the meantime.
+func (m *ConnManager) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-m.quit:
+		return false
+	}
+}
@@ -0,0 +1,112 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// closedAddr returns a local address which nothing is listening on.
+func closedAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	return addr
+}
+
+// waitForState blocks until the manager reports the target state.
+func waitForState(t *testing.T, m *ConnManager, target ConnState) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case state := <-m.States():
+			if state == target {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for state %v, currently %v",
+				target, m.State())
+		}
+	}
+}
+
+func TestConnManagerReconnects(t *testing.T) {
+	listener, _, _, err := makeListener()
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	// The first address is unreachable, so the manager must fall through
+	// to the listener's real address on every attempt.
+	addrs := []string{closedAddr(t), listener.Addr().String()}
+	m, err := NewConnManager(localPriv, listener.localStatic.PubKey(),
+		addrs, net.Dial,
+		WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unable to create conn manager: %v", err)
+	}
+	m.Start()
+	defer m.Stop()
+
+	var lastConn *Conn
+	for i := 0; i < 3; i++ {
+		accepted, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("unable to accept connection: %v", err)
+		}
+		waitForState(t, m, StateConnected)
+
+		conn := m.Conn()
+		if conn == nil || conn == lastConn {
+			t.Fatalf("expected a fresh connection after drop %d", i)
+		}
+		lastConn = conn
+
+		// Drop the connection from the listener's end. The reader on
+		// the managed side sees the error and closes its end, after
+		// which the manager should reconnect.
+		accepted.Close()
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Fatalf("expected read from dropped conn to fail")
+		}
+		conn.Close()
+		waitForState(t, m, StateConnecting)
+	}
+}
+
+func TestConnManagerFailedState(t *testing.T) {
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	m, err := NewConnManager(localPriv, localPriv.PubKey(),
+		[]string{closedAddr(t)}, net.Dial,
+		WithReconnectBackoff(10*time.Millisecond, 20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unable to create conn manager: %v", err)
+	}
+	m.Start()
+
+	waitForState(t, m, StateFailed)
+	if m.Conn() != nil {
+		t.Fatalf("failed manager shouldn't expose a connection")
+	}
+
+	m.Stop()
+	if m.State() != StateStopped {
+		t.Fatalf("expected stopped state, got %v", m.State())
+	}
+}
@@ -0,0 +1,555 @@
+package lndc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// The handshake and the messages which follow it assume the reliable, ordered
+// delivery of a stream such as TCP. A datagram conn provides such a stream
+// over an unreliable datagram transport, like a UDP based overlay, by carrying
+// the stream in numbered segments which the remote peer acknowledges, and
+// retransmitting those which go unacknowledged. Each datagram holds a single
+// segment: a type byte, followed by an 8-byte big endian sequence number and
+// the segment's payload.
+const (
+	// segmentData carries a chunk of the stream.
+	segmentData byte = 0
+
+	// segmentAck carries, in place of a sequence number, the sequence
+	// number of the next segment the sender expects, acknowledging all
+	// of those which precede it.
+	segmentAck byte = 1
+
+	// segmentFin carries no payload. It marks the end of the stream.
+	segmentFin byte = 2
+)
+
+const (
+	// segmentHeaderSize is the size of the type byte and sequence number
+	// preceding each segment's payload.
+	segmentHeaderSize = 9
+
+	// maxSegmentPayload is the most stream data carried by a segment,
+	// keeping each datagram within the MTU of a typical path.
+	maxSegmentPayload = 1200
+
+	// datagramWindow is the number of segments which may be sent before
+	// the earliest of them is acknowledged. The receiver likewise only
+	// holds segments within this many of the next it expects.
+	datagramWindow = 64
+
+	// datagramReadBuffer is the most data a datagram conn buffers before
+	// it's read. Segments which arrive while the buffer is full aren't
+	// acknowledged, so the sender retransmits them later.
+	datagramReadBuffer = datagramWindow * maxSegmentPayload
+
+	// retransmitTimeout is how long a segment goes unacknowledged before
+	// it's sent again.
+	retransmitTimeout = 200 * time.Millisecond
+
+	// datagramPeerTimeout is how long a segment may go unacknowledged
+	// before the remote peer is deemed lost.
+	datagramPeerTimeout = 30 * time.Second
+
+	// datagramCloseLinger bounds how long Close waits for the remote peer
+	// to acknowledge the segments still in flight.
+	datagramCloseLinger = time.Second
+)
+
+// ErrDatagramPeerLost is returned by a datagram conn once a segment has gone
+// unacknowledged by the remote peer for too long.
+var ErrDatagramPeerLost = errors.New("lndc: datagram peer stopped " +
+	"acknowledging segments")
+
+// errDatagramTimeout is returned by a read or write of a datagram conn which
+// reached its deadline.
+var errDatagramTimeout net.Error = datagramTimeoutError{}
+
+type datagramTimeoutError struct{}
+
+func (datagramTimeoutError) Error() string {
+	return "lndc: datagram conn i/o timeout"
+}
+func (datagramTimeoutError) Timeout() bool   { return true }
+func (datagramTimeoutError) Temporary() bool { return true }
+
+// sentSegment is a segment awaiting acknowledgement by the remote peer.
+type sentSegment struct {
+	seq       uint64
+	datagram  []byte
+	firstSent time.Time
+	lastSent  time.Time
+}
+
+// receivedSegment is a segment received ahead of those preceding it.
+type receivedSegment struct {
+	fin     bool
+	payload []byte
+}
+
+// datagramConn is a reliable, ordered stream carried over an unreliable
+// datagram transport. It's created by NewDatagramConn.
+type datagramConn struct {
+	pc    net.PacketConn
+	raddr net.Addr
+
+	mtx sync.Mutex
+
+	// changed is closed, and replaced, whenever the state guarded by mtx
+	// changes, waking anyone waiting on it.
+	changed chan struct{}
+
+	nextSeq     uint64
+	unacked     []*sentSegment
+	writeClosed bool
+
+	expected   uint64
+	outOfOrder map[uint64]receivedSegment
+	readBuf    bytes.Buffer
+	readEOF    bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	err     error
+	closing bool
+	closed  bool
+	quit    chan struct{}
+}
+
+// A compile-time assertion to ensure that datagramConn meets the net.Conn
+// interface.
+var _ net.Conn = (*datagramConn)(nil)
+
+// NewDatagramConn returns a connection carrying a reliable, ordered stream to
+// the remote peer at raddr over the datagram transport pc, such that the lndc
+// handshake can be run over it by Upgrade or UpgradeInbound. The remote peer
+// must wrap its own socket with NewDatagramConn too, as the datagrams it's
+// sent can only be understood by another datagram conn. Datagrams from any
+// address but raddr are ignored, so pc must be dedicated to this peer, and
+// it's closed along with the connection. Over TCP, which is already
+// reliable, none of this is needed.
+func NewDatagramConn(pc net.PacketConn, raddr net.Addr) net.Conn {
+	c := &datagramConn{
+		pc:         pc,
+		raddr:      raddr,
+		changed:    make(chan struct{}),
+		outOfOrder: make(map[uint64]receivedSegment),
+		quit:       make(chan struct{}),
+	}
+
+	go c.receive()
+	go c.retransmit()
+
+	return c
+}
+
+// broadcast wakes everyone waiting on a change to the connection's state.
+//
+// NOTE: mtx must be held by the caller.
+func (c *datagramConn) broadcast() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// wait releases mtx until the connection's state changes or deadline, if
+// set, passes.
+//
+// NOTE: mtx must be held by the caller.
+func (c *datagramConn) wait(deadline time.Time) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	changed := c.changed
+	c.mtx.Unlock()
+	defer c.mtx.Lock()
+
+	select {
+	case <-changed:
+	case <-timeout:
+	}
+}
+
+// deadlinePassed reports whether deadline is set and has passed.
+func deadlinePassed(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
+// Read reads the next chunk of the stream from the connection.
+//
+// Part of the net.Conn interface.
+func (c *datagramConn) Read(p []byte) (int, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for {
+		switch {
+		case c.readBuf.Len() > 0:
+			n, _ := c.readBuf.Read(p)
+
+			// Room has been made for any segments held back
+			// while the buffer was full.
+			if c.deliver() {
+				c.sendAck()
+			}
+			return n, nil
+
+		case c.readEOF:
+			return 0, io.EOF
+
+		case c.closed:
+			return 0, errConnClosed
+
+		case c.err != nil:
+			return 0, c.err
+
+		case deadlinePassed(c.readDeadline):
+			return 0, errDatagramTimeout
+		}
+
+		c.wait(c.readDeadline)
+	}
+}
+
+// Write writes p to the stream, split into as many segments as needed. It
+// blocks while the window of unacknowledged segments is full.
+//
+// Part of the net.Conn interface.
+func (c *datagramConn) Write(p []byte) (int, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var n int
+	for n < len(p) {
+		if err := c.waitWindow(); err != nil {
+			return n, err
+		}
+
+		chunk := p[n:]
+		if len(chunk) > maxSegmentPayload {
+			chunk = chunk[:maxSegmentPayload]
+		}
+		c.send(segmentData, chunk)
+		n += len(chunk)
+	}
+
+	return n, nil
+}
+
+// waitWindow waits for the window of unacknowledged segments to have room
+// for another.
+//
+// NOTE: mtx must be held by the caller.
+func (c *datagramConn) waitWindow() error {
+	for {
+		switch {
+		case c.closed:
+			return errConnClosed
+
+		case c.writeClosed:
+			return ErrWriteClosed
+
+		case c.err != nil:
+			return c.err
+
+		case len(c.unacked) < datagramWindow:
+			return nil
+
+		case deadlinePassed(c.writeDeadline):
+			return errDatagramTimeout
+		}
+
+		c.wait(c.writeDeadline)
+	}
+}
+
+// send sends a new segment of the passed type, holding on to it until it's
+// acknowledged.
+//
+// NOTE: mtx must be held by the caller.
+func (c *datagramConn) send(segmentType byte, payload []byte) {
+	datagram := make([]byte, segmentHeaderSize+len(payload))
+	datagram[0] = segmentType
+	binary.BigEndian.PutUint64(datagram[1:], c.nextSeq)
+	copy(datagram[segmentHeaderSize:], payload)
+
+	now := time.Now()
+	segment := &sentSegment{
+		seq:       c.nextSeq,
+		datagram:  datagram,
+		firstSent: now,
+		lastSent:  now,
+	}
+	c.nextSeq++
+	c.unacked = append(c.unacked, segment)
+
+	// A datagram which fails to send is as good as lost, and will be
+	// retransmitted all the same.
+	c.pc.WriteTo(datagram, c.raddr)
+}
+
+// sendAck acknowledges every segment preceding the next one expected.
+//
+// NOTE: mtx must be held by the caller.
+func (c *datagramConn) sendAck() {
+	var ack [segmentHeaderSize]byte
+	ack[0] = segmentAck
+	binary.BigEndian.PutUint64(ack[1:], c.expected)
+	c.pc.WriteTo(ack[:], c.raddr)
+}
+
+// receive reads the datagrams sent by the remote peer until the connection
+// is closed.
+//
+// NOTE: This method must be run as a goroutine.
+func (c *datagramConn) receive() {
+	buf := make([]byte, segmentHeaderSize+maxSegmentPayload)
+	for {
+		n, addr, err := c.pc.ReadFrom(buf)
+		if err != nil {
+			c.mtx.Lock()
+			if c.err == nil {
+				c.err = err
+			}
+			c.broadcast()
+			c.mtx.Unlock()
+			return
+		}
+		if n < segmentHeaderSize || addr.String() != c.raddr.String() {
+			continue
+		}
+
+		seq := binary.BigEndian.Uint64(buf[1:segmentHeaderSize])
+		c.mtx.Lock()
+		c.received(buf[0], seq, buf[segmentHeaderSize:n])
+		c.mtx.Unlock()
+	}
+}
+
+// received processes a segment sent by the remote peer.
+//
+// NOTE: mtx must be held by the caller.
+func (c *datagramConn) received(segmentType byte, seq uint64,
+	payload []byte) {
+
+	switch segmentType {
+	case segmentAck:
+		c.acknowledged(seq)
+
+	case segmentData, segmentFin:
+		// Segments already delivered are acknowledged once more, as
+		// the earlier acknowledgement may have been lost.
+		_, held := c.outOfOrder[seq]
+		if !held && seq >= c.expected && seq < c.expected+datagramWindow {
+			c.outOfOrder[seq] = receivedSegment{
+				fin:     segmentType == segmentFin,
+				payload: append([]byte(nil), payload...),
+			}
+			c.deliver()
+		}
+		c.sendAck()
+	}
+}
+
+// deliver moves the segments received in order into the read buffer, while
+// it has room for them, reporting whether any were.
+//
+// NOTE: mtx must be held by the caller.
+func (c *datagramConn) deliver() bool {
+	var delivered bool
+	for c.readBuf.Len() < datagramReadBuffer {
+		segment, ok := c.outOfOrder[c.expected]
+		if !ok {
+			break
+		}
+		delete(c.outOfOrder, c.expected)
+		c.expected++
+		delivered = true
+
+		if segment.fin {
+			c.readEOF = true
+			continue
+		}
+		c.readBuf.Write(segment.payload)
+	}
+
+	if delivered {
+		c.broadcast()
+	}
+
+	return delivered
+}
+
+// acknowledged releases the segments preceding ack, which the remote peer has
+// received.
+//
+// NOTE: mtx must be held by the caller.
+func (c *datagramConn) acknowledged(ack uint64) {
+	var n int
+	for n < len(c.unacked) && c.unacked[n].seq < ack {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	c.unacked = c.unacked[n:]
+	c.broadcast()
+}
+
+// retransmit resends the segments which have gone unacknowledged for longer
+// than retransmitTimeout, until the connection is closed.
+//
+// NOTE: This method must be run as a goroutine.
+func (c *datagramConn) retransmit() {
+	ticker := time.NewTicker(retransmitTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			c.mtx.Lock()
+			c.retransmitAt(now)
+			c.mtx.Unlock()
+
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// retransmitAt resends the segments due to be retransmitted at now, failing
+// the connection if the remote peer appears to be lost.
+//
+// NOTE: mtx must be held by the caller.
+func (c *datagramConn) retransmitAt(now time.Time) {
+	if c.err != nil || len(c.unacked) == 0 {
+		return
+	}
+	if now.Sub(c.unacked[0].firstSent) > datagramPeerTimeout {
+		c.err = ErrDatagramPeerLost
+		c.broadcast()
+		return
+	}
+
+	for _, segment := range c.unacked {
+		if now.Sub(segment.lastSent) < retransmitTimeout {
+			continue
+		}
+		segment.lastSent = now
+		c.pc.WriteTo(segment.datagram, c.raddr)
+	}
+}
+
+// CloseWrite ends the stream, so that the remote peer's reads return io.EOF
+// once it has read everything written before. The connection can still be
+// read from, until Close is called.
+func (c *datagramConn) CloseWrite() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.closing {
+		return errConnClosed
+	}
+	if !c.writeClosed {
+		c.send(segmentFin, nil)
+		c.writeClosed = true
+		c.broadcast()
+	}
+
+	return nil
+}
+
+// Close ends the stream, waiting up to datagramCloseLinger for the remote
+// peer to acknowledge everything written, then closes the datagram
+// transport.
+//
+// Part of the net.Conn interface.
+func (c *datagramConn) Close() error {
+	c.mtx.Lock()
+	if c.closing {
+		c.mtx.Unlock()
+		return nil
+	}
+	c.closing = true
+	if !c.writeClosed {
+		c.send(segmentFin, nil)
+		c.writeClosed = true
+	}
+
+	linger := time.Now().Add(datagramCloseLinger)
+	for len(c.unacked) > 0 && c.err == nil && !deadlinePassed(linger) {
+		c.wait(linger)
+	}
+
+	c.closed = true
+	close(c.quit)
+	c.broadcast()
+	c.mtx.Unlock()
+
+	return c.pc.Close()
+}
+
+// LocalAddr returns the local address of the datagram transport.
+//
+// Part of the net.Conn interface.
+func (c *datagramConn) LocalAddr() net.Addr {
+	return c.pc.LocalAddr()
+}
+
+// RemoteAddr returns the address of the remote peer.
+//
+// Part of the net.Conn interface.
+func (c *datagramConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// SetDeadline sets both the read and write deadlines.
+//
+// Part of the net.Conn interface.
+func (c *datagramConn) SetDeadline(t time.Time) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.broadcast()
+
+	return nil
+}
+
+// SetReadDeadline sets the deadline for reads from the stream.
+//
+// Part of the net.Conn interface.
+func (c *datagramConn) SetReadDeadline(t time.Time) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.readDeadline = t
+	c.broadcast()
+
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for writes blocked on a full window.
+//
+// Part of the net.Conn interface.
+func (c *datagramConn) SetWriteDeadline(t time.Time) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.writeDeadline = t
+	c.broadcast()
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package lndc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyPacketConn simulates an unreliable network, dropping, duplicating and
+// reordering the datagrams written to the wrapped connection.
+type lossyPacketConn struct {
+	net.PacketConn
+
+	mtx  sync.Mutex
+	rand *rand.Rand
+	held []byte
+}
+
+func newLossyPacketConn(t *testing.T, seed int64) *lossyPacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+
+	return &lossyPacketConn{PacketConn: pc, rand: rand.New(rand.NewSource(seed))}
+}
+
+func (l *lossyPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	switch roll := l.rand.Intn(10); {
+	// Drop one in five datagrams.
+	case roll < 2:
+		return len(p), nil
+
+	// Duplicate one in ten.
+	case roll < 3:
+		l.PacketConn.WriteTo(p, addr)
+
+	// Hold back one in ten until after the next datagram is sent.
+	case roll < 4 && l.held == nil:
+		l.held = append([]byte(nil), p...)
+		return len(p), nil
+	}
+
+	n, err := l.PacketConn.WriteTo(p, addr)
+	if l.held != nil {
+		l.PacketConn.WriteTo(l.held, addr)
+		l.held = nil
+	}
+
+	return n, err
+}
+
+// lossyPair returns a pair of datagram conns linked over a lossy network.
+func lossyPair(t *testing.T) (net.Conn, net.Conn) {
+	a, b := newLossyPacketConn(t, 1), newLossyPacketConn(t, 2)
+
+	return NewDatagramConn(a, b.LocalAddr()),
+		NewDatagramConn(b, a.LocalAddr())
+}
+
+func TestDatagramConnLossy(t *testing.T) {
+	a, b := lossyPair(t)
+	defer a.Close()
+	defer b.Close()
+
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	writeErr := make(chan error, 1)
+	go func() {
+		if _, err := a.Write(data); err != nil {
+			writeErr <- err
+			return
+		}
+		writeErr <- a.(*datagramConn).CloseWrite()
+	}()
+
+	b.SetReadDeadline(time.Now().Add(30 * time.Second))
+	got, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatalf("unable to read stream: %v", err)
+	}
+	if err := <-writeErr; err != nil {
+		t.Fatalf("unable to write stream: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("stream corrupted: read %d of %d bytes", len(got),
+			len(data))
+	}
+}
+
+func TestDatagramConnHandshake(t *testing.T) {
+	a, b := lossyPair(t)
+
+	localPriv, remotePriv := newKey(t), newKey(t)
+	type result struct {
+		conn *Conn
+		err  error
+	}
+	inbound := make(chan result, 1)
+	go func() {
+		conn, err := UpgradeInbound(b, localPriv)
+		inbound <- result{conn, err}
+	}()
+
+	remote, err := Upgrade(a, remotePriv, pkhOf(localPriv))
+	if err != nil {
+		t.Fatalf("unable to upgrade outbound: %v", err)
+	}
+	defer remote.Close()
+
+	res := <-inbound
+	if res.err != nil {
+		t.Fatalf("unable to upgrade inbound: %v", res.err)
+	}
+	local := res.conn
+	defer local.Close()
+
+	for i := 0; i < 10; i++ {
+		roundTrip(t, local, remote)
+	}
+}
+
+func TestDatagramConnDeadline(t *testing.T) {
+	a, b := lossyPair(t)
+	defer a.Close()
+	defer b.Close()
+
+	b.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := b.Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !lit_debug
+// +build !lit_debug
+
+package lndc
+
+// debugBuild reports whether this binary was built with the lit_debug tag,
+// which enables checks against misuse such as claiming a Conn's ownership
+// twice.
+const debugBuild = false
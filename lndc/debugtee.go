@@ -0,0 +1,90 @@
+package lndc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+// errDebugTeeBuild is returned when a DebugTee is configured within a binary
+// that wasn't built with the lit_insecure tag.
+var errDebugTeeBuild = errors.New("lndc: DebugTee requires a binary built " +
+	"with the lit_insecure tag")
+
+// DebugTee copies the decrypted traffic of a sample of a listener's accepted
+// connections to a debug sink. Each record written to the sink is a header
+// line of the form "<listener id> <seq> <sent|received> <length>" followed
+// by that many bytes of plaintext.
+//
+// WARNING: The sink receives the plaintext of every message exchanged over
+// the sampled connections. It's intended purely for debugging, and so only
+// works in binaries built with the lit_insecure tag. In any other binary a
+// listener configured with a DebugTee fails to be created.
+type DebugTee struct {
+	// Writer is the sink to which the traffic is copied. Writes to it
+	// are serialized.
+	Writer io.Writer
+
+	// Rate is the fraction of accepted connections which are sampled,
+	// between 0 and 1.
+	Rate float64
+
+	mtx sync.Mutex
+}
+
+// WithDebugTee is a functional option that copies the decrypted traffic of
+// the passed fraction of a listener's accepted connections to w.
+func WithDebugTee(w io.Writer, rate float64) func(*Config) {
+	return func(c *Config) {
+		c.DebugTee = &DebugTee{Writer: w, Rate: rate}
+	}
+}
+
+// validate ensures the tee may be used within this binary.
+func (t *DebugTee) validate() error {
+	if !insecureBuild {
+		return errDebugTeeBuild
+	}
+	if t.Rate < 0 || t.Rate > 1 {
+		return fmt.Errorf("lndc: DebugTee rate %v not within [0, 1]",
+			t.Rate)
+	}
+
+	return nil
+}
+
+// sample decides whether a newly accepted connection should be teed.
+func (t *DebugTee) sample() bool {
+	return rand.Float64() < t.Rate
+}
+
+// record writes a single record of traffic to the sink. Errors are ignored
+// so that the sink never affects the connection.
+func (t *DebugTee) record(c *Conn, dir Direction, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	fmt.Fprintf(t.Writer, "%s %d %v %d\n", c.listenerID, c.seq, dir,
+		len(data))
+	t.Writer.Write(data)
+}
+
+// teeRead copies data read from the connection to its tee, if it has one.
+func (c *Conn) teeRead(data []byte) {
+	if c.tee != nil {
+		c.tee.record(c, DirectionReceived, data)
+	}
+}
+
+// teeWrite copies data written to the connection to its tee, if it has one.
+func (c *Conn) teeWrite(data []byte) {
+	if c.tee != nil {
+		c.tee.record(c, DirectionSent, data)
+	}
+}
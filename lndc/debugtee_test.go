@@ -0,0 +1,70 @@
+//go:build lit_insecure
+// +build lit_insecure
+
+package lndc
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer which is safe for concurrent use.
+type syncBuffer struct {
+	mtx sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.buf.String()
+}
+
+func TestDebugTee(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		sampled bool
+	}{
+		{name: "sampled", rate: 1, sampled: true},
+		{name: "unsampled", rate: 0, sampled: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &syncBuffer{}
+			listener, pkh := newTestListener(t,
+				WithDebugTee(sink, test.rate))
+			defer listener.Close()
+
+			local, remote := dialAndAccept(t, listener, pkh)
+			defer local.Close()
+			defer remote.Close()
+			roundTrip(t, local, remote)
+
+			// roundTrip sends 100 bytes from the accepted conn,
+			// then 100 bytes back to it.
+			expected := fmt.Sprintf("%s %d sent 100\n%s",
+				listener.ID(), local.Seq(), bytes.Repeat([]byte{1}, 100))
+			expected += fmt.Sprintf("%s %d received 100\n%s",
+				listener.ID(), local.Seq(), bytes.Repeat([]byte{2}, 100))
+			if !test.sampled {
+				expected = ""
+			}
+			if sink.String() != expected {
+				t.Fatalf("expected sink to hold %q, got %q",
+					expected, sink.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package lndc
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// ErrDuplicateConn is returned by Dial, and by the Accept of a listener,
+// when a connection is closed as it duplicates one already established with
+// the same peer.
+var ErrDuplicateConn = errors.New("lndc: duplicate connection to peer")
+
+// ConnRegistry tracks the connections a node has established with each of
+// its peers, whether dialed or accepted, so that duplicates are resolved.
+// When two nodes dial each other at once, each ends up with two connections
+// to the other. Both sides then keep the connection dialed by whichever of
+// the two has the lower static public key and close the other, so that
+// they agree on which survives without any further coordination. A single
+// ConnRegistry should be shared by all of a node's listeners and dials via
+// the WithConnRegistry option.
+type ConnRegistry struct {
+	mtx   sync.Mutex
+	conns map[[33]byte]*Conn
+}
+
+// NewConnRegistry returns an empty ConnRegistry.
+func NewConnRegistry() *ConnRegistry {
+	return &ConnRegistry{
+		conns: make(map[[33]byte]*Conn),
+	}
+}
+
+// Conn returns the connection held with the peer whose identity is
+// remotePub, or nil if there is none.
+func (r *ConnRegistry) Conn(remotePub *koblitz.PublicKey) *Conn {
+	var key [33]byte
+	copy(key[:], remotePub.SerializeCompressed())
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.conns[key]
+}
+
+// register records a newly established connection. If one is already held
+// with the same peer, the loser of the two is closed. ErrDuplicateConn is
+// returned if that's the new connection, which the caller must close.
+func (r *ConnRegistry) register(conn *Conn) error {
+	key := peerKey(conn)
+
+	r.mtx.Lock()
+	existing := r.conns[key]
+	if existing != nil && !prefers(conn, existing) {
+		r.mtx.Unlock()
+		return ErrDuplicateConn
+	}
+	r.conns[key] = conn
+	r.mtx.Unlock()
+
+	conn.onClose(func() {
+		r.mtx.Lock()
+		if r.conns[key] == conn {
+			delete(r.conns, key)
+		}
+		r.mtx.Unlock()
+	})
+	if existing != nil {
+		existing.Close()
+	}
+
+	return nil
+}
+
+// prefers reports whether the new connection conn should replace existing,
+// a connection with the same peer. The connection dialed by the side with
+// the lower static public key is kept, or if both were made in the same
+// direction, the existing one.
+func prefers(conn, existing *Conn) bool {
+	if conn.noise.initiator == existing.noise.initiator {
+		return false
+	}
+
+	localLower := bytes.Compare(conn.LocalPub().SerializeCompressed(),
+		conn.RemotePub().SerializeCompressed()) < 0
+
+	return conn.noise.initiator == localLower
+}
+
+// registerConn records conn within the configured ConnRegistry, if any.
+func (c *Config) registerConn(conn *Conn) error {
+	if c.ConnRegistry == nil {
+		return nil
+	}
+
+	return c.ConnRegistry.register(conn)
+}
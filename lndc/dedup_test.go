@@ -0,0 +1,165 @@
+package lndc
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// dedupNode is one side of a simultaneous connect, collecting every
+// connection it ends up with.
+type dedupNode struct {
+	key       *koblitz.PrivateKey
+	registry  *ConnRegistry
+	transport *Transport
+	listener  *Listener
+
+	mtx   sync.Mutex
+	conns []*Conn
+}
+
+func newDedupNode(t *testing.T) *dedupNode {
+	n := &dedupNode{key: newKey(t), registry: NewConnRegistry()}
+	n.transport = NewTransport(n.key, net.Dial,
+		WithConnRegistry(n.registry))
+
+	listener, err := n.transport.Listen(0)
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	n.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if listener.isClosed() {
+				return
+			}
+			if err == nil {
+				n.add(conn.(*Conn))
+			}
+		}
+	}()
+
+	return n
+}
+
+func (n *dedupNode) add(conn *Conn) {
+	n.mtx.Lock()
+	n.conns = append(n.conns, conn)
+	n.mtx.Unlock()
+}
+
+// open returns the node's connections which haven't been closed.
+func (n *dedupNode) open() []*Conn {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	var open []*Conn
+	for _, conn := range n.conns {
+		if !conn.isClosed() {
+			open = append(open, conn)
+		}
+	}
+
+	return open
+}
+
+func (n *dedupNode) close() {
+	n.listener.Close()
+	for _, conn := range n.open() {
+		conn.Close()
+	}
+}
+
+func TestSimultaneousConnect(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		a, b := newDedupNode(t), newDedupNode(t)
+		defer a.close()
+		defer b.close()
+
+		// Each node dials the other at the same time.
+		var wg sync.WaitGroup
+		for _, pair := range [][2]*dedupNode{{a, b}, {b, a}} {
+			from, to := pair[0], pair[1]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn, err := from.transport.Dial(
+					to.listener.Addr().String(), to.key.PubKey())
+				if err == nil {
+					from.add(conn)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// Both sides settle on the same single connection.
+		deadline := time.Now().Add(5 * time.Second)
+		for len(a.open()) != 1 || len(b.open()) != 1 ||
+			a.open()[0].LocalAddr().String() !=
+				b.open()[0].RemoteAddr().String() {
+
+			if time.Now().After(deadline) {
+				t.Fatalf("expected a single shared connection, "+
+					"got %d and %d", len(a.open()), len(b.open()))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		survivor := a.open()[0]
+		if a.registry.Conn(b.key.PubKey()) != survivor {
+			t.Fatalf("expected the registry to hold the survivor")
+		}
+
+		// The survivor was dialed by the node with the lower key.
+		aLower := bytes.Compare(a.key.PubKey().SerializeCompressed(),
+			b.key.PubKey().SerializeCompressed()) < 0
+		if survivor.noise.initiator != aLower {
+			t.Fatalf("expected the connection dialed by the lower " +
+				"key to survive")
+		}
+		roundTrip(t, survivor, b.open()[0])
+	}
+}
+
+func TestConnRegistryUnregisters(t *testing.T) {
+	registry := NewConnRegistry()
+	listener, pkh := newTestListener(t, WithConnRegistry(registry))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer remote.Close()
+	if registry.Conn(remote.LocalPub()) != local {
+		t.Fatalf("expected accepted conn to be registered")
+	}
+
+	// A second connection in the same direction is the duplicate.
+	duplicate, err := Upgrade(mustDial(t, listener),
+		remote.noise.localStatic, pkh)
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	defer duplicate.Close()
+	if _, err := listener.Accept(); err != ErrDuplicateConn {
+		t.Fatalf("expected %v, got %v", ErrDuplicateConn, err)
+	}
+
+	local.Close()
+	if registry.Conn(remote.LocalPub()) != nil {
+		t.Fatalf("expected closed conn to be unregistered")
+	}
+}
+
+// mustDial opens a raw TCP connection to the listener.
+func mustDial(t *testing.T, listener *Listener) net.Conn {
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+
+	return conn
+}
@@ -0,0 +1,115 @@
+package lndc
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/lnutil"
+)
+
+// ErrNoAddrs is returned by DialBest when it's given no addresses to dial.
+var ErrNoAddrs = errors.New("lndc: no addresses to dial")
+
+// dialResult is the outcome of one of the dials raced by DialBest.
+type dialResult struct {
+	conn *Conn
+	err  error
+}
+
+// DialBest dials every one of addrs concurrently, such as the clearnet and
+// onion addresses advertised by a single peer, and returns the first
+// connection whose handshake with remotePub completes. The other dials are
+// then aborted, and any connection which completes regardless is closed. If
+// every dial fails, the error of the first to fail is returned, while if ctx
+// is done first, its error is.
+func DialBest(ctx context.Context, localStatic *koblitz.PrivateKey,
+	addrs []string, remotePub *koblitz.PublicKey,
+	options ...func(*Config)) (*Conn, error) {
+
+	if len(addrs) == 0 {
+		return nil, ErrNoAddrs
+	}
+
+	var idPub [33]byte
+	copy(idPub[:], remotePub.SerializeCompressed())
+	remotePKH := lnutil.LitAdrFromPubkey(idPub)
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	results := make(chan dialResult, len(addrs))
+	for _, addr := range addrs {
+		addr := addr
+		go func() {
+			conn, err := dialContext(raceCtx, localStatic, addr,
+				remotePKH, options...)
+			results <- dialResult{conn, err}
+		}()
+	}
+
+	var firstErr error
+	for i := range addrs {
+		result := <-results
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+
+		// Abort the dials still racing, closing any which complete
+		// before noticing.
+		cancel()
+		go func(remaining int) {
+			for ; remaining > 0; remaining-- {
+				if loser := <-results; loser.err == nil {
+					loser.conn.Close()
+				}
+			}
+		}(len(addrs) - i - 1)
+
+		return result.conn, nil
+	}
+	cancel()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return nil, firstErr
+}
+
+// dialContext dials the peer at addr as Dial does, abandoning both the
+// connection attempt and the handshake should ctx be done first.
+func dialContext(ctx context.Context, localStatic *koblitz.PrivateKey,
+	addr, remotePKH string, options ...func(*Config)) (*Conn, error) {
+
+	// Once connected, the connection is closed should ctx be done before
+	// the handshake completes, unblocking it.
+	done := make(chan struct{})
+	defer close(done)
+	dialer := func(network, address string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-done:
+			}
+		}()
+
+		return conn, nil
+	}
+
+	conn, err := Dial(localStatic, addr, remotePKH, dialer, options...)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return conn, err
+}
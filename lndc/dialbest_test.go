@@ -0,0 +1,103 @@
+package lndc
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialBest(t *testing.T) {
+	listenerPriv := newKey(t)
+	listener, err := NewListener(listenerPriv, 0)
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if listener.isClosed() {
+				return
+			}
+			if err == nil {
+				defer conn.Close()
+			}
+		}
+	}()
+
+	// The slow address accepts connections but never answers act one.
+	slow, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer slow.Close()
+	stalled := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := slow.Accept(); err == nil {
+			stalled <- conn
+		}
+	}()
+
+	addrs := []string{slow.Addr().String(), closedAddr(t),
+		listener.Addr().String()}
+	start := time.Now()
+	conn, err := DialBest(context.Background(), newKey(t), addrs,
+		listenerPriv.PubKey())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if elapsed := time.Since(start); elapsed > handshakeReadTimeout/2 {
+		t.Fatalf("dial took %v, expected the fast address to win",
+			elapsed)
+	}
+	if conn.RemoteAddr().(*net.TCPAddr).Port != listener.Port() ||
+		!conn.RemotePub().IsEqual(listenerPriv.PubKey()) {
+
+		t.Fatalf("expected the fast address to win, got %v",
+			conn.RemoteAddr())
+	}
+
+	// The stalled handshake with the slow address was aborted, closing
+	// its connection once act one was sent.
+	select {
+	case stalledConn := <-stalled:
+		defer stalledConn.Close()
+		stalledConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := ioutil.ReadAll(stalledConn); err != nil {
+			t.Fatalf("expected the slow dial to be aborted, got %v",
+				err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("slow address was never dialed")
+	}
+}
+
+func TestDialBestAllFail(t *testing.T) {
+	_, err := DialBest(context.Background(), newKey(t),
+		[]string{closedAddr(t), closedAddr(t)}, newKey(t).PubKey())
+	if err == nil {
+		t.Fatalf("expected dial to fail")
+	}
+
+	_, err = DialBest(context.Background(), newKey(t), nil,
+		newKey(t).PubKey())
+	if err != ErrNoAddrs {
+		t.Fatalf("expected ErrNoAddrs, got %v", err)
+	}
+
+	// A dial abandoned by the caller returns the context's error.
+	slow, cleanup := silentListener(t)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+	_, err = DialBest(ctx, newKey(t), []string{slow.Addr().String()},
+		newKey(t).PubKey())
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package lndc
+
+import (
+	"sync"
+	"time"
+)
+
+// DialStats collects the outcomes of the outbound connections made by Dial,
+// along with the time taken by their handshakes. A single DialStats can be
+// shared by any number of dials via the WithDialStats option.
+type DialStats struct {
+	mtx           sync.Mutex
+	attempted     uint64
+	succeeded     uint64
+	failed        uint64
+	handshakeTime time.Duration
+	cryptoTime    time.Duration
+}
+
+// NewDialStats returns an empty DialStats.
+func NewDialStats() *DialStats {
+	return &DialStats{}
+}
+
+// record registers the outcome of a dial. conn is the established
+// connection, or nil if the dial failed.
+func (s *DialStats) record(conn *Conn, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.attempted++
+	if err != nil {
+		s.failed++
+		return
+	}
+
+	s.succeeded++
+	s.handshakeTime += conn.handshakeDuration
+	s.cryptoTime += conn.HandshakeCryptoTime()
+}
+
+// Attempted returns the number of outbound connections attempted.
+func (s *DialStats) Attempted() uint64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.attempted
+}
+
+// Succeeded returns the number of outbound connections which completed the
+// handshake.
+func (s *DialStats) Succeeded() uint64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.succeeded
+}
+
+// Failed returns the number of outbound connections which either couldn't be
+// made or failed the handshake.
+func (s *DialStats) Failed() uint64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.failed
+}
+
+// AverageHandshake returns the mean time taken by the handshakes of the
+// outbound connections which succeeded, or zero if none have.
+func (s *DialStats) AverageHandshake() time.Duration {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.succeeded == 0 {
+		return 0
+	}
+
+	return s.handshakeTime / time.Duration(s.succeeded)
+}
+
+// AverageHandshakeCrypto returns the mean time spent computing the handshakes
+// of the outbound connections which succeeded, apart from waiting on the
+// network, or zero if none have.
+func (s *DialStats) AverageHandshakeCrypto() time.Duration {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.succeeded == 0 {
+		return 0
+	}
+
+	return s.cryptoTime / time.Duration(s.succeeded)
+}
@@ -0,0 +1,63 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDialStats(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	stats := NewDialStats()
+
+	// Two dials succeed.
+	for i := 0; i < 2; i++ {
+		local, remote := dialAndAccept(t, listener, pkh,
+			WithDialStats(stats))
+		local.Close()
+		remote.Close()
+	}
+
+	// One fails the handshake, as the listener's key doesn't match.
+	key, wrongPKH := newKey(t), pkhOf(newKey(t))
+	dialErr := make(chan error, 1)
+	go func() {
+		_, err := Dial(key, listener.Addr().String(), wrongPKH,
+			net.Dial, WithDialStats(stats))
+		dialErr <- err
+	}()
+	listener.Accept()
+	if err := <-dialErr; err == nil {
+		t.Fatalf("expected the dial to fail")
+	}
+
+	// And one can't connect at all.
+	unused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	unusedAddr := unused.Addr().String()
+	unused.Close()
+	if _, err := Dial(key, unusedAddr, pkh, net.Dial,
+		WithDialStats(stats)); err == nil {
+
+		t.Fatalf("expected the dial to fail")
+	}
+
+	if stats.Attempted() != 4 || stats.Succeeded() != 2 ||
+		stats.Failed() != 2 {
+
+		t.Fatalf("expected 4 attempted, 2 succeeded and 2 failed, got "+
+			"%d, %d and %d", stats.Attempted(), stats.Succeeded(),
+			stats.Failed())
+	}
+	if stats.AverageHandshake() <= 0 {
+		t.Fatalf("expected an average handshake time")
+	}
+	crypto := stats.AverageHandshakeCrypto()
+	if crypto <= 0 || crypto > stats.AverageHandshake() {
+		t.Fatalf("expected average crypto time within the handshake "+
+			"time of %v, got %v", stats.AverageHandshake(), crypto)
+	}
+}
@@ -0,0 +1,72 @@
+package lndc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// ErrDraining is returned by a read from a connection whose remote peer has
+// announced that it's shutting down, so that channels and routes relying on
+// it can be moved elsewhere in the meantime. Unlike the other errors carried
+// by control frames, the connection remains usable and reads after it carry
+// on as normal.
+type ErrDraining struct {
+	// In is the delay after which the peer expects to close the
+	// connection.
+	In time.Duration
+}
+
+// Error returns a description of the peer's shutdown.
+func (e ErrDraining) Error() string {
+	return fmt.Sprintf("lndc: peer draining, going away in %v", e.In)
+}
+
+// NotifyDraining tells the remote peer that the connection will be closed
+// after in, which it surfaces from its next read as an ErrDraining. The
+// delay is sent with a resolution of seconds. Over a connection which didn't
+// negotiate frames the notice can't be delivered, so ErrFramesUnsupported is
+// returned.
+func (c *Conn) NotifyDraining(in time.Duration) error {
+	if !c.framed {
+		return ErrFramesUnsupported
+	}
+
+	seconds := (in + time.Second - 1) / time.Second
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], uint32(seconds))
+
+	c.armWriteDeadline()
+	return c.writeFrame(frameDraining, payload[:])
+}
+
+// NotifyDraining sends each of the listener's established connections a
+// notice, via the connection's NotifyDraining, that it will be closed after
+// in. It's intended to be called ahead of a graceful shutdown, leaving the
+// peers time to react before the connections are closed. The number of
+// peers notified is returned; those which didn't negotiate frames, or whose
+// notice couldn't be written, are skipped.
+func (l *Listener) NotifyDraining(in time.Duration) int {
+	notified := 0
+	for _, conn := range l.Conns() {
+		if err := conn.NotifyDraining(in); err != nil {
+			l.cfg.log().Debugf("lndc listener %s: unable to notify "+
+				"conn %d of draining: %v", l.id, conn.seq, err)
+			continue
+		}
+		notified++
+	}
+
+	return notified
+}
+
+// decodeDraining parses the payload of a draining frame into the
+// ErrDraining to be returned to the reader.
+func decodeDraining(payload []byte) error {
+	if len(payload) != 4 {
+		return ErrMalformedFrame
+	}
+	seconds := binary.BigEndian.Uint32(payload)
+
+	return ErrDraining{In: time.Duration(seconds) * time.Second}
+}
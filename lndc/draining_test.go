@@ -0,0 +1,41 @@
+package lndc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListenerNotifyDraining(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	var peers []*Conn
+	for i := 0; i < 3; i++ {
+		local, remote := dialAndAccept(t, listener, pkh,
+			WithFlowWindow(1024))
+		defer local.Close()
+		defer remote.Close()
+		peers = append(peers, remote)
+	}
+
+	// A peer which didn't negotiate frames can't be notified.
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	if n := listener.NotifyDraining(90 * time.Second); n != len(peers) {
+		t.Fatalf("expected %d peers notified, got %d", len(peers), n)
+	}
+
+	expected := ErrDraining{In: 90 * time.Second}
+	for i, peer := range peers {
+		if _, err := peer.Read(make([]byte, 1)); err != expected {
+			t.Fatalf("peer %d: expected %v, got %v", i, expected, err)
+		}
+	}
+
+	// The connections stay usable until they're closed.
+	for i, conn := range listener.Conns()[:len(peers)] {
+		roundTrip(t, conn, peers[i])
+	}
+}
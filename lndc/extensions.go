@@ -0,0 +1,460 @@
+package lndc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Once the extended handshake version has been negotiated, each side sends
+// a single encrypted hello message straight after act three. A hello is a
+// series of records, each consisting of a 2-byte type, a 2-byte length and
+// then the value itself, sorted in ascending order of type. The initiator
+// sends its hello first, offering the extensions it has configured, after
+// which the responder answers with a hello of its own.
+const (
+	// recordCipherSuites carries the comma separated cipher suites
+	// offered by the initiator in order of preference, and the single
+	// suite selected by the responder.
+	recordCipherSuites uint16 = 1
+
+	// recordAdvertisedAddr carries the address at which the sender can
+	// be reached, as set by its AdvertisedAddr.
+	recordAdvertisedAddr uint16 = 2
+
+	// recordFlowWindow carries the sender's 4-byte big endian receive
+	// window, or zero if it's unlimited. Its presence signals support
+	// for frames, which are enabled if both sides send it.
+	recordFlowWindow uint16 = 3
+
+	// recordCertificate carries the certificate delegating the sender's
+	// root identity to the static key used for the handshake.
+	recordCertificate uint16 = 4
+
+	// recordExtendedLength carries no value. Its presence signals
+	// support for 4-byte length prefixes, which are used once both sides
+	// send it.
+	recordExtendedLength uint16 = 5
+
+	// recordHeader carries the sender's LocalHeader.
+	recordHeader uint16 = 6
+
+	// recordChainHash carries the 32-byte genesis hash of the chain the
+	// sender is running on.
+	recordChainHash uint16 = 7
+
+	// recordSequenceNumbers carries no value. Its presence signals
+	// support for sequence numbers within data frames, which are used
+	// once both sides send it.
+	recordSequenceNumbers uint16 = 8
+
+	// recordChannelProof carries the initiator's ChannelProof.
+	recordChannelProof uint16 = 9
+)
+
+// ErrMalformedHello is returned when the hello message sent by the remote
+// peer after an extended handshake can't be parsed.
+var ErrMalformedHello = errors.New("lndc: malformed hello message")
+
+// hello maps the type of each record within a hello message to its value.
+type hello map[uint16][]byte
+
+// encode serializes the hello's records in ascending order of type.
+func (h hello) encode() []byte {
+	types := make([]int, 0, len(h))
+	for t := range h {
+		types = append(types, int(t))
+	}
+	sort.Ints(types)
+
+	var buf []byte
+	for _, t := range types {
+		value := h[uint16(t)]
+
+		var header [4]byte
+		binary.BigEndian.PutUint16(header[:2], uint16(t))
+		binary.BigEndian.PutUint16(header[2:], uint16(len(value)))
+		buf = append(buf, header[:]...)
+		buf = append(buf, value...)
+	}
+
+	return buf
+}
+
+// decodeHello parses a hello message, ensuring that its records are sorted
+// in strictly ascending order of type and that none runs past the end of the
+// message.
+func decodeHello(b []byte) (hello, error) {
+	h := make(hello)
+	var last int = -1
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, ErrMalformedHello
+		}
+
+		t := binary.BigEndian.Uint16(b[:2])
+		length := int(binary.BigEndian.Uint16(b[2:4]))
+		if int(t) <= last || len(b) < 4+length {
+			return nil, ErrMalformedHello
+		}
+
+		h[t] = b[4 : 4+length]
+		last = int(t)
+		b = b[4+length:]
+	}
+
+	return h, nil
+}
+
+// extension is an optional feature of the handshake which is negotiated
+// through the hello messages.
+type extension struct {
+	// name identifies the extension to callers introspecting which are
+	// supported.
+	name string
+
+	// record is the hello record type used by the extension.
+	record uint16
+
+	// enabled reports whether the extension is configured, in which case
+	// an initiator offers the extended handshake version.
+	enabled func(cfg *Config) bool
+
+	// secure marks an extension guarding the connection's security,
+	// rather than merely tuning it, which a dialer must never forego by
+	// falling back to the original handshake.
+	secure bool
+
+	// offer returns the value of the initiator's record, or nil if the
+	// record should be omitted.
+	offer func(c *Conn, cfg *Config) []byte
+
+	// answer is called by the responder with the initiator's record,
+	// which is nil if it was omitted, and returns the value of the
+	// responder's record, or nil if it should be omitted.
+	answer func(c *Conn, cfg *Config, offer []byte) ([]byte, error)
+
+	// accept is called by the initiator with the responder's record,
+	// which is nil if it was omitted.
+	accept func(c *Conn, cfg *Config, answer []byte) error
+
+	// verify, if set, is called on both sides once the hellos have been
+	// exchanged, before any finish, failing the handshake if it returns
+	// an error. Unlike an error from answer, this allows the responder
+	// to send its hello before rejecting the initiator, so that both
+	// sides learn why the handshake failed.
+	verify func(c *Conn, cfg *Config) error
+
+	// finish, if set, is called on both sides once the hellos have been
+	// exchanged.
+	finish func(c *Conn)
+}
+
+// extensions are all of the handshake extensions known to the package.
+var extensions = []extension{
+	{
+		name:    "cipher-suites",
+		record:  recordCipherSuites,
+		enabled: func(cfg *Config) bool { return len(cfg.CipherSuites) > 0 },
+		secure:  true,
+		offer:   offerCipherSuites,
+		answer:  answerCipherSuites,
+		accept:  acceptCipherSuite,
+		finish:  finishCipherSuite,
+	},
+	{
+		name:    "advertised-addr",
+		record:  recordAdvertisedAddr,
+		enabled: func(cfg *Config) bool { return cfg.AdvertisedAddr != "" },
+		offer:   offerAdvertisedAddr,
+		answer:  answerAdvertisedAddr,
+		accept:  acceptAdvertisedAddr,
+	},
+	{
+		name:    "flow-window",
+		record:  recordFlowWindow,
+		enabled: func(cfg *Config) bool { return cfg.FlowWindow > 0 },
+		offer:   offerFlowWindow,
+		answer:  answerFlowWindow,
+		accept:  acceptFlowWindow,
+	},
+	{
+		name:   "certificate",
+		record: recordCertificate,
+		enabled: func(cfg *Config) bool {
+			return cfg.Certificate != nil || cfg.AcceptCertificates
+		},
+		secure: true,
+		offer:  offerCertificate,
+		answer: answerCertificate,
+		accept: acceptCertificate,
+	},
+	{
+		name:    "extended-length",
+		record:  recordExtendedLength,
+		enabled: func(cfg *Config) bool { return cfg.ExtendedLength },
+		offer:   offerExtendedLength,
+		answer:  answerExtendedLength,
+		accept:  acceptExtendedLength,
+		finish:  finishExtendedLength,
+	},
+	{
+		name:    "header",
+		record:  recordHeader,
+		enabled: func(cfg *Config) bool { return cfg.LocalHeader != nil },
+		offer:   offerHeader,
+		answer:  answerHeader,
+		accept:  acceptHeader,
+	},
+	{
+		name:    "chain-hash",
+		record:  recordChainHash,
+		enabled: func(cfg *Config) bool { return cfg.ChainHash != nil },
+		secure:  true,
+		offer:   offerChainHash,
+		answer:  answerChainHash,
+		accept:  acceptChainHash,
+		verify:  verifyChainHash,
+	},
+	{
+		name:    "sequence-numbers",
+		record:  recordSequenceNumbers,
+		enabled: func(cfg *Config) bool { return cfg.SequenceNumbers },
+		secure:  true,
+		offer:   offerSequenceNumbers,
+		answer:  answerSequenceNumbers,
+		accept:  acceptSequenceNumbers,
+	},
+	{
+		name:    "channel-proof",
+		record:  recordChannelProof,
+		enabled: func(cfg *Config) bool { return cfg.ChannelProof != nil },
+		secure:  true,
+		offer:   offerChannelProof,
+		answer:  answerChannelProof,
+		accept:  acceptChannelProof,
+	},
+}
+
+// SupportedExtensions returns the names of all of the handshake extensions
+// known to the package, in the order of their hello records. Whether each
+// is used with a given peer is negotiated during the extended handshake.
+func SupportedExtensions() []string {
+	names := make([]string, 0, len(extensions))
+	for _, ext := range extensions {
+		names = append(names, ext.name)
+	}
+
+	return names
+}
+
+// enabledExtensions returns the names of the extensions configured within
+// the config, which an initiator offers to the remote peer.
+func (c *Config) enabledExtensions() []string {
+	var names []string
+	for _, ext := range extensions {
+		if ext.enabled(c) {
+			names = append(names, ext.name)
+		}
+	}
+
+	return names
+}
+
+// smallBufferSize is the size at which message buffers are first allocated
+// if SmallBuffers is set, which fits the hello messages and most control
+// frames without growing.
+const smallBufferSize = 512
+
+// machineOptions returns the options used to create the noise machine for
+// one side of a handshake. A responder always supports the extended
+// handshake, while an initiator only offers it if it has an extension
+// configured or requires its peers to support it, so that it otherwise
+// remains compatible with peers that predate it.
+func (c *Config) machineOptions(initiator bool) []func(*Machine) {
+	var options []func(*Machine)
+	if c.SmallBuffers {
+		options = append(options, InitialBufferSize(smallBufferSize))
+	}
+
+	if !initiator || c.MinPeerVersion >= ExtendedHandshakeVersion {
+		return append(options,
+			MaxHandshakeVersion(ExtendedHandshakeVersion))
+	}
+
+	for _, ext := range extensions {
+		if ext.enabled(c) {
+			return append(options,
+				MaxHandshakeVersion(ExtendedHandshakeVersion))
+		}
+	}
+
+	return options
+}
+
+// canFallBack reports whether a dialer refused an offer of the extended
+// handshake may redial offering only the original version. It must have
+// opted in with LegacyFallback, mustn't require the extended handshake, and
+// mustn't have configured any extension guarding the connection's security.
+func (c *Config) canFallBack() bool {
+	if !c.LegacyFallback || c.MinPeerVersion >= ExtendedHandshakeVersion {
+		return false
+	}
+
+	for _, ext := range extensions {
+		if ext.secure && ext.enabled(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// exchangeHello carries out the exchange of hello messages which follows an
+// extended handshake. It's a no-op if an earlier version was negotiated.
+func exchangeHello(c *Conn, cfg *Config, initiator bool) error {
+	if c.noise.Version() < ExtendedHandshakeVersion {
+		return nil
+	}
+
+	if initiator {
+		offer := make(hello)
+		for _, ext := range extensions {
+			if value := ext.offer(c, cfg); value != nil {
+				offer[ext.record] = value
+			}
+		}
+		if err := c.noise.WriteMessage(c.conn, offer.encode()); err != nil {
+			return err
+		}
+
+		msg, err := c.noise.ReadMessage(c.conn)
+		if err != nil {
+			return err
+		}
+		answer, err := decodeHello(msg)
+		if err != nil {
+			return err
+		}
+		for _, ext := range extensions {
+			if err := ext.accept(c, cfg, answer[ext.record]); err != nil {
+				return err
+			}
+		}
+	} else {
+		msg, err := c.noise.ReadMessage(c.conn)
+		if err != nil {
+			return err
+		}
+		offer, err := decodeHello(msg)
+		if err != nil {
+			return err
+		}
+
+		answer := make(hello)
+		for _, ext := range extensions {
+			value, err := ext.answer(c, cfg, offer[ext.record])
+			if err != nil {
+				return err
+			}
+			if value != nil {
+				answer[ext.record] = value
+			}
+		}
+		if err := c.noise.WriteMessage(c.conn, answer.encode()); err != nil {
+			return err
+		}
+	}
+
+	for _, ext := range extensions {
+		if ext.verify == nil {
+			continue
+		}
+		if err := ext.verify(c, cfg); err != nil {
+			return err
+		}
+	}
+
+	for _, ext := range extensions {
+		if ext.finish != nil {
+			ext.finish(c)
+		}
+	}
+
+	return nil
+}
+
+// offerCipherSuites offers the initiator's configured cipher suites.
+func offerCipherSuites(c *Conn, cfg *Config) []byte {
+	if len(cfg.CipherSuites) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(cfg.CipherSuites, ","))
+}
+
+// answerCipherSuites selects the first of the initiator's cipher suites which
+// the responder also supports, falling back to CipherSuiteChaChaPoly if there
+// is none. A responder without any configured cipher suites only supports
+// CipherSuiteChaChaPoly.
+func answerCipherSuites(c *Conn, cfg *Config, offer []byte) ([]byte, error) {
+	if offer == nil {
+		return nil, nil
+	}
+
+	supported := cfg.CipherSuites
+	if len(supported) == 0 {
+		supported = []string{CipherSuiteChaChaPoly}
+	}
+
+	c.suite = CipherSuiteChaChaPoly
+	for _, suite := range strings.Split(string(offer), ",") {
+		if containsSuite(supported, suite) {
+			c.suite = suite
+			break
+		}
+	}
+
+	return []byte(c.suite), nil
+}
+
+// acceptCipherSuite ensures the responder selected either one of the offered
+// cipher suites or the default.
+func acceptCipherSuite(c *Conn, cfg *Config, answer []byte) error {
+	if answer == nil {
+		return nil
+	}
+
+	suite := string(answer)
+	if suite != CipherSuiteChaChaPoly && !containsSuite(cfg.CipherSuites, suite) {
+		return fmt.Errorf("lndc: peer selected cipher suite %q which "+
+			"wasn't offered", suite)
+	}
+	c.suite = suite
+
+	return nil
+}
+
+// finishCipherSuite switches both directions of the connection over to the
+// negotiated cipher suite.
+func finishCipherSuite(c *Conn) {
+	if c.suite == "" || c.suite == CipherSuiteChaChaPoly {
+		return
+	}
+
+	c.noise.sendCipher.switchSuite(c.suite)
+	c.noise.recvCipher.switchSuite(c.suite)
+}
+
+// containsSuite reports whether suite is within suites.
+func containsSuite(suites []string, suite string) bool {
+	for _, s := range suites {
+		if s == suite {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,101 @@
+package lndc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// FailureResponse governs what, if anything, a listener tells a dialer whose
+// handshake it refuses before closing the connection.
+type FailureResponse int
+
+const (
+	// FailureSilent closes the connection without sending anything, so
+	// that a dialer can't tell why it was refused, nor indeed that it
+	// reached an lndc listener at all.
+	FailureSilent FailureResponse = iota
+
+	// FailureHint sends a single byte in place of act two before closing
+	// the connection, telling the dialer whether it was refused by
+	// policy, such as a ban, or because its act one couldn't be
+	// authenticated.
+	FailureHint
+)
+
+// String returns the name of the response.
+func (r FailureResponse) String() string {
+	switch r {
+	case FailureSilent:
+		return "silent"
+	case FailureHint:
+		return "hint"
+	default:
+		return fmt.Sprintf("FailureResponse(%d)", int(r))
+	}
+}
+
+// The bytes sent under FailureHint. A byte is a short read of act two, so it
+// can't be confused with a responder carrying on with the handshake.
+const (
+	hintRefused    byte = 1
+	hintAuthFailed byte = 2
+)
+
+// hintLinger bounds how long a listener waits for the dialer to read a hint
+// and close the connection. Closing the connection while bytes the dialer
+// sent are unread would reset it, which may discard the hint.
+const hintLinger = time.Second
+
+// hintDrainLimit is the most a listener reads from a dialer while lingering
+// after sending a hint.
+const hintDrainLimit = 4096
+
+// ErrHandshakeRefused is returned by a dialer when the listener hinted that
+// it refused the handshake by policy, such as because the dialer is banned,
+// scored below the minimum reputation or omitted a required proof of work.
+var ErrHandshakeRefused = errors.New("lndc: handshake refused by listener")
+
+// ErrHandshakeAuthFailed is returned by a dialer when the listener hinted
+// that it couldn't authenticate act one, as when the dialer expects the wrong
+// static key for the listener.
+var ErrHandshakeAuthFailed = errors.New("lndc: listener couldn't " +
+	"authenticate act one")
+
+// rejectHandshake sends hint to the dialer over conn if the FailureHint
+// response is configured, waiting briefly for the dialer to hang up so that
+// the hint isn't lost as the connection is closed. Only failures detected
+// before act two is sent are hinted.
+func (c *Config) rejectHandshake(conn net.Conn, hint byte) {
+	if c.FailureResponse != FailureHint {
+		return
+	}
+
+	timer := newHandshakeTimer(conn)
+	defer timer.stop()
+	timer.reset(hintLinger)
+
+	if _, err := conn.Write([]byte{hint}); err != nil {
+		return
+	}
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+	io.CopyN(ioutil.Discard, conn, hintDrainLimit)
+}
+
+// hintError returns the error corresponding to the hint byte sent by a
+// listener in place of act two, or err if the byte isn't a known hint.
+func hintError(hint byte, err error) error {
+	switch hint {
+	case hintRefused:
+		return ErrHandshakeRefused
+	case hintAuthFailed:
+		return ErrHandshakeAuthFailed
+	default:
+		return err
+	}
+}
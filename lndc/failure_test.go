@@ -0,0 +1,104 @@
+package lndc
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialBanned dials a listener banning loopback IPs under the passed failure
+// response, returning the error the dialer sees.
+func dialBanned(t *testing.T, response FailureResponse) error {
+	bans := &testBanList{ips: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}}
+	listener, pkh := newTestListener(t, WithBanList(bans),
+		WithFailureResponse(response))
+	defer listener.Close()
+
+	key := newKey(t)
+	dialErr := make(chan error, 1)
+	go func() {
+		_, err := Dial(key, listener.Addr().String(), pkh, net.Dial)
+		dialErr <- err
+	}()
+
+	if _, err := listener.Accept(); err == nil {
+		t.Fatalf("expected banned peer to be refused")
+	}
+
+	select {
+	case err := <-dialErr:
+		if err == nil {
+			t.Fatalf("expected banned dial to fail")
+		}
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("banned dial didn't fail")
+		return nil
+	}
+}
+
+func TestFailureResponseSilent(t *testing.T) {
+	err := dialBanned(t, FailureSilent)
+	if err == ErrHandshakeRefused || err == ErrHandshakeAuthFailed {
+		t.Fatalf("expected no hint, got %v", err)
+	}
+}
+
+func TestFailureResponseHintRefused(t *testing.T) {
+	if err := dialBanned(t, FailureHint); err != ErrHandshakeRefused {
+		t.Fatalf("expected ErrHandshakeRefused, got %v", err)
+	}
+}
+
+func TestFailureResponseHintAuthFailed(t *testing.T) {
+	for _, response := range []FailureResponse{FailureSilent, FailureHint} {
+		response := response
+		t.Run(response.String(), func(t *testing.T) {
+			listener, _ := newTestListener(t,
+				WithFailureResponse(response))
+			defer listener.Close()
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatalf("unable to dial: %v", err)
+			}
+			defer conn.Close()
+
+			machine := NewNoiseMachine(true, newKey(t))
+			actOne, err := machine.GenActOne()
+			if err != nil {
+				t.Fatalf("unable to generate act one: %v", err)
+			}
+			actOne[ActOneSize-1] ^= 0xff
+			if _, err := conn.Write(actOne[:]); err != nil {
+				t.Fatalf("unable to write act one: %v", err)
+			}
+
+			go listener.Accept()
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var actTwo [ActTwoSize]byte
+			n, err := io.ReadFull(conn, actTwo[:])
+			if err == nil {
+				t.Fatalf("expected act one to be refused")
+			}
+
+			switch response {
+			case FailureSilent:
+				if n != 0 {
+					t.Fatalf("expected nothing, got %x", actTwo[:n])
+				}
+			case FailureHint:
+				if n != 1 || actTwo[0] != hintAuthFailed {
+					t.Fatalf("expected auth failure hint, got %x",
+						actTwo[:n])
+				}
+				if hintError(actTwo[0], err) != ErrHandshakeAuthFailed {
+					t.Fatalf("hint not mapped to " +
+						"ErrHandshakeAuthFailed")
+				}
+			}
+		})
+	}
+}
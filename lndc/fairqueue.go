@@ -0,0 +1,133 @@
+package lndc
+
+import (
+	"net"
+	"sync"
+)
+
+// queuedConn is a connection accepted from the network which is waiting for
+// a handshake slot.
+type queuedConn struct {
+	conn net.Conn
+	seq  uint64
+}
+
+// fairQueue holds the connections waiting for a handshake slot, queued by
+// source IP. Slots are handed out round robin across the sources rather than
+// in the order connections arrived, so that a single source opening
+// connections rapidly can't starve the others. As the peer's identity isn't
+// known until the handshake is complete, sources are told apart by IP alone.
+type fairQueue struct {
+	mtx     sync.Mutex
+	sources map[string][]queuedConn
+	order   []string
+	queued  int
+	limit   int
+	closed  bool
+
+	// perSource, if non-zero, caps the number of connections queued from
+	// any single source.
+	perSource int
+
+	// ready is notified whenever a connection is queued.
+	ready chan struct{}
+}
+
+// newFairQueue returns a fairQueue holding at most limit connections in
+// total, and at most perSource from any single source unless it's zero.
+func newFairQueue(limit, perSource int) *fairQueue {
+	return &fairQueue{
+		sources:   make(map[string][]queuedConn),
+		limit:     limit,
+		perSource: perSource,
+		ready:     make(chan struct{}, 1),
+	}
+}
+
+// sourceOf returns the key used to group connections by their source.
+func sourceOf(conn net.Conn) string {
+	if ip := remoteIP(conn.RemoteAddr()); ip != nil {
+		return ip.String()
+	}
+
+	return conn.RemoteAddr().String()
+}
+
+// push queues a connection, returning false if it was instead closed as the
+// queue, or the queue of its source, is full or the queue has been closed.
+func (q *fairQueue) push(conn net.Conn, seq uint64) bool {
+	source := sourceOf(conn)
+
+	q.mtx.Lock()
+	if q.closed || q.queued >= q.limit ||
+		(q.perSource > 0 && len(q.sources[source]) >= q.perSource) {
+
+		q.mtx.Unlock()
+		conn.Close()
+		return false
+	}
+
+	if len(q.sources[source]) == 0 {
+		q.order = append(q.order, source)
+	}
+	q.sources[source] = append(q.sources[source], queuedConn{conn, seq})
+	q.queued++
+	q.mtx.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// pop blocks until a connection is queued, returning the oldest connection
+// of the source which has gone the longest without being served. False is
+// returned if quit is closed first.
+func (q *fairQueue) pop(quit <-chan struct{}) (queuedConn, bool) {
+	for {
+		q.mtx.Lock()
+		if len(q.order) > 0 {
+			source := q.order[0]
+			q.order = q.order[1:]
+
+			pending := q.sources[source]
+			next := pending[0]
+			if len(pending) > 1 {
+				q.sources[source] = pending[1:]
+				q.order = append(q.order, source)
+			} else {
+				delete(q.sources, source)
+			}
+			q.queued--
+			q.mtx.Unlock()
+
+			return next, true
+		}
+		q.mtx.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-quit:
+			return queuedConn{}, false
+		}
+	}
+}
+
+// close closes all of the queued connections, along with any pushed from
+// here on.
+func (q *fairQueue) close() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.closed = true
+	for _, pending := range q.sources {
+		for _, p := range pending {
+			p.conn.Close()
+		}
+	}
+	q.sources = make(map[string][]queuedConn)
+	q.order = nil
+	q.queued = 0
+}
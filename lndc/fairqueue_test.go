@@ -0,0 +1,137 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// dialFrom dials the listener from the passed local IP, skipping the test if
+// the address can't be bound.
+func dialFrom(t *testing.T, listener *Listener, ip string) func(string,
+	string) (net.Conn, error) {
+
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+	probe, err := dialer.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Skipf("unable to dial from %v: %v", ip, err)
+	}
+	probe.Close()
+	if _, err := listener.Accept(); err == nil {
+		t.Fatalf("expected the probe to be rejected")
+	}
+
+	return dialer.Dial
+}
+
+func TestListenerFairQueueing(t *testing.T) {
+	const (
+		floods = 10
+		stall  = 150 * time.Millisecond
+	)
+
+	listener, pkh := newTestListener(t, WithMaxHandshakes(1))
+	defer listener.Close()
+	addr := listener.Addr().String()
+
+	flood := dialFrom(t, listener, "127.0.0.2")
+	var quiet []func(string, string) (net.Conn, error)
+	for _, ip := range []string{"127.0.0.3", "127.0.0.4"} {
+		quiet = append(quiet, dialFrom(t, listener, ip))
+	}
+
+	// A single source opens a burst of connections, each of which holds
+	// its handshake slot for a while once it's served.
+	for i := 0; i < floods; i++ {
+		conn, err := flood("tcp", addr)
+		if err != nil {
+			t.Fatalf("unable to dial: %v", err)
+		}
+		defer conn.Close()
+
+		actOne, err := NewNoiseMachine(true, newKey(t)).GenActOne()
+		if err != nil {
+			t.Fatalf("unable to generate act one: %v", err)
+		}
+		if _, err := conn.Write(actOne[:]); err != nil {
+			t.Fatalf("unable to write act one: %v", err)
+		}
+		go func() {
+			var actTwo [ActTwoSize]byte
+			conn.Read(actTwo[:])
+			time.Sleep(stall)
+			conn.Close()
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Peers on other sources arriving afterwards needn't wait for the
+	// whole burst to be served.
+	start := time.Now()
+	dialed := make(chan error, 2)
+	for _, dial := range quiet {
+		dial, key := dial, newKey(t)
+		go func() {
+			conn, err := Dial(key, addr, pkh, dial)
+			if err == nil {
+				conn.Close()
+			}
+			dialed <- err
+		}()
+	}
+
+	accepted := 0
+	for accepted < 2 {
+		conn, err := listener.Accept()
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		accepted++
+	}
+	if elapsed := time.Since(start); elapsed > floods*stall/2 {
+		t.Fatalf("quiet peers waited %v behind the burst", elapsed)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-dialed; err != nil {
+			t.Fatalf("unable to dial: %v", err)
+		}
+	}
+}
+
+func TestFairQueuePerSource(t *testing.T) {
+	// Pipes share a single source, as would the peers reached through
+	// a reverse proxy.
+	push := func(q *fairQueue) (bool, net.Conn) {
+		local, remote := net.Pipe()
+		return q.push(local, 0), remote
+	}
+
+	// By default, a source may queue up to the overall limit.
+	q := newFairQueue(32, 0)
+	for i := 0; i < 32; i++ {
+		if ok, _ := push(q); !ok {
+			t.Fatalf("connection %d from a single source dropped", i)
+		}
+	}
+	if ok, _ := push(q); ok {
+		t.Fatalf("connection beyond the overall limit queued")
+	}
+	q.close()
+
+	// While with a cap, connections beyond it are closed.
+	q = newFairQueue(32, 2)
+	defer q.close()
+	for i := 0; i < 2; i++ {
+		if ok, _ := push(q); !ok {
+			t.Fatalf("connection %d within the cap dropped", i)
+		}
+	}
+	ok, remote := push(q)
+	if ok {
+		t.Fatalf("connection beyond the per source cap queued")
+	}
+	if _, err := remote.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected the dropped connection to be closed")
+	}
+}
@@ -0,0 +1,30 @@
+package lndc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// fingerprintSize is the number of bytes of the hash kept by Fingerprint.
+const fingerprintSize = 8
+
+// Fingerprint returns a short hex encoded hash of the connection's local and
+// remote static public keys and the time its handshake completed, by which
+// the connection can be told apart in log lines and metrics without quoting
+// either key in full. It's stable for the lifetime of the connection, but as
+// each side completes the handshake at its own time, the two ends of a
+// connection have different fingerprints.
+func (c *Conn) Fingerprint() string {
+	h := sha256.New()
+	h.Write(c.LocalPub().SerializeCompressed())
+	if remote := c.RemotePub(); remote != nil {
+		h.Write(remote.SerializeCompressed())
+	}
+
+	var at [8]byte
+	binary.BigEndian.PutUint64(at[:], uint64(c.establishedAt.UnixNano()))
+	h.Write(at[:])
+
+	return hex.EncodeToString(h.Sum(nil)[:fingerprintSize])
+}
@@ -0,0 +1,48 @@
+package lndc
+
+import (
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	// Connections between the same pair of peers are told apart by when
+	// they were established.
+	key := newKey(t)
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		local, remote := dialAndAcceptWithKey(t, listener, pkh, key)
+		defer local.Close()
+		defer remote.Close()
+
+		fingerprint := local.Fingerprint()
+		if len(fingerprint) != 2*fingerprintSize {
+			t.Fatalf("expected a %d character fingerprint, got %q",
+				2*fingerprintSize, fingerprint)
+		}
+
+		// The fingerprint is unaffected by the connection's use.
+		roundTrip(t, local, remote)
+		if local.Fingerprint() != fingerprint {
+			t.Fatalf("fingerprint changed from %s to %s", fingerprint,
+				local.Fingerprint())
+		}
+
+		for _, f := range []string{fingerprint, remote.Fingerprint()} {
+			if seen[f] {
+				t.Fatalf("fingerprint %s repeated", f)
+			}
+			seen[f] = true
+		}
+	}
+
+	// As are those with other peers.
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+	if seen[local.Fingerprint()] || seen[remote.Fingerprint()] {
+		t.Fatalf("fingerprint repeated across peers")
+	}
+}
@@ -0,0 +1,323 @@
+package lndc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ErrFlowControlViolation is returned when the remote peer sends more data
+// than the receive window advertised to it allows.
+var ErrFlowControlViolation = errors.New("lndc: peer overran its flow " +
+	"control window")
+
+// ErrExceedsFlowWindow is returned by WriteMessageWithAAD when the message is
+// larger than the remote peer's whole receive window, so could never be sent
+// in one piece.
+var ErrExceedsFlowWindow = errors.New("lndc: message exceeds the remote " +
+	"peer's flow control window")
+
+// errCreditTimeout is returned by a Write which timed out while blocked
+// waiting for the remote peer to replenish the flow control window.
+var errCreditTimeout net.Error = creditTimeoutError{}
+
+type creditTimeoutError struct{}
+
+func (creditTimeoutError) Error() string {
+	return "lndc: write timed out awaiting flow control credits"
+}
+func (creditTimeoutError) Timeout() bool   { return true }
+func (creditTimeoutError) Temporary() bool { return true }
+
+// errConnClosed is returned by a Write which was blocked awaiting flow
+// control credits when the connection was closed.
+var errConnClosed = errors.New("lndc: use of closed connection")
+
+// offerFlowWindow offers the initiator's receive window. It's sent over every
+// extended handshake, even when zero, to signal support for frames.
+func offerFlowWindow(c *Conn, cfg *Config) []byte {
+	var window [4]byte
+	binary.BigEndian.PutUint32(window[:], cfg.FlowWindow)
+
+	return window[:]
+}
+
+// answerFlowWindow records the initiator's receive window and answers with
+// the responder's own, enabling frames. If the initiator didn't send a window
+// it doesn't support frames, so nothing is sent.
+func answerFlowWindow(c *Conn, cfg *Config, offer []byte) ([]byte, error) {
+	if offer == nil {
+		return nil, nil
+	}
+	if err := acceptFlowWindow(c, cfg, offer); err != nil {
+		return nil, err
+	}
+
+	return offerFlowWindow(c, cfg), nil
+}
+
+// acceptFlowWindow records the remote peer's receive window, enabling frames.
+func acceptFlowWindow(c *Conn, cfg *Config, window []byte) error {
+	if window == nil {
+		return nil
+	}
+	if len(window) != 4 {
+		return ErrMalformedHello
+	}
+
+	c.framed = true
+	c.recvWindow = cfg.FlowWindow
+	c.sendCredits = binary.BigEndian.Uint32(window)
+	c.sendWindow = c.sendCredits
+	c.sendLimited = c.sendCredits != 0
+	c.creditSignal = make(chan struct{}, 1)
+
+	return nil
+}
+
+// takeCredits consumes up to n bytes of the remote peer's receive window
+// without blocking, returning the number consumed. False is returned if the
+// window is full.
+func (c *Conn) takeCredits(n int) (int, bool) {
+	c.flowMtx.Lock()
+	defer c.flowMtx.Unlock()
+
+	if !c.framed || !c.sendLimited {
+		return n, true
+	}
+	if c.sendCredits == 0 {
+		return 0, false
+	}
+	if uint32(n) > c.sendCredits {
+		n = int(c.sendCredits)
+	}
+	c.sendCredits -= uint32(n)
+
+	return n, true
+}
+
+// takeAllCredits consumes n bytes of the remote peer's receive window
+// without blocking, returning false, having consumed nothing, if the window
+// doesn't have room for all of them.
+func (c *Conn) takeAllCredits(n int) bool {
+	c.flowMtx.Lock()
+	defer c.flowMtx.Unlock()
+
+	if !c.framed || !c.sendLimited {
+		return true
+	}
+	if uint32(n) > c.sendCredits {
+		return false
+	}
+	c.sendCredits -= uint32(n)
+
+	return true
+}
+
+// acquireCredits blocks until the remote peer's receive window has room for
+// at least one byte, then consumes up to n bytes of it, returning the number
+// consumed. If the remote peer didn't advertise a window, n is returned
+// immediately.
+func (c *Conn) acquireCredits(n int) (int, error) {
+	if !c.framed {
+		return n, nil
+	}
+
+	var taken int
+	err := c.awaitCredits(func() bool {
+		var ok bool
+		taken, ok = c.takeCredits(n)
+		return ok
+	})
+
+	return taken, err
+}
+
+// acquireAllCredits blocks until the remote peer's receive window has room
+// for all n bytes, then consumes them at once, so that nothing is held
+// should the wait be abandoned. ErrExceedsFlowWindow is returned at once if
+// n is larger than the whole window.
+func (c *Conn) acquireAllCredits(n int) error {
+	if !c.framed {
+		return nil
+	}
+
+	c.flowMtx.Lock()
+	window, limited := c.sendWindow, c.sendLimited
+	c.flowMtx.Unlock()
+	if limited && window != 0 && uint32(n) > window {
+		return fmt.Errorf("%v: message of %d bytes, window of %d",
+			ErrExceedsFlowWindow, n, window)
+	}
+
+	return c.awaitCredits(func() bool { return c.takeAllCredits(n) })
+}
+
+// awaitCredits blocks until take succeeds in consuming credits, retrying it
+// each time credits arrive, or gives up once the connection is closed or
+// its write deadline passes.
+func (c *Conn) awaitCredits(take func() bool) error {
+	var timer <-chan time.Time
+	for {
+		if take() {
+			return nil
+		}
+
+		c.closeMtx.Lock()
+		closed := c.closed
+		c.closeMtx.Unlock()
+		if closed {
+			return errConnClosed
+		}
+
+		if timer == nil {
+			if deadline := c.creditDeadline(); !deadline.IsZero() {
+				t := time.NewTimer(time.Until(deadline))
+				defer t.Stop()
+				timer = t.C
+			}
+		}
+
+		select {
+		case <-c.creditSignal:
+		case <-timer:
+			c.recordFailure(errCreditTimeout, true)
+			return errCreditTimeout
+		}
+	}
+}
+
+// creditDeadline returns the time by which a write blocked awaiting credits
+// must give up, which is the earlier of the rolling write timeout and the
+// explicit write deadline. The zero time means it may wait forever.
+func (c *Conn) creditDeadline() time.Time {
+	c.deadlineMtx.Lock()
+	deadline := c.writeDeadline
+	c.deadlineMtx.Unlock()
+
+	if d := time.Duration(atomic.LoadInt64(&c.writeTimeout)); d != 0 {
+		rolling := time.Now().Add(d)
+		if deadline.IsZero() || rolling.Before(deadline) {
+			deadline = rolling
+		}
+	}
+
+	return deadline
+}
+
+// wakeWriters unblocks any write waiting for credits so it can re-evaluate.
+func (c *Conn) wakeWriters() {
+	select {
+	case c.creditSignal <- struct{}{}:
+	default:
+	}
+}
+
+// receivedCredit replenishes the remote peer's receive window by the amount
+// carried within a credit frame. Credits saturate rather than wrap around, so
+// a peer granting more than fits can't shrink its own window.
+func (c *Conn) receivedCredit(payload []byte) error {
+	if len(payload) != 4 {
+		return ErrMalformedFrame
+	}
+
+	credit := binary.BigEndian.Uint32(payload)
+	c.flowMtx.Lock()
+	if credit > math.MaxUint32-c.sendCredits {
+		c.sendCredits = math.MaxUint32
+	} else {
+		c.sendCredits += credit
+	}
+	c.flowMtx.Unlock()
+	c.wakeWriters()
+
+	return nil
+}
+
+// receivedData accounts for n bytes of data received from the remote peer,
+// ensuring it hasn't overrun the window advertised to it.
+func (c *Conn) receivedData(n int) error {
+	if c.recvWindow == 0 {
+		return nil
+	}
+
+	c.flowMtx.Lock()
+	defer c.flowMtx.Unlock()
+
+	c.recvOutstanding += uint32(n)
+	if c.recvOutstanding > c.recvWindow {
+		return ErrFlowControlViolation
+	}
+
+	return nil
+}
+
+// consumed accounts for n bytes of received data being handed to the
+// application. Once half of the receive window has been consumed, it's
+// returned to the remote peer within a credit frame.
+//
+// The reader never writes the credit frame itself, as it would otherwise
+// wait on a write blocked by the remote peer, which may in turn be waiting
+// on our credit to read any further. Instead, the credit is left for a
+// writer in progress to send once it's done with its message, or for a
+// goroutine of its own if there's none.
+func (c *Conn) consumed(n int) {
+	if c.recvWindow == 0 || n == 0 {
+		return
+	}
+
+	c.flowMtx.Lock()
+	c.recvConsumed += uint32(n)
+	credit := c.recvConsumed
+	if credit < c.recvWindow/2 {
+		c.flowMtx.Unlock()
+		return
+	}
+	c.recvConsumed = 0
+	c.recvOutstanding -= credit
+	c.pendingCredit += credit
+	idle := c.creditWriters == 0
+	if idle {
+		c.creditWriters++
+	}
+	c.flowMtx.Unlock()
+
+	if idle {
+		go func() {
+			c.writeMtx.Lock()
+			c.flushCredit()
+			c.writeMtx.Unlock()
+		}()
+	}
+}
+
+// flushCredit sends any credit left pending by consumed to the remote peer,
+// then releases the caller's registration in creditWriters.
+//
+// NOTE: This method must be called with writeMtx held.
+func (c *Conn) flushCredit() {
+	for {
+		c.flowMtx.Lock()
+		credit := c.pendingCredit
+		c.pendingCredit = 0
+		if credit == 0 {
+			c.creditWriters--
+			c.flowMtx.Unlock()
+			return
+		}
+		c.flowMtx.Unlock()
+
+		var payload [4]byte
+		binary.BigEndian.PutUint32(payload[:], credit)
+		if err := c.writeLocked(controlFrame(frameCredit, payload[:]), nil); err != nil {
+			c.flowMtx.Lock()
+			c.creditWriters--
+			c.flowMtx.Unlock()
+			return
+		}
+	}
+}
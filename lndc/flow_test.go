@@ -0,0 +1,196 @@
+package lndc
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlowControl(t *testing.T) {
+	const (
+		window    = 1024
+		chunk     = 128
+		totalSize = 8 * window
+	)
+
+	listener, pkh := newTestListener(t, WithFlowWindow(window))
+	defer listener.Close()
+
+	reader, writer := dialAndAccept(t, listener, pkh,
+		WithFlowWindow(window))
+	defer reader.Close()
+	defer writer.Close()
+
+	if !reader.framed || !writer.framed {
+		t.Fatalf("expected frames to be negotiated")
+	}
+
+	// The writer must keep reading in order to receive credits.
+	go io.Copy(ioutil.Discard, writer)
+
+	var written int64
+	writeDone := make(chan error, 1)
+	go func() {
+		buf := make([]byte, chunk)
+		for i := 0; i < totalSize/chunk; i++ {
+			if _, err := writer.Write(buf); err != nil {
+				writeDone <- err
+				return
+			}
+			atomic.AddInt64(&written, chunk)
+		}
+		writeDone <- nil
+	}()
+
+	// With the reader yet to read anything, the writer should stall once
+	// it has filled the window.
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt64(&written); n != window {
+		t.Fatalf("expected writer to stall after %d bytes, wrote %d",
+			window, n)
+	}
+	select {
+	case err := <-writeDone:
+		t.Fatalf("writer finished despite the full window: %v", err)
+	default:
+	}
+
+	// Slowly reading everything should let the writer complete.
+	buf := make([]byte, totalSize)
+	for read := 0; read < totalSize; {
+		n, err := reader.Read(buf[read:])
+		if err != nil {
+			t.Fatalf("unable to read: %v", err)
+		}
+		read += n
+	}
+	select {
+	case err := <-writeDone:
+		if err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("writer never completed")
+	}
+}
+
+func TestFlowControlWriteTimeout(t *testing.T) {
+	listener, pkh := newTestListener(t, WithFlowWindow(16))
+	defer listener.Close()
+
+	reader, writer := dialAndAccept(t, listener, pkh, WithFlowWindow(16))
+	defer reader.Close()
+	defer writer.Close()
+
+	// A write which can't be credited in time should time out.
+	writer.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	n, err := writer.Write(make([]byte, 32))
+	expectTimeout(t, err)
+	if n != 16 {
+		t.Fatalf("expected 16 bytes to be written, got %d", n)
+	}
+}
+
+func TestFlowControlCreditSaturates(t *testing.T) {
+	const window = 1024
+
+	listener, pkh := newTestListener(t, WithFlowWindow(window))
+	defer listener.Close()
+
+	reader, writer := dialAndAccept(t, listener, pkh,
+		WithFlowWindow(window))
+	defer reader.Close()
+	defer writer.Close()
+
+	go io.Copy(ioutil.Discard, writer)
+
+	// Exhaust the window, then have the reader grant a byte more credit
+	// than fits.
+	if _, err := writer.Write(make([]byte, window)); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	for _, amount := range []uint32{math.MaxUint32, 1} {
+		var credit [4]byte
+		binary.BigEndian.PutUint32(credit[:], amount)
+		if err := reader.writeFrame(frameCredit, credit[:]); err != nil {
+			t.Fatalf("unable to send credit: %v", err)
+		}
+	}
+
+	// Had the credits wrapped around, the writer would be left stalled.
+	writer.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := writer.Write(make([]byte, 128)); err != nil {
+		t.Fatalf("unable to write after the credit: %v", err)
+	}
+	writer.flowMtx.Lock()
+	credits := writer.sendCredits
+	writer.flowMtx.Unlock()
+	if credits != math.MaxUint32-128 {
+		t.Fatalf("expected %d credits, got %d", uint32(math.MaxUint32-128),
+			credits)
+	}
+}
+
+func TestFlowControlBidirectional(t *testing.T) {
+	const (
+		window    = 1 << 20
+		chunk     = 32 << 10
+		totalSize = 16 << 20
+	)
+
+	listener, pkh := newTestListener(t, WithFlowWindow(window))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh, WithFlowWindow(window))
+	defer local.Close()
+	defer remote.Close()
+
+	// With socket buffers far smaller than the window, each side's
+	// writes block until the other side reads, which it must keep doing
+	// while its own writes are blocked.
+	for _, c := range []*Conn{local, remote} {
+		tcp := c.conn.(*net.TCPConn)
+		tcp.SetReadBuffer(64 << 10)
+		tcp.SetWriteBuffer(64 << 10)
+	}
+
+	errs := make(chan error, 4)
+	for _, c := range []*Conn{local, remote} {
+		c := c
+		go func() {
+			buf := make([]byte, chunk)
+			for i := 0; i < totalSize/chunk; i++ {
+				if _, err := c.Write(buf); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+		go func() {
+			_, err := io.CopyN(ioutil.Discard, c, totalSize)
+			errs <- err
+
+			// Credits are only received by reading, so the
+			// reader carries on until the other side's done.
+			io.Copy(ioutil.Discard, c)
+		}()
+	}
+
+	timeout := time.After(30 * time.Second)
+	for i := 0; i < 4; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("unable to transfer: %v", err)
+			}
+		case <-timeout:
+			t.Fatalf("transfer deadlocked")
+		}
+	}
+}
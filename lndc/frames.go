@@ -0,0 +1,241 @@
+package lndc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Once the hello messages of an extended handshake have been exchanged, every
+// message sent over the connection is a frame: a single type byte followed
+// by its payload. This allows control messages to be carried alongside the
+// data written by the application.
+const (
+	// frameData carries data written by the application.
+	frameData byte = 0
+
+	// frameCredit carries a 4-byte big endian count of bytes by which
+	// the sender's receive window has been replenished.
+	frameCredit byte = 1
+
+	// frameGoingAway carries the 2-byte big endian code and message of
+	// the reason the sender is closing the connection.
+	frameGoingAway byte = 2
+
+	// frameEnd carries no payload. It marks the end of the data the
+	// sender will write, after which it may still send control frames.
+	frameEnd byte = 3
+
+	// frameMaintenance carries the 4-byte big endian number of seconds
+	// after which the sender, being in maintenance, suggests retrying.
+	frameMaintenance byte = 4
+
+	// frameDraining carries the 4-byte big endian number of seconds
+	// after which the sender, shutting down, expects to close the
+	// connection.
+	frameDraining byte = 5
+
+	// frameRedirect carries the 33-byte compressed static public key and
+	// then the address of the node the sender, closing the connection,
+	// asks to be reconnected to instead.
+	frameRedirect byte = 6
+)
+
+// ErrMalformedFrame is returned when a frame received from the remote peer
+// can't be parsed.
+var ErrMalformedFrame = errors.New("lndc: malformed frame")
+
+// ErrFramesUnsupported is returned when a control frame can't be sent to the
+// remote peer as frames weren't negotiated with it.
+var ErrFramesUnsupported = errors.New("lndc: frames not negotiated with peer")
+
+// maxPayload returns the largest number of bytes of application data that
+// can be sent within a single message.
+func (c *Conn) maxPayload() int {
+	// Each frame spends one byte of the message on its type, and data
+	// frames a further sequenceSize bytes on their sequence number if
+	// those are in use.
+	if c.framed {
+		return c.noise.maxMessageLength() - 1 - c.sequenceOverhead()
+	}
+
+	return c.noise.maxMessageLength()
+}
+
+// writeMessage writes a single message to the connection, serializing it
+// with any control frames sent concurrently by a reader.
+func (c *Conn) writeMessage(p []byte) error {
+	return c.writeMessageAD(p, nil)
+}
+
+// writeMessageAD writes a single message to the connection as writeMessage
+// does, binding the associated data ad, if any, to it.
+func (c *Conn) writeMessageAD(p, ad []byte) error {
+	// Registering as a writer before waiting on writeMtx leaves any
+	// credit consumed in the meantime for us to send once done.
+	c.flowMtx.Lock()
+	c.creditWriters++
+	c.flowMtx.Unlock()
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	defer c.flushCredit()
+
+	return c.writeLocked(p, ad)
+}
+
+// writeLocked writes a single message to the connection, binding the
+// associated data ad, if any, to it.
+//
+// NOTE: This method must be called with writeMtx held.
+func (c *Conn) writeLocked(p, ad []byte) error {
+	if c.writeClosed && (!c.framed || p[0] == frameData) {
+		return ErrWriteClosed
+	}
+
+	// Any message left part written by TryWrite must be finished first.
+	if len(c.pendingWrite) > 0 {
+		n, err := c.conn.Write(c.pendingWrite)
+		c.pendingWrite = c.pendingWrite[n:]
+		if err != nil {
+			return err
+		}
+	}
+
+	c.stampSequence(p)
+	err := c.noise.writeMessage(c.conn, p, ad)
+	c.snapshotNonces()
+	if err == nil {
+		c.touchWrite()
+		c.tracef("wrote %d byte message", len(p))
+	} else {
+		c.recordFailure(err, true)
+		c.tracef("write failed: %v", err)
+	}
+
+	return err
+}
+
+// dataFrame returns a data frame carrying payload, leaving room for its
+// sequence number to be stamped as it's written if those are in use.
+func (c *Conn) dataFrame(payload []byte) []byte {
+	frame := make([]byte, 1+c.sequenceOverhead()+len(payload))
+	frame[0] = frameData
+	copy(frame[1+c.sequenceOverhead():], payload)
+
+	return frame
+}
+
+// writeFrame writes a frame of the passed type to the connection.
+func (c *Conn) writeFrame(frameType byte, payload []byte) error {
+	return c.writeMessage(controlFrame(frameType, payload))
+}
+
+// controlFrame returns a control frame of type frameType carrying payload.
+func controlFrame(frameType byte, payload []byte) []byte {
+	f := make([]byte, 1+len(payload))
+	f[0] = frameType
+	copy(f[1:], payload)
+
+	return f
+}
+
+// readMessage reads the next message of application data from the
+// connection, processing any control frames which precede it.
+func (c *Conn) readMessage() ([]byte, error) {
+	return c.readMessageAD(nil)
+}
+
+// readMessageAD reads the next message of application data from the
+// connection as readMessage does, ensuring that it's bound to the associated
+// data ad if set. Control frames never carry associated data.
+func (c *Conn) readMessageAD(ad []byte) ([]byte, error) {
+	return c.readPayload(ad, nil)
+}
+
+// readPayload reads the next message of application data from the
+// connection as readMessageAD does, decrypting each message read into dst,
+// which may be nil. The payload returned aliases dst if it has the capacity
+// to hold the message.
+func (c *Conn) readPayload(ad, dst []byte) ([]byte, error) {
+	payload, err := c.readFrames(ad, dst)
+	if err != nil {
+		c.recordFailure(err, false)
+		c.tracef("read failed: %v", err)
+	} else {
+		c.tracef("read %d byte message", len(payload))
+	}
+
+	return payload, err
+}
+
+// readFrames carries out readPayload, processing control frames until a
+// message of application data is read.
+func (c *Conn) readFrames(ad, dst []byte) ([]byte, error) {
+	if c.readEOF {
+		return nil, io.EOF
+	}
+
+	for {
+		msg, withAD, err := c.noise.readMessageInto(c.conn, ad, dst)
+		c.snapshotRecvNonce()
+		if err != nil {
+			return nil, err
+		}
+		c.touchRead()
+		if !c.framed {
+			if ad != nil && !withAD {
+				return nil, ErrAADMismatch
+			}
+			return msg, nil
+		}
+		if len(msg) == 0 {
+			return nil, ErrMalformedFrame
+		}
+
+		switch msg[0] {
+		case frameData:
+			payload, err := c.checkSequence(msg[1:])
+			if err != nil {
+				return nil, err
+			}
+			if err := c.receivedData(len(payload)); err != nil {
+				return nil, err
+			}
+
+			// A message which is dropped as its associated data
+			// doesn't match still counts as consumed, so that its
+			// flow control credits are returned.
+			if ad != nil && !withAD {
+				c.consumed(len(payload))
+				return nil, ErrAADMismatch
+			}
+			return payload, nil
+
+		case frameCredit:
+			if err := c.receivedCredit(msg[1:]); err != nil {
+				return nil, err
+			}
+
+		case frameGoingAway:
+			return nil, decodeGoingAway(msg[1:])
+
+		case frameEnd:
+			c.readEOF = true
+			return nil, io.EOF
+
+		case frameMaintenance:
+			return nil, decodeMaintenance(msg[1:])
+
+		case frameDraining:
+			return nil, decodeDraining(msg[1:])
+
+		case frameRedirect:
+			return nil, decodeRedirect(msg[1:])
+
+		default:
+			return nil, fmt.Errorf("%v: unknown type %d",
+				ErrMalformedFrame, msg[0])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package lndc
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MaxReasonLength is the maximum length in bytes of the message passed to
+// CloseWithReason.
+const MaxReasonLength = 256
+
+// ErrPeerGoingAway is returned by a read from a connection which the remote
+// peer closed via CloseWithReason, carrying the reason it gave. Reads after
+// it return the error of the closed underlying connection.
+type ErrPeerGoingAway struct {
+	// Code is the application defined code of the reason.
+	Code uint16
+
+	// Msg is a human readable description of the reason.
+	Msg string
+}
+
+// Error returns a description of the reason the peer went away.
+func (e ErrPeerGoingAway) Error() string {
+	return fmt.Sprintf("lndc: peer going away with code %d: %s", e.Code,
+		e.Msg)
+}
+
+// CloseWithReason closes the connection after telling the remote peer why,
+// such as a protocol violation or a shutdown. The reason is sent within a
+// final encrypted frame, which the remote peer surfaces from its next read as
+// an ErrPeerGoingAway. The message may be at most MaxReasonLength bytes long.
+//
+// Frames are only used over connections established through the extended
+// handshake. Over any other connection the reason can't be delivered, so the
+// connection is simply closed and ErrFramesUnsupported returned.
+func (c *Conn) CloseWithReason(code uint16, msg string) error {
+	if len(msg) > MaxReasonLength {
+		return fmt.Errorf("lndc: reason of %d bytes exceeds the maximum "+
+			"of %d", len(msg), MaxReasonLength)
+	}
+
+	if !c.framed {
+		c.Close()
+		return ErrFramesUnsupported
+	}
+
+	payload := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(payload[:2], code)
+	copy(payload[2:], msg)
+
+	c.armWriteDeadline()
+	if err := c.writeFrame(frameGoingAway, payload); err != nil {
+		c.Close()
+		return err
+	}
+
+	return c.Close()
+}
+
+// decodeGoingAway parses the payload of a going away frame into the
+// ErrPeerGoingAway to be returned to the reader.
+func decodeGoingAway(payload []byte) error {
+	if len(payload) < 2 || len(payload)-2 > MaxReasonLength {
+		return ErrMalformedFrame
+	}
+
+	return ErrPeerGoingAway{
+		Code: binary.BigEndian.Uint16(payload[:2]),
+		Msg:  string(payload[2:]),
+	}
+}
@@ -0,0 +1,65 @@
+package lndc
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCloseWithReason(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh, WithFlowWindow(1<<16))
+	defer local.Close()
+
+	// An overly long reason is refused without closing the connection.
+	if err := remote.CloseWithReason(1, strings.Repeat("x",
+		MaxReasonLength+1)); err == nil {
+
+		t.Fatalf("expected an overly long reason to be refused")
+	}
+	if _, err := remote.Write([]byte("still open")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+
+	const code, msg = 7, "shutting down"
+	if err := remote.CloseWithReason(code, msg); err != nil {
+		t.Fatalf("unable to close with reason: %v", err)
+	}
+
+	// The data written beforehand is read in full first.
+	buf := make([]byte, len("still open"))
+	if _, err := io.ReadFull(local, buf); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+
+	// Followed by the reason, and then EOF.
+	_, err := local.Read(buf)
+	reason, ok := err.(ErrPeerGoingAway)
+	if !ok {
+		t.Fatalf("expected ErrPeerGoingAway, got %T: %v", err, err)
+	}
+	if reason.Code != code || reason.Msg != msg {
+		t.Fatalf("expected reason %d %q, got %d %q", code, msg,
+			reason.Code, reason.Msg)
+	}
+	if _, err := local.Read(buf); err != io.EOF {
+		t.Fatalf("expected EOF after the reason, got %v", err)
+	}
+}
+
+func TestCloseWithReasonUnframed(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+
+	if err := remote.CloseWithReason(1, "bye"); err != ErrFramesUnsupported {
+		t.Fatalf("expected %v, got %v", ErrFramesUnsupported, err)
+	}
+	if _, err := local.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
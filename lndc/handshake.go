@@ -0,0 +1,375 @@
+package lndc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/lnutil"
+)
+
+// ErrShortActOne is returned when the initiator closes the connection part way
+// through sending the ActOneSize bytes of act one. A connection closed before
+// any of act one was sent, as by a port scanner, instead fails with io.EOF.
+var ErrShortActOne = errors.New("lndc: connection closed before act one " +
+	"was received in full")
+
+// ErrSelfConnection is returned when the remote peer presents our own static
+// key, as when a node dials its own listener through a misconfigured address.
+var ErrSelfConnection = errors.New("lndc: connection to self")
+
+// Upgrade carries out the initiator's side of the lndc handshake over an
+// already established connection, expecting the remote peer's static public
+// key to hash to remotePKH. This allows the handshake to be run over any
+// net.Conn, such as one wrapped with instrumentation. In the case of a
+// handshake failure, the connection is closed and a non-nil error is
+// returned.
+//
+// NOTE: The handshake only ever interacts with the connection through the
+// net.Conn interface, and never asserts it to be a *net.TCPConn.
+func Upgrade(conn net.Conn, localPriv *koblitz.PrivateKey, remotePKH string,
+	options ...func(*Config)) (*Conn, error) {
+
+	if err := validateStaticKey(localPriv); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	cfg := newConfig(options...)
+	if err := cfg.validate(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	b, err := upgrade(conn, localPriv, remotePKH, 0, cfg)
+	if refusal, ok := err.(offerRefusedError); ok {
+		err = refusal.err
+	}
+
+	return b, err
+}
+
+// UpgradeInbound carries out the responder's side of the lndc handshake over
+// an already established connection, as a Listener would for each connection
+// it accepts. In the case of a handshake failure, the connection is closed
+// and a non-nil error is returned.
+//
+// NOTE: The handshake only ever interacts with the connection through the
+// net.Conn interface, and never asserts it to be a *net.TCPConn.
+func UpgradeInbound(conn net.Conn, localStatic *koblitz.PrivateKey,
+	options ...func(*Config)) (*Conn, error) {
+
+	if err := validateStaticKey(localStatic); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	cfg := newConfig(options...)
+	if err := cfg.validate(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	start := time.Now()
+	noise := NewNoiseMachine(false, localStatic, cfg.machineOptions(false)...)
+	lndcConn := newConn(conn, noise, cfg)
+	if err := respond(lndcConn, cfg, nil); err != nil {
+		lndcConn.traceHandshake(err)
+		conn.Close()
+		return nil, err
+	}
+	lndcConn.established(start)
+	lndcConn.traceHandshake(nil)
+	cfg.handshakeDone(conn.RemoteAddr(), lndcConn.handshakeDuration)
+	if err := cfg.registerConn(lndcConn); err != nil {
+		lndcConn.Close()
+		return nil, err
+	}
+
+	return lndcConn, nil
+}
+
+// offerRefusedError is returned by initiate when the responder closed the
+// connection without answering an act one offering a version above
+// HandshakeVersion, as a responder predating the extended handshake does.
+// It wraps the error the read of act two failed with.
+type offerRefusedError struct {
+	err error
+}
+
+func (e offerRefusedError) Error() string {
+	return e.err.Error()
+}
+
+// upgrade carries out the initiator's side of the handshake using an already
+// validated configuration. rtt is the time taken to connect to the remote
+// peer, or zero if unknown. machineOptions are applied to the noise machine
+// after those of the configuration.
+func upgrade(conn net.Conn, localPriv *koblitz.PrivateKey, remotePKH string,
+	rtt time.Duration, cfg *Config,
+	machineOptions ...func(*Machine)) (*Conn, error) {
+
+	start := time.Now()
+	noise := NewNoiseMachine(true, localPriv,
+		append(cfg.machineOptions(true), machineOptions...)...)
+	b := newConn(conn, noise, cfg)
+	err := initiate(b, remotePKH, cfg.handshakeTimeout(rtt), cfg)
+	if err != nil {
+		b.traceHandshake(err)
+		conn.Close()
+		return nil, err
+	}
+
+	b.established(start)
+	b.traceHandshake(nil)
+	cfg.handshakeDone(conn.RemoteAddr(), b.handshakeDuration)
+	if err := cfg.registerConn(b); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// initiate carries out the initiator's side of the three act handshake over
+// the connection wrapped by b, waiting up to timeout for the remote peer's
+// act.
+func initiate(b *Conn, remotePKH string, timeout time.Duration,
+	cfg *Config) error {
+
+	conn := b.conn
+
+	// Initiate the handshake by sending the first act to the receiver.
+	actOne, err := b.noise.GenActOne()
+	if err != nil {
+		return err
+	}
+	msg := actOne[:]
+	if cfg.ProofOfWork > 0 {
+		proof, err := solveProofOfWork(&actOne, cfg.ProofOfWork,
+			time.Now())
+		if err != nil {
+			return err
+		}
+		msg = append(actOne[:], proof[:]...)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	cfg.transcript(1, DirectionSent, actOne[:])
+	b.tracef("sent act one")
+
+	// We'll ensure that we get ActTwo from the remote peer in a timely
+	// manner. If they don't respond within the timeout, then we'll kill
+	// the connection.
+	timer := newHandshakeTimer(conn)
+	defer timer.stop()
+	timer.reset(timeout)
+
+	// If the first act was successful (we know that address is actually
+	// remotePub), then read the second act after which we'll be able to
+	// send our static public key to the remote peer with strong forward
+	// secrecy.
+	var actTwo [ActTwoSize]byte
+	if n, err := io.ReadFull(conn, actTwo[:]); err != nil {
+		// A lone byte is a hint from a listener explaining why it
+		// refused the handshake.
+		if n == 1 && err == io.ErrUnexpectedEOF {
+			return hintError(actTwo[0], err)
+		}
+
+		// A responder predating the extended handshake refuses any
+		// later version by closing the connection without a word.
+		if n == 0 && b.noise.maxVersion > HandshakeVersion &&
+			(err == io.EOF || errors.Is(err, syscall.ECONNRESET)) {
+
+			return offerRefusedError{err}
+		}
+		return err
+	}
+	cfg.transcript(2, DirectionReceived, actTwo[:])
+	s, err := b.noise.RecvActTwo(actTwo)
+	if err != nil {
+		return err
+	}
+	b.tracef("received act two from %x", s)
+
+	cfg.log().Infof("Received pubkey %x", s)
+	if b.isSelfConnection() {
+		return ErrSelfConnection
+	}
+	if lnutil.LitAdrFromPubkey(s) != remotePKH {
+		// If the responder may be a delegated session key, its
+		// identity is instead checked against the certificate it
+		// presents once the hello messages are exchanged.
+		if !cfg.AcceptCertificates ||
+			b.noise.Version() < ExtendedHandshakeVersion {
+
+			return fmt.Errorf("Remote PKH doesn't match. Quitting!")
+		}
+		b.delegatedPKH = remotePKH
+	} else {
+		cfg.log().Infof("Received PKH %s matches",
+			lnutil.LitAdrFromPubkey(s))
+	}
+	if err := cfg.checkPeerVersion(b); err != nil {
+		return err
+	}
+
+	// Finally, complete the handshake by sending over our encrypted static
+	// key and execute the final ECDH operation.
+	actThree, err := b.noise.GenActThree()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(actThree[:]); err != nil {
+		return err
+	}
+	cfg.transcript(3, DirectionSent, actThree[:])
+	b.tracef("sent act three")
+
+	// If the extended handshake was negotiated, the acts are followed by
+	// an exchange of hello messages to settle the extensions.
+	if err := exchangeHello(b, cfg, true); err != nil {
+		return err
+	}
+
+	// The deadline is reset as the timer is stopped, as it's no longer
+	// critical beyond the initial handshake.
+	return nil
+}
+
+// respond carries out the responder's side of the three act handshake over
+// the connection wrapped by lndcConn. If quit is closed part way through the
+// handshake, errListenerClosed is returned.
+func respond(lndcConn *Conn, cfg *Config, quit <-chan struct{}) error {
+	conn := lndcConn.conn
+
+	// Turn away banned IPs before doing any work on their behalf.
+	if err := cfg.checkBanned(nil, conn.RemoteAddr()); err != nil {
+		cfg.rejectHandshake(conn, hintRefused)
+		return err
+	}
+	if err := cfg.checkReputation(conn.RemoteAddr()); err != nil {
+		cfg.rejectHandshake(conn, hintRefused)
+		return err
+	}
+
+	// We'll ensure that we get ActOne from the remote peer in a timely
+	// manner. If they don't respond within 1s, then we'll kill the
+	// connection.
+	timer := newHandshakeTimer(conn)
+	defer timer.stop()
+	timer.reset(handshakeReadTimeout)
+
+	// Attempt to carry out the first act of the handshake protocol. If the
+	// connecting node doesn't know our long-term static public key, then
+	// this portion will fail with a non-nil error.
+	var actOne [ActOneSize]byte
+	if _, err := io.ReadFull(conn, actOne[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return ErrShortActOne
+		}
+		return err
+	}
+	cfg.transcript(1, DirectionReceived, actOne[:])
+	lndcConn.tracef("received act one")
+
+	// If act one carries a proof of work then read it, verifying it if
+	// we require one, before doing any further work.
+	if actOne[0]&powFlag != 0 {
+		var proof [powSize]byte
+		if _, err := io.ReadFull(conn, proof[:]); err != nil {
+			return err
+		}
+		if cfg.ProofOfWork > 0 {
+			err := cfg.checkProofOfWork(actOne, proof, time.Now())
+			if err != nil {
+				cfg.rejectHandshake(conn, hintRefused)
+				return err
+			}
+		}
+		actOne[0] &^= powFlag
+	} else if cfg.ProofOfWork > 0 {
+		cfg.rejectHandshake(conn, hintRefused)
+		return ErrProofOfWorkRequired
+	}
+
+	if err := lndcConn.noise.RecvActOne(actOne); err != nil {
+		cfg.rejectHandshake(conn, hintAuthFailed)
+		return err
+	}
+	// Next, progress the handshake processes by sending over our ephemeral
+	// key for the session along with an authenticating tag.
+	actTwo, err := lndcConn.noise.GenActTwo()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(actTwo[:]); err != nil {
+		return err
+	}
+	cfg.transcript(2, DirectionSent, actTwo[:])
+	lndcConn.tracef("sent act two")
+
+	select {
+	case <-quit:
+		return errListenerClosed
+	default:
+	}
+
+	// We'll ensure that we get ActTwo from the remote peer in a timely
+	// manner. If they don't respond within 1 second, then we'll kill the
+	// connection.
+	timer.reset(handshakeReadTimeout)
+
+	// Finally, finish the handshake processes by reading and decrypting
+	// the connection peer's static public key. If this succeeds then both
+	// sides have mutually authenticated each other.
+	var actThree [ActThreeSize]byte
+	if _, err := io.ReadFull(conn, actThree[:]); err != nil {
+		return err
+	}
+	cfg.transcript(3, DirectionReceived, actThree[:])
+	if err := lndcConn.noise.RecvActThree(actThree); err != nil {
+		return err
+	}
+	lndcConn.tracef("received act three from %x",
+		lndcConn.RemotePub().SerializeCompressed())
+	if lndcConn.isSelfConnection() {
+		return ErrSelfConnection
+	}
+	if err := cfg.checkPeerVersion(lndcConn); err != nil {
+		return err
+	}
+
+	// If the extended handshake was negotiated, the acts are followed by
+	// an exchange of hello messages to settle the extensions.
+	if err := exchangeHello(lndcConn, cfg, false); err != nil {
+		return err
+	}
+
+	// Now that the peer has been authenticated, check its identity
+	// against the bans.
+	err = cfg.checkBanned(lndcConn.RemoteIdentity(), conn.RemoteAddr())
+	if err != nil {
+		return err
+	}
+	if err := cfg.checkChannelProof(lndcConn); err != nil {
+		return err
+	}
+	if err := cfg.authorize(lndcConn); err != nil {
+		return err
+	}
+
+	// The deadline is reset as the timer is stopped, as it's no longer
+	// critical beyond the initial handshake.
+	return nil
+}
+
+// isSelfConnection reports whether the remote peer's static key, once
+// learned, is our own.
+func (c *Conn) isSelfConnection() bool {
+	return c.RemotePub().IsEqual(c.LocalPub())
+}
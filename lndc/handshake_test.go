@@ -0,0 +1,381 @@
+package lndc
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mit-dci/lit/btcutil/chaincfg/chainhash"
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// countingConn wraps a net.Conn, recording the size of every Read and Write
+// carried out over it.
+type countingConn struct {
+	net.Conn
+
+	mtx    sync.Mutex
+	reads  []int
+	writes []int
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	c.mtx.Lock()
+	c.reads = append(c.reads, n)
+	c.mtx.Unlock()
+
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+
+	c.mtx.Lock()
+	c.writes = append(c.writes, n)
+	c.mtx.Unlock()
+
+	return n, err
+}
+
+// totals returns the number of writes carried out along with the total bytes
+// read and written.
+func (c *countingConn) totals() (int, int, int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var read, written int
+	for _, n := range c.reads {
+		read += n
+	}
+	for _, n := range c.writes {
+		written += n
+	}
+
+	return len(c.writes), read, written
+}
+
+// upgradePipe runs the handshake over both ends of an in-memory pipe, each
+// wrapped in a countingConn.
+func upgradePipe(t *testing.T) (*Conn, *Conn, *countingConn, *countingConn) {
+	initiatorPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	responderPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	initiatorPipe, responderPipe := net.Pipe()
+	initiatorRaw := &countingConn{Conn: initiatorPipe}
+	responderRaw := &countingConn{Conn: responderPipe}
+
+	responderChan := make(chan maybeNetConn, 1)
+	go func() {
+		conn, err := UpgradeInbound(responderRaw, responderPriv)
+		responderChan <- maybeNetConn{conn, err}
+	}()
+
+	initiator, err := Upgrade(initiatorRaw, initiatorPriv,
+		pkhOf(responderPriv))
+	if err != nil {
+		t.Fatalf("unable to upgrade outbound conn: %v", err)
+	}
+	result := <-responderChan
+	if result.err != nil {
+		t.Fatalf("unable to upgrade inbound conn: %v", result.err)
+	}
+
+	return initiator, result.conn.(*Conn), initiatorRaw, responderRaw
+}
+
+func TestUpgradeWrappedConn(t *testing.T) {
+	initiator, responder, initiatorRaw, responderRaw := upgradePipe(t)
+	defer initiator.Close()
+	defer responder.Close()
+
+	// The initiator writes acts one and three, and reads act two, while
+	// the responder does the opposite.
+	writes, read, written := initiatorRaw.totals()
+	if writes != 2 || written != ActOneSize+ActThreeSize ||
+		read != ActTwoSize {
+
+		t.Fatalf("unexpected initiator handshake traffic: %d writes, "+
+			"%d bytes read, %d bytes written", writes, read, written)
+	}
+	writes, read, written = responderRaw.totals()
+	if writes != 1 || written != ActTwoSize ||
+		read != ActOneSize+ActThreeSize {
+
+		t.Fatalf("unexpected responder handshake traffic: %d writes, "+
+			"%d bytes read, %d bytes written", writes, read, written)
+	}
+
+	// The upgraded conns should function just like dialed ones.
+	msg := []byte("over any net.Conn")
+	go initiator.Write(msg)
+
+	buf := make([]byte, len(msg))
+	if _, err := responder.Read(buf); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if !bytes.Equal(buf, msg) {
+		t.Fatalf("expected %q, got %q", msg, buf)
+	}
+}
+
+func TestShortActOne(t *testing.T) {
+	listener, _ := newTestListener(t)
+	defer listener.Close()
+
+	for _, sent := range []int{0, 1, ActOneSize / 2, ActOneSize - 1} {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("unable to dial listener: %v", err)
+		}
+		if _, err := conn.Write(make([]byte, sent)); err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+		conn.Close()
+
+		// A connection closed before sending anything fails with a
+		// plain io.EOF, as it did before ErrShortActOne existed.
+		expected := ErrShortActOne
+		if sent == 0 {
+			expected = io.EOF
+		}
+		if _, err := listener.Accept(); err != expected {
+			t.Fatalf("expected %v after sending %d bytes, got %v",
+				expected, sent, err)
+		}
+	}
+}
+
+func TestEmptyConnKeepsListening(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	// A peer which connects and closes without a word, such as a port
+	// scanner, fails with an error whose text is exactly "EOF", which
+	// callers such as lnp2p's accept loop skip over.
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("unable to dial listener: %v", err)
+		}
+		conn.Close()
+
+		_, err = listener.Accept()
+		if err == nil || err.Error() != "EOF" {
+			t.Fatalf("expected EOF, got %v", err)
+		}
+	}
+
+	// The listener carries on accepting peers.
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+	roundTrip(t, local, remote)
+}
+
+func TestSelfConnection(t *testing.T) {
+	priv := newKey(t)
+	listener, err := NewListener(priv, 0)
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	// Dialing our own listener is caught by the dialer as soon as the
+	// listener's static key is revealed.
+	_, err = Dial(priv, listener.Addr().String(), pkhOf(priv), net.Dial)
+	if err != ErrSelfConnection {
+		t.Fatalf("expected %v, got %v", ErrSelfConnection, err)
+	}
+	if _, err := listener.Accept(); err == nil {
+		t.Fatalf("expected the listener to drop the connection")
+	}
+
+	// The responder catches it too, should the initiator carry on.
+	initiatorRaw, responderRaw := net.Pipe()
+	defer initiatorRaw.Close()
+	go func() {
+		noise := NewNoiseMachine(true, priv)
+		actOne, err := noise.GenActOne()
+		if err != nil {
+			return
+		}
+		initiatorRaw.Write(actOne[:])
+
+		var actTwo [ActTwoSize]byte
+		if _, err := io.ReadFull(initiatorRaw, actTwo[:]); err != nil {
+			return
+		}
+		if _, err := noise.RecvActTwo(actTwo); err != nil {
+			return
+		}
+		actThree, err := noise.GenActThree()
+		if err != nil {
+			return
+		}
+		initiatorRaw.Write(actThree[:])
+	}()
+
+	if _, err := UpgradeInbound(responderRaw, priv); err != ErrSelfConnection {
+		t.Fatalf("expected %v, got %v", ErrSelfConnection, err)
+	}
+}
+
+func TestHandshakeCryptoTime(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	for _, conn := range []*Conn{local, remote} {
+		crypto := conn.HandshakeCryptoTime()
+		if crypto <= 0 || crypto > conn.HandshakeDuration() {
+			t.Fatalf("expected crypto time within the handshake "+
+				"time of %v, got %v", conn.HandshakeDuration(),
+				crypto)
+		}
+	}
+}
+
+func BenchmarkHandshakeCrypto(b *testing.B) {
+	listener, pkh := newTestListener(b)
+	defer listener.Close()
+
+	var dialer, listenerSide time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		local, remote := dialAndAccept(b, listener, pkh)
+		listenerSide += local.HandshakeCryptoTime()
+		dialer += remote.HandshakeCryptoTime()
+		local.Close()
+		remote.Close()
+	}
+
+	b.ReportMetric(float64(dialer.Nanoseconds())/float64(b.N),
+		"dialer-crypto-ns/op")
+	b.ReportMetric(float64(listenerSide.Nanoseconds())/float64(b.N),
+		"listener-crypto-ns/op")
+}
+
+// prefixConn is a net.Conn whose reads are served from r, which replays bytes
+// already read from the connection before carrying on with it.
+type prefixConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (p *prefixConn) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+// predatingResponder listens for handshakes as a peer predating version
+// negotiation does, closing any connection whose act one offers a version
+// other than HandshakeVersion. It returns the listener, the number of
+// connections it has received, and its established connections.
+func predatingResponder(t *testing.T, priv *koblitz.PrivateKey) (net.Listener,
+	*int32, chan *Conn) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+
+	var dials int32
+	conns := make(chan *Conn, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&dials, 1)
+
+			var actOne [ActOneSize]byte
+			if _, err := io.ReadFull(conn, actOne[:]); err != nil ||
+				actOne[0] != HandshakeVersion {
+
+				conn.Close()
+				continue
+			}
+
+			replay := &prefixConn{conn, io.MultiReader(
+				bytes.NewReader(actOne[:]), conn)}
+			if c, err := UpgradeInbound(replay, priv); err == nil {
+				conns <- c
+			}
+		}
+	}()
+
+	return l, &dials, conns
+}
+
+func TestDialPredatingResponder(t *testing.T) {
+	priv := newKey(t)
+	l, dials, conns := predatingResponder(t, priv)
+	defer l.Close()
+
+	// expectRefused asserts a dial with options fails without a redial,
+	// returning the error the responder's close caused.
+	expectRefused := func(options ...func(*Config)) {
+		t.Helper()
+
+		atomic.StoreInt32(dials, 0)
+		_, err := Dial(newKey(t), l.Addr().String(), pkhOf(priv),
+			net.Dial, options...)
+		if err == nil {
+			t.Fatalf("expected the dial to fail")
+		}
+		if _, ok := err.(offerRefusedError); ok {
+			t.Fatalf("internal refusal error leaked: %v", err)
+		}
+		if n := atomic.LoadInt32(dials); n != 1 {
+			t.Fatalf("expected no redial, got %d dials", n)
+		}
+	}
+
+	// By default, a dialer offering the extended handshake isn't
+	// downgraded, as it can't tell the peer is predating from it being
+	// refused for any other reason.
+	expectRefused(WithFlowWindow(1 << 16))
+
+	// Nor is it when it requires the extended handshake, or relies on an
+	// extension guarding the connection's security.
+	expectRefused(WithLegacyFallback(),
+		WithMinPeerVersion(ExtendedHandshakeVersion))
+	expectRefused(WithLegacyFallback(), WithFlowWindow(1<<16),
+		WithSequenceNumbers())
+	expectRefused(WithLegacyFallback(), WithChainHash(&chainhash.Hash{1}))
+
+	// Otherwise, having opted in, it falls back to the original version.
+	atomic.StoreInt32(dials, 0)
+	remote, err := Dial(newKey(t), l.Addr().String(), pkhOf(priv), net.Dial,
+		WithLegacyFallback(), WithFlowWindow(1<<16))
+	if err != nil {
+		t.Fatalf("unable to dial predating responder: %v", err)
+	}
+	defer remote.Close()
+	local := <-conns
+	defer local.Close()
+
+	if n := atomic.LoadInt32(dials); n != 2 {
+		t.Fatalf("expected a single redial, got %d dials", n)
+	}
+	if remote.noise.Version() != HandshakeVersion || remote.framed {
+		t.Fatalf("expected the original version without frames, got "+
+			"version %d", remote.noise.Version())
+	}
+	roundTrip(t, local, remote)
+}
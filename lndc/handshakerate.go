@@ -0,0 +1,146 @@
+package lndc
+
+import (
+	"sync"
+	"time"
+)
+
+// rateBuckets is the number of one second buckets handshake outcomes are
+// tallied within, covering the longest window reported by Stats.
+const rateBuckets = 15 * 60
+
+// HandshakeRate tallies the outcomes of the handshakes carried out over a
+// window of time.
+type HandshakeRate struct {
+	// Window is the period of time ending now over which the
+	// handshakes were carried out.
+	Window time.Duration
+
+	// Succeeded and Failed count the handshakes which completed and
+	// those which didn't.
+	Succeeded uint64
+	Failed    uint64
+}
+
+// SuccessRate returns the fraction of the handshakes which succeeded, or
+// zero if none were carried out.
+func (r HandshakeRate) SuccessRate() float64 {
+	total := r.Succeeded + r.Failed
+	if total == 0 {
+		return 0
+	}
+
+	return float64(r.Succeeded) / float64(total)
+}
+
+// ListenerStats is a snapshot of a listener's connections and the outcomes
+// of its recent handshakes, as returned by Stats.
+type ListenerStats struct {
+	// Conns is the number of established connections the listener held.
+	Conns int
+
+	// Handshakes1m, Handshakes5m and Handshakes15m tally the handshakes
+	// carried out over the last one, five and fifteen minutes, so that
+	// a sudden rise in failures, such as after a botched key rotation,
+	// stands out from the listener's history.
+	Handshakes1m  HandshakeRate
+	Handshakes5m  HandshakeRate
+	Handshakes15m HandshakeRate
+}
+
+// rateBucket tallies the handshake outcomes of the second tick.
+type rateBucket struct {
+	tick      int64
+	succeeded uint64
+	failed    uint64
+}
+
+// rateTracker tallies handshake outcomes within a ring of one second
+// buckets. Time is measured from start using the monotonic clock, so that
+// the windows aren't skewed by changes to the wall clock.
+type rateTracker struct {
+	mtx     sync.Mutex
+	start   time.Time
+	buckets [rateBuckets]rateBucket
+}
+
+// newRateTracker returns an empty rateTracker measuring time from start.
+func newRateTracker(start time.Time) *rateTracker {
+	t := &rateTracker{start: start}
+	for i := range t.buckets {
+		t.buckets[i].tick = -1
+	}
+
+	return t
+}
+
+// tick returns the second since the tracker's start which now falls in.
+func (t *rateTracker) tick(now time.Time) int64 {
+	return int64(now.Sub(t.start) / time.Second)
+}
+
+// record tallies the outcome of a handshake completed at now.
+func (t *rateTracker) record(succeeded bool, now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	tick := t.tick(now)
+	if tick < 0 {
+		return
+	}
+	bucket := &t.buckets[tick%rateBuckets]
+	if bucket.tick != tick {
+		*bucket = rateBucket{tick: tick}
+	}
+
+	if succeeded {
+		bucket.succeeded++
+	} else {
+		bucket.failed++
+	}
+}
+
+// rate tallies the handshakes completed over the window ending at now. The
+// window is rounded up to whole seconds, and capped at rateBuckets of them.
+func (t *rateTracker) rate(window time.Duration, now time.Time) HandshakeRate {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	ticks := int64((window + time.Second - 1) / time.Second)
+	if ticks > rateBuckets {
+		ticks = rateBuckets
+	}
+
+	rate := HandshakeRate{Window: window}
+	tick := t.tick(now)
+	for i := range t.buckets {
+		bucket := &t.buckets[i]
+		if bucket.tick < 0 || bucket.tick > tick ||
+			bucket.tick <= tick-ticks {
+
+			continue
+		}
+
+		rate.Succeeded += bucket.succeeded
+		rate.Failed += bucket.failed
+	}
+
+	return rate
+}
+
+// Stats returns a snapshot of the listener's established connections and the
+// outcomes of its recent handshakes. Handshakes abandoned as the listener
+// was closed aren't counted.
+func (l *Listener) Stats() ListenerStats {
+	l.connMtx.Lock()
+	conns := len(l.established)
+	l.connMtx.Unlock()
+
+	now := time.Now()
+	return ListenerStats{
+		Conns:         conns,
+		Handshakes1m:  l.handshakeRates.rate(time.Minute, now),
+		Handshakes5m:  l.handshakeRates.rate(5*time.Minute, now),
+		Handshakes15m: l.handshakeRates.rate(15*time.Minute, now),
+	}
+}
@@ -0,0 +1,109 @@
+package lndc
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateTrackerWindows(t *testing.T) {
+	start := time.Now()
+	tracker := newRateTracker(start)
+	at := func(offset time.Duration) time.Time { return start.Add(offset) }
+
+	// Steady successes for the first ten minutes, a success every ten
+	// seconds.
+	for offset := time.Duration(0); offset < 10*time.Minute; offset += 10 * time.Second {
+		tracker.record(true, at(offset))
+	}
+
+	// Then peers suddenly start failing, a failure every five seconds
+	// for two minutes.
+	for offset := 10 * time.Minute; offset < 12*time.Minute; offset += 5 * time.Second {
+		tracker.record(false, at(offset))
+	}
+
+	// Take stock a second short of twelve minutes in.
+	now := at(12*time.Minute - time.Second)
+	tests := []struct {
+		window            time.Duration
+		succeeded, failed uint64
+		successRate       float64
+	}{
+		// The last minute holds only failures.
+		{time.Minute, 0, 12, 0},
+
+		// The last five, three minutes of successes and two of
+		// failures.
+		{5 * time.Minute, 18, 24, 18.0 / 42},
+
+		// And the last fifteen, the whole history.
+		{15 * time.Minute, 60, 24, 60.0 / 84},
+	}
+	for _, test := range tests {
+		rate := tracker.rate(test.window, now)
+		if rate.Window != test.window || rate.Succeeded != test.succeeded ||
+			rate.Failed != test.failed {
+
+			t.Fatalf("%v: expected %d/%d, got %d/%d", test.window,
+				test.succeeded, test.failed, rate.Succeeded,
+				rate.Failed)
+		}
+		if rate.SuccessRate() != test.successRate {
+			t.Fatalf("%v: expected success rate %v, got %v",
+				test.window, test.successRate, rate.SuccessRate())
+		}
+	}
+
+	// Long after, the outcomes have all aged out of the windows, even
+	// though their buckets haven't been reused.
+	rate := tracker.rate(15*time.Minute, at(time.Hour))
+	if rate.Succeeded != 0 || rate.Failed != 0 || rate.SuccessRate() != 0 {
+		t.Fatalf("expected no handshakes an hour later, got %+v", rate)
+	}
+
+	// Buckets are reused as the ring wraps around.
+	tracker.record(true, at(time.Hour))
+	rate = tracker.rate(time.Minute, at(time.Hour))
+	if rate.Succeeded != 1 || rate.Failed != 0 {
+		t.Fatalf("expected a single success, got %+v", rate)
+	}
+}
+
+func TestListenerStats(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	// A dialer which doesn't know the listener's key fails act one.
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(bytes.Repeat([]byte{0}, ActOneSize)); err != nil {
+		t.Fatalf("unable to write act one: %v", err)
+	}
+	if _, err := listener.Accept(); err == nil {
+		t.Fatalf("expected the handshake to fail")
+	}
+
+	stats := listener.Stats()
+	if stats.Conns != 1 {
+		t.Fatalf("expected 1 conn, got %d", stats.Conns)
+	}
+	for _, rate := range []HandshakeRate{stats.Handshakes1m,
+		stats.Handshakes5m, stats.Handshakes15m} {
+
+		if rate.Succeeded != 1 || rate.Failed != 1 ||
+			rate.SuccessRate() != 0.5 {
+
+			t.Fatalf("%v: expected 1 of 2 handshakes to succeed, "+
+				"got %+v", rate.Window, rate)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package lndc
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// aLongTimeAgo is a deadline which has passed however the wall clock has
+// been stepped, failing any blocked I/O at once.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// handshakeTimer bounds how long the handshake waits on the remote peer with
+// a timer, which runs on the monotonic clock, rather than a deadline of
+// time.Now().Add(timeout). A deadline is an instant on the wall clock, which
+// a connection wrapping TCP may compare against a wall clock of its own, such
+// that a clock stepped by NTP or a resumed VM fires it early or never. When
+// the timer fires, the connection's deadline is set long past, which fails
+// the blocked I/O whatever the wall clock reads.
+type handshakeTimer struct {
+	conn net.Conn
+
+	mtx   sync.Mutex
+	timer *time.Timer
+
+	// gen is incremented each time the timer is reset or stopped, so
+	// that a timer firing concurrently doesn't expire a wait it no
+	// longer bounds.
+	gen uint64
+}
+
+// newHandshakeTimer returns a stopped timer bounding waits on conn.
+func newHandshakeTimer(conn net.Conn) *handshakeTimer {
+	return &handshakeTimer{conn: conn}
+}
+
+// reset bounds the waits from here on to timeout, replacing any earlier
+// bound.
+func (h *handshakeTimer) reset(timeout time.Duration) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.stopLocked()
+	gen := h.gen
+	h.timer = time.AfterFunc(timeout, func() {
+		h.expire(gen)
+	})
+}
+
+// stop lifts the bound on waits, clearing the connection's deadline.
+func (h *handshakeTimer) stop() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.stopLocked()
+}
+
+// stopLocked carries out stop.
+//
+// NOTE: mtx must be held by the caller.
+func (h *handshakeTimer) stopLocked() {
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	h.gen++
+	h.conn.SetDeadline(time.Time{})
+}
+
+// expire fails the blocked I/O of the wait bounded by the timer of the
+// passed generation, unless it has since been reset or stopped.
+func (h *handshakeTimer) expire(gen uint64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if gen != h.gen {
+		return
+	}
+	h.conn.SetDeadline(aLongTimeAgo)
+}
@@ -0,0 +1,86 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// clockJumpConn simulates a connection comparing its deadlines against a wall
+// clock which has been stepped by jump, such that each deadline it's set
+// fires jump later, or earlier if jump is negative, than intended.
+type clockJumpConn struct {
+	net.Conn
+	jump time.Duration
+}
+
+func (c *clockJumpConn) shift(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+
+	return t.Round(0).Add(c.jump)
+}
+
+func (c *clockJumpConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(c.shift(t))
+}
+
+func (c *clockJumpConn) SetReadDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(c.shift(t))
+}
+
+func (c *clockJumpConn) SetWriteDeadline(t time.Time) error {
+	return c.Conn.SetWriteDeadline(c.shift(t))
+}
+
+// jumpDialer returns a dialer whose connections see the wall clock stepped
+// by jump.
+func jumpDialer(jump time.Duration) func(string, string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := net.Dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &clockJumpConn{Conn: conn, jump: jump}, nil
+	}
+}
+
+func TestHandshakeTimeoutClockStepBack(t *testing.T) {
+	l, cleanup := silentListener(t)
+	defer cleanup()
+
+	// Were the timeout a deadline on the wall clock, a clock stepped back
+	// by an hour would leave the handshake waiting on the silent
+	// listener for an hour.
+	start := time.Now()
+	_, err := Dial(newKey(t), l.Addr().String(), "unused",
+		jumpDialer(time.Hour), WithAdaptiveHandshakeTimeout(1,
+			200*time.Millisecond, 200*time.Millisecond))
+	if err == nil {
+		t.Fatalf("expected handshake to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("handshake took %v to time out", elapsed)
+	}
+}
+
+func TestHandshakeTimeoutClockStepForward(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	// Were the timeout a deadline on the wall clock, a clock stepped
+	// forward by an hour would time the handshake out at once.
+	conn, err := Dial(newKey(t), listener.Addr().String(), pkh,
+		jumpDialer(-time.Hour))
+	if err != nil {
+		t.Fatalf("expected handshake to succeed, got %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,64 @@
+package lndc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxHeaderLength is the largest header which may be exchanged with the
+// remote peer through LocalHeader.
+const MaxHeaderLength = 4096
+
+// ErrHeaderTooLarge is returned when the remote peer sends a header longer
+// than MaxHeaderLength.
+var ErrHeaderTooLarge = errors.New("lndc: peer's header exceeds the " +
+	"maximum length")
+
+// offerHeader offers the initiator's header, if it has one.
+func offerHeader(c *Conn, cfg *Config) []byte {
+	return cfg.LocalHeader
+}
+
+// answerHeader records the initiator's header, if any, and answers with the
+// responder's own.
+func answerHeader(c *Conn, cfg *Config, offer []byte) ([]byte, error) {
+	if err := acceptHeader(c, cfg, offer); err != nil {
+		return nil, err
+	}
+
+	return offerHeader(c, cfg), nil
+}
+
+// acceptHeader records the remote peer's header, if it sent one.
+func acceptHeader(c *Conn, cfg *Config, header []byte) error {
+	if header == nil {
+		return nil
+	}
+	if len(header) > MaxHeaderLength {
+		return ErrHeaderTooLarge
+	}
+
+	// The record points into the noise machine's read buffer, so it's
+	// copied before the next message overwrites it.
+	c.remoteHeader = append([]byte{}, header...)
+
+	return nil
+}
+
+// validateHeader ensures the local header fits within MaxHeaderLength.
+func validateHeader(header []byte) error {
+	if len(header) > MaxHeaderLength {
+		return fmt.Errorf("lndc header of %d bytes exceeds the maximum "+
+			"of %d", len(header), MaxHeaderLength)
+	}
+
+	return nil
+}
+
+// RemoteHeader returns the header sent by the remote peer through its
+// LocalHeader during the handshake, which is available as soon as the
+// connection has been established. nil is returned if the peer didn't send
+// one.
+func (c *Conn) RemoteHeader() []byte {
+	return c.remoteHeader
+}
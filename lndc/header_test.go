@@ -0,0 +1,58 @@
+package lndc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHeaderExchange(t *testing.T) {
+	listenerHeader := []byte("listener v1,v2")
+	dialerHeader := []byte("dialer v2")
+
+	listener, pkh := newTestListener(t, WithLocalHeader(listenerHeader))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh,
+		WithLocalHeader(dialerHeader))
+	defer local.Close()
+	defer remote.Close()
+
+	// Each side's header is readable before anything else is read from
+	// the connection.
+	if !bytes.Equal(local.RemoteHeader(), dialerHeader) {
+		t.Fatalf("expected listener to see %q, got %q", dialerHeader,
+			local.RemoteHeader())
+	}
+	if !bytes.Equal(remote.RemoteHeader(), listenerHeader) {
+		t.Fatalf("expected dialer to see %q, got %q", listenerHeader,
+			remote.RemoteHeader())
+	}
+
+	// Reading application traffic leaves them intact.
+	roundTrip(t, local, remote)
+	if !bytes.Equal(local.RemoteHeader(), dialerHeader) ||
+		!bytes.Equal(remote.RemoteHeader(), listenerHeader) {
+
+		t.Fatalf("headers changed after reading")
+	}
+
+	// A peer which doesn't set a header doesn't send one.
+	local, remote = dialAndAccept(t, listener, pkh, WithFlowWindow(1024))
+	defer local.Close()
+	defer remote.Close()
+	if local.RemoteHeader() != nil {
+		t.Fatalf("expected no header, got %q", local.RemoteHeader())
+	}
+	if !bytes.Equal(remote.RemoteHeader(), listenerHeader) {
+		t.Fatalf("expected dialer to see %q, got %q", listenerHeader,
+			remote.RemoteHeader())
+	}
+}
+
+func TestHeaderTooLarge(t *testing.T) {
+	header := make([]byte, MaxHeaderLength+1)
+	_, err := NewListener(newKey(t), 0, WithLocalHeader(header))
+	if err == nil {
+		t.Fatalf("expected an oversized header to be rejected")
+	}
+}
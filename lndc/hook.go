@@ -0,0 +1,17 @@
+package lndc
+
+// CompletionHook is notified by a listener as each handshake completes,
+// allowing tests of code built on the listener to observe, and serialize,
+// the order in which connections are accepted. Handshakes run concurrently,
+// so connections are otherwise accepted in whatever order the scheduler
+// happens to finish them.
+//
+// NOTE: This is intended for tests only.
+type CompletionHook interface {
+	// HandshakeComplete is called from the handshake goroutine with each
+	// connection that has been authenticated, just before it's handed to
+	// Accept. The connection isn't handed over until it returns, so it
+	// may block to hold back the connection until others have been
+	// accepted.
+	HandshakeComplete(conn *Conn)
+}
@@ -0,0 +1,83 @@
+package lndc
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// orderedHook holds back each connection until all of those with a lower
+// sequence number have been accepted, so that they're accepted in sequence
+// order.
+type orderedHook struct {
+	mtx  sync.Mutex
+	cond *sync.Cond
+	next uint64
+}
+
+func newOrderedHook() *orderedHook {
+	h := &orderedHook{next: 1}
+	h.cond = sync.NewCond(&h.mtx)
+	return h
+}
+
+func (h *orderedHook) HandshakeComplete(conn *Conn) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for conn.Seq() != h.next {
+		h.cond.Wait()
+	}
+}
+
+// accepted releases the connection following the one just accepted.
+func (h *orderedHook) accepted() {
+	h.mtx.Lock()
+	h.next++
+	h.mtx.Unlock()
+	h.cond.Broadcast()
+}
+
+func TestCompletionHookOrdering(t *testing.T) {
+	const numConns = 8
+
+	hook := newOrderedHook()
+	listener, pkh := newTestListener(t, WithCompletionHook(hook))
+	defer listener.Close()
+
+	var wg sync.WaitGroup
+	dialed := make(chan net.Conn, numConns)
+	for i := 0; i < numConns; i++ {
+		key := newKey(t)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := Dial(key, listener.Addr().String(), pkh,
+				net.Dial)
+			if err == nil {
+				dialed <- conn
+			}
+		}()
+	}
+
+	// However the handshakes happen to finish, the connections are
+	// accepted in the order they arrived.
+	for i := 1; i <= numConns; i++ {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("unable to accept: %v", err)
+		}
+		defer conn.Close()
+
+		if seq := conn.(*Conn).Seq(); seq != uint64(i) {
+			t.Fatalf("expected conn %d to be accepted, got %d", i, seq)
+		}
+		hook.accepted()
+	}
+
+	wg.Wait()
+	close(dialed)
+	for conn := range dialed {
+		conn.Close()
+	}
+}
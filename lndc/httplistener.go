@@ -0,0 +1,37 @@
+package lndc
+
+import "net"
+
+// httpListener adapts a Listener for servers such as http.Serve, which give
+// up on the first error returned by Accept unless it's temporary.
+type httpListener struct {
+	*Listener
+}
+
+// HTTPListener returns a net.Listener accepting the listener's connections
+// which, unlike the Listener itself, skips those whose handshake fails
+// rather than returning their error, so that it can be passed to http.Serve
+// to serve HTTP to authenticated peers only. Accept only fails once the
+// listener is closed. The *Conn of each request's connection, and so the
+// peer's identity, can be recovered through the server's ConnContext.
+func (l *Listener) HTTPListener() net.Listener {
+	return httpListener{l}
+}
+
+// Accept waits for and returns the next connection whose handshake succeeds.
+//
+// Part of the net.Listener interface.
+func (h httpListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := h.Listener.Accept()
+		if err == nil {
+			return conn, nil
+		}
+		if h.isClosed() {
+			return nil, err
+		}
+
+		h.cfg.log().Debugf("lndc listener %s: HTTPListener skipping "+
+			"rejected conn: %v", h.id, err)
+	}
+}
@@ -0,0 +1,79 @@
+package lndc
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// remotePubKey is the context key under which the test server stores the
+// identity of each request's peer.
+type remotePubKey struct{}
+
+func TestListenerHTTPServe(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Context().Value(remotePubKey{}).(string)))
+	})
+	server := &http.Server{
+		Handler: mux,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			pub := c.(*Conn).RemotePub().SerializeCompressed()
+			return context.WithValue(ctx, remotePubKey{},
+				hex.EncodeToString(pub))
+		},
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener.HTTPListener())
+	}()
+
+	// A peer failing the handshake doesn't bring the server down.
+	raw, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	raw.Write([]byte("not an act one"))
+	raw.Close()
+
+	key := newKey(t)
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network,
+				addr string) (net.Conn, error) {
+
+				return Dial(key, addr, pkh, net.Dial)
+			},
+		},
+	}
+
+	// The requests share a single kept alive connection.
+	expected := hex.EncodeToString(key.PubKey().SerializeCompressed())
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("http://" + listener.Addr().String() +
+			"/whoami")
+		if err != nil {
+			t.Fatalf("unable to make request: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("unable to read response: %v", err)
+		}
+		if string(body) != expected {
+			t.Fatalf("expected peer %s, got %s", expected, body)
+		}
+	}
+	client.CloseIdleConnections()
+
+	listener.Close()
+	if err := <-served; err == nil {
+		t.Fatalf("expected Serve to return once the listener closed")
+	}
+}
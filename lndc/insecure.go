@@ -0,0 +1,31 @@
+package lndc
+
+import "fmt"
+
+// CipherSuiteInsecureNull is a null cipher suite which sends all messages in
+// the clear, followed by an all-zero tag in place of a MAC. It provides
+// neither confidentiality nor integrity, and is only available in binaries
+// built with the lit_insecure tag. See InsecureNoEncryption.
+const CipherSuiteInsecureNull = "insecure-null"
+
+// errInsecureBuild is returned when InsecureNoEncryption is used within a
+// binary that wasn't built with the lit_insecure tag.
+var errInsecureBuild = fmt.Errorf("lndc: %v requires a binary built with "+
+	"the lit_insecure tag", CipherSuiteInsecureNull)
+
+// WithInsecureNoEncryption is a functional option which, once the handshake has
+// authenticated both peers, sends every message over the connection in
+// plaintext so that the message protocol can be inspected on the wire. Both
+// the dialer and the listener must be given this option, otherwise the
+// connection falls back to an encrypted cipher suite.
+//
+// WARNING: THIS DISABLES ALL PROTECTION OF THE MESSAGES SENT OVER THE
+// CONNECTION, WHICH CAN THEN BE READ AND TAMPERED WITH BY ANYONE ON THE
+// NETWORK PATH. It's intended purely for debugging in tests, and so only
+// works in binaries built with the lit_insecure tag. In any other binary a
+// listener or dialer given this option fails to be created.
+func WithInsecureNoEncryption() func(*Config) {
+	return func(c *Config) {
+		c.CipherSuites = []string{CipherSuiteInsecureNull}
+	}
+}
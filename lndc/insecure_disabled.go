@@ -0,0 +1,8 @@
+//go:build !lit_insecure
+// +build !lit_insecure
+
+package lndc
+
+// insecureBuild reports whether this binary was built with the lit_insecure
+// tag, which permits the use of InsecureNoEncryption.
+const insecureBuild = false
@@ -0,0 +1,35 @@
+//go:build !lit_insecure
+// +build !lit_insecure
+
+package lndc
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+func TestInsecureNoEncryptionUnavailable(t *testing.T) {
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	_, err = NewListener(localPriv, 0, WithInsecureNoEncryption())
+	if err != errInsecureBuild {
+		t.Fatalf("expected %v, got %v", errInsecureBuild, err)
+	}
+}
+
+func TestDebugTeeUnavailable(t *testing.T) {
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	_, err = NewListener(localPriv, 0, WithDebugTee(ioutil.Discard, 1))
+	if err != errDebugTeeBuild {
+		t.Fatalf("expected %v, got %v", errDebugTeeBuild, err)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build lit_insecure
+// +build lit_insecure
+
+package lndc
+
+import (
+	"crypto/cipher"
+	"errors"
+)
+
+// insecureBuild reports whether this binary was built with the lit_insecure
+// tag, which permits the use of InsecureNoEncryption.
+const insecureBuild = true
+
+func init() {
+	cipherSuites[CipherSuiteInsecureNull] = func(key []byte) (cipher.AEAD, error) {
+		return nullAEAD{}, nil
+	}
+}
+
+// errNullTag is returned when a message sent with the null cipher suite is
+// too short to carry its tag.
+var errNullTag = errors.New("lndc: message too short for null tag")
+
+// nullAEAD is a cipher.AEAD which leaves the plaintext untouched, appending
+// an all-zero tag so that the framing of messages is unchanged.
+type nullAEAD struct{}
+
+func (nullAEAD) NonceSize() int { return 12 }
+
+func (nullAEAD) Overhead() int { return macSize }
+
+func (nullAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	dst = append(dst, plaintext...)
+	return append(dst, make([]byte, macSize)...)
+}
+
+func (nullAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < macSize {
+		return nil, errNullTag
+	}
+
+	return append(dst, ciphertext[:len(ciphertext)-macSize]...), nil
+}
@@ -0,0 +1,92 @@
+//go:build lit_insecure
+// +build lit_insecure
+
+package lndc
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// tapConn wraps a net.Conn, recording every byte written over it.
+type tapConn struct {
+	net.Conn
+
+	mtx     sync.Mutex
+	written bytes.Buffer
+}
+
+func (c *tapConn) Write(b []byte) (int, error) {
+	c.mtx.Lock()
+	c.written.Write(b)
+	c.mtx.Unlock()
+
+	return c.Conn.Write(b)
+}
+
+func (c *tapConn) wire() []byte {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return append([]byte(nil), c.written.Bytes()...)
+}
+
+func TestInsecureNoEncryption(t *testing.T) {
+	initiatorPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	responderPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	initiatorPipe, responderPipe := net.Pipe()
+	tap := &tapConn{Conn: initiatorPipe}
+
+	responderChan := make(chan maybeNetConn, 1)
+	go func() {
+		conn, err := UpgradeInbound(responderPipe, responderPriv,
+			WithInsecureNoEncryption())
+		responderChan <- maybeNetConn{conn, err}
+	}()
+
+	initiator, err := Upgrade(tap, initiatorPriv, pkhOf(responderPriv),
+		WithInsecureNoEncryption())
+	if err != nil {
+		t.Fatalf("unable to upgrade outbound conn: %v", err)
+	}
+	defer initiator.Close()
+	result := <-responderChan
+	if result.err != nil {
+		t.Fatalf("unable to upgrade inbound conn: %v", result.err)
+	}
+	responder := result.conn.(*Conn)
+	defer responder.Close()
+
+	for _, conn := range []*Conn{initiator, responder} {
+		if conn.CipherSuite() != CipherSuiteInsecureNull {
+			t.Fatalf("expected cipher suite %v, got %v",
+				CipherSuiteInsecureNull, conn.CipherSuite())
+		}
+	}
+
+	// The message should arrive intact, and be visible on the wire.
+	msg := []byte("plainly visible on the wire")
+	go initiator.Write(msg)
+
+	buf := make([]byte, len(msg))
+	if _, err := responder.Read(buf); err != nil {
+		t.Fatalf("unable to read message: %v", err)
+	}
+	if !bytes.Equal(buf, msg) {
+		t.Fatalf("expected %q, got %q", msg, buf)
+	}
+	if !bytes.Contains(tap.wire(), msg) {
+		t.Fatalf("plaintext wasn't visible on the wire")
+	}
+}
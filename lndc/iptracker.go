@@ -0,0 +1,87 @@
+package lndc
+
+import "sync"
+
+// ipTrackerShards is the number of shards an ipTracker fans its counts out
+// across, so that connections from different IPs rarely contend on the
+// same lock.
+const ipTrackerShards = 64
+
+// ipTracker counts the connections held with each IP. The counts are
+// sharded by a hash of the IP, each shard guarded by a lock of its own, so
+// that a busy listener tracking tens of thousands of connections doesn't
+// serialize on a single lock. Entries are removed as their count falls to
+// zero, bounding the tracker's size by the number of IPs with connections.
+type ipTracker struct {
+	shards [ipTrackerShards]ipShard
+}
+
+// ipShard is a single shard of an ipTracker.
+type ipShard struct {
+	mtx    sync.Mutex
+	counts map[string]int
+}
+
+// shard returns the shard holding the count of ip, picked by its FNV-1a
+// hash.
+func (t *ipTracker) shard(ip string) *ipShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(ip); i++ {
+		hash ^= uint32(ip[i])
+		hash *= 16777619
+	}
+
+	return &t.shards[hash%ipTrackerShards]
+}
+
+// acquire counts a new connection with ip, unless limit connections are
+// already held with it, in which case false is returned. A limit of zero
+// means there is no limit.
+func (t *ipTracker) acquire(ip string, limit int) bool {
+	s := t.shard(ip)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if limit > 0 && s.counts[ip] >= limit {
+		return false
+	}
+	if s.counts == nil {
+		s.counts = make(map[string]int)
+	}
+	s.counts[ip]++
+
+	return true
+}
+
+// release uncounts a connection with ip which was counted by acquire.
+func (t *ipTracker) release(ip string) {
+	s := t.shard(ip)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.counts[ip]--; s.counts[ip] <= 0 {
+		delete(s.counts, ip)
+	}
+}
+
+// count returns the number of connections counted with ip.
+func (t *ipTracker) count(ip string) int {
+	s := t.shard(ip)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.counts[ip]
+}
+
+// size returns the number of IPs with connections counted.
+func (t *ipTracker) size() int {
+	n := 0
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mtx.Lock()
+		n += len(s.counts)
+		s.mtx.Unlock()
+	}
+
+	return n
+}
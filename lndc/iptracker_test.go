@@ -0,0 +1,104 @@
+package lndc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestIPTracker(t *testing.T) {
+	var tracker ipTracker
+
+	// Concurrent acquisitions from the same IP never exceed the limit.
+	const limit = 10
+	var wg sync.WaitGroup
+	acquired := make(chan bool, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			acquired <- tracker.acquire("10.0.0.1", limit)
+		}()
+	}
+	wg.Wait()
+	close(acquired)
+
+	granted := 0
+	for ok := range acquired {
+		if ok {
+			granted++
+		}
+	}
+	if granted != limit || tracker.count("10.0.0.1") != limit {
+		t.Fatalf("expected %d acquired, got %d with a count of %d",
+			limit, granted, tracker.count("10.0.0.1"))
+	}
+
+	// Other IPs are counted independently, and without a limit.
+	for i := 0; i < 1000; i++ {
+		ip := "10.1." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+		if !tracker.acquire(ip, 0) {
+			t.Fatalf("unable to acquire %s", ip)
+		}
+	}
+	if n := tracker.size(); n != 1001 {
+		t.Fatalf("expected 1001 IPs tracked, got %d", n)
+	}
+
+	// Entries are dropped once their count falls to zero.
+	for i := 0; i < limit; i++ {
+		tracker.release("10.0.0.1")
+	}
+	for i := 0; i < 1000; i++ {
+		tracker.release("10.1." + strconv.Itoa(i/256) + "." +
+			strconv.Itoa(i%256))
+	}
+	if n := tracker.size(); n != 0 {
+		t.Fatalf("expected no IPs tracked, got %d", n)
+	}
+}
+
+func TestListenerMaxConnsPerIP(t *testing.T) {
+	listener, pkh := newTestListener(t, WithMaxConnsPerIP(2))
+	defer listener.Close()
+
+	first, remote := dialAndAccept(t, listener, pkh)
+	defer remote.Close()
+	second, remote := dialAndAccept(t, listener, pkh)
+	defer second.Close()
+	defer remote.Close()
+
+	// A third connection from the same IP is closed before the
+	// handshake.
+	if _, err := Dial(newKey(t), listener.Addr().String(), pkh,
+		net.Dial); err == nil {
+
+		t.Fatalf("expected dial beyond the per-IP limit to fail")
+	}
+
+	// Closing an established connection makes room for another.
+	first.Close()
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+}
+
+func BenchmarkIPTracker(b *testing.B) {
+	ips := make([]string, 1024)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("10.%d.%d.%d", i>>16, (i>>8)&0xff, i&0xff)
+	}
+
+	var tracker ipTracker
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			ip := ips[i%len(ips)]
+			tracker.acquire(ip, 0)
+			tracker.release(ip)
+			i++
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package lndc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// ErrInvalidStaticKey is returned when the local static key handed to Dial,
+// NewListener or one of the Upgrade functions can't be used in the
+// handshake. Without this check such a key would only surface as an
+// obscure failure partway through act one, or worse, as a handshake every
+// peer completes with a key nobody holds.
+var ErrInvalidStaticKey = errors.New("lndc: invalid local static key")
+
+// validateStaticKey checks that priv is a usable secp256k1 private key: its
+// scalar is non-zero and below the curve order, and its public key is the
+// point that scalar derives rather than one set inconsistently by hand.
+func validateStaticKey(priv *koblitz.PrivateKey) error {
+	if priv == nil || priv.D == nil {
+		return fmt.Errorf("%v: key is nil", ErrInvalidStaticKey)
+	}
+
+	curve := koblitz.S256()
+	if priv.D.Sign() <= 0 {
+		return fmt.Errorf("%v: scalar is zero or negative",
+			ErrInvalidStaticKey)
+	}
+	if priv.D.Cmp(curve.N) >= 0 {
+		return fmt.Errorf("%v: scalar isn't below the curve order",
+			ErrInvalidStaticKey)
+	}
+
+	x, y := curve.ScalarBaseMult(priv.D.Bytes())
+	if !curve.IsOnCurve(x, y) {
+		return fmt.Errorf("%v: scalar doesn't derive a valid point",
+			ErrInvalidStaticKey)
+	}
+	if priv.X == nil || priv.Y == nil ||
+		priv.X.Cmp(x) != 0 || priv.Y.Cmp(y) != 0 {
+
+		return fmt.Errorf("%v: public key doesn't match scalar",
+			ErrInvalidStaticKey)
+	}
+
+	return nil
+}
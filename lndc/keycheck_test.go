@@ -0,0 +1,98 @@
+package lndc
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// badStaticKeys returns keys that validateStaticKey should reject, each
+// otherwise shaped like a real key.
+func badStaticKeys(t *testing.T) map[string]*koblitz.PrivateKey {
+	curve := koblitz.S256()
+	withScalar := func(d *big.Int) *koblitz.PrivateKey {
+		x, y := curve.ScalarBaseMult(newKey(t).D.Bytes())
+		return &koblitz.PrivateKey{
+			PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+			D:         d,
+		}
+	}
+
+	mismatched := newKey(t)
+	mismatched.PublicKey = newKey(t).PublicKey
+
+	return map[string]*koblitz.PrivateKey{
+		"nil":         nil,
+		"zero":        withScalar(new(big.Int)),
+		"order":       withScalar(new(big.Int).Set(curve.N)),
+		"above order": withScalar(new(big.Int).Add(curve.N, big.NewInt(1))),
+		"mismatched":  mismatched,
+		"missing pub": {D: big.NewInt(1)},
+		"negative":    withScalar(big.NewInt(-1)),
+		"oversized":   withScalar(new(big.Int).Lsh(big.NewInt(1), 256)),
+	}
+}
+
+func assertInvalidStaticKey(t *testing.T, name string, err error) {
+	t.Helper()
+
+	if err == nil || !strings.HasPrefix(err.Error(),
+		ErrInvalidStaticKey.Error()) {
+
+		t.Fatalf("%s: expected %v, got %v", name, ErrInvalidStaticKey, err)
+	}
+}
+
+func TestValidateStaticKey(t *testing.T) {
+	if err := validateStaticKey(newKey(t)); err != nil {
+		t.Fatalf("valid key rejected: %v", err)
+	}
+
+	one, _ := koblitz.PrivKeyFromBytes(koblitz.S256(), []byte{1})
+	if err := validateStaticKey(one); err != nil {
+		t.Fatalf("key of scalar one rejected: %v", err)
+	}
+
+	for name, priv := range badStaticKeys(t) {
+		assertInvalidStaticKey(t, name, validateStaticKey(priv))
+	}
+}
+
+func TestInvalidStaticKeyRejected(t *testing.T) {
+	listener, remotePKH := newTestListener(t)
+	defer listener.Close()
+
+	for name, priv := range badStaticKeys(t) {
+		l, err := NewListener(priv, 0)
+		if err == nil {
+			l.Close()
+		}
+		assertInvalidStaticKey(t, name+" listener", err)
+
+		dialed := false
+		dialer := func(network, addr string) (net.Conn, error) {
+			dialed = true
+			return nil, errConnClosed
+		}
+		_, err = Dial(priv, "127.0.0.1:1", remotePKH, dialer)
+		assertInvalidStaticKey(t, name+" dial", err)
+		if dialed {
+			t.Fatalf("%s: dialed with an invalid key", name)
+		}
+
+		// The connections handed to the Upgrade functions are closed
+		// on rejection, as they would be on a handshake failure.
+		a, b := net.Pipe()
+		_, err = Upgrade(a, priv, remotePKH)
+		assertInvalidStaticKey(t, name+" upgrade", err)
+		_, err = UpgradeInbound(b, priv)
+		assertInvalidStaticKey(t, name+" upgrade inbound", err)
+		if _, err := a.Write([]byte{0}); err == nil {
+			t.Fatalf("%s: connection left open", name)
+		}
+	}
+}
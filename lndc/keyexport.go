@@ -0,0 +1,89 @@
+package lndc
+
+import "errors"
+
+// errKeyExportBuild is returned when InsecureExportKeys is used within a
+// binary that wasn't built with the lit_keyexport tag.
+var errKeyExportBuild = errors.New("lndc: exporting keys requires a " +
+	"binary built with the lit_keyexport tag")
+
+// ErrKeyExportDisabled is returned by ExportKeys for a connection which
+// wasn't created with InsecureExportKeys.
+var ErrKeyExportDisabled = errors.New("lndc: key export not enabled for " +
+	"connection")
+
+// CipherKeys is the state of the cipher protecting one direction of a
+// connection.
+type CipherKeys struct {
+	// Key is the current symmetric key of the cipher suite.
+	Key [32]byte
+
+	// Salt is mixed with Key to derive the next key once Nonce reaches
+	// 1000, after which the nonce resets to zero. Each message's length
+	// header and body take a nonce each.
+	Salt [32]byte
+
+	// Nonce is the nonce of the next message to be encrypted or
+	// decrypted, encoded little endian into the last 8 bytes of the
+	// 12-byte AEAD nonce.
+	Nonce uint64
+}
+
+// SessionKeys are the keys protecting a connection, as exported by
+// ExportKeys.
+type SessionKeys struct {
+	// CipherSuite is the AEAD construction the keys are used with.
+	CipherSuite string
+
+	// Send and Recv are the state of the ciphers protecting the
+	// messages written to and read from the connection.
+	Send CipherKeys
+	Recv CipherKeys
+}
+
+// WithInsecureExportKeys is a functional option which allows the symmetric keys
+// of the connections established with it to be exported via ExportKeys, so
+// that encryption can be offloaded to external hardware once the handshake
+// is complete.
+//
+// WARNING: ANYONE HOLDING THE EXPORTED KEYS CAN READ AND FORGE EVERY
+// MESSAGE SENT OVER THE CONNECTION. They must never be logged or leave the
+// process other than to the device taking over encryption. To guard
+// against accidental use, this option only works in binaries built with the
+// lit_keyexport tag. In any other binary a listener or dialer given this
+// option fails to be created.
+func WithInsecureExportKeys() func(*Config) {
+	return func(c *Config) {
+		c.InsecureExportKeys = true
+	}
+}
+
+// ExportKeys returns the current keys protecting the connection, for an
+// external cipher implementation to take over from. The keys are only
+// meaningful while nothing is read from or written to the connection, as
+// the nonces advance with every message and the keys rotate every 500.
+// ErrKeyExportDisabled is returned unless the connection was created with
+// InsecureExportKeys.
+func (c *Conn) ExportKeys() (*SessionKeys, error) {
+	if !keyExportBuild || !c.keysExportable {
+		return nil, ErrKeyExportDisabled
+	}
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	return &SessionKeys{
+		CipherSuite: c.CipherSuite(),
+		Send:        exportCipherKeys(&c.noise.sendCipher),
+		Recv:        exportCipherKeys(&c.noise.recvCipher),
+	}, nil
+}
+
+// exportCipherKeys copies the keys held by the passed cipherState.
+func exportCipherKeys(c *cipherState) CipherKeys {
+	return CipherKeys{
+		Key:   c.secretKey,
+		Salt:  c.salt,
+		Nonce: c.nonce,
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !lit_keyexport
+// +build !lit_keyexport
+
+package lndc
+
+import "testing"
+
+func TestExportKeysUnavailable(t *testing.T) {
+	_, err := NewListener(newKey(t), 0, WithInsecureExportKeys())
+	if err != errKeyExportBuild {
+		t.Fatalf("expected %v, got %v", errKeyExportBuild, err)
+	}
+}
+
+func TestImportConnUnavailable(t *testing.T) {
+	if _, err := ImportConn(nil, nil); err != errKeyExportBuild {
+		t.Fatalf("expected %v, got %v", errKeyExportBuild, err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build lit_keyexport
+// +build lit_keyexport
+
+package lndc
+
+// keyExportBuild reports whether this binary was built with the
+// lit_keyexport tag, which permits the use of InsecureExportKeys.
+const keyExportBuild = true
@@ -0,0 +1,91 @@
+//go:build lit_keyexport
+// +build lit_keyexport
+
+package lndc
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// openExternally decrypts the next ciphertext of size bytes read from r with
+// the exported keys, advancing their nonce.
+func openExternally(t *testing.T, keys *CipherKeys, r io.Reader,
+	size int) []byte {
+
+	aead, err := chacha20poly1305.New(keys.Key[:])
+	if err != nil {
+		t.Fatalf("unable to create cipher: %v", err)
+	}
+
+	cipherText := make([]byte, size)
+	if _, err := io.ReadFull(r, cipherText); err != nil {
+		t.Fatalf("unable to read ciphertext: %v", err)
+	}
+
+	var nonce [12]byte
+	binary.LittleEndian.PutUint64(nonce[4:], keys.Nonce)
+	keys.Nonce++
+
+	plainText, err := aead.Open(nil, nonce[:], cipherText, nil)
+	if err != nil {
+		t.Fatalf("unable to decrypt with exported keys: %v", err)
+	}
+
+	return plainText
+}
+
+func TestExportKeys(t *testing.T) {
+	listener, pkh := newTestListener(t, WithInsecureExportKeys())
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh,
+		WithInsecureExportKeys())
+	defer local.Close()
+	defer remote.Close()
+
+	senderKeys, err := remote.ExportKeys()
+	if err != nil {
+		t.Fatalf("unable to export keys: %v", err)
+	}
+	receiverKeys, err := local.ExportKeys()
+	if err != nil {
+		t.Fatalf("unable to export keys: %v", err)
+	}
+	if senderKeys.Send != receiverKeys.Recv {
+		t.Fatalf("expected the sender's send keys to match the " +
+			"receiver's receive keys")
+	}
+
+	// A message written by the internal cipher is decrypted externally
+	// from the raw stream with the exported keys.
+	msg := []byte("offloaded")
+	go remote.Write(msg)
+
+	keys := receiverKeys.Recv
+	header := openExternally(t, &keys, local.conn, 2+macSize)
+	length := int(binary.BigEndian.Uint16(header))
+	if length != len(msg) {
+		t.Fatalf("expected length %d, got %d", len(msg), length)
+	}
+	body := openExternally(t, &keys, local.conn, length+macSize)
+	if string(body) != string(msg) {
+		t.Fatalf("expected %q, got %q", msg, body)
+	}
+}
+
+func TestExportKeysNotEnabled(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	if _, err := local.ExportKeys(); err != ErrKeyExportDisabled {
+		t.Fatalf("expected %v, got %v", ErrKeyExportDisabled, err)
+	}
+}
@@ -0,0 +1,53 @@
+package lndc
+
+// MaxExtendedMessageLength is the largest message payload which can be sent
+// once extended lengths have been negotiated. Messages are buffered whole
+// before being decrypted, so this bounds the memory a peer can make us
+// allocate.
+const MaxExtendedMessageLength = 1 << 24
+
+// offerExtendedLength offers extended lengths if the initiator has them
+// enabled. The record carries no value, as its presence alone signals
+// support.
+func offerExtendedLength(c *Conn, cfg *Config) []byte {
+	if !cfg.ExtendedLength {
+		return nil
+	}
+
+	return []byte{}
+}
+
+// answerExtendedLength agrees to extended lengths if they were offered by the
+// initiator and the responder has them enabled too.
+func answerExtendedLength(c *Conn, cfg *Config, offer []byte) ([]byte, error) {
+	if offer == nil || !cfg.ExtendedLength {
+		return nil, nil
+	}
+	if err := acceptExtendedLength(c, cfg, offer); err != nil {
+		return nil, err
+	}
+
+	return []byte{}, nil
+}
+
+// acceptExtendedLength records that the remote peer agreed to extended
+// lengths.
+func acceptExtendedLength(c *Conn, cfg *Config, answer []byte) error {
+	if answer == nil {
+		return nil
+	}
+	if len(answer) != 0 {
+		return ErrMalformedHello
+	}
+
+	c.extendedLength = true
+
+	return nil
+}
+
+// finishExtendedLength switches both directions of the connection over to
+// 4-byte length prefixes if they were agreed. The hellos themselves are
+// always sent with 2-byte prefixes.
+func finishExtendedLength(c *Conn) {
+	c.noise.extendedLength = c.extendedLength
+}
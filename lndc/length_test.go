@@ -0,0 +1,100 @@
+package lndc
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+// sendLarge writes msg from one end of the connection and returns the first
+// message read from the other.
+func sendLarge(t *testing.T, from, to *Conn, msg []byte) []byte {
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := from.Write(msg)
+		errChan <- err
+	}()
+
+	got, err := to.ReadNextMessage()
+	if err != nil {
+		t.Fatalf("unable to read message: %v", err)
+	}
+	for read := len(got); read < len(msg); {
+		rest, err := to.ReadNextMessage()
+		if err != nil {
+			t.Fatalf("unable to read message: %v", err)
+		}
+		read += len(rest)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("unable to write message: %v", err)
+	}
+
+	return got
+}
+
+func TestExtendedLengthDefault(t *testing.T) {
+	msg := bytes.Repeat([]byte("x"), 3*math.MaxUint16)
+
+	// Unless both sides enable extended lengths, messages are split to
+	// fit within a 2-byte length prefix, whether or not the extended
+	// handshake is used.
+	for _, test := range []struct {
+		name             string
+		listener, dialer []func(*Config)
+	}{
+		{"legacy dialer", []func(*Config){WithExtendedLength()}, nil},
+		{"extended dialer", nil, []func(*Config){WithExtendedLength()}},
+	} {
+		listener, pkh := newTestListener(t, test.listener...)
+		local, remote := dialAndAccept(t, listener, pkh, test.dialer...)
+
+		if local.noise.extendedLength || remote.noise.extendedLength {
+			t.Fatalf("%s: extended lengths enabled", test.name)
+		}
+		got := sendLarge(t, remote, local, msg)
+		if len(got) > math.MaxUint16 {
+			t.Fatalf("%s: received a message of %d bytes",
+				test.name, len(got))
+		}
+		roundTrip(t, local, remote)
+
+		local.Close()
+		remote.Close()
+		listener.Close()
+	}
+}
+
+func TestExtendedLength(t *testing.T) {
+	listener, pkh := newTestListener(t, WithExtendedLength())
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh, WithExtendedLength())
+	defer local.Close()
+	defer remote.Close()
+
+	if !local.noise.extendedLength || !remote.noise.extendedLength {
+		t.Fatalf("extended lengths weren't negotiated")
+	}
+
+	// A message too large for a 2-byte length prefix is sent whole, in
+	// either direction.
+	msg := bytes.Repeat([]byte("extended"), math.MaxUint16)
+	if got := sendLarge(t, remote, local, msg); !bytes.Equal(got, msg) {
+		t.Fatalf("expected a single message of %d bytes, got %d",
+			len(msg), len(got))
+	}
+	if got := sendLarge(t, local, remote, msg); !bytes.Equal(got, msg) {
+		t.Fatalf("expected a single message of %d bytes, got %d",
+			len(msg), len(got))
+	}
+	roundTrip(t, local, remote)
+
+	// Anything larger still is split.
+	msg = make([]byte, MaxExtendedMessageLength+1)
+	if got := sendLarge(t, remote, local, msg); len(got) >
+		MaxExtendedMessageLength {
+
+		t.Fatalf("received a message of %d bytes", len(got))
+	}
+}
@@ -1,41 +1,132 @@
 package lndc
 
 import (
+	"context"
 	"errors"
-	"io"
 	"net"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mit-dci/lit/crypto/koblitz"
 )
 
 // defaultHandshakes is the maximum number of handshakes that can be done in
-// parallel.
+// parallel, unless overridden by MaxHandshakes.
 const defaultHandshakes = 1000
 
+// maxPendingHandshakes is the maximum number of accepted connections that
+// can be waiting for a free handshake slot at once.
+const maxPendingHandshakes = 1000
+
 // Listener is an implementation of a net.Conn which executes an authenticated
 // key exchange and message encryption protocol dubbed "Machine" after
 // initial connection acceptance. See the Machine struct for additional
 // details w.r.t the handshake and encryption scheme used within the
 // connection.
 type Listener struct {
+	// seq is the sequence number handed to the most recently accepted
+	// connection. It must only be accessed atomically and is kept first
+	// to guarantee 64-bit alignment.
+	seq uint64
+
 	localStatic *koblitz.PrivateKey
 
 	tcp *net.TCPListener
 
-	handshakeSema chan struct{}
+	// id identifies this listener within log lines.
+	id string
+
+	cfg *Config
+
+	// connMtx guards established, the set of authenticated connections
+	// produced by this listener which haven't yet been closed, and
+	// inFlight, the set of connections still carrying out the handshake.
+	// Both are keyed by connection sequence number. perPeer counts the
+	// established connections with each peer, keyed by its serialized
+	// identity, and perClass those with the peers of each class, whose
+	// rates are limited by classBuckets.
+	connMtx      sync.Mutex
+	established  map[uint64]*Conn
+	inFlight     map[uint64]net.Conn
+	perPeer      map[[33]byte]int
+	perClass     map[string]int
+	classBuckets map[string]*classBucket
+
+	// perIP counts the connections held from each IP if MaxConnsPerIP is
+	// set, from when they're accepted from the network until they're
+	// closed.
+	perIP ipTracker
+
+	// drained holds the authenticated connections which were still
+	// waiting to be accepted when the listener was closed, until they're
+	// claimed by Drain. It's guarded by connMtx.
+	drained []*Conn
+
+	// handshakes tracks the running handshake goroutines, all of which
+	// are started by the dispatch goroutine before it closes listenDone.
+	handshakes sync.WaitGroup
+	listenDone chan struct{}
+
+	// activeHandshakes counts the handshake goroutines currently running.
+	// It must only be accessed atomically.
+	activeHandshakes int32
+
+	// pending holds the accepted connections waiting for a handshake
+	// slot.
+	pending *fairQueue
+
+	// handshakeRates tallies the outcomes of the listener's handshakes
+	// for Stats.
+	handshakeRates *rateTracker
+
+	// pauseMtx guards paused, which is set while the listener is paused,
+	// and resumed, which is closed once it's resumed.
+	pauseMtx sync.Mutex
+	paused   bool
+	resumed  chan struct{}
+
+	// maintMtx guards maintenance, which is set while the listener is in
+	// maintenance mode, and retryAfter, the delay it suggests to the
+	// peers it turns away meanwhile.
+	maintMtx    sync.Mutex
+	maintenance bool
+	retryAfter  time.Duration
+
+	// handler holds the connHandler each connection accepted by Serve is
+	// passed to.
+	handler atomic.Value
+
+	handshakeSema *weightedSema
 	conns         chan maybeConn
 	quit          chan struct{}
+	closeOnce     sync.Once
 }
 
 // A compile-time assertion to ensure that Conn meets the net.Listener interface.
 var _ net.Listener = (*Listener)(nil)
 
 // NewListener returns a new net.Listener which enforces the lndc scheme
-// during both initial connection establishment and data transfer.
-func NewListener(localStatic *koblitz.PrivateKey, port int) (*Listener,
-	error) {
+// during both initial connection establishment and data transfer. The last
+// parameter is a set of variadic functional options used to tune the
+// listener's Config.
+func NewListener(localStatic *koblitz.PrivateKey, port int,
+	options ...func(*Config)) (*Listener, error) {
+
+	if err := validateStaticKey(localStatic); err != nil {
+		return nil, err
+	}
+	cfg := newConfig(options...)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.ListenerID == "" {
+		cfg.ListenerID = newListenerID()
+	}
+	maxHandshakes := cfg.maxHandshakes()
+
 	// since this is a listener, it is sufficient that we just pass the
 	// port and then add the later stuff here
 	str := ":" + strconv.Itoa(port) // colonize!
@@ -50,129 +141,395 @@ func NewListener(localStatic *koblitz.PrivateKey, port int) (*Listener,
 	}
 
 	lndcListener := &Listener{
-		localStatic:   localStatic,
-		tcp:           l,
-		handshakeSema: make(chan struct{}, defaultHandshakes),
-		conns:         make(chan maybeConn),
-		quit:          make(chan struct{}),
-	}
-
-	for i := 0; i < defaultHandshakes; i++ {
-		lndcListener.handshakeSema <- struct{}{}
+		localStatic:    localStatic,
+		tcp:            l,
+		id:             cfg.ListenerID,
+		cfg:            cfg,
+		established:    make(map[uint64]*Conn),
+		perPeer:        make(map[[33]byte]int),
+		perClass:       make(map[string]int),
+		handshakeRates: newRateTracker(time.Now()),
+		classBuckets:   make(map[string]*classBucket),
+		inFlight:       make(map[uint64]net.Conn),
+		handshakeSema:  newWeightedSema(maxHandshakes),
+		conns:          make(chan maybeConn),
+		quit:           make(chan struct{}),
+		listenDone:     make(chan struct{}),
+		pending:        newFairQueue(maxPendingHandshakes, cfg.MaxQueuedPerIP),
 	}
 
 	go lndcListener.listen()
+	go lndcListener.dispatch()
 
 	return lndcListener, nil
 }
 
-// listen accepts connection from the underlying tcp conn, then performs
-// the brontinde handshake procedure asynchronously. A maximum of
-// defaultHandshakes will be active at any given time.
+// NewListenerContext returns a new Listener as NewListener does, which is
+// closed once ctx is done. If ctx is already done, the listener is closed
+// right away.
+func NewListenerContext(ctx context.Context, localStatic *koblitz.PrivateKey,
+	port int, options ...func(*Config)) (*Listener, error) {
+
+	l, err := NewListener(localStatic, port, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-l.quit:
+		}
+	}()
+
+	return l, nil
+}
+
+// listen accepts connections from the underlying tcp conn, queueing them
+// for the dispatch goroutine to perform the brontide handshake procedure.
 //
 // NOTE: This method must be run as a goroutine.
 func (l *Listener) listen() {
 	for {
-		select {
-		case <-l.handshakeSema:
-		case <-l.quit:
+		if !l.waitResumed() {
 			return
 		}
 
 		conn, err := l.tcp.Accept()
 		if err != nil {
+			if l.isClosed() {
+				return
+			}
 			l.rejectConn(err)
-			l.handshakeSema <- struct{}{}
 			continue
 		}
+		if filter := l.cfg.AcceptFilter; filter != nil &&
+			!filter(conn.RemoteAddr()) {
+
+			l.cfg.log().Debugf("lndc listener %s: conn from %v "+
+				"filtered", l.id, conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		if guard := l.cfg.MemoryGuard; guard != nil && guard.overloaded() {
+			l.cfg.log().Debugf("lndc listener %s: conn from %v "+
+				"refused under memory pressure", l.id,
+				conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		if !l.acquireIP(conn) {
+			l.cfg.log().Debugf("lndc listener %s: conn from %v "+
+				"refused, too many conns from IP", l.id,
+				conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		seq := atomic.AddUint64(&l.seq, 1)
+		if !l.pending.push(conn, seq) {
+			l.releaseIP(conn)
+			l.cfg.log().Debugf("lndc listener %s: conn %d from %v "+
+				"dropped, too many pending handshakes", l.id, seq,
+				conn.RemoteAddr())
+		}
+	}
+}
+
+// dispatch hands the queued connections out to handshake slots as they
+// become free, carrying out each handshake asynchronously. Handshakes taking
+// at most MaxHandshakes slots, as estimated by HandshakeCost, will be active
+// at any given time, with the slots shared fairly between the connections'
+// sources.
+//
+// NOTE: This method must be run as a goroutine.
+func (l *Listener) dispatch() {
+	defer close(l.listenDone)
+
+	for {
+		next, ok := l.pending.pop(l.quit)
+		if !ok {
+			return
+		}
 
-		go l.doHandshake(conn)
+		cost := l.handshakeSema.clamp(
+			l.cfg.handshakeCost(next.conn.RemoteAddr()))
+		if !l.handshakeSema.acquire(cost, l.quit) {
+			next.conn.Close()
+			l.releaseIP(next.conn)
+			return
+		}
+
+		// A connection accepted just as the listener was paused is
+		// held back until it's resumed.
+		if !l.waitResumed() {
+			l.handshakeSema.release(cost)
+			next.conn.Close()
+			l.releaseIP(next.conn)
+			return
+		}
+
+		l.handshakes.Add(1)
+		go l.doHandshake(next.conn, next.seq, cost)
 	}
 }
 
 // doHandshake asynchronously performs the lndc handshake, so that it does
 // not block the main accept loop. This prevents peers that delay writing to the
 // connection from block other connection attempts.
-func (l *Listener) doHandshake(conn net.Conn) {
-	defer func() { l.handshakeSema <- struct{}{} }()
-
-	select {
-	case <-l.quit:
+func (l *Listener) doHandshake(conn net.Conn, seq uint64, cost int) {
+	atomic.AddInt32(&l.activeHandshakes, 1)
+	defer func() {
+		atomic.AddInt32(&l.activeHandshakes, -1)
+		l.handshakeSema.release(cost)
+		l.handshakes.Done()
+	}()
+
+	// Track the connection for the duration of the handshake, so that
+	// closing the listener can abort it even if it's blocked on the
+	// network. Once the handshake is over the connection is untracked,
+	// so that an authenticated connection survives the listener being
+	// closed and can be retrieved via Drain.
+	if !l.trackHandshake(seq, conn) {
+		conn.Close()
+		l.releaseIP(conn)
 		return
-	default:
 	}
 
-	lndcConn := &Conn{
-		conn:  conn,
-		noise: NewNoiseMachine(false, l.localStatic),
-	}
-
-	// We'll ensure that we get ActOne from the remote peer in a timely
-	// manner. If they don't respond within 1s, then we'll kill the
-	// connection.
-	conn.SetReadDeadline(time.Now().Add(handshakeReadTimeout))
+	lndcConn := newConn(conn, NewNoiseMachine(false, l.localStatic,
+		l.cfg.machineOptions(false)...), l.cfg)
+	lndcConn.listenerID = l.id
+	lndcConn.seq = seq
 
-	// Attempt to carry out the first act of the handshake protocol. If the
-	// connecting node doesn't know our long-term static public key, then
-	// this portion will fail with a non-nil error.
-	var actOne [ActOneSize]byte
-	if _, err := io.ReadFull(conn, actOne[:]); err != nil {
-		lndcConn.conn.Close()
-		l.rejectConn(err)
-		return
+	start := time.Now()
+	err := l.handshake(lndcConn)
+	l.untrackHandshake(seq)
+	if err != errListenerClosed && !l.isClosed() {
+		l.handshakeRates.record(err == nil, time.Now())
 	}
-	if err := lndcConn.noise.RecvActOne(actOne); err != nil {
-		lndcConn.conn.Close()
-		l.rejectConn(err)
-		return
+	lndcConn.established(start)
+	lndcConn.traceHandshake(err)
+	l.cfg.handshakeDone(conn.RemoteAddr(), lndcConn.handshakeDuration)
+	if err == nil {
+		err = l.turnAway(lndcConn)
+	}
+	if err == nil {
+		err = l.admit(lndcConn)
+	}
+	if err == nil {
+		err = l.cfg.registerConn(lndcConn)
 	}
-	// Next, progress the handshake processes by sending over our ephemeral
-	// key for the session along with an authenticating tag.
-	actTwo, err := lndcConn.noise.GenActTwo()
 	if err != nil {
-		lndcConn.conn.Close()
+		lndcConn.Close()
+		l.releaseIP(conn)
+		if err == errListenerClosed || l.isClosed() {
+			return
+		}
+
+		l.cfg.log().Debugf("lndc listener %s: conn %d from %v rejected: %v",
+			l.id, seq, conn.RemoteAddr(), err)
+		l.audit(lndcConn, err)
 		l.rejectConn(err)
 		return
 	}
-	if _, err := conn.Write(actTwo[:]); err != nil {
-		lndcConn.conn.Close()
-		l.rejectConn(err)
+
+	l.cfg.log().Debugf("lndc listener %s: conn %d from %v accepted", l.id, seq,
+		conn.RemoteAddr())
+	lndcConn.onClose(func() { l.releaseIP(conn) })
+	l.audit(lndcConn, nil)
+	if tee := l.cfg.DebugTee; tee != nil && tee.sample() {
+		l.cfg.log().Warnf("lndc listener %s: teeing conn %d to debug sink",
+			l.id, seq)
+		lndcConn.tee = tee
+	}
+	if l.cfg.CompletionHook != nil {
+		l.cfg.CompletionHook.HandshakeComplete(lndcConn)
+	}
+	l.acceptConn(lndcConn)
+}
+
+// acquireIP counts a connection accepted from the network against the
+// MaxConnsPerIP of its IP, returning false if the IP is already at the
+// limit.
+func (l *Listener) acquireIP(conn net.Conn) bool {
+	if l.cfg.MaxConnsPerIP == 0 {
+		return true
+	}
+
+	return l.perIP.acquire(sourceOf(conn), l.cfg.MaxConnsPerIP)
+}
+
+// releaseIP uncounts a connection counted by acquireIP once it's closed.
+func (l *Listener) releaseIP(conn net.Conn) {
+	if l.cfg.MaxConnsPerIP == 0 {
 		return
 	}
 
+	l.perIP.release(sourceOf(conn))
+}
+
+// ActiveHandshakeGoroutines returns the number of goroutines currently
+// carrying out a handshake on behalf of the listener, including those
+// waiting to hand an authenticated connection to Accept. Once the listener
+// is idle this should fall back to zero, so a count which keeps growing
+// under churn points to a leak.
+func (l *Listener) ActiveHandshakeGoroutines() int {
+	return int(atomic.LoadInt32(&l.activeHandshakes))
+}
+
+// trackHandshake registers a connection which is about to carry out the
+// handshake. False is returned if the listener has already been closed.
+func (l *Listener) trackHandshake(seq uint64, conn net.Conn) bool {
+	l.connMtx.Lock()
+	defer l.connMtx.Unlock()
+
+	if l.isClosed() {
+		return false
+	}
+	l.inFlight[seq] = conn
+
+	return true
+}
+
+// untrackHandshake removes a connection which has finished the handshake,
+// successfully or not, from the in-flight set.
+func (l *Listener) untrackHandshake(seq uint64) {
+	l.connMtx.Lock()
+	delete(l.inFlight, seq)
+	l.connMtx.Unlock()
+}
+
+// isClosed returns true if the listener has been closed.
+func (l *Listener) isClosed() bool {
 	select {
 	case <-l.quit:
-		return
+		return true
 	default:
+		return false
 	}
+}
 
-	// We'll ensure that we get ActTwo from the remote peer in a timely
-	// manner. If they don't respond within 1 second, then we'll kill the
-	// connection.
-	conn.SetReadDeadline(time.Now().Add(handshakeReadTimeout))
+// handshake carries out the responder's side of the three act handshake over
+// the passed connection. errListenerClosed is returned if the listener is
+// shut down part way through.
+func (l *Listener) handshake(lndcConn *Conn) error {
+	return respond(lndcConn, l.cfg, l.quit)
+}
 
-	// Finally, finish the handshake processes by reading and decrypting
-	// the connection peer's static public key. If this succeeds then both
-	// sides have mutually authenticated each other.
-	var actThree [ActThreeSize]byte
-	if _, err := io.ReadFull(conn, actThree[:]); err != nil {
-		lndcConn.conn.Close()
-		l.rejectConn(err)
-		return
+// admit registers a freshly authenticated connection as established,
+// enforcing the MaxConnsPerPeer, ClassLimits and MaxConns caps. Once the MaxConns cap has
+// been reached, the new connection is only admitted if the OverflowPolicy
+// picks an established connection to evict to make room for it.
+func (l *Listener) admit(conn *Conn) error {
+	if l.cfg.Priority != nil {
+		conn.priority = l.cfg.Priority(conn.RemotePub())
 	}
-	if err := lndcConn.noise.RecvActThree(actThree); err != nil {
-		lndcConn.conn.Close()
-		l.rejectConn(err)
+	if l.cfg.Classify != nil {
+		conn.class = l.cfg.Classify(conn.RemoteIdentity())
+	}
+
+	l.connMtx.Lock()
+	peer := peerKey(conn)
+	if l.cfg.MaxConnsPerPeer > 0 &&
+		l.perPeer[peer] >= l.cfg.MaxConnsPerPeer {
+
+		l.connMtx.Unlock()
+		return ErrTooManyConns
+	}
+	if err := l.checkClass(conn, time.Now()); err != nil {
+		l.connMtx.Unlock()
+		return err
+	}
+
+	var evict *Conn
+	if l.cfg.MaxConns > 0 && len(l.established) >= l.cfg.MaxConns {
+		evict = l.evictionCandidate(conn)
+		if evict == nil {
+			l.connMtx.Unlock()
+			return ErrListenerFull
+		}
+		l.untrackEstablished(evict)
+	}
+	l.established[conn.seq] = conn
+	l.perPeer[peer]++
+	l.countClass(conn)
+	l.connMtx.Unlock()
+
+	conn.onClose(func() {
+		l.connMtx.Lock()
+		l.untrackEstablished(conn)
+		l.connMtx.Unlock()
+	})
+
+	if evict != nil {
+		l.cfg.log().Infof("lndc listener %s: evicting conn %d (priority %d) "+
+			"for conn %d (priority %d)", l.id, evict.seq,
+			evict.priority, conn.seq, conn.priority)
+		evict.Close()
+	}
+
+	return nil
+}
+
+// untrackEstablished removes conn from the set of established connections,
+// if it's still within it.
+//
+// NOTE: This method must be called with connMtx held.
+func (l *Listener) untrackEstablished(conn *Conn) {
+	if _, ok := l.established[conn.seq]; !ok {
 		return
 	}
+	delete(l.established, conn.seq)
 
-	// We'll reset the deadline as it's no longer critical beyond the
-	// initial handshake.
-	conn.SetReadDeadline(time.Time{})
+	peer := peerKey(conn)
+	if l.perPeer[peer]--; l.perPeer[peer] == 0 {
+		delete(l.perPeer, peer)
+	}
+	l.uncountClass(conn)
+}
 
-	l.acceptConn(lndcConn)
+// peerKey returns the key under which the connections with conn's peer are
+// counted.
+func peerKey(conn *Conn) [33]byte {
+	var key [33]byte
+	copy(key[:], conn.RemoteIdentity().SerializeCompressed())
+	return key
+}
+
+// lowestPriorityConn returns the established connection with the lowest
+// priority, preferring the oldest connection amongst those of equal priority.
+//
+// NOTE: connMtx must be held by the caller.
+func (l *Listener) lowestPriorityConn() *Conn {
+	var lowest *Conn
+	for _, c := range l.established {
+		if lowest == nil || c.priority < lowest.priority ||
+			(c.priority == lowest.priority && c.seq < lowest.seq) {
+
+			lowest = c
+		}
+	}
+
+	return lowest
 }
 
+// ErrListenerFull is returned when an authenticated connection is refused
+// because the listener already holds MaxConns established connections, none
+// of which is of a lower priority than the new one.
+var ErrListenerFull = errors.New("lndc listener has reached its maximum " +
+	"number of connections")
+
+// ErrTooManyConns is returned when an authenticated connection is refused
+// because the listener already holds MaxConnsPerPeer established connections
+// with the same peer.
+var ErrTooManyConns = errors.New("lndc listener has reached its maximum " +
+	"number of connections with the peer")
+
+// errListenerClosed is used internally to signal that a handshake was
+// abandoned because the listener was closed.
+var errListenerClosed = errors.New("lndc connection closed")
+
 // maybeConn holds either a lndc connection or an error returned from the
 // handshake.
 type maybeConn struct {
@@ -185,6 +542,9 @@ func (l *Listener) acceptConn(conn *Conn) {
 	select {
 	case l.conns <- maybeConn{conn: conn}:
 	case <-l.quit:
+		l.connMtx.Lock()
+		l.drained = append(l.drained, conn)
+		l.connMtx.Unlock()
 	}
 }
 
@@ -208,22 +568,98 @@ func (l *Listener) Accept() (net.Conn, error) {
 	case result := <-l.conns:
 		return result.conn, result.err
 	case <-l.quit:
-		return nil, errors.New("lndc connection closed")
+		return nil, errListenerClosed
 	}
 }
 
+// AcceptN waits for n connections to complete the handshake with the
+// listener, returning them in the order they were accepted. Connections
+// whose handshake fails are skipped. If ctx is done or the listener is
+// closed first, the connections accepted so far are returned along with
+// ctx's error or errListenerClosed respectively.
+func (l *Listener) AcceptN(ctx context.Context, n int) ([]*Conn, error) {
+	conns := make([]*Conn, 0, n)
+	for len(conns) < n {
+		select {
+		case result := <-l.conns:
+			if result.err != nil {
+				l.cfg.log().Debugf("lndc listener %s: AcceptN "+
+					"skipping rejected conn: %v", l.id,
+					result.err)
+				continue
+			}
+			conns = append(conns, result.conn)
+
+		case <-ctx.Done():
+			return conns, ctx.Err()
+
+		case <-l.quit:
+			return conns, errListenerClosed
+		}
+	}
+
+	return conns, nil
+}
+
 // Close closes the listener.  Any blocked Accept operations will be unblocked
-// and return errors.
+// and return errors. Handshakes still in progress are aborted, while
+// connections which completed the handshake but were never accepted remain
+// open and can be retrieved via Drain.
 //
 // Part of the net.Listener interface.
 func (l *Listener) Close() error {
-	select {
-	case <-l.quit:
-	default:
+	l.closeOnce.Do(func() {
 		close(l.quit)
+	})
+	err := l.tcp.Close()
+	l.pending.close()
+
+	// Abort any handshakes still in progress. As quit has already been
+	// closed, no new handshakes can be tracked from here on.
+	l.connMtx.Lock()
+	inFlight := make([]net.Conn, 0, len(l.inFlight))
+	for _, conn := range l.inFlight {
+		inFlight = append(inFlight, conn)
+	}
+	l.connMtx.Unlock()
+
+	for _, conn := range inFlight {
+		conn.Close()
 	}
 
-	return l.tcp.Close()
+	return err
+}
+
+// Drain returns the authenticated connections which were still waiting to be
+// accepted when the listener was closed, allowing them to be handed off
+// during a graceful restart rather than dropped. It must only be called once
+// Close has returned, and blocks until any handshakes aborted by Close have
+// finished. Each connection is returned at most once, in the order in which
+// they were accepted from the network.
+//
+// NOTE: Until they're drained, such connections are held open by the
+// listener. Callers which don't drain them are responsible for closing them
+// via Conns.
+func (l *Listener) Drain() []*Conn {
+	if !l.isClosed() {
+		return nil
+	}
+
+	// Once the dispatch goroutine has exited no more handshakes can be
+	// started, so we can safely wait for those already running.
+	<-l.listenDone
+	l.handshakes.Wait()
+
+	l.connMtx.Lock()
+	drained := l.drained
+	l.drained = nil
+	l.connMtx.Unlock()
+
+	sort.Slice(drained, func(i, j int) bool {
+		return drained[i].seq < drained[j].seq
+	})
+
+	return drained
 }
 
 // Addr returns the listener's network address.
@@ -232,3 +668,40 @@ func (l *Listener) Close() error {
 func (l *Listener) Addr() net.Addr {
 	return l.tcp.Addr()
 }
+
+// Port returns the TCP port the listener is bound to. This is useful when the
+// listener was created with a port of zero, in which case a random free port
+// is chosen by the operating system.
+func (l *Listener) Port() int {
+	return l.tcp.Addr().(*net.TCPAddr).Port
+}
+
+// Conns returns a snapshot of the established connections produced by this
+// listener which haven't yet been closed, ordered by sequence number. The
+// remote peer of each is available via its RemotePub and RemoteAddr methods.
+func (l *Listener) Conns() []*Conn {
+	l.connMtx.Lock()
+	conns := make([]*Conn, 0, len(l.established))
+	for _, conn := range l.established {
+		conns = append(conns, conn)
+	}
+	l.connMtx.Unlock()
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].seq < conns[j].seq
+	})
+
+	return conns
+}
+
+// EnabledExtensions returns the names, as listed by SupportedExtensions, of
+// the handshake extensions configured on the listener. The listener still
+// answers the other extensions its peers offer where it's able to.
+func (l *Listener) EnabledExtensions() []string {
+	return l.cfg.enabledExtensions()
+}
+
+// ID returns the identifier used to correlate this listener's log lines.
+func (l *Listener) ID() string {
+	return l.id
+}
@@ -0,0 +1,963 @@
+package lndc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/lnutil"
+)
+
+// dialAndAccept dials the passed listener with a fresh key and returns both
+// ends of the established connection. Any options are passed to Dial.
+func dialAndAccept(t testing.TB, listener *Listener, pkh string,
+	options ...func(*Config)) (*Conn, *Conn) {
+
+	remotePriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	return dialAndAcceptWithKey(t, listener, pkh, remotePriv, options...)
+}
+
+// dialAndAcceptWithKey dials the passed listener using remotePriv as the
+// dialer's static key and returns both ends of the established connection.
+func dialAndAcceptWithKey(t testing.TB, listener *Listener, pkh string,
+	remotePriv *koblitz.PrivateKey, options ...func(*Config)) (*Conn, *Conn) {
+
+	remoteConnChan := make(chan maybeNetConn, 1)
+	go func() {
+		remoteConn, err := Dial(remotePriv, listener.Addr().String(), pkh,
+			net.Dial, options...)
+		remoteConnChan <- maybeNetConn{remoteConn, err}
+	}()
+
+	localConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("unable to accept connection: %v", err)
+	}
+	remote := <-remoteConnChan
+	if remote.err != nil {
+		t.Fatalf("unable to dial listener: %v", remote.err)
+	}
+
+	return localConn.(*Conn), remote.conn.(*Conn)
+}
+
+// pkhOf returns the lit address of the passed private key's public key.
+func pkhOf(priv *koblitz.PrivateKey) string {
+	var idPub [33]byte
+	copy(idPub[:], priv.PubKey().SerializeCompressed())
+	return lnutil.LitAdrFromPubkey(idPub)
+}
+
+func TestListenerConnSequence(t *testing.T) {
+	listener, pkh, _, err := makeListener()
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	other, err := NewListener(listener.localStatic, 0,
+		WithListenerID("other"))
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer other.Close()
+
+	if listener.ID() == "" {
+		t.Fatalf("expected listener to be assigned a random id")
+	}
+	if other.ID() != "other" {
+		t.Fatalf("expected configured listener id, got %v", other.ID())
+	}
+
+	var lastSeq uint64
+	for i := 0; i < 3; i++ {
+		local, remote := dialAndAccept(t, listener, pkh)
+		defer local.Close()
+		defer remote.Close()
+
+		if local.Seq() <= lastSeq {
+			t.Fatalf("sequence number %v didn't increase past %v",
+				local.Seq(), lastSeq)
+		}
+		lastSeq = local.Seq()
+
+		if local.ListenerID() != listener.ID() {
+			t.Fatalf("expected listener id %v, got %v",
+				listener.ID(), local.ListenerID())
+		}
+		if remote.Seq() != 0 || remote.ListenerID() != "" {
+			t.Fatalf("dialed conn shouldn't carry listener info")
+		}
+	}
+
+	// The sequence is tracked per listener, so the first connection to
+	// the second listener starts again from one.
+	local, remote := dialAndAccept(t, other, pkh)
+	defer local.Close()
+	defer remote.Close()
+	if local.Seq() != 1 || local.ListenerID() != "other" {
+		t.Fatalf("expected seq 1 on listener other, got %v on %v",
+			local.Seq(), local.ListenerID())
+	}
+}
+
+// transcriptRecord is a single act captured by a TranscriptHook.
+type transcriptRecord struct {
+	act  int
+	dir  Direction
+	size int
+}
+
+// transcriptRecorder captures the acts passed to a TranscriptHook.
+type transcriptRecorder struct {
+	mtx     sync.Mutex
+	records []transcriptRecord
+}
+
+func (r *transcriptRecorder) hook(act int, dir Direction, data []byte) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.records = append(r.records, transcriptRecord{act, dir, len(data)})
+}
+
+func TestTranscriptHook(t *testing.T) {
+	var listenerRec, dialerRec transcriptRecorder
+
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	listener, err := NewListener(localPriv, 0,
+		WithTranscriptHook(listenerRec.hook))
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkhOf(localPriv),
+		WithTranscriptHook(dialerRec.hook))
+	defer local.Close()
+	defer remote.Close()
+
+	expectedListener := []transcriptRecord{
+		{1, DirectionReceived, ActOneSize},
+		{2, DirectionSent, ActTwoSize},
+		{3, DirectionReceived, ActThreeSize},
+	}
+	expectedDialer := []transcriptRecord{
+		{1, DirectionSent, ActOneSize},
+		{2, DirectionReceived, ActTwoSize},
+		{3, DirectionSent, ActThreeSize},
+	}
+
+	for name, check := range map[string]struct {
+		rec      *transcriptRecorder
+		expected []transcriptRecord
+	}{
+		"listener": {&listenerRec, expectedListener},
+		"dialer":   {&dialerRec, expectedDialer},
+	} {
+		check.rec.mtx.Lock()
+		records := check.rec.records
+		check.rec.mtx.Unlock()
+
+		if len(records) != len(check.expected) {
+			t.Fatalf("%s: expected %d records, got %v", name,
+				len(check.expected), records)
+		}
+		for i, record := range records {
+			if record != check.expected[i] {
+				t.Fatalf("%s: record %d mismatch: expected %v, "+
+					"got %v", name, i, check.expected[i], record)
+			}
+		}
+	}
+}
+
+func TestListenerPriorityEviction(t *testing.T) {
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	highPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	priority := func(pub *koblitz.PublicKey) int {
+		if pub.IsEqual(highPriv.PubKey()) {
+			return 10
+		}
+		return 0
+	}
+	listener, err := NewListener(localPriv, 0, WithMaxConns(1),
+		WithPriority(priority))
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+	pkh := pkhOf(localPriv)
+
+	// The first, low priority, peer fills the listener to capacity.
+	lowLocal, lowRemote := dialAndAccept(t, listener, pkh)
+	defer lowLocal.Close()
+	defer lowRemote.Close()
+
+	// The high priority peer should displace it.
+	highLocal, highRemote := dialAndAcceptWithKey(t, listener, pkh, highPriv)
+	defer highLocal.Close()
+	defer highRemote.Close()
+
+	if _, err := lowRemote.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected evicted low priority conn to be closed")
+	}
+
+	// Another low priority peer can't displace the high priority one, so
+	// it must be refused.
+	lowPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	go func() {
+		conn, err := Dial(lowPriv, listener.Addr().String(), pkh, net.Dial)
+		if err == nil {
+			defer conn.Close()
+		}
+	}()
+	if _, err := listener.Accept(); err != ErrListenerFull {
+		t.Fatalf("expected ErrListenerFull, got %v", err)
+	}
+
+	// The high priority conn must still be usable.
+	if _, err := highRemote.Write([]byte("still here")); err != nil {
+		t.Fatalf("unable to write to high priority conn: %v", err)
+	}
+	buf := make([]byte, 10)
+	if _, err := highLocal.Read(buf); err != nil {
+		t.Fatalf("unable to read from high priority conn: %v", err)
+	}
+}
+
+// TestListenerCloseAbortsHandshakes ensures that closing the listener tears
+// down connections stalled part way through the handshake immediately,
+// rather than once the handshake read timeout expires.
+func TestListenerCloseAbortsHandshakes(t *testing.T) {
+	listener, _, _, err := makeListener()
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+
+	// Send a valid act one and then never read act two or send act
+	// three, leaving the listener's handshake goroutine blocked.
+	initiatorPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	actOne, err := NewNoiseMachine(true, initiatorPriv).GenActOne()
+	if err != nil {
+		t.Fatalf("unable to generate act one: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(actOne[:]); err != nil {
+		t.Fatalf("unable to write act one: %v", err)
+	}
+
+	// Wait for the handshake to be picked up before closing.
+	for i := 0; ; i++ {
+		listener.connMtx.Lock()
+		n := len(listener.inFlight)
+		listener.connMtx.Unlock()
+		if n == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("handshake never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	listener.Close()
+
+	// Reading past act two, the connection should be torn down well
+	// within the handshake timeout.
+	conn.SetReadDeadline(time.Now().Add(handshakeReadTimeout))
+	_, err = io.Copy(ioutil.Discard, conn)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatalf("connection wasn't closed by the listener")
+	}
+	if elapsed := time.Since(start); elapsed > handshakeReadTimeout/2 {
+		t.Fatalf("handshake took %v to be aborted", elapsed)
+	}
+
+	// The handshake goroutine untracks the connection once it notices
+	// it has been closed, which may be just after we do.
+	for i := 0; ; i++ {
+		listener.connMtx.Lock()
+		n := len(listener.inFlight)
+		listener.connMtx.Unlock()
+		if n == 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("expected no in-flight handshakes after close")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// captureLogger is a Logger which records every line logged through it.
+type captureLogger struct {
+	mtx   sync.Mutex
+	lines []string
+}
+
+func (c *captureLogger) record(level, format string, args ...interface{}) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.lines = append(c.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (c *captureLogger) Debugf(format string, args ...interface{}) {
+	c.record("DEBUG", format, args...)
+}
+
+func (c *captureLogger) Infof(format string, args ...interface{}) {
+	c.record("INFO", format, args...)
+}
+
+func (c *captureLogger) Warnf(format string, args ...interface{}) {
+	c.record("WARN", format, args...)
+}
+
+// matching returns the logged lines which contain all of the passed
+// substrings.
+func (c *captureLogger) matching(substrs ...string) []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var matches []string
+	for _, line := range c.lines {
+		matched := true
+		for _, substr := range substrs {
+			if !strings.Contains(line, substr) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, line)
+		}
+	}
+
+	return matches
+}
+
+// rawHandshake carries out the initiator's side of the handshake with the
+// listener at addr over a plain TCP connection, sleeping for delay before
+// sending act three.
+func rawHandshake(t *testing.T, addr string, delay time.Duration) net.Conn {
+	initiatorPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	initiator := NewNoiseMachine(true, initiatorPriv)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+
+	actOne, err := initiator.GenActOne()
+	if err != nil {
+		t.Fatalf("unable to generate act one: %v", err)
+	}
+	if _, err := conn.Write(actOne[:]); err != nil {
+		t.Fatalf("unable to write act one: %v", err)
+	}
+
+	var actTwo [ActTwoSize]byte
+	if _, err := io.ReadFull(conn, actTwo[:]); err != nil {
+		t.Fatalf("unable to read act two: %v", err)
+	}
+	if _, err := initiator.RecvActTwo(actTwo); err != nil {
+		t.Fatalf("unable to process act two: %v", err)
+	}
+
+	time.Sleep(delay)
+
+	actThree, err := initiator.GenActThree()
+	if err != nil {
+		t.Fatalf("unable to generate act three: %v", err)
+	}
+	if _, err := conn.Write(actThree[:]); err != nil {
+		t.Fatalf("unable to write act three: %v", err)
+	}
+
+	return conn
+}
+
+func TestSlowHandshakeLogging(t *testing.T) {
+	localPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	var logger captureLogger
+	listener, err := NewListener(localPriv, 0, WithLogger(&logger),
+		WithSlowHandshakeThreshold(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	// A handshake well under the threshold shouldn't be reported.
+	local, remote := dialAndAccept(t, listener, pkhOf(localPriv))
+	local.Close()
+	remote.Close()
+	if lines := logger.matching("WARN", "slow handshake"); len(lines) != 0 {
+		t.Fatalf("unexpected slow handshake warning: %v", lines)
+	}
+
+	// One which stalls before sending act three should be.
+	conn := rawHandshake(t, listener.Addr().String(), 200*time.Millisecond)
+	defer conn.Close()
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("unable to accept connection: %v", err)
+	}
+	defer accepted.Close()
+
+	if d := accepted.(*Conn).HandshakeDuration(); d < 200*time.Millisecond {
+		t.Fatalf("expected handshake duration over the delay, got %v", d)
+	}
+	lines := logger.matching("WARN", "slow handshake",
+		conn.LocalAddr().String())
+	if len(lines) != 1 {
+		t.Fatalf("expected a single slow handshake warning, got %v",
+			logger.lines)
+	}
+}
+
+func TestListenerConns(t *testing.T) {
+	listener, pkh, _, err := makeListener()
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	var locals, remotes []*Conn
+	for i := 0; i < 3; i++ {
+		local, remote := dialAndAccept(t, listener, pkh)
+		defer local.Close()
+		defer remote.Close()
+
+		locals = append(locals, local)
+		remotes = append(remotes, remote)
+	}
+
+	assertConns := func(expected ...*Conn) {
+		conns := listener.Conns()
+		if len(conns) != len(expected) {
+			t.Fatalf("expected %d conns, got %d", len(expected),
+				len(conns))
+		}
+		for i, conn := range conns {
+			if conn != expected[i] {
+				t.Fatalf("conn %d mismatch: expected seq %d, got %d",
+					i, expected[i].Seq(), conn.Seq())
+			}
+		}
+	}
+	assertConns(locals...)
+
+	// Each enumerated conn reports the identity of the dialer.
+	for i, conn := range listener.Conns() {
+		if !conn.RemotePub().IsEqual(remotes[i].LocalPub()) {
+			t.Fatalf("conn %d has unexpected remote pubkey", i)
+		}
+		if conn.RemoteAddr().String() != remotes[i].LocalAddr().String() {
+			t.Fatalf("conn %d has unexpected remote address", i)
+		}
+	}
+
+	// Closing a conn removes it from the live set.
+	locals[1].Close()
+	assertConns(locals[0], locals[2])
+}
+
+func TestListenerPort(t *testing.T) {
+	listener, _, _, err := makeListener()
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	port := listener.Port()
+	if port == 0 {
+		t.Fatalf("expected a random non-zero port")
+	}
+
+	_, addrPort, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to parse listener address: %v", err)
+	}
+	if addrPort != strconv.Itoa(port) {
+		t.Fatalf("expected port %d to match address %v", port,
+			listener.Addr())
+	}
+}
+
+func TestListenerDrain(t *testing.T) {
+	listener, pkh, _, err := makeListener()
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+
+	if drained := listener.Drain(); drained != nil {
+		t.Fatalf("expected nothing to drain from an open listener")
+	}
+
+	// Complete the handshake on several conns without ever accepting
+	// them.
+	const numConns = 3
+	var dialed []*Conn
+	for i := 0; i < numConns; i++ {
+		remotePriv, err := koblitz.NewPrivateKey(koblitz.S256())
+		if err != nil {
+			t.Fatalf("unable to generate private key: %v", err)
+		}
+		conn, err := Dial(remotePriv, listener.Addr().String(), pkh,
+			net.Dial)
+		if err != nil {
+			t.Fatalf("unable to dial listener: %v", err)
+		}
+		defer conn.Close()
+		dialed = append(dialed, conn)
+	}
+
+	// Wait for the listener to finish its side of each handshake.
+	for i := 0; len(listener.Conns()) != numConns; i++ {
+		if i == 100 {
+			t.Fatalf("handshakes never completed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	listener.Close()
+	if _, err := listener.Accept(); err == nil {
+		t.Fatalf("expected accept to fail once closed")
+	}
+
+	drained := listener.Drain()
+	if len(drained) != numConns {
+		t.Fatalf("expected %d drained conns, got %d", numConns,
+			len(drained))
+	}
+	for i, conn := range drained {
+		defer conn.Close()
+
+		if conn.Seq() != uint64(i+1) {
+			t.Fatalf("expected conn %d to have seq %d, got %d", i,
+				i+1, conn.Seq())
+		}
+
+		// The drained conns must still be usable.
+		msg := []byte("handed off")
+		if _, err := dialed[i].Write(msg); err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("unable to read from drained conn: %v", err)
+		}
+		if !bytes.Equal(buf, msg) {
+			t.Fatalf("expected %q, got %q", msg, buf)
+		}
+	}
+
+	if drained := listener.Drain(); len(drained) != 0 {
+		t.Fatalf("expected conns to only be drained once")
+	}
+}
+
+func TestListenerAcceptN(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+	addr := listener.Addr().String()
+
+	// dial connects to the listener from a fresh identity, returning the
+	// dialed conn over the channel.
+	dial := func(dialed chan<- net.Conn) {
+		key := newKey(t)
+		go func() {
+			conn, err := Dial(key, addr, pkh, net.Dial)
+			if err != nil {
+				dialed <- nil
+				return
+			}
+			dialed <- conn
+		}()
+	}
+
+	// A connection which hangs up before completing the handshake is
+	// skipped over.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	conn.Close()
+
+	const numConns = 3
+	dialed := make(chan net.Conn, numConns)
+	for i := 0; i < numConns; i++ {
+		dial(dialed)
+	}
+
+	conns, err := listener.AcceptN(context.Background(), numConns)
+	if err != nil {
+		t.Fatalf("unable to accept conns: %v", err)
+	}
+	if len(conns) != numConns {
+		t.Fatalf("expected %d conns, got %d", numConns, len(conns))
+	}
+	for i := 0; i < numConns; i++ {
+		remote := <-dialed
+		if remote == nil {
+			t.Fatalf("unable to dial listener")
+		}
+		defer remote.Close()
+		defer conns[i].Close()
+	}
+
+	// If the context is done part way through, the conns accepted so far
+	// are returned.
+	dial(dialed)
+	ctx, cancel := context.WithTimeout(context.Background(),
+		200*time.Millisecond)
+	defer cancel()
+
+	conns, err = listener.AcceptN(ctx, numConns)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if len(conns) != 1 {
+		t.Fatalf("expected a single conn, got %d", len(conns))
+	}
+	conns[0].Close()
+	if remote := <-dialed; remote != nil {
+		remote.Close()
+	}
+}
+
+func TestListenerMaxConnsPerPeer(t *testing.T) {
+	const limit = 2
+
+	listener, pkh := newTestListener(t, WithMaxConnsPerPeer(limit))
+	defer listener.Close()
+
+	// A peer may hold up to the limit of conns at once.
+	key := newKey(t)
+	var conns []*Conn
+	for i := 0; i < limit; i++ {
+		local, remote := dialAndAcceptWithKey(t, listener, pkh, key)
+		defer local.Close()
+		defer remote.Close()
+		conns = append(conns, local)
+	}
+
+	// Any more are refused.
+	dialErr := make(chan error, 1)
+	go func() {
+		conn, err := Dial(key, listener.Addr().String(), pkh, net.Dial)
+		if err == nil {
+			conn.Close()
+		}
+		dialErr <- err
+	}()
+	if _, err := listener.Accept(); err != ErrTooManyConns {
+		t.Fatalf("expected %v, got %v", ErrTooManyConns, err)
+	}
+	<-dialErr
+
+	// While other peers are unaffected.
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	// Once one of the peer's conns is closed, it may open another.
+	conns[0].Close()
+	local, remote = dialAndAcceptWithKey(t, listener, pkh, key)
+	defer local.Close()
+	defer remote.Close()
+}
+
+func TestListenerHandshakesPerCPU(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(3))
+
+	listener, err := NewListener(newKey(t), 0, WithHandshakesPerCPU(4))
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+	if n := listener.handshakeSema.capacity; n != 12 {
+		t.Fatalf("expected 4 handshakes for each of 3 procs, got %d", n)
+	}
+
+	// An explicit cap takes precedence.
+	listener, err = NewListener(newKey(t), 0, WithHandshakesPerCPU(4),
+		WithMaxHandshakes(5))
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+	if n := listener.handshakeSema.capacity; n != 5 {
+		t.Fatalf("expected MaxHandshakes of 5, got %d", n)
+	}
+}
+
+func TestListenerWeightedHandshakes(t *testing.T) {
+	// Connections from the expensive address are thought to cost three
+	// of the four slots.
+	expensive := net.ParseIP("127.0.0.2")
+	cost := func(addr net.Addr) int {
+		if addr.(*net.TCPAddr).IP.Equal(expensive) {
+			return 3
+		}
+		return 1
+	}
+
+	tests := []struct {
+		name      string
+		expensive int
+		active    int
+	}{
+		{"cheap", 0, 4},
+		{"one expensive", 1, 2},
+		{"all expensive", 4, 1},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			listener, _ := newTestListener(t, WithMaxHandshakes(4),
+				WithHandshakeCost(cost))
+			defer listener.Close()
+
+			// Each connection stalls its handshake, holding on
+			// to its slots. The expensive ones are made first.
+			for i := 0; i < 4; i++ {
+				dialer := &net.Dialer{}
+				if i < test.expensive {
+					dialer.LocalAddr = &net.TCPAddr{IP: expensive}
+				}
+				conn, err := dialer.Dial("tcp",
+					listener.Addr().String())
+				if err != nil {
+					t.Skipf("unable to dial: %v", err)
+				}
+				defer conn.Close()
+
+				// Let the connection reach the dispatcher
+				// before the next is made, so they're
+				// dispatched in order.
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			if n := listener.ActiveHandshakeGoroutines(); n != test.active {
+				t.Fatalf("expected %d active handshakes, got %d",
+					test.active, n)
+			}
+		})
+	}
+}
+
+func TestListenerAcceptFilter(t *testing.T) {
+	filtered := net.ParseIP("127.0.0.2")
+	listener, pkh := newTestListener(t, WithMaxHandshakes(1),
+		WithAcceptFilter(func(addr net.Addr) bool {
+			return !addr.(*net.TCPAddr).IP.Equal(filtered)
+		}))
+	defer listener.Close()
+
+	// Connections from the filtered address are closed before anything
+	// is read from them, even though they never send act one.
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: filtered}}
+	for i := 0; i < 3; i++ {
+		conn, err := dialer.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Skipf("unable to dial from %v: %v", filtered, err)
+		}
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("expected filtered conn to be closed, got %v",
+				err)
+		}
+	}
+
+	// None of them held the only handshake slot, so a connection from
+	// elsewhere completes its handshake straight away.
+	start := time.Now()
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+	if elapsed := time.Since(start); elapsed > handshakeReadTimeout/2 {
+		t.Fatalf("handshake took %v, expected no wait for a slot",
+			elapsed)
+	}
+}
+
+func TestListenerHandshakeGoroutinesStress(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	// Keep accepting, so that no handshake goroutine is left blocked
+	// handing over its result.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if listener.isClosed() {
+				return
+			}
+			if err == nil {
+				conn.Close()
+			}
+		}
+	}()
+
+	// Churn the listener with handshakes which complete alongside ones
+	// whose peer hangs up part way through.
+	const rounds = 50
+	keys := make([]*koblitz.PrivateKey, rounds)
+	for i := range keys {
+		keys[i] = newKey(t)
+	}
+
+	// Some of the connections may be dropped while too many from the
+	// same IP are pending, which is fine as long as nothing leaks.
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		key := key
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			conn, err := Dial(key, listener.Addr().String(), pkh,
+				net.Dial)
+			if err == nil {
+				conn.Close()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				return
+			}
+			conn.Write(make([]byte, ActOneSize/2))
+			conn.Close()
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for listener.ActiveHandshakeGoroutines() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected handshake goroutines to exit, %d "+
+				"still running", listener.ActiveHandshakeGoroutines())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListenerEnabledExtensions(t *testing.T) {
+	supported := SupportedExtensions()
+	if len(supported) != len(extensions) {
+		t.Fatalf("expected %d supported extensions, got %v",
+			len(extensions), supported)
+	}
+
+	listener, _ := newTestListener(t)
+	defer listener.Close()
+	if enabled := listener.EnabledExtensions(); len(enabled) != 0 {
+		t.Fatalf("expected no extensions enabled, got %v", enabled)
+	}
+
+	listener, _ = newTestListener(t, WithFlowWindow(1024),
+		WithSequenceNumbers(), WithCipherSuites(CipherSuiteAESGCM))
+	defer listener.Close()
+	enabled := listener.EnabledExtensions()
+	expected := []string{"cipher-suites", "flow-window", "sequence-numbers"}
+	if strings.Join(enabled, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v enabled, got %v", expected, enabled)
+	}
+	for _, name := range enabled {
+		found := false
+		for _, s := range supported {
+			found = found || s == name
+		}
+		if !found {
+			t.Fatalf("enabled extension %q not supported", name)
+		}
+	}
+}
+
+func TestNewListenerContext(t *testing.T) {
+	localPriv := newKey(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener, err := NewListenerContext(ctx, localPriv, 0)
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	// The listener serves connections until the context is cancelled.
+	local, remote := dialAndAccept(t, listener, pkhOf(localPriv))
+	local.Close()
+	remote.Close()
+
+	acceptErr := make(chan error, 1)
+	go func() {
+		_, err := listener.Accept()
+		acceptErr <- err
+	}()
+
+	cancel()
+
+	select {
+	case err := <-acceptErr:
+		if err != errListenerClosed {
+			t.Fatalf("expected errListenerClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Accept didn't return once the context was cancelled")
+	}
+
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Fatalf("expected the listener's socket to be closed")
+	}
+}
@@ -0,0 +1,96 @@
+package lndc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// listenerStateFormat is the version of the encoding produced by SaveState.
+const listenerStateFormat = 1
+
+// ErrBanListNotSaveable is returned by SaveState and LoadState when the
+// listener's BanList isn't a BanSet, so its bans can't be saved or restored.
+var ErrBanListNotSaveable = errors.New("lndc: listener's ban list isn't " +
+	"a BanSet")
+
+// listenerState is the state of a Listener carried across restarts by
+// SaveState and LoadState.
+type listenerState struct {
+	Format     int
+	BannedPubs [][]byte
+	BannedIPs  []net.IP
+}
+
+// SaveState writes the listener's policy state to w, so that it can be
+// restored by LoadState after a restart. This is the bans of its BanList,
+// which must be a BanSet if set. The per-peer connection counts enforcing
+// MaxConnsPerPeer and MaxConnsPerIP aren't saved, as they count the live
+// connections, which don't outlive the process, and are rebuilt as peers
+// reconnect.
+func (l *Listener) SaveState(w io.Writer) error {
+	state := listenerState{Format: listenerStateFormat}
+
+	if l.cfg.BanList != nil {
+		bans, ok := l.cfg.BanList.(*BanSet)
+		if !ok {
+			return ErrBanListNotSaveable
+		}
+
+		pubs, ips := bans.Bans()
+		for _, pub := range pubs {
+			state.BannedPubs = append(state.BannedPubs,
+				pub.SerializeCompressed())
+		}
+		state.BannedIPs = ips
+	}
+
+	return json.NewEncoder(w).Encode(&state)
+}
+
+// LoadState restores the policy state written by SaveState, adding its bans
+// to those of the listener's BanList. As the BanList can't be replaced while
+// the listener runs, it must have been created with a BanSet for any bans to
+// be restored.
+func (l *Listener) LoadState(r io.Reader) error {
+	var state listenerState
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+	if state.Format != listenerStateFormat {
+		return fmt.Errorf("lndc: unknown listener state format %d",
+			state.Format)
+	}
+	if len(state.BannedPubs) == 0 && len(state.BannedIPs) == 0 {
+		return nil
+	}
+
+	bans, ok := l.cfg.BanList.(*BanSet)
+	if !ok {
+		return ErrBanListNotSaveable
+	}
+
+	// Parse every key before restoring any, so that a corrupt state
+	// leaves the bans untouched.
+	pubs := make([]*koblitz.PublicKey, 0, len(state.BannedPubs))
+	for _, b := range state.BannedPubs {
+		pub, err := koblitz.ParsePubKey(b, koblitz.S256())
+		if err != nil {
+			return err
+		}
+		pubs = append(pubs, pub)
+	}
+
+	for _, pub := range pubs {
+		bans.Ban(pub)
+	}
+	for _, ip := range state.BannedIPs {
+		bans.BanIP(ip)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package lndc
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestListenerStateRestoresBans(t *testing.T) {
+	bannedKey := newKey(t)
+	bannedIP := net.IPv4(192, 0, 2, 1)
+
+	bans := NewBanSet()
+	bans.Ban(bannedKey.PubKey())
+	bans.BanIP(bannedIP)
+	listener, _ := newTestListener(t, WithBanList(bans))
+
+	var state bytes.Buffer
+	if err := listener.SaveState(&state); err != nil {
+		t.Fatalf("unable to save state: %v", err)
+	}
+	listener.Close()
+
+	// A fresh listener, as after a restart, enforces the saved bans once
+	// they're loaded.
+	restored := NewBanSet()
+	listener, pkh := newTestListener(t, WithBanList(restored))
+	defer listener.Close()
+	if err := listener.LoadState(&state); err != nil {
+		t.Fatalf("unable to load state: %v", err)
+	}
+
+	if !restored.IsBanned(nil, bannedIP) {
+		t.Fatalf("expected %v to still be banned", bannedIP)
+	}
+
+	dialErr := make(chan error, 1)
+	go func() {
+		_, err := Dial(bannedKey, listener.Addr().String(), pkh,
+			net.Dial)
+		dialErr <- err
+	}()
+
+	_, err := listener.Accept()
+	banned, ok := err.(ErrBanned)
+	if !ok {
+		t.Fatalf("expected ErrBanned, got %T: %v", err, err)
+	}
+	if !banned.Pub.IsEqual(bannedKey.PubKey()) {
+		t.Fatalf("unexpected ban: %v", banned)
+	}
+	<-dialErr
+
+	// Peers which weren't banned are let through.
+	local, remote := dialAndAccept(t, listener, pkh)
+	local.Close()
+	remote.Close()
+}
+
+func TestListenerStateRequiresBanSet(t *testing.T) {
+	listener, _ := newTestListener(t, WithBanList(&testBanList{}))
+	defer listener.Close()
+
+	var state bytes.Buffer
+	if err := listener.SaveState(&state); err != ErrBanListNotSaveable {
+		t.Fatalf("expected ErrBanListNotSaveable, got %v", err)
+	}
+}
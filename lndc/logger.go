@@ -0,0 +1,42 @@
+package lndc
+
+import (
+	"github.com/mit-dci/lit/logging"
+)
+
+// Logger is the set of logging functions used by lndc. It allows callers to
+// redirect the package's log output, for instance to tag the lines of a
+// particular listener or to capture them within tests.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// defaultLogger is the Logger used when none is configured, which passes all
+// lines through to lit's logging package.
+type defaultLogger struct{}
+
+// Debugf logs a line at the debug level.
+func (defaultLogger) Debugf(format string, args ...interface{}) {
+	logging.Debugf(format, args...)
+}
+
+// Infof logs a line at the info level.
+func (defaultLogger) Infof(format string, args ...interface{}) {
+	logging.Infof(format, args...)
+}
+
+// Warnf logs a line at the warning level.
+func (defaultLogger) Warnf(format string, args ...interface{}) {
+	logging.Warnf(format, args...)
+}
+
+// log returns the Logger to be used for the configuration.
+func (c *Config) log() Logger {
+	if c.Logger == nil {
+		return defaultLogger{}
+	}
+
+	return c.Logger
+}
@@ -0,0 +1,89 @@
+package lndc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// ErrMaintenance is returned by a read from a connection which the remote
+// peer turned away as it's in maintenance, and by the Accept of the listener
+// which turned it away.
+type ErrMaintenance struct {
+	// RetryAfter is the delay after which the peer suggests connecting
+	// again.
+	RetryAfter time.Duration
+}
+
+// Error returns a description of the peer's maintenance.
+func (e ErrMaintenance) Error() string {
+	return fmt.Sprintf("lndc: peer in maintenance, retry after %v",
+		e.RetryAfter)
+}
+
+// EnterMaintenance puts the listener into maintenance mode until
+// ExitMaintenance is called. In maintenance, each peer still completes the
+// handshake, so that it can be told securely, but is then sent a
+// maintenance frame suggesting it retries after retryAfter and the
+// connection closed. The peer surfaces this from its next read as an
+// ErrMaintenance.
+//
+// Frames are only used over connections established through the extended
+// handshake, so a peer which didn't negotiate it only sees the connection
+// close. The delay is sent with a resolution of seconds.
+func (l *Listener) EnterMaintenance(retryAfter time.Duration) {
+	l.maintMtx.Lock()
+	defer l.maintMtx.Unlock()
+
+	l.maintenance = true
+	l.retryAfter = retryAfter
+}
+
+// ExitMaintenance takes the listener out of maintenance mode, so that it
+// accepts connections again.
+func (l *Listener) ExitMaintenance() {
+	l.maintMtx.Lock()
+	defer l.maintMtx.Unlock()
+
+	l.maintenance = false
+	l.retryAfter = 0
+}
+
+// turnAway tells the remote peer of a connection which has completed the
+// handshake to retry later if the listener is in maintenance, returning
+// the ErrMaintenance it was sent.
+func (l *Listener) turnAway(conn *Conn) error {
+	l.maintMtx.Lock()
+	maintenance, retryAfter := l.maintenance, l.retryAfter
+	l.maintMtx.Unlock()
+
+	if !maintenance {
+		return nil
+	}
+
+	if conn.framed {
+		seconds := (retryAfter + time.Second - 1) / time.Second
+		var payload [4]byte
+		binary.BigEndian.PutUint32(payload[:], uint32(seconds))
+
+		conn.armWriteDeadline()
+		if err := conn.writeFrame(frameMaintenance, payload[:]); err != nil {
+			return err
+		}
+	}
+
+	return ErrMaintenance{RetryAfter: retryAfter}
+}
+
+// decodeMaintenance parses the payload of a maintenance frame into the
+// ErrMaintenance to be returned to the reader.
+func decodeMaintenance(payload []byte) error {
+	if len(payload) != 4 {
+		return ErrMalformedFrame
+	}
+	seconds := binary.BigEndian.Uint32(payload)
+
+	return ErrMaintenance{
+		RetryAfter: time.Duration(seconds) * time.Second,
+	}
+}
@@ -0,0 +1,39 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenerMaintenance(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	listener.EnterMaintenance(30 * time.Second)
+
+	// The dialer completes the handshake, then learns from its first
+	// read when it should retry.
+	conn, err := Dial(newKey(t), listener.Addr().String(), pkh, net.Dial,
+		WithFlowWindow(1024))
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Read(make([]byte, 1))
+	expected := ErrMaintenance{RetryAfter: 30 * time.Second}
+	if err != expected {
+		t.Fatalf("expected %v, got %v", expected, err)
+	}
+	if _, err := listener.Accept(); err != expected {
+		t.Fatalf("expected listener to report %v, got %v", expected, err)
+	}
+
+	// Once out of maintenance, connections are accepted again.
+	listener.ExitMaintenance()
+	local, remote := dialAndAccept(t, listener, pkh, WithFlowWindow(1024))
+	defer local.Close()
+	defer remote.Close()
+	roundTrip(t, local, remote)
+}
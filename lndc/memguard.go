@@ -0,0 +1,57 @@
+package lndc
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// memorySampleInterval is how long a MemoryGuard reuses its reading of the
+// runtime's memory statistics, as reading them briefly stops the world.
+const memorySampleInterval = 100 * time.Millisecond
+
+// MemoryGuard protects a listener from running out of memory by having it
+// turn away new connections while memory pressure is above a threshold,
+// trading new connectivity for the stability of those already established.
+// Connections are refused as soon as they're accepted from the network,
+// before any handshake work is done on their behalf. A single MemoryGuard
+// can be shared by any number of listeners via the WithMemoryGuard option.
+type MemoryGuard struct {
+	threshold uint64
+	pressure  func() uint64
+
+	mtx       sync.Mutex
+	sampledAt time.Time
+	sample    uint64
+}
+
+// NewMemoryGuard returns a MemoryGuard which refuses connections while the
+// pressure reported by pressure exceeds threshold. If pressure is nil, the
+// bytes of heap memory in use by the runtime are used instead, sampled at
+// most every memorySampleInterval.
+func NewMemoryGuard(threshold uint64, pressure func() uint64) *MemoryGuard {
+	return &MemoryGuard{
+		threshold: threshold,
+		pressure:  pressure,
+	}
+}
+
+// overloaded reports whether memory pressure is currently above the
+// guard's threshold.
+func (g *MemoryGuard) overloaded() bool {
+	if g.pressure != nil {
+		return g.pressure() > g.threshold
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if time.Since(g.sampledAt) >= memorySampleInterval {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		g.sample = stats.HeapInuse
+		g.sampledAt = time.Now()
+	}
+
+	return g.sample > g.threshold
+}
@@ -0,0 +1,52 @@
+package lndc
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestListenerMemoryGuard(t *testing.T) {
+	var pressure uint64
+	guard := NewMemoryGuard(100, func() uint64 {
+		return atomic.LoadUint64(&pressure)
+	})
+	listener, pkh := newTestListener(t, WithMemoryGuard(guard))
+	defer listener.Close()
+
+	// Above the threshold, connections are closed without a handshake.
+	atomic.StoreUint64(&pressure, 101)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected refused conn to be closed, got %v", err)
+	}
+	if _, err := Dial(newKey(t), listener.Addr().String(), pkh,
+		net.Dial); err == nil {
+
+		t.Fatalf("expected dial to fail under memory pressure")
+	}
+
+	// Once pressure subsides, connections are accepted again.
+	atomic.StoreUint64(&pressure, 100)
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+	roundTrip(t, local, remote)
+}
+
+func TestMemoryGuardRuntimeStats(t *testing.T) {
+	if !NewMemoryGuard(0, nil).overloaded() {
+		t.Fatalf("expected heap in use to exceed a zero threshold")
+	}
+	if NewMemoryGuard(^uint64(0), nil).overloaded() {
+		t.Fatalf("expected heap in use to be below the maximum")
+	}
+}
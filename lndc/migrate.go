@@ -0,0 +1,214 @@
+package lndc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// stateFormat is the version of the encoding produced by ExportState.
+const stateFormat = 1
+
+// ErrConnBusy is returned by ExportState when a message is part way through
+// being read from or written to the connection, or has been read but not yet
+// fully handed to the application by ReadMessageInto.
+var ErrConnBusy = errors.New("lndc: connection has a message in flight")
+
+// connState is the state of a Conn carried between processes by ExportState
+// and ImportConn.
+type connState struct {
+	Format         int
+	Version        byte
+	CipherSuite    string
+	Send           CipherKeys
+	Recv           CipherKeys
+	RemotePub      []byte
+	LocalPub       []byte
+	ExtendedLength bool
+
+	Framed    bool
+	Sequenced bool
+	SendSeq   uint64
+	RecvSeq   uint64
+
+	SendCredits     uint32
+	SendWindow      uint32
+	SendLimited     bool
+	RecvWindow      uint32
+	RecvOutstanding uint32
+	RecvConsumed    uint32
+
+	WriteClosed bool
+	ReadEOF     bool
+	ReadBuf     []byte
+
+	RemoteAdvertisedAddr string
+	RemoteHeader         []byte
+}
+
+// ExportState serializes the state of the connection, including its keys,
+// so that another process handed the underlying socket can resume the
+// session through ImportConn without a new handshake. Nothing may be read
+// from or written to the connection once its state has been exported, and
+// the connection must be abandoned without being closed, as closing it on
+// either side would end the session. The remote peer's certificate and
+// chain hash aren't carried over.
+//
+// Like ExportKeys, ExportState returns ErrKeyExportDisabled unless the
+// connection was created with InsecureExportKeys, as the exported state
+// allows anyone holding it to read and forge the connection's messages.
+// ErrConnBusy is returned if a message is in flight.
+func (c *Conn) ExportState() ([]byte, error) {
+	if !keyExportBuild || !c.keysExportable {
+		return nil, ErrKeyExportDisabled
+	}
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	if c.noise.nextHeaderRead != 0 || c.noise.nextBodyLen != 0 ||
+		len(c.pendingWrite) > 0 || c.heldMessage != nil {
+
+		return nil, ErrConnBusy
+	}
+
+	c.flowMtx.Lock()
+	defer c.flowMtx.Unlock()
+
+	if c.pendingCredit != 0 || c.creditWriters != 0 {
+		return nil, ErrConnBusy
+	}
+
+	state := connState{
+		Format:         stateFormat,
+		Version:        c.noise.version,
+		CipherSuite:    c.CipherSuite(),
+		Send:           exportCipherKeys(&c.noise.sendCipher),
+		Recv:           exportCipherKeys(&c.noise.recvCipher),
+		RemotePub:      c.RemotePub().SerializeCompressed(),
+		LocalPub:       c.LocalPub().SerializeCompressed(),
+		ExtendedLength: c.extendedLength,
+
+		Framed:    c.framed,
+		Sequenced: c.sequenced,
+		SendSeq:   c.sendSeq,
+		RecvSeq:   c.recvSeq,
+
+		SendCredits:     c.sendCredits,
+		SendWindow:      c.sendWindow,
+		SendLimited:     c.sendLimited,
+		RecvWindow:      c.recvWindow,
+		RecvOutstanding: c.recvOutstanding,
+		RecvConsumed:    c.recvConsumed,
+
+		WriteClosed: c.writeClosed,
+		ReadEOF:     c.readEOF,
+		ReadBuf:     c.readBuf.Bytes(),
+
+		RemoteAdvertisedAddr: c.remoteAdvertisedAddr,
+		RemoteHeader:         c.remoteHeader,
+	}
+
+	return json.Marshal(&state)
+}
+
+// ImportConn resumes a session over the socket f, using the state exported
+// from its previous Conn by ExportState. The file is duplicated, so f may
+// be closed once ImportConn returns. The local static private key isn't
+// part of the state, though the returned Conn's state may be exported once
+// more. ImportConn fails unless the binary was built with the lit_keyexport
+// tag.
+func ImportConn(f *os.File, state []byte) (*Conn, error) {
+	if !keyExportBuild {
+		return nil, errKeyExportBuild
+	}
+
+	var s connState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return nil, err
+	}
+	if s.Format != stateFormat {
+		return nil, fmt.Errorf("lndc: unknown connection state format %d",
+			s.Format)
+	}
+	if _, ok := cipherSuites[s.CipherSuite]; !ok {
+		return nil, fmt.Errorf("lndc: unknown cipher suite %q",
+			s.CipherSuite)
+	}
+
+	remotePub, err := koblitz.ParsePubKey(s.RemotePub, koblitz.S256())
+	if err != nil {
+		return nil, err
+	}
+	localPub, err := koblitz.ParsePubKey(s.LocalPub, koblitz.S256())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.FileConn(f)
+	if err != nil {
+		return nil, err
+	}
+
+	noise := &Machine{
+		maxVersion:        s.Version,
+		version:           s.Version,
+		initialBufferSize: math.MaxUint16 + macSize,
+		extendedLength:    s.ExtendedLength,
+	}
+	noise.remoteStatic = remotePub
+	noise.sendCipher = importCipherKeys(s.CipherSuite, s.Send)
+	noise.recvCipher = importCipherKeys(s.CipherSuite, s.Recv)
+	noise.nextCipherText = make([]byte, noise.initialBufferSize)
+	noise.nextSendText = make([]byte, noise.initialBufferSize)
+
+	cfg := newConfig()
+	cfg.InsecureExportKeys = true
+	c := newConn(conn, noise, cfg)
+	c.localPub = localPub
+	c.suite = s.CipherSuite
+	c.extendedLength = s.ExtendedLength
+
+	c.framed = s.Framed
+	c.sequenced = s.Sequenced
+	c.sendSeq = s.SendSeq
+	c.recvSeq = s.RecvSeq
+
+	c.sendCredits = s.SendCredits
+	c.sendWindow = s.SendWindow
+	c.sendLimited = s.SendLimited
+	c.recvWindow = s.RecvWindow
+	c.recvOutstanding = s.RecvOutstanding
+	c.recvConsumed = s.RecvConsumed
+	if c.framed {
+		c.creditSignal = make(chan struct{}, 1)
+	}
+
+	c.writeClosed = s.WriteClosed
+	c.readEOF = s.ReadEOF
+	c.readBuf.Write(s.ReadBuf)
+
+	c.remoteAdvertisedAddr = s.RemoteAdvertisedAddr
+	c.remoteHeader = s.RemoteHeader
+
+	c.snapshotNonces()
+	c.snapshotRecvNonce()
+
+	return c, nil
+}
+
+// importCipherKeys recreates a cipherState of the passed suite from keys
+// exported by exportCipherKeys.
+func importCipherKeys(suite string, keys CipherKeys) cipherState {
+	c := cipherState{suite: suite}
+	c.InitializeKey(keys.Key)
+	c.salt = keys.Salt
+	c.nonce = keys.Nonce
+
+	return c
+}
@@ -0,0 +1,123 @@
+//go:build lit_keyexport
+// +build lit_keyexport
+
+package lndc
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// migrate exports the state of c and resumes its session over a duplicate
+// of its socket, abandoning c as a process handing it over would.
+func migrate(t *testing.T, c *Conn) *Conn {
+	state, err := c.ExportState()
+	if err != nil {
+		t.Fatalf("unable to export state: %v", err)
+	}
+
+	f, err := c.conn.(*net.TCPConn).File()
+	if err != nil {
+		t.Fatalf("unable to get socket file: %v", err)
+	}
+	defer f.Close()
+
+	imported, err := ImportConn(f, state)
+	if err != nil {
+		t.Fatalf("unable to import connection: %v", err)
+	}
+	c.conn.Close()
+
+	return imported
+}
+
+func TestImportConn(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []func(*Config)
+	}{
+		{"unframed", nil},
+		{"framed", []func(*Config){WithFlowWindow(1 << 12)}},
+		{"sequenced", []func(*Config){WithSequenceNumbers()}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			options := append(test.options,
+				WithInsecureExportKeys())
+			listener, pkh := newTestListener(t, options...)
+			defer listener.Close()
+
+			local, remote := dialAndAccept(t, listener, pkh, options...)
+			defer remote.Close()
+
+			// Plaintext already read from the socket but not
+			// yet by the application travels with the state.
+			if _, err := remote.Write([]byte("before migration")); err != nil {
+				t.Fatalf("unable to write: %v", err)
+			}
+			readExactly(t, local, "before")
+
+			local = migrate(t, local)
+			defer local.Close()
+
+			readExactly(t, local, " migration")
+			if !local.LocalPub().IsEqual(remote.RemotePub()) {
+				t.Fatalf("local static key not carried over")
+			}
+
+			// Enough messages are sent each way for the keys to
+			// rotate after the migration.
+			for i := 0; i < 300; i++ {
+				roundTrip(t, local, remote)
+			}
+
+			// The imported connection can be migrated again.
+			local = migrate(t, local)
+			defer local.Close()
+			roundTrip(t, local, remote)
+		})
+	}
+}
+
+func TestExportStateBusy(t *testing.T) {
+	listener, pkh := newTestListener(t, WithInsecureExportKeys())
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh,
+		WithInsecureExportKeys())
+	defer local.Close()
+	defer remote.Close()
+
+	msg := bytes.Repeat([]byte{1}, 100)
+	if _, err := remote.Write(msg); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	if _, err := local.ReadMessageInto(make([]byte, 10)); err != ErrShortBuffer {
+		t.Fatalf("expected %v, got %v", ErrShortBuffer, err)
+	}
+
+	if _, err := local.ExportState(); err != ErrConnBusy {
+		t.Fatalf("expected %v, got %v", ErrConnBusy, err)
+	}
+}
+
+func TestExportStateNotEnabled(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	if _, err := local.ExportState(); err != ErrKeyExportDisabled {
+		t.Fatalf("expected %v, got %v", ErrKeyExportDisabled, err)
+	}
+	if _, err := io.WriteString(local, "still usable"); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	readExactly(t, remote, "still usable")
+}
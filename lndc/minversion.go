@@ -0,0 +1,49 @@
+package lndc
+
+import (
+	"fmt"
+)
+
+// ErrClientTooOld is returned when a handshake is abandoned as the remote
+// peer revealed a handshake version below the configured MinPeerVersion.
+type ErrClientTooOld struct {
+	// Version is the handshake version the peer revealed.
+	Version byte
+
+	// MinVersion is the lowest version that would have been accepted.
+	MinVersion byte
+}
+
+// Error returns a description of the peer's version.
+func (e ErrClientTooOld) Error() string {
+	return fmt.Sprintf("lndc: peer handshake version %d is below the "+
+		"minimum of %d", e.Version, e.MinVersion)
+}
+
+// WithMinPeerVersion is a functional option that sets the lowest handshake
+// version accepted from a remote peer.
+func WithMinPeerVersion(version byte) func(*Config) {
+	return func(c *Config) {
+		c.MinPeerVersion = version
+	}
+}
+
+// WithLegacyFallback is a functional option that allows a dialer refused by a
+// peer predating the extended handshake to redial offering only the original
+// version.
+func WithLegacyFallback() func(*Config) {
+	return func(c *Config) {
+		c.LegacyFallback = true
+	}
+}
+
+// checkPeerVersion returns ErrClientTooOld if the remote peer of conn
+// revealed a handshake version below the configured MinPeerVersion.
+func (c *Config) checkPeerVersion(conn *Conn) error {
+	version := conn.noise.RemoteVersion()
+	if version < c.MinPeerVersion {
+		return ErrClientTooOld{Version: version, MinVersion: c.MinPeerVersion}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMinPeerVersion(t *testing.T) {
+	listener, pkh := newTestListener(t,
+		WithMinPeerVersion(ExtendedHandshakeVersion))
+	defer listener.Close()
+
+	// A peer without any extensions configured only offers the original
+	// version, so is turned away once authenticated.
+	key := newKey(t)
+	dialed := make(chan struct{})
+	go func() {
+		defer close(dialed)
+		conn, err := Dial(key, listener.Addr().String(), pkh, net.Dial)
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	_, err := listener.Accept()
+	<-dialed
+	expected := ErrClientTooOld{
+		Version:    HandshakeVersion,
+		MinVersion: ExtendedHandshakeVersion,
+	}
+	if err != expected {
+		t.Fatalf("expected %v, got %v", expected, err)
+	}
+
+	// A peer offering the extended handshake is accepted.
+	local, remote := dialAndAccept(t, listener, pkh, WithFlowWindow(1<<16))
+	defer local.Close()
+	defer remote.Close()
+	roundTrip(t, local, remote)
+
+	// As is a dialer which requires it itself, offering it even without
+	// any extensions configured.
+	local, remote = dialAndAccept(t, listener, pkh,
+		WithMinPeerVersion(ExtendedHandshakeVersion))
+	defer local.Close()
+	defer remote.Close()
+	if remote.noise.Version() != ExtendedHandshakeVersion {
+		t.Fatalf("expected version %d negotiated, got %d",
+			ExtendedHandshakeVersion, remote.noise.Version())
+	}
+	roundTrip(t, local, remote)
+}
+
+func TestMinPeerVersionDefault(t *testing.T) {
+	// By default, peers of every version are accepted.
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+	if local.noise.RemoteVersion() != HandshakeVersion {
+		t.Fatalf("expected version %d revealed, got %d",
+			HandshakeVersion, local.noise.RemoteVersion())
+	}
+	roundTrip(t, local, remote)
+
+	// A minimum no peer could meet is refused outright.
+	_, err := NewListener(newKey(t), 0,
+		WithMinPeerVersion(ExtendedHandshakeVersion+1))
+	if err == nil {
+		t.Fatalf("expected an unsupported minimum version to be refused")
+	}
+}
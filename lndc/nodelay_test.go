@@ -0,0 +1,62 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package lndc
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+// noDelay reads TCP_NODELAY from the socket underlying the passed Conn.
+func noDelay(t *testing.T, c *Conn) bool {
+	raw, err := c.conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("unable to get raw conn: %v", err)
+	}
+
+	var value int
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd),
+			syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+	})
+	if err != nil || sockErr != nil {
+		t.Fatalf("unable to read TCP_NODELAY: %v %v", err, sockErr)
+	}
+
+	return value != 0
+}
+
+func TestNoDelay(t *testing.T) {
+	listener, pkh := newTestListener(t, WithNoDelay(false))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	// The listener's default applies to its own conns only.
+	if noDelay(t, local) {
+		t.Fatalf("expected TCP_NODELAY to be off on the accepted conn")
+	}
+	if !noDelay(t, remote) {
+		t.Fatalf("expected TCP_NODELAY to be on on the dialed conn")
+	}
+
+	if err := local.SetNoDelay(true); err != nil {
+		t.Fatalf("unable to set no delay: %v", err)
+	}
+	if !noDelay(t, local) {
+		t.Fatalf("expected TCP_NODELAY to be on once set")
+	}
+
+	// A conn over a pipe has no TCP settings.
+	initiator, responder, _, _ := upgradePipe(t)
+	defer initiator.Close()
+	defer responder.Close()
+	if err := initiator.SetNoDelay(true); err != ErrNotTCP {
+		t.Fatalf("expected %v, got %v", ErrNotTCP, err)
+	}
+}
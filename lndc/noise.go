@@ -8,9 +8,9 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net"
 	"time"
 
-	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/hkdf"
 
 	"github.com/mit-dci/lit/crypto/koblitz"
@@ -31,6 +31,11 @@ const (
 	// length of a message payload.
 	lengthHeaderSize = 2
 
+	// extendedLengthHeaderSize is the number of bytes used to prefix
+	// encode the length of a message payload once extended lengths have
+	// been negotiated.
+	extendedLengthHeaderSize = 4
+
 	// keyRotationInterval is the number of messages sent on a single
 	// cipher stream before the keys are rotated forwards.
 	keyRotationInterval = 1000
@@ -42,6 +47,25 @@ const (
 	handshakeReadTimeout = time.Second * 5 // not 10 because of litrpc
 )
 
+// CurveSecp256k1 names the secp256k1 curve, which is the only curve lndc
+// handshakes are currently defined over.
+const CurveSecp256k1 = "secp256k1"
+
+// ErrCurveMismatch is returned when the remote peer presents an ephemeral key
+// which isn't encoded as a compressed point on the pinned curve. Rejecting
+// these outright guards against a party attempting to steer the handshake
+// onto a different curve or key type.
+var ErrCurveMismatch = errors.New("remote ephemeral key isn't a compressed " +
+	CurveSecp256k1 + " point")
+
+// ErrInvalidEphemeral is returned when the ephemeral key presented by the
+// remote peer during the handshake doesn't decode to a valid point on the
+// secp256k1 curve. As the ephemeral key is used directly within an ECDH
+// operation, this is treated as a crypto-level failure rather than an
+// ordinary handshake error.
+var ErrInvalidEphemeral = errors.New("remote ephemeral key is not a valid " +
+	"secp256k1 point")
+
 // ecdh performs an ECDH operation between pub and priv. The returned value is
 // the sha256 of the compressed shared point.
 func ecdh(pub *koblitz.PublicKey, priv *koblitz.PrivateKey) []byte {
@@ -54,6 +78,36 @@ func ecdh(pub *koblitz.PublicKey, priv *koblitz.PrivateKey) []byte {
 	return h[:]
 }
 
+// parseEphemeral decodes a compressed ephemeral public key sent by the remote
+// peer. ErrCurveMismatch is returned if the key isn't encoded as a compressed
+// secp256k1 point, and ErrInvalidEphemeral if it isn't a valid curve point.
+func parseEphemeral(e []byte) (*koblitz.PublicKey, error) {
+	if len(e) != 33 || (e[0] != 0x02 && e[0] != 0x03) {
+		return nil, ErrCurveMismatch
+	}
+
+	pub, err := koblitz.ParsePubKey(e, koblitz.S256())
+	if err != nil || !validEphemeral(pub) {
+		return nil, ErrInvalidEphemeral
+	}
+
+	return pub, nil
+}
+
+// validEphemeral returns true if pub is a finite point on the secp256k1
+// curve. secp256k1 has a cofactor of one, so any such point lies in the
+// prime order group and is safe to use within an ECDH operation.
+func validEphemeral(pub *koblitz.PublicKey) bool {
+	if pub == nil || pub.X == nil || pub.Y == nil {
+		return false
+	}
+	if pub.X.Sign() == 0 && pub.Y.Sign() == 0 {
+		return false
+	}
+
+	return koblitz.S256().IsOnCurve(pub.X, pub.Y)
+}
+
 // cipherState encapsulates the state for the AEAD which will be used to
 // encrypt+authenticate any payloads sent during the handshake, and messages
 // sent once the handshake has completed.
@@ -71,9 +125,14 @@ type cipherState struct {
 	// generate new keys.
 	salt [32]byte
 
-	// cipher is an instance of the ChaCha20-Poly1305 AEAD construction
-	// created using the secretKey above.
+	// cipher is an instance of the AEAD construction created using the
+	// secretKey above. Unless another cipher suite has been negotiated,
+	// this is ChaCha20-Poly1305.
 	cipher cipher.AEAD
+
+	// suite is the cipher suite used to instantiate cipher. An empty
+	// suite denotes the default, CipherSuiteChaChaPoly.
+	suite string
 }
 
 // Encrypt returns a ciphertext which is the encryption of the plainText
@@ -111,6 +170,34 @@ func (c *cipherState) Decrypt(associatedData, plainText, cipherText []byte) ([]b
 	return c.cipher.Open(plainText, nonce[:], cipherText, associatedData)
 }
 
+// decryptEither decrypts the passed ciphertext observing ad within the AEAD
+// construction, or failing that no associated data at all, advancing the
+// nonce only once. withAD reports whether ad was observed, and ErrAADMismatch
+// is returned if neither authenticates the ciphertext.
+func (c *cipherState) decryptEither(ad, dst, cipherText []byte) (
+	plainText []byte, withAD bool, err error) {
+
+	defer func() {
+		c.nonce++
+
+		if c.nonce == keyRotationInterval {
+			c.rotateKey()
+		}
+	}()
+
+	var nonce [12]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.nonce)
+
+	if plainText, err = c.cipher.Open(dst, nonce[:], cipherText, ad); err == nil {
+		return plainText, true, nil
+	}
+	if plainText, err = c.cipher.Open(dst, nonce[:], cipherText, nil); err != nil {
+		return nil, false, ErrAADMismatch
+	}
+
+	return plainText, false, nil
+}
+
 // InitializeKey initializes the secret key and AEAD cipher scheme based off of
 // the passed key.
 func (c *cipherState) InitializeKey(key [32]byte) {
@@ -119,7 +206,15 @@ func (c *cipherState) InitializeKey(key [32]byte) {
 
 	// Safe to ignore the error here as our key is properly sized
 	// (32-bytes).
-	c.cipher, _ = chacha20poly1305.New(c.secretKey[:])
+	c.cipher, _ = newAEAD(c.suite, c.secretKey[:])
+}
+
+// wipe zeroes the cipherState's key and salt, and drops its AEAD instance.
+func (c *cipherState) wipe() {
+	c.secretKey = [32]byte{}
+	c.salt = [32]byte{}
+	c.nonce = 0
+	c.cipher = nil
 }
 
 // InitializeKeyWithSalt is identical to InitializeKey however it also sets the
@@ -292,6 +387,31 @@ func EphemeralGenerator(gen func() (*koblitz.PrivateKey, error)) func(*Machine)
 	}
 }
 
+// MaxHandshakeVersion is a functional option that sets the highest handshake
+// version supported by the Machine. An initiator offers this version within
+// act one, while a responder negotiates down to the lower of it and the
+// initiator's offer. The function closure returned by this function can be
+// passed into NewNoiseMachine as a function option parameter.
+func MaxHandshakeVersion(version byte) func(*Machine) {
+	return func(m *Machine) {
+		m.maxVersion = version
+	}
+}
+
+// InitialBufferSize is a functional option that sets the size at which the
+// Machine first allocates its buffers for reading and writing messages,
+// which are then grown on demand to fit larger ones. By default they're
+// allocated to fit the largest message possible without extended lengths,
+// so they never need to grow. Starting smaller saves memory for
+// connections which only ever carry small messages. The function closure
+// returned by this function can be passed into NewNoiseMachine as a
+// function option parameter.
+func InitialBufferSize(size int) func(*Machine) {
+	return func(m *Machine) {
+		m.initialBufferSize = size
+	}
+}
+
 // Machine is a state-machine which implements lndc: an
 // Authenticated-key Exchange in Three Acts. lndc is derived from the Noise
 // framework, specifically implementing the Noise_XX handshake. Once the
@@ -327,21 +447,63 @@ type Machine struct {
 
 	ephemeralGen func() (*koblitz.PrivateKey, error)
 
+	// maxVersion is the highest handshake version this machine supports,
+	// which the initiator offers within act one. version is the version
+	// negotiated for the handshake, and remoteVersion is the version
+	// offered by the initiator as seen by the responder, or that answered
+	// by the responder as seen by the initiator.
+	maxVersion    byte
+	version       byte
+	remoteVersion byte
+
 	handshakeState
 
 	// nextCipherHeader is a static buffer that we'll use to read in the
 	// next ciphertext header from the wire. The header is a 2 byte length
 	// (of the next ciphertext), followed by a 16 byte MAC.
-	nextCipherHeader [lengthHeaderSize + macSize]byte
-
-	// nextCipherText is a static buffer that we'll use to read in the
-	// bytes of the next cipher text message. As all messages in the
-	// protocol MUST be below 65KB plus our macSize, this will be
-	// sufficient to buffer all messages from the socket when we need to
-	// read the next one. Having a fixed buffer that's re-used also means
-	// that we save on allocations as we don't need to create a new one
-	// each time.
-	nextCipherText [math.MaxUint16 + macSize]byte
+	nextCipherHeader [extendedLengthHeaderSize + macSize]byte
+
+	// nextCipherText is a buffer that we'll use to read in the bytes of
+	// the next cipher text message. Unless extended lengths have been
+	// negotiated, all messages in the protocol MUST be below 65KB plus
+	// our macSize, so by default it's allocated at that size to buffer
+	// any message from the socket without growing. Having a buffer
+	// that's re-used also means that we save on allocations as we don't
+	// need to create a new one each time. It's grown to fit the largest
+	// message read so far.
+	nextCipherText []byte
+
+	// nextSendHeader and nextSendText are buffers into which the
+	// ciphertext of the next message's header and body are encrypted
+	// before being written out, saving on allocations for every message
+	// sent. nextSendText is grown to fit the largest message sent so
+	// far, up to 65KB plus our macSize, beyond which each message is
+	// encrypted into a buffer of its own.
+	nextSendHeader [extendedLengthHeaderSize + macSize]byte
+	nextSendText   []byte
+
+	// initialBufferSize is the size at which nextCipherText and
+	// nextSendText are first allocated.
+	initialBufferSize int
+
+	// cryptoTime is the time spent computing the acts of the handshake,
+	// apart from any spent waiting on the network.
+	cryptoTime time.Duration
+
+	// extendedLength is set once both sides have agreed to prefix each
+	// message with a 4-byte length, allowing messages of up to
+	// MaxExtendedMessageLength bytes.
+	extendedLength bool
+
+	// nextHeaderRead is the number of bytes of the next ciphertext header
+	// which have been read so far. nextBodyLen is the total length of the
+	// ciphertext following the last decrypted header, or zero if the
+	// header hasn't been read yet, and nextBodyRead is the number of its
+	// bytes read so far. Together they allow ReadMessage to resume an
+	// interrupted read.
+	nextHeaderRead int
+	nextBodyLen    uint32
+	nextBodyRead   uint32
 }
 
 // NewNoiseMachine creates a new instance of the lndc state-machine. If
@@ -357,7 +519,11 @@ func NewNoiseMachine(initiator bool, localStatic *koblitz.PrivateKey,
 	// TODO: if we're sending messages of type XK, set it back to
 	// "lightning" which is what BOLT uses
 
-	m := &Machine{handshakeState: handshake}
+	m := &Machine{
+		handshakeState:    handshake,
+		maxVersion:        HandshakeVersion,
+		initialBufferSize: math.MaxUint16 + macSize,
+	}
 
 	// With the initial base machine created, we'll assign our default
 	// version of the ephemeral key generator.
@@ -369,16 +535,59 @@ func NewNoiseMachine(initiator bool, localStatic *koblitz.PrivateKey,
 	for _, option := range options {
 		option(m)
 	}
+	m.version = m.maxVersion
+	m.nextCipherText = make([]byte, m.initialBufferSize)
+	m.nextSendText = make([]byte, m.initialBufferSize)
 
 	return m
 }
 
+// Version returns the handshake version in use by the machine. Once act two
+// has been processed this is the version negotiated with the remote peer.
+func (b *Machine) Version() byte {
+	return b.version
+}
+
+// RemoteVersion returns the handshake version the remote peer revealed during
+// the handshake: for a responder, the highest version offered by the
+// initiator in act one, and for an initiator, the version the responder
+// answered with in act two.
+func (b *Machine) RemoteVersion() byte {
+	return b.remoteVersion
+}
+
+// mixVersions binds the negotiated handshake version, along with the version
+// offered by the initiator, into the handshake digest, so that a party in the
+// middle can't alter either between two versions above HandshakeVersion
+// without the handshake failing. It's only done for those versions, keeping
+// handshakes of the original version compatible with peers predating
+// negotiation.
+//
+// NOTE: As nothing is mixed when the original version is negotiated, a party
+// in the middle can silently downgrade a handshake to it, by rewriting the
+// version offered in act one or, for a dialer with LegacyFallback set, by
+// closing the connection so Dial falls back to it, stripping every extension
+// from the connection. Peers that rely on an extension, such as the chain
+// hash check, must set MinPeerVersion to refuse the original version
+// outright.
+func (b *Machine) mixVersions(offered, negotiated byte) {
+	if negotiated > HandshakeVersion {
+		b.mixHash([]byte{offered, negotiated})
+	}
+}
+
 const (
 	// HandshakeVersion is the expected version of the lndc handshake.
 	// Any messages that carry a different version will cause the handshake
 	// to abort immediately.
 	HandshakeVersion = byte(1) // TODO: add support for noise_XK (brontide) as well
 
+	// ExtendedHandshakeVersion is the version of the lndc handshake
+	// which, once negotiated, is followed by an exchange of encrypted
+	// hello messages carrying the optional handshake extensions. An
+	// initiator only offers it when it has an extension configured.
+	ExtendedHandshakeVersion = byte(2)
+
 	// ActOneSize is the size of the packet sent from initiator to
 	// responder in ActOne. The packet consists of a handshake version, an
 	// ephemeral key in compressed format, and a 16-byte poly1305 tag.
@@ -410,6 +619,8 @@ const (
 // -> e
 
 func (b *Machine) GenActOne() ([ActOneSize]byte, error) {
+	defer b.timeCrypto(time.Now())
+
 	var (
 		err    error
 		actOne [ActOneSize]byte
@@ -427,7 +638,7 @@ func (b *Machine) GenActOne() ([ActOneSize]byte, error) {
 	b.mixHash(e)
 
 	authPayload := b.EncryptAndHash([]byte{})
-	actOne[0] = HandshakeVersion
+	actOne[0] = b.maxVersion
 	copy(actOne[1:34], e)
 	copy(actOne[34:], authPayload)
 	return actOne, nil
@@ -438,6 +649,8 @@ func (b *Machine) GenActOne() ([ActOneSize]byte, error) {
 // handshake digest and deriving a new shared secret based on an ECDH with the
 // initiator's ephemeral key and responder's static key.
 func (b *Machine) RecvActOne(actOne [ActOneSize]byte) error {
+	defer b.timeCrypto(time.Now())
+
 	var (
 		err error
 		e   [33]byte
@@ -445,18 +658,24 @@ func (b *Machine) RecvActOne(actOne [ActOneSize]byte) error {
 	)
 
 	// If the handshake version is unknown, then the handshake fails
-	// immediately.
-	if actOne[0] != HandshakeVersion {
+	// immediately. Otherwise we'll settle on the highest version both
+	// sides support.
+	if actOne[0] < HandshakeVersion {
 		return fmt.Errorf("Act One: invalid handshake version: %v, "+
-			"only %v is valid, msg=%x", actOne[0], HandshakeVersion,
-			actOne[:])
+			"only %v through %v are valid, msg=%x", actOne[0],
+			HandshakeVersion, b.maxVersion, actOne[:])
+	}
+	b.remoteVersion = actOne[0]
+	b.version = actOne[0]
+	if b.version > b.maxVersion {
+		b.version = b.maxVersion
 	}
 
 	copy(e[:], actOne[1:34])
 	copy(p[:], actOne[34:])
 
 	// e
-	b.remoteEphemeral, err = koblitz.ParsePubKey(e[:], koblitz.S256())
+	b.remoteEphemeral, err = parseEphemeral(e[:])
 	if err != nil {
 		return err
 	}
@@ -470,11 +689,19 @@ func (b *Machine) RecvActOne(actOne [ActOneSize]byte) error {
 // responder to the initiator
 // <- e, ee, s, es
 func (b *Machine) GenActTwo() ([ActTwoSize]byte, error) {
+	defer b.timeCrypto(time.Now())
+
 	var (
 		err    error
 		actTwo [ActTwoSize]byte
 	)
 
+	// We need a valid remote ephemeral key from act one before we can
+	// carry out any of the DH operations below.
+	if !validEphemeral(b.remoteEphemeral) {
+		return actTwo, ErrInvalidEphemeral
+	}
+
 	// e
 	b.localEphemeral, err = b.ephemeralGen()
 	if err != nil {
@@ -496,8 +723,10 @@ func (b *Machine) GenActTwo() ([ActTwoSize]byte, error) {
 	es := ecdh(b.remoteEphemeral, b.localStatic)
 	b.mixKey(es)
 
+	b.mixVersions(b.remoteVersion, b.version)
+
 	authPayload := b.EncryptAndHash([]byte{})
-	actTwo[0] = HandshakeVersion
+	actTwo[0] = b.version
 	copy(actTwo[1:34], e)
 	copy(actTwo[34:67], s)
 	copy(actTwo[67:], authPayload)
@@ -509,6 +738,8 @@ func (b *Machine) GenActTwo() ([ActTwoSize]byte, error) {
 // the initiator. A successful processing of this packet authenticates the
 // initiator to the responder.
 func (b *Machine) RecvActTwo(actTwo [ActTwoSize]byte) ([33]byte, error) {
+	defer b.timeCrypto(time.Now())
+
 	var (
 		err error
 		e   [33]byte
@@ -518,18 +749,20 @@ func (b *Machine) RecvActTwo(actTwo [ActTwoSize]byte) ([33]byte, error) {
 	var empty [33]byte
 	// If the handshake version is unknown, then the handshake fails
 	// immediately.
-	if actTwo[0] != HandshakeVersion {
+	if actTwo[0] < HandshakeVersion || actTwo[0] > b.maxVersion {
 		return empty, fmt.Errorf("Act Two: invalid handshake version: %v, "+
-			"only %v is valid, msg=%x", actTwo[0], HandshakeVersion,
-			actTwo[:])
+			"only %v through %v are valid, msg=%x", actTwo[0],
+			HandshakeVersion, b.maxVersion, actTwo[:])
 	}
+	b.version = actTwo[0]
+	b.remoteVersion = actTwo[0]
 
 	copy(e[:], actTwo[1:34])
 	copy(s[:], actTwo[34:67])
 	copy(p[:], actTwo[67:])
 
 	// e
-	b.remoteEphemeral, err = koblitz.ParsePubKey(e[:], koblitz.S256())
+	b.remoteEphemeral, err = parseEphemeral(e[:])
 	if err != nil {
 		return empty, err
 	}
@@ -550,6 +783,8 @@ func (b *Machine) RecvActTwo(actTwo [ActTwoSize]byte) ([33]byte, error) {
 	es := ecdh(b.remoteStatic, b.localEphemeral)
 	b.mixKey(es)
 
+	b.mixVersions(b.maxVersion, b.version)
+
 	_, err = b.DecryptAndHash(p[:])
 	return s, err
 }
@@ -561,6 +796,8 @@ func (b *Machine) RecvActTwo(actTwo [ActTwoSize]byte) ([33]byte, error) {
 // the final session.
 // -> s, se
 func (b *Machine) GenActThree() ([ActThreeSize]byte, error) {
+	defer b.timeCrypto(time.Now())
+
 	var actThree [ActThreeSize]byte
 
 	// s
@@ -573,7 +810,7 @@ func (b *Machine) GenActThree() ([ActThreeSize]byte, error) {
 
 	authPayload := b.EncryptAndHash([]byte{})
 
-	actThree[0] = HandshakeVersion
+	actThree[0] = b.version
 	copy(actThree[1:50], encryptedS)
 	copy(actThree[50:], authPayload)
 
@@ -588,6 +825,8 @@ func (b *Machine) GenActThree() ([ActThreeSize]byte, error) {
 // initiator's static public key. Decryption of the static key serves to
 // authenticate the initiator to the responder.
 func (b *Machine) RecvActThree(actThree [ActThreeSize]byte) error {
+	defer b.timeCrypto(time.Now())
+
 	var (
 		err error
 		s   [49]byte
@@ -596,9 +835,9 @@ func (b *Machine) RecvActThree(actThree [ActThreeSize]byte) error {
 
 	// If the handshake version is unknown, then the handshake fails
 	// immediately.
-	if actThree[0] != HandshakeVersion {
+	if actThree[0] != b.version {
 		return fmt.Errorf("Act Three: invalid handshake version: %v, "+
-			"only %v is valid, msg=%x", actThree[0], HandshakeVersion,
+			"only %v is valid, msg=%x", actThree[0], b.version,
 			actThree[:])
 	}
 
@@ -666,61 +905,212 @@ func (b *Machine) split() {
 	}
 }
 
+// wipe zeroes all of the session key material held by the machine, leaving
+// it unusable. The long-term static key is left untouched as it's owned by
+// the caller.
+func (b *Machine) wipe() {
+	b.sendCipher.wipe()
+	b.recvCipher.wipe()
+	b.symmetricState.cipherState.wipe()
+
+	b.chainingKey = [32]byte{}
+	b.tempKey = [32]byte{}
+	b.handshakeDigest = [32]byte{}
+
+	if b.localEphemeral != nil {
+		b.localEphemeral.D.SetInt64(0)
+		b.localEphemeral = nil
+	}
+	b.remoteEphemeral = nil
+
+	b.nextHeaderRead = 0
+	b.nextBodyLen = 0
+	b.nextBodyRead = 0
+}
+
 // WriteMessage writes the next message p to the passed io.Writer. The
 // ciphertext of the message is prepended with an encrypt+auth'd length which
 // must be used as the AD to the AEAD construction when being decrypted by the
 // other side.
 func (b *Machine) WriteMessage(w io.Writer, p []byte) error {
+	return b.writeMessage(w, p, nil)
+}
+
+// writeMessage writes the next message p to the passed io.Writer, binding
+// the associated data ad, if any, to its body.
+func (b *Machine) writeMessage(w io.Writer, p, ad []byte) error {
 	// The total length of each message payload including the MAC size
 	// payload exceed the largest number encodable within a 16-bit unsigned
-	// integer.
-	if len(p) > math.MaxUint16 {
-		return errors.New("the generated payload exceeds " +
-			"the max allowed message length of (2^16)-1")
+	// integer, unless extended lengths have been negotiated.
+	if len(p) > b.maxMessageLength() {
+		return fmt.Errorf("the generated payload exceeds "+
+			"the max allowed message length of %d",
+			b.maxMessageLength())
 	}
 
 	// The full length of the packet is only the packet length, and does
 	// NOT include the MAC.
-	fullLength := uint16(len(p))
-
-	var pktLen [2]byte
-	binary.BigEndian.PutUint16(pktLen[:], fullLength)
+	var pktLen [extendedLengthHeaderSize]byte
+	header := pktLen[:b.lengthHeaderSize()]
+	if b.extendedLength {
+		binary.BigEndian.PutUint32(header, uint32(len(p)))
+	} else {
+		binary.BigEndian.PutUint16(header, uint16(len(p)))
+	}
 
-	// First, write out the encrypted+MAC'd length prefix for the packet.
-	cipherLen := b.sendCipher.Encrypt(nil, nil, pktLen[:])
-	if _, err := w.Write(cipherLen); err != nil {
-		return err
+	// Encrypt the length prefix for the packet followed by the packet
+	// itself into our static buffers. We only write out a single packet,
+	// as any fragmentation should have taken place at a higher level.
+	// Packets too large for the buffer to ever grow to are encrypted
+	// into one allocated just for them.
+	var textBuf []byte
+	switch {
+	case len(p) > math.MaxUint16:
+		textBuf = make([]byte, 0, len(p)+macSize)
+
+	default:
+		b.nextSendText = growBuffer(b.nextSendText, len(p)+macSize,
+			math.MaxUint16+macSize)
+		textBuf = b.nextSendText[:0]
 	}
+	cipherLen := b.sendCipher.Encrypt(nil, b.nextSendHeader[:0], header)
+	cipherText := b.sendCipher.Encrypt(ad, textBuf, p)
 
-	// Finally, write out the encrypted packet itself. We only write out a
-	// single packet, as any fragmentation should have taken place at a
-	// higher level.
-	cipherText := b.sendCipher.Encrypt(nil, nil, p)
-	_, err := w.Write(cipherText)
+	// Both are then written out together, which for a TCP connection is
+	// done with a single vectored write rather than a write each.
+	buffers := net.Buffers{cipherLen, cipherText}
+	_, err := buffers.WriteTo(w)
 	return err
 }
 
 // ReadMessage attempts to read the next message from the passed io.Reader. In
 // the case of an authentication error, a non-nil error is returned.
+//
+// If the reader returns an error part way through a message, such as a
+// timeout caused by a read deadline, the bytes read so far are retained and
+// the next call to ReadMessage resumes reading the same message. This allows
+// callers to retry reads which have timed out without desynchronizing the
+// stream.
 func (b *Machine) ReadMessage(r io.Reader) ([]byte, error) {
-	if _, err := io.ReadFull(r, b.nextCipherHeader[:]); err != nil {
-		return nil, err
-	}
+	msg, _, err := b.readMessage(r, nil)
+	return msg, err
+}
 
-	// Attempt to decrypt+auth the packet length present in the stream.
-	pktLenBytes, err := b.recvCipher.Decrypt(
-		nil, nil, b.nextCipherHeader[:],
-	)
-	if err != nil {
-		return nil, err
+// readMessage reads the next message from the passed io.Reader. If ad is set,
+// the body is first authenticated against it, then failing that against no
+// associated data, with withAD reporting which succeeded. This allows
+// control messages, which never carry associated data, to be read alongside
+// those which do.
+func (b *Machine) readMessage(r io.Reader, ad []byte) (msg []byte,
+	withAD bool, err error) {
+
+	return b.readMessageInto(r, ad, nil)
+}
+
+// readMessageInto reads the next message from the passed io.Reader as
+// readMessage does, appending its plaintext to dst, which may be nil, rather
+// than a newly allocated buffer.
+func (b *Machine) readMessageInto(r io.Reader, ad, dst []byte) (msg []byte,
+	withAD bool, err error) {
+
+	if b.nextBodyLen == 0 {
+		cipherHeader := b.nextCipherHeader[:b.lengthHeaderSize()+macSize]
+		n, err := io.ReadFull(r, cipherHeader[b.nextHeaderRead:])
+		b.nextHeaderRead += n
+		if err != nil {
+			return nil, false, err
+		}
+		b.nextHeaderRead = 0
+
+		// Attempt to decrypt+auth the packet length present in the
+		// stream.
+		pktLenBytes, err := b.recvCipher.Decrypt(
+			nil, nil, cipherHeader,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		var bodyLen uint32
+		if b.extendedLength {
+			bodyLen = binary.BigEndian.Uint32(pktLenBytes)
+		} else {
+			bodyLen = uint32(binary.BigEndian.Uint16(pktLenBytes))
+		}
+		if bodyLen > uint32(b.maxMessageLength()) {
+			return nil, false, fmt.Errorf("remote peer sent a "+
+				"message of %d bytes, exceeding the max allowed "+
+				"message length of %d", bodyLen,
+				b.maxMessageLength())
+		}
+		b.nextBodyLen = bodyLen + macSize
 	}
 
 	// Next, using the length read from the packet header, read the
 	// encrypted packet itself.
-	pktLen := uint32(binary.BigEndian.Uint16(pktLenBytes)) + macSize
-	if _, err := io.ReadFull(r, b.nextCipherText[:pktLen]); err != nil {
-		return nil, err
+	pktLen := b.nextBodyLen
+	b.nextCipherText = growBuffer(b.nextCipherText, int(pktLen),
+		b.maxMessageLength()+macSize)
+	cipherText := b.nextCipherText
+	n, err := io.ReadFull(r, cipherText[b.nextBodyRead:pktLen])
+	b.nextBodyRead += uint32(n)
+	if err != nil {
+		return nil, false, err
+	}
+	b.nextBodyLen = 0
+	b.nextBodyRead = 0
+
+	if ad == nil {
+		msg, err := b.recvCipher.Decrypt(nil, dst, cipherText[:pktLen])
+		return msg, false, err
+	}
+
+	return b.recvCipher.decryptEither(ad, dst, cipherText[:pktLen])
+}
+
+// timeCrypto adds the time elapsed since start to the time spent computing
+// the handshake.
+func (b *Machine) timeCrypto(start time.Time) {
+	b.cryptoTime += time.Since(start)
+}
+
+// growBuffer returns buf if it holds at least n bytes, otherwise a buffer of
+// at least n bytes which doubles its size, up to limit. Any bytes already
+// read into buf are carried over.
+func growBuffer(buf []byte, n, limit int) []byte {
+	if n <= len(buf) {
+		return buf
+	}
+
+	size := 2 * len(buf)
+	if size > limit {
+		size = limit
+	}
+	if size < n {
+		size = n
+	}
+	grown := make([]byte, size)
+	copy(grown, buf)
+
+	return grown
+}
+
+// lengthHeaderSize returns the number of bytes used to prefix encode the
+// length of each message.
+func (b *Machine) lengthHeaderSize() int {
+	if b.extendedLength {
+		return extendedLengthHeaderSize
+	}
+
+	return lengthHeaderSize
+}
+
+// maxMessageLength returns the largest message payload which can be sent or
+// received.
+func (b *Machine) maxMessageLength() int {
+	if b.extendedLength {
+		return MaxExtendedMessageLength
 	}
 
-	return b.recvCipher.Decrypt(nil, nil, b.nextCipherText[:pktLen])
+	return math.MaxUint16
 }
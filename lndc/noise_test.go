@@ -2,8 +2,10 @@ package lndc
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"io"
+	"io/ioutil"
 	"math"
 	"net"
 	"sync"
@@ -516,3 +518,272 @@ func TestBolt0008TestVectors(t *testing.T) {
 		buf.Reset()
 	}
 }
+
+// TestInvalidRemoteEphemeral ensures that an act one carrying an ephemeral key
+// which isn't a valid curve point is rejected with ErrInvalidEphemeral.
+func TestInvalidRemoteEphemeral(t *testing.T) {
+	t.Parallel()
+
+	initiatorPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	responderPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	initiator := NewNoiseMachine(true, initiatorPriv)
+	actOne, err := initiator.GenActOne()
+	if err != nil {
+		t.Fatalf("unable to generate act one: %v", err)
+	}
+
+	// There is no point on secp256k1 with an x coordinate of zero, and an
+	// x coordinate larger than the field prime can never be valid.
+	badPoints := map[string][33]byte{
+		"zero x":    {0x02},
+		"x above p": {0x03},
+	}
+	p := badPoints["x above p"]
+	copy(p[1:], bytes.Repeat([]byte{0xff}, 32))
+	badPoints["x above p"] = p
+
+	for name, point := range badPoints {
+		badActOne := actOne
+		copy(badActOne[1:34], point[:])
+
+		responder := NewNoiseMachine(false, responderPriv)
+		err := responder.RecvActOne(badActOne)
+		if err != ErrInvalidEphemeral {
+			t.Fatalf("%s: expected ErrInvalidEphemeral, got %v",
+				name, err)
+		}
+	}
+
+	// Generating act two without a valid remote ephemeral must also fail
+	// before any DH operation is attempted.
+	responder := NewNoiseMachine(false, responderPriv)
+	if _, err := responder.GenActTwo(); err != ErrInvalidEphemeral {
+		t.Fatalf("expected ErrInvalidEphemeral, got %v", err)
+	}
+}
+
+// TestEphemeralCurveMismatch ensures that an act one carrying a key which
+// isn't a compressed secp256k1 point is rejected with ErrCurveMismatch, and
+// that only the secp256k1 curve can be pinned.
+func TestEphemeralCurveMismatch(t *testing.T) {
+	t.Parallel()
+
+	initiatorPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	responderPriv, err := koblitz.NewPrivateKey(koblitz.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+
+	initiator := NewNoiseMachine(true, initiatorPriv)
+	actOne, err := initiator.GenActOne()
+	if err != nil {
+		t.Fatalf("unable to generate act one: %v", err)
+	}
+
+	// Prefixes for uncompressed and hybrid keys as well as garbage.
+	for _, prefix := range []byte{0x00, 0x04, 0x06, 0x07, 0xff} {
+		badActOne := actOne
+		badActOne[1] = prefix
+
+		responder := NewNoiseMachine(false, responderPriv)
+		if err := responder.RecvActOne(badActOne); err != ErrCurveMismatch {
+			t.Fatalf("prefix %x: expected ErrCurveMismatch, got %v",
+				prefix, err)
+		}
+	}
+
+	_, err = NewListener(responderPriv, 0, WithCurve("ed25519"))
+	if err == nil {
+		t.Fatalf("expected listener pinned to ed25519 to be refused")
+	}
+	listener, err := NewListener(responderPriv, 0, WithCurve(CurveSecp256k1))
+	if err != nil {
+		t.Fatalf("unable to create listener pinned to secp256k1: %v", err)
+	}
+	listener.Close()
+}
+
+func TestWriteMessageVectored(t *testing.T) {
+	localConn, remoteConn, cleanUp, err := establishTestConnection(false)
+	if err != nil {
+		t.Fatalf("unable to establish test connection: %v", err)
+	}
+	defer cleanUp()
+
+	local := localConn.(*Conn)
+	remote := remoteConn.(*Conn)
+
+	// Each message's header and body are sent together with a single
+	// vectored write, and must arrive intact regardless of their size.
+	sizes := []int{0, 1, 100, math.MaxUint16}
+	errChan := make(chan error, 1)
+	go func() {
+		for _, size := range sizes {
+			msg := bytes.Repeat([]byte{byte(size)}, size)
+			if err := local.noise.WriteMessage(local.conn, msg); err != nil {
+				errChan <- err
+				return
+			}
+		}
+		errChan <- nil
+	}()
+
+	for _, size := range sizes {
+		msg, err := remote.ReadNextMessage()
+		if err != nil {
+			t.Fatalf("unable to read message: %v", err)
+		}
+		if !bytes.Equal(msg, bytes.Repeat([]byte{byte(size)}, size)) {
+			t.Fatalf("message of size %d corrupted", size)
+		}
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("unable to write message: %v", err)
+	}
+}
+
+// writeMessageConcat writes a message the way WriteMessage would, but by
+// concatenating the header and body before a single write, for comparison
+// with the vectored write.
+func writeMessageConcat(b *Machine, w io.Writer, p []byte) error {
+	var pktLen [2]byte
+	binary.BigEndian.PutUint16(pktLen[:], uint16(len(p)))
+
+	msg := b.sendCipher.Encrypt(nil, nil, pktLen[:])
+	msg = b.sendCipher.Encrypt(nil, msg, p)
+	_, err := w.Write(msg)
+	return err
+}
+
+// benchmarkWriteMessage measures write, which sends a single message using
+// the sending half of an established connection, while the raw bytes are
+// drained from the receiving half.
+func benchmarkWriteMessage(bench *testing.B,
+	write func(b *Machine, w io.Writer, p []byte) error) {
+
+	localConn, remoteConn, cleanUp, err := establishTestConnection(false)
+	if err != nil {
+		bench.Fatalf("unable to establish test connection: %v", err)
+	}
+	defer cleanUp()
+
+	local := localConn.(*Conn)
+	go io.Copy(ioutil.Discard, remoteConn.(*Conn).conn)
+
+	msg := make([]byte, 1024)
+	bench.SetBytes(int64(len(msg)))
+	bench.ReportAllocs()
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		if err := write(local.noise, local.conn, msg); err != nil {
+			bench.Fatalf("unable to write message: %v", err)
+		}
+	}
+}
+
+func BenchmarkWriteMessageConcat(b *testing.B) {
+	benchmarkWriteMessage(b, writeMessageConcat)
+}
+
+func BenchmarkWriteMessageVectored(b *testing.B) {
+	benchmarkWriteMessage(b, func(m *Machine, w io.Writer, p []byte) error {
+		return m.WriteMessage(w, p)
+	})
+}
+
+// handshakeMachines carries out the three acts between a pair of machines
+// supporting up to the passed handshake versions, returning both.
+func handshakeMachines(t *testing.T, initiatorMax,
+	responderMax byte) (*Machine, *Machine) {
+
+	initiator := NewNoiseMachine(true, newKey(t),
+		MaxHandshakeVersion(initiatorMax))
+	responder := NewNoiseMachine(false, newKey(t),
+		MaxHandshakeVersion(responderMax))
+
+	actOne, err := initiator.GenActOne()
+	if err != nil {
+		t.Fatalf("unable to generate act one: %v", err)
+	}
+	if err := responder.RecvActOne(actOne); err != nil {
+		t.Fatalf("unable to process act one: %v", err)
+	}
+	actTwo, err := responder.GenActTwo()
+	if err != nil {
+		t.Fatalf("unable to generate act two: %v", err)
+	}
+	if _, err := initiator.RecvActTwo(actTwo); err != nil {
+		t.Fatalf("unable to process act two: %v", err)
+	}
+	actThree, err := initiator.GenActThree()
+	if err != nil {
+		t.Fatalf("unable to generate act three: %v", err)
+	}
+	if err := responder.RecvActThree(actThree); err != nil {
+		t.Fatalf("unable to process act three: %v", err)
+	}
+
+	return initiator, responder
+}
+
+// TestHandshakeVersionNegotiation checks the negotiation between machines
+// capped at either version. A machine capped at the original version still
+// accepts a later offer and negotiates down, unlike a peer predating
+// negotiation, which is covered by TestDialPredatingResponder.
+func TestHandshakeVersionNegotiation(t *testing.T) {
+	const (
+		old   = HandshakeVersion
+		newer = ExtendedHandshakeVersion
+	)
+	tests := []struct {
+		name                 string
+		initiator, responder byte
+		expected             byte
+	}{
+		{"new to capped", newer, old, old},
+		{"old to new", old, newer, old},
+		{"new to new", newer, newer, newer},
+		{"old to old", old, old, old},
+	}
+
+	for _, test := range tests {
+		initiator, responder := handshakeMachines(t, test.initiator,
+			test.responder)
+
+		// Both sides settle on the highest version they share.
+		if initiator.Version() != test.expected ||
+			responder.Version() != test.expected {
+
+			t.Fatalf("%s: expected version %d, got %d and %d",
+				test.name, test.expected, initiator.Version(),
+				responder.Version())
+		}
+
+		// The handshake completed in that version, deriving the same
+		// keys on both sides.
+		var buf bytes.Buffer
+		msg := []byte(test.name)
+		if err := initiator.WriteMessage(&buf, msg); err != nil {
+			t.Fatalf("%s: unable to write message: %v", test.name,
+				err)
+		}
+		got, err := responder.ReadMessage(&buf)
+		if err != nil {
+			t.Fatalf("%s: unable to read message: %v", test.name,
+				err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("%s: expected %q, got %q", test.name, msg, got)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package lndc
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy governs which connection, if any, a listener holding
+// MaxConns established connections evicts to make room for a new one.
+type OverflowPolicy int
+
+const (
+	// OverflowReject refuses the new connection with ErrListenerFull
+	// unless it outranks an established connection by Priority, in which
+	// case the oldest of the lowest priority connections is evicted.
+	OverflowReject OverflowPolicy = iota
+
+	// OverflowDropOldest evicts the oldest established connection whose
+	// priority doesn't exceed that of the new one.
+	OverflowDropOldest
+
+	// OverflowDropLeastActive evicts the established connection which
+	// has gone the longest without reading or writing a message, amongst
+	// those whose priority doesn't exceed that of the new one.
+	OverflowDropLeastActive
+)
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowReject:
+		return "reject"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropLeastActive:
+		return "drop-least-active"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// evictionCandidate returns the established connection to evict in favor of
+// conn under the configured OverflowPolicy, or nil if conn should instead be
+// refused.
+//
+// NOTE: connMtx must be held by the caller.
+func (l *Listener) evictionCandidate(conn *Conn) *Conn {
+	if l.cfg.OverflowPolicy == OverflowReject {
+		lowest := l.lowestPriorityConn()
+		if lowest == nil || lowest.priority >= conn.priority {
+			return nil
+		}
+		return lowest
+	}
+
+	var candidate *Conn
+	for _, c := range l.established {
+		if c.priority > conn.priority {
+			continue
+		}
+		if candidate == nil || l.evictsBefore(c, candidate) {
+			candidate = c
+		}
+	}
+
+	return candidate
+}
+
+// evictsBefore reports whether a should be evicted ahead of b under the
+// configured OverflowPolicy.
+func (l *Listener) evictsBefore(a, b *Conn) bool {
+	if l.cfg.OverflowPolicy == OverflowDropLeastActive {
+		aActive, bActive := a.lastActiveNanos(), b.lastActiveNanos()
+		if aActive != bActive {
+			return aActive < bActive
+		}
+	}
+
+	return a.seq < b.seq
+}
+
+// touch records the connection as having just been both read from and
+// written to, as it is once created.
+func (c *Conn) touch() {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&c.lastRead, now)
+	atomic.StoreInt64(&c.lastWrite, now)
+}
+
+// touchRead records that a message was just read from the connection.
+func (c *Conn) touchRead() {
+	atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+	c.clearTimeout()
+}
+
+// touchWrite records that a message was just written to the connection.
+func (c *Conn) touchWrite() {
+	atomic.StoreInt64(&c.lastWrite, time.Now().UnixNano())
+	c.clearTimeout()
+}
+
+// lastActiveNanos returns when a message was last read from or written to
+// the connection, in nanoseconds since the epoch.
+func (c *Conn) lastActiveNanos() int64 {
+	read, write := atomic.LoadInt64(&c.lastRead), atomic.LoadInt64(&c.lastWrite)
+	if read > write {
+		return read
+	}
+
+	return write
+}
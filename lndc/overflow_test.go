@@ -0,0 +1,90 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// establishedSeqs returns the sequence numbers of the listener's established
+// conns.
+func establishedSeqs(listener *Listener) map[uint64]bool {
+	seqs := make(map[uint64]bool)
+	for _, conn := range listener.Conns() {
+		seqs[conn.Seq()] = true
+	}
+	return seqs
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	for _, test := range []struct {
+		policy OverflowPolicy
+
+		// touchFirst makes the first conn the most recently active.
+		touchFirst bool
+
+		// evicted is the seq of the conn expected to be evicted for
+		// the third, or zero if it should be refused.
+		evicted uint64
+	}{
+		{policy: OverflowReject},
+		{policy: OverflowDropOldest, touchFirst: true, evicted: 1},
+		{policy: OverflowDropLeastActive, touchFirst: true, evicted: 2},
+	} {
+		listener, pkh := newTestListener(t, WithMaxConns(2),
+			WithOverflowPolicy(test.policy))
+
+		// Fill the listener to capacity.
+		var locals, remotes []*Conn
+		for i := 0; i < 2; i++ {
+			local, remote := dialAndAccept(t, listener, pkh)
+			locals = append(locals, local)
+			remotes = append(remotes, remote)
+			time.Sleep(10 * time.Millisecond)
+		}
+		if test.touchFirst {
+			roundTrip(t, locals[0], remotes[0])
+		}
+
+		if test.evicted == 0 {
+			key := newKey(t)
+			go func() {
+				conn, err := Dial(key, listener.Addr().String(),
+					pkh, net.Dial)
+				if err == nil {
+					conn.Close()
+				}
+			}()
+			if _, err := listener.Accept(); err != ErrListenerFull {
+				t.Fatalf("%v: expected %v, got %v", test.policy,
+					ErrListenerFull, err)
+			}
+			if seqs := establishedSeqs(listener); !seqs[1] || !seqs[2] {
+				t.Fatalf("%v: established conns were evicted",
+					test.policy)
+			}
+		} else {
+			local, remote := dialAndAccept(t, listener, pkh)
+			locals = append(locals, local)
+			remotes = append(remotes, remote)
+
+			seqs := establishedSeqs(listener)
+			if len(seqs) != 2 || seqs[test.evicted] || !seqs[3] {
+				t.Fatalf("%v: expected conn %d to be evicted, "+
+					"established %v", test.policy,
+					test.evicted, seqs)
+			}
+			evicted := remotes[test.evicted-1]
+			if _, err := evicted.Read(make([]byte, 1)); err == nil {
+				t.Fatalf("%v: expected evicted conn to be closed",
+					test.policy)
+			}
+		}
+
+		for i := range locals {
+			locals[i].Close()
+			remotes[i].Close()
+		}
+		listener.Close()
+	}
+}
@@ -0,0 +1,35 @@
+package lndc
+
+import "sync/atomic"
+
+// TakeOwnership claims ownership of the connection for the calling
+// goroutine, which should be the only one to read from it until it calls
+// ReleaseOwnership. This makes hand-offs of a connection between goroutines
+// explicit, such as from the goroutine which completed the handshake to the
+// one serving the peer.
+//
+// Ownership is only checked in builds with the lit_debug tag, which panic
+// if the connection is claimed while already owned. Otherwise both methods
+// are no-ops.
+func (c *Conn) TakeOwnership() {
+	if !debugBuild {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&c.owned, 0, 1) {
+		panic("lndc: ownership of conn claimed while already owned")
+	}
+}
+
+// ReleaseOwnership gives up the ownership claimed by TakeOwnership, so that
+// another goroutine may take it. In builds with the lit_debug tag it panics
+// if the connection isn't owned.
+func (c *Conn) ReleaseOwnership() {
+	if !debugBuild {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&c.owned, 1, 0) {
+		panic("lndc: ownership of conn released while not owned")
+	}
+}
@@ -0,0 +1,63 @@
+//go:build lit_debug
+// +build lit_debug
+
+package lndc
+
+import (
+	"sync"
+	"testing"
+)
+
+// claim attempts to take ownership of conn, reporting whether the claim was
+// detected as a double claim.
+func claim(conn *Conn) (detected bool) {
+	defer func() {
+		detected = recover() != nil
+	}()
+	conn.TakeOwnership()
+
+	return false
+}
+
+func TestOwnershipDoubleClaim(t *testing.T) {
+	pooled, peer, _, _ := upgradePipe(t)
+	defer pooled.Close()
+	defer peer.Close()
+
+	// Ownership may be handed from one goroutine to another.
+	pooled.TakeOwnership()
+	done := make(chan bool)
+	go func() {
+		pooled.ReleaseOwnership()
+		done <- claim(pooled)
+	}()
+	if <-done {
+		t.Fatalf("hand-off detected as a double claim")
+	}
+	pooled.ReleaseOwnership()
+
+	// But when two goroutines race to claim it, only one succeeds and the
+	// other is caught.
+	var wg sync.WaitGroup
+	results := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- claim(pooled)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	detected := 0
+	for result := range results {
+		if result {
+			detected++
+		}
+	}
+	if detected != 1 {
+		t.Fatalf("expected a single double claim detected, got %d",
+			detected)
+	}
+}
@@ -0,0 +1,48 @@
+package lndc
+
+// Pause stops the listener from accepting new connections, without closing
+// it, until Resume is called. Connections arriving while paused wait in the
+// operating system's backlog, and any already accepted from it but yet to
+// start their handshake are held back. Handshakes already under way are
+// unaffected.
+func (l *Listener) Pause() {
+	l.pauseMtx.Lock()
+	defer l.pauseMtx.Unlock()
+
+	if l.paused {
+		return
+	}
+	l.paused = true
+	l.resumed = make(chan struct{})
+}
+
+// Resume resumes accepting connections after a call to Pause.
+func (l *Listener) Resume() {
+	l.pauseMtx.Lock()
+	defer l.pauseMtx.Unlock()
+
+	if !l.paused {
+		return
+	}
+	l.paused = false
+	close(l.resumed)
+}
+
+// waitResumed blocks while the listener is paused, returning false if it's
+// closed first.
+func (l *Listener) waitResumed() bool {
+	l.pauseMtx.Lock()
+	paused, resumed := l.paused, l.resumed
+	l.pauseMtx.Unlock()
+
+	if !paused {
+		return true
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-l.quit:
+		return false
+	}
+}
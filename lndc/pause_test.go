@@ -0,0 +1,55 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenerPause(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	// While paused, a dialer's handshake isn't carried out.
+	listener.Pause()
+	key := newKey(t)
+	dialed := make(chan maybeNetConn, 1)
+	go func() {
+		conn, err := Dial(key, listener.Addr().String(), pkh, net.Dial)
+		dialed <- maybeNetConn{conn, err}
+	}()
+
+	accepted := make(chan maybeNetConn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		accepted <- maybeNetConn{conn, err}
+	}()
+
+	select {
+	case <-accepted:
+		t.Fatalf("conn accepted while paused")
+	case <-dialed:
+		t.Fatalf("dial completed while paused")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Once resumed, the waiting dialer is accepted.
+	listener.Resume()
+	result := <-accepted
+	if result.err != nil {
+		t.Fatalf("unable to accept: %v", result.err)
+	}
+	defer result.conn.Close()
+
+	remote := <-dialed
+	if remote.err != nil {
+		t.Fatalf("unable to dial: %v", remote.err)
+	}
+	defer remote.conn.Close()
+
+	// And further conns flow as normal.
+	local, other := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer other.Close()
+	roundTrip(t, local, other)
+}
@@ -0,0 +1,157 @@
+package lndc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	// powFlag is set within the version byte of an act one which is
+	// followed by a proof of work. It's cleared again before the act is
+	// processed.
+	powFlag = byte(0x80)
+
+	// powSize is the size of the proof of work following act one: a
+	// 4-byte big endian unix timestamp and a 4-byte nonce.
+	powSize = 8
+
+	// powWindow bounds how far the timestamp of a proof of work may be
+	// from the listener's clock, limiting how long a proof can be
+	// replayed for.
+	powWindow = 2 * time.Minute
+
+	// MaxProofOfWork is the highest proof of work difficulty which can
+	// be configured.
+	MaxProofOfWork = 32
+)
+
+var (
+	// ErrProofOfWorkRequired is returned when a listener requiring a
+	// proof of work receives an act one without one.
+	ErrProofOfWorkRequired = errors.New("lndc: proof of work required")
+
+	// ErrInsufficientProofOfWork is returned when the proof of work
+	// following act one doesn't meet the listener's difficulty, or its
+	// timestamp is too far from the listener's clock.
+	ErrInsufficientProofOfWork = errors.New("lndc: insufficient proof of " +
+		"work")
+
+	// ErrProofOfWorkReplayed is returned when a proof of work which has
+	// already been used is received again.
+	ErrProofOfWorkReplayed = errors.New("lndc: proof of work replayed")
+)
+
+// powDigest returns the hash which must have the required number of leading
+// zero bits for a proof of work. It commits to all of act one, which itself
+// commits to the listener's static key and the dialer's ephemeral key.
+func powDigest(actOne [ActOneSize]byte, proof [powSize]byte) [32]byte {
+	var preimage [ActOneSize + powSize]byte
+	copy(preimage[:], actOne[:])
+	copy(preimage[ActOneSize:], proof[:])
+
+	return sha256.Sum256(preimage[:])
+}
+
+// leadingZeros counts the leading zero bits of digest.
+func leadingZeros(digest [32]byte) int {
+	var n int
+	for _, b := range digest {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+
+	return n
+}
+
+// solveProofOfWork flags actOne as carrying a proof of work and searches for
+// one meeting difficulty.
+func solveProofOfWork(actOne *[ActOneSize]byte, difficulty uint8,
+	now time.Time) ([powSize]byte, error) {
+
+	actOne[0] |= powFlag
+
+	var proof [powSize]byte
+	binary.BigEndian.PutUint32(proof[:4], uint32(now.Unix()))
+	for nonce := uint64(0); nonce <= 0xffffffff; nonce++ {
+		binary.BigEndian.PutUint32(proof[4:], uint32(nonce))
+		if leadingZeros(powDigest(*actOne, proof)) >= int(difficulty) {
+			return proof, nil
+		}
+	}
+
+	return proof, fmt.Errorf("lndc: no proof of work of difficulty %d "+
+		"found", difficulty)
+}
+
+// checkProofOfWork verifies a proof of work against the listener's
+// difficulty, then records it so that it can't be replayed. Only a single
+// hash is computed, so an insufficient proof is rejected cheaply.
+func (c *Config) checkProofOfWork(actOne [ActOneSize]byte,
+	proof [powSize]byte, now time.Time) error {
+
+	digest := powDigest(actOne, proof)
+	if leadingZeros(digest) < int(c.ProofOfWork) {
+		return ErrInsufficientProofOfWork
+	}
+
+	stamp := time.Unix(int64(binary.BigEndian.Uint32(proof[:4])), 0)
+	if stamp.Before(now.Add(-powWindow)) || stamp.After(now.Add(powWindow)) {
+		return fmt.Errorf("%v: timestamp %v outside of window",
+			ErrInsufficientProofOfWork, stamp)
+	}
+
+	return c.powSeen.add(digest, now)
+}
+
+// proofCache remembers the proofs of work received within the last window,
+// so that they can't be replayed. Proofs are pruned in the order they were
+// received, so each is only visited once more as it ages out, however many
+// a low difficulty lets peers send.
+type proofCache struct {
+	mtx   sync.Mutex
+	seen  map[[32]byte]time.Time
+	order []seenProof
+}
+
+// seenProof is the digest of a proof of work along with when it was
+// received.
+type seenProof struct {
+	digest [32]byte
+	at     time.Time
+}
+
+// add records a proof of work, returning ErrProofOfWorkReplayed if it has
+// already been seen. Proofs which have aged out of the window are pruned.
+func (p *proofCache) add(digest [32]byte, now time.Time) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.seen == nil {
+		p.seen = make(map[[32]byte]time.Time)
+	}
+
+	pruned := 0
+	for _, proof := range p.order {
+		if now.Sub(proof.at) <= 2*powWindow {
+			break
+		}
+		delete(p.seen, proof.digest)
+		pruned++
+	}
+	p.order = p.order[pruned:]
+
+	if _, ok := p.seen[digest]; ok {
+		return ErrProofOfWorkReplayed
+	}
+	p.seen[digest] = now
+	p.order = append(p.order, seenProof{digest, now})
+
+	return nil
+}
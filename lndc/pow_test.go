@@ -0,0 +1,149 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProofOfWorkAccepted(t *testing.T) {
+	listener, pkh := newTestListener(t, WithProofOfWork(8))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh, WithProofOfWork(8))
+	defer local.Close()
+	defer remote.Close()
+	roundTrip(t, local, remote)
+
+	// A listener which doesn't require a proof of work still accepts
+	// one.
+	other, otherPKH := newTestListener(t)
+	defer other.Close()
+
+	local, remote = dialAndAccept(t, other, otherPKH, WithProofOfWork(8))
+	defer local.Close()
+	defer remote.Close()
+	roundTrip(t, local, remote)
+}
+
+// sendActOne writes a fresh act one for the listener to it along with the
+// passed proof of work, or a flagless act one if proof is nil, then hangs up
+// and returns the error the listener rejects it with.
+func sendActOne(t *testing.T, listener *Listener,
+	proof func(actOne *[ActOneSize]byte) []byte) error {
+
+	initiator := NewNoiseMachine(true, newKey(t))
+	actOne, err := initiator.GenActOne()
+	if err != nil {
+		t.Fatalf("unable to generate act one: %v", err)
+	}
+	msg := actOne[:]
+	if proof != nil {
+		msg = append([]byte(nil), proof(&actOne)...)
+	}
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	_, err = conn.Write(msg)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("unable to write act one: %v", err)
+	}
+
+	_, err = listener.Accept()
+	return err
+}
+
+func TestProofOfWorkRejected(t *testing.T) {
+	const difficulty = 16
+
+	listener, _ := newTestListener(t, WithProofOfWork(difficulty))
+	defer listener.Close()
+
+	// An act one without any proof is turned away.
+	if err := sendActOne(t, listener, nil); err != ErrProofOfWorkRequired {
+		t.Fatalf("expected %v, got %v", ErrProofOfWorkRequired, err)
+	}
+
+	// As is one whose proof falls short of the difficulty.
+	err := sendActOne(t, listener, func(actOne *[ActOneSize]byte) []byte {
+		proof, err := solveProofOfWork(actOne, difficulty/2, time.Now())
+		if err != nil {
+			t.Fatalf("unable to solve proof of work: %v", err)
+		}
+		for leadingZeros(powDigest(*actOne, proof)) >= difficulty {
+			proof[4]++
+		}
+		return append(actOne[:], proof[:]...)
+	})
+	if err != ErrInsufficientProofOfWork {
+		t.Fatalf("expected %v, got %v", ErrInsufficientProofOfWork, err)
+	}
+
+	// A valid proof that's stale is also refused.
+	err = sendActOne(t, listener, func(actOne *[ActOneSize]byte) []byte {
+		proof, err := solveProofOfWork(actOne, difficulty,
+			time.Now().Add(-2*powWindow))
+		if err != nil {
+			t.Fatalf("unable to solve proof of work: %v", err)
+		}
+		return append(actOne[:], proof[:]...)
+	})
+	if err == nil {
+		t.Fatalf("expected a stale proof of work to be refused")
+	}
+
+	// Replaying a valid act one and proof is refused the second time.
+	var replay []byte
+	replayed := func(actOne *[ActOneSize]byte) []byte {
+		if replay == nil {
+			proof, err := solveProofOfWork(actOne, difficulty,
+				time.Now())
+			if err != nil {
+				t.Fatalf("unable to solve proof of work: %v", err)
+			}
+			replay = append(actOne[:], proof[:]...)
+		}
+		return replay
+	}
+	if err := sendActOne(t, listener, replayed); err == ErrProofOfWorkReplayed {
+		t.Fatalf("first use of the proof shouldn't be a replay")
+	}
+	if err := sendActOne(t, listener, replayed); err != ErrProofOfWorkReplayed {
+		t.Fatalf("expected %v, got %v", ErrProofOfWorkReplayed, err)
+	}
+}
+
+func TestProofCachePruning(t *testing.T) {
+	var cache proofCache
+	start := time.Now()
+	digest := func(i int) (d [32]byte) {
+		d[0], d[1] = byte(i>>8), byte(i)
+		return d
+	}
+
+	// A flood of proofs within the window are all remembered.
+	const flood = 1000
+	for i := 0; i < flood; i++ {
+		at := start.Add(time.Duration(i) * time.Millisecond)
+		if err := cache.add(digest(i), at); err != nil {
+			t.Fatalf("unable to add proof %d: %v", i, err)
+		}
+	}
+	err := cache.add(digest(0), start.Add(time.Second))
+	if err != ErrProofOfWorkReplayed {
+		t.Fatalf("expected %v, got %v", ErrProofOfWorkReplayed, err)
+	}
+
+	// Once they've aged out, the next proof prunes them all.
+	later := start.Add(2*powWindow + 2*time.Second)
+	if err := cache.add(digest(flood), later); err != nil {
+		t.Fatalf("unable to add proof: %v", err)
+	}
+	if len(cache.seen) != 1 || len(cache.order) != 1 {
+		t.Fatalf("expected a single proof remembered, got %d",
+			len(cache.seen))
+	}
+}
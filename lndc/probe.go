@@ -0,0 +1,87 @@
+package lndc
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/lnutil"
+)
+
+// ErrProbeFailed is returned by Probe when the peer couldn't be verified.
+type ErrProbeFailed struct {
+	// Addr is the address which was probed.
+	Addr string
+
+	// Reachable reports whether a connection to Addr was established,
+	// in which case it was the handshake which failed, such as when the
+	// peer presents a key other than the one expected.
+	Reachable bool
+
+	// Err is the error the probe failed with.
+	Err error
+}
+
+// Error returns a description of why the probe failed.
+func (e ErrProbeFailed) Error() string {
+	if !e.Reachable {
+		return fmt.Sprintf("lndc: probe of %s failed, unreachable: %v",
+			e.Addr, e.Err)
+	}
+
+	return fmt.Sprintf("lndc: probe of %s failed, handshake: %v", e.Addr,
+		e.Err)
+}
+
+// Unwrap returns the error the probe failed with.
+func (e ErrProbeFailed) Unwrap() error {
+	return e.Err
+}
+
+// Probe checks that the peer at addr is reachable and authenticates as
+// expectedPub by carrying out a full handshake with it, then immediately
+// closing the connection without any messages being sent. nil is returned
+// if the peer authenticated as expected, otherwise ErrProbeFailed is. The
+// probe is abandoned if ctx is done before the handshake completes.
+func Probe(ctx context.Context, localStatic *koblitz.PrivateKey, addr string,
+	expectedPub *koblitz.PublicKey, options ...func(*Config)) error {
+
+	var idPub [33]byte
+	copy(idPub[:], expectedPub.SerializeCompressed())
+
+	// Once connected, the connection is closed should ctx be done before
+	// the handshake completes, unblocking it.
+	reachable := false
+	done := make(chan struct{})
+	defer close(done)
+	dialer := func(network, address string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		reachable = true
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-done:
+			}
+		}()
+
+		return conn, nil
+	}
+
+	conn, err := Dial(localStatic, addr, lnutil.LitAdrFromPubkey(idPub),
+		dialer, options...)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return ErrProbeFailed{Addr: addr, Reachable: reachable, Err: err}
+	}
+
+	return conn.Close()
+}
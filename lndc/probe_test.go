@@ -0,0 +1,66 @@
+package lndc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	listenerKey := newKey(t)
+	listener, err := NewListener(listenerKey, 0)
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+	addr := listener.Addr().String()
+
+	// Accept, and discard, the probing connections.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err == errListenerClosed {
+				return
+			}
+			if err == nil {
+				conn.Close()
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A peer presenting the expected key passes.
+	if err := Probe(ctx, newKey(t), addr, listenerKey.PubKey()); err != nil {
+		t.Fatalf("unable to probe peer: %v", err)
+	}
+
+	// One presenting another key fails the handshake.
+	err = Probe(ctx, newKey(t), addr, newKey(t).PubKey())
+	probeErr, ok := err.(ErrProbeFailed)
+	if !ok {
+		t.Fatalf("expected ErrProbeFailed, got %T: %v", err, err)
+	}
+	if !probeErr.Reachable {
+		t.Fatalf("expected the peer to be reachable")
+	}
+
+	// As does one at an address nothing is listening on.
+	unused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	unusedAddr := unused.Addr().String()
+	unused.Close()
+
+	err = Probe(ctx, newKey(t), unusedAddr, listenerKey.PubKey())
+	probeErr, ok = err.(ErrProbeFailed)
+	if !ok {
+		t.Fatalf("expected ErrProbeFailed, got %T: %v", err, err)
+	}
+	if probeErr.Reachable {
+		t.Fatalf("expected the address to be unreachable")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package lndc
+
+import (
+	"errors"
+	"net"
+)
+
+// errRawWriteUnsupported is returned by TryWrite on this platform.
+var errRawWriteUnsupported = errors.New("lndc: TryWrite isn't supported on " +
+	"this platform")
+
+// canRawWrite returns errRawWriteUnsupported, as rawWrite is unsupported on
+// this platform.
+func canRawWrite(conn net.Conn) error {
+	return errRawWriteUnsupported
+}
+
+// rawWrite is unsupported on this platform.
+func rawWrite(conn net.Conn, b []byte) (int, error) {
+	return 0, errRawWriteUnsupported
+}
@@ -0,0 +1,53 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package lndc
+
+import (
+	"net"
+	"syscall"
+)
+
+// canRawWrite returns ErrNotTCP unless conn supports rawWrite.
+func canRawWrite(conn net.Conn) error {
+	if _, ok := conn.(*net.TCPConn); !ok {
+		return ErrNotTCP
+	}
+
+	return nil
+}
+
+// rawWrite writes as much of b to the socket underlying conn as its send
+// buffer has room for, returning ErrWouldBlock rather than blocking if there
+// was none.
+func rawWrite(conn net.Conn, b []byte) (int, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return 0, ErrNotTCP
+	}
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	var writeErr error
+	err = rawConn.Write(func(fd uintptr) bool {
+		n, writeErr = syscall.Write(int(fd), b)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		n = 0
+	}
+	if writeErr == syscall.EAGAIN || writeErr == syscall.EWOULDBLOCK {
+		return n, ErrWouldBlock
+	}
+	if writeErr == nil && n < len(b) {
+		return n, ErrWouldBlock
+	}
+
+	return n, writeErr
+}
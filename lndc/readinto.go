@@ -0,0 +1,51 @@
+package lndc
+
+import "errors"
+
+// ErrShortBuffer is returned by ReadMessageInto when the next message is
+// larger than the buffer passed to it.
+var ErrShortBuffer = errors.New("lndc: buffer too short for message")
+
+// ReadMessageInto reads the next full message from the connection into buf,
+// returning its length, as ReadNextMessage does without allocating a buffer
+// for every message. This allows callers reading at a high rate to manage
+// their own pool of buffers.
+//
+// If the message is larger than buf, ErrShortBuffer is returned and the
+// message is held, to be returned by the next call with a large enough
+// buffer. Messages are at most 65535 bytes long, unless extended lengths
+// have been negotiated.
+func (c *Conn) ReadMessageInto(buf []byte) (int, error) {
+	if err := c.waitReadsResumed(); err != nil {
+		return 0, err
+	}
+
+	msg := c.heldMessage
+	if msg == nil {
+		c.armReadDeadline()
+
+		var err error
+		msg, err = c.readPayload(nil, c.readScratch[:0])
+		if err != nil {
+			return 0, err
+		}
+
+		// Keep hold of the buffer the message was decrypted into, in
+		// case it had to be grown to fit.
+		if cap(msg) > cap(c.readScratch) {
+			c.readScratch = msg[:0:cap(msg)]
+		}
+	}
+
+	if len(msg) > len(buf) {
+		c.heldMessage = msg
+		return 0, ErrShortBuffer
+	}
+	c.heldMessage = nil
+
+	n := copy(buf, msg)
+	c.teeRead(buf[:n])
+	c.consumed(n)
+
+	return n, nil
+}
@@ -0,0 +1,66 @@
+package lndc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadMessageInto(t *testing.T) {
+	for _, framed := range []bool{false, true} {
+		var options []func(*Config)
+		if framed {
+			options = append(options, WithFlowWindow(1024))
+		}
+		testReadMessageInto(t, options...)
+	}
+}
+
+func testReadMessageInto(t *testing.T, options ...func(*Config)) {
+	listener, pkh := newTestListener(t, options...)
+	defer listener.Close()
+	local, remote := dialAndAccept(t, listener, pkh, options...)
+	defer local.Close()
+	defer remote.Close()
+
+	msgs := [][]byte{
+		[]byte("first"),
+		bytes.Repeat([]byte("second"), 50),
+		[]byte("third"),
+	}
+	go func() {
+		for _, msg := range msgs {
+			remote.Write(msg)
+		}
+	}()
+
+	buf := make([]byte, 100)
+	n, err := local.ReadMessageInto(buf)
+	if err != nil {
+		t.Fatalf("unable to read message: %v", err)
+	}
+	if !bytes.Equal(buf[:n], msgs[0]) {
+		t.Fatalf("expected %q, got %q", msgs[0], buf[:n])
+	}
+
+	// A message too large for the buffer is held until one large enough
+	// is passed.
+	if _, err := local.ReadMessageInto(buf); err != ErrShortBuffer {
+		t.Fatalf("expected %v, got %v", ErrShortBuffer, err)
+	}
+	large := make([]byte, len(msgs[1]))
+	n, err = local.ReadMessageInto(large)
+	if err != nil {
+		t.Fatalf("unable to read message: %v", err)
+	}
+	if !bytes.Equal(large[:n], msgs[1]) {
+		t.Fatalf("expected %q, got %q", msgs[1], large[:n])
+	}
+
+	n, err = local.ReadMessageInto(buf)
+	if err != nil {
+		t.Fatalf("unable to read message: %v", err)
+	}
+	if !bytes.Equal(buf[:n], msgs[2]) {
+		t.Fatalf("expected %q, got %q", msgs[2], buf[:n])
+	}
+}
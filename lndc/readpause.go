@@ -0,0 +1,97 @@
+package lndc
+
+import (
+	"net"
+	"time"
+)
+
+// errPausedReadTimeout is returned by a read which reached its deadline
+// while reads were paused.
+var errPausedReadTimeout net.Error = pausedReadTimeoutError{}
+
+type pausedReadTimeoutError struct{}
+
+func (pausedReadTimeoutError) Error() string {
+	return "lndc: read timed out while reads were paused"
+}
+func (pausedReadTimeoutError) Timeout() bool   { return true }
+func (pausedReadTimeoutError) Temporary() bool { return true }
+
+// PauseReads stops the connection from reading from the network, without
+// closing it, until ResumeReads is called. Reads made in the meantime block,
+// including those which could be served from already decrypted data. As
+// nothing is read, the remote peer's writes eventually block too, once its
+// flow control window or the TCP buffers fill up, so that backpressure from
+// a consumer which can't keep up reaches the peer. A blocked read still
+// fails once its deadline set via SetReadDeadline passes or the connection
+// is closed; the rolling read timeout doesn't apply while paused.
+func (c *Conn) PauseReads() {
+	c.pauseMtx.Lock()
+	defer c.pauseMtx.Unlock()
+
+	if c.readsPaused {
+		return
+	}
+	c.readsPaused = true
+	c.readsResumed = make(chan struct{})
+}
+
+// ResumeReads resumes reading after a call to PauseReads, unblocking any
+// reads waiting on it.
+func (c *Conn) ResumeReads() {
+	c.pauseMtx.Lock()
+	defer c.pauseMtx.Unlock()
+
+	if !c.readsPaused {
+		return
+	}
+	c.readsPaused = false
+	close(c.readsResumed)
+}
+
+// waitReadsResumed blocks while reads are paused, returning an error if the
+// read deadline passes or the connection is closed first. The deadline is
+// re-evaluated whenever it's set in the meantime.
+func (c *Conn) waitReadsResumed() error {
+	c.pauseMtx.Lock()
+	paused, resumed := c.readsPaused, c.readsResumed
+	c.pauseMtx.Unlock()
+
+	if !paused {
+		return nil
+	}
+
+	for waiting := true; waiting; {
+		c.deadlineMtx.Lock()
+		deadline := c.readDeadline
+		if c.readDeadlineSet == nil {
+			c.readDeadlineSet = make(chan struct{})
+		}
+		deadlineSet := c.readDeadlineSet
+		c.deadlineMtx.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			expired = timer.C
+		}
+
+		select {
+		case <-resumed:
+			waiting = false
+		case <-deadlineSet:
+		case <-expired:
+			return errPausedReadTimeout
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+
+	if c.isClosed() {
+		return errConnClosed
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package lndc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnPauseReads(t *testing.T) {
+	listener, pkh := newTestListener(t, WithFlowWindow(1<<14))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh, WithFlowWindow(1<<14))
+	defer local.Close()
+	defer remote.Close()
+
+	local.PauseReads()
+
+	// Credits returned to the sender only arrive while it reads.
+	go io.Copy(ioutil.Discard, remote)
+
+	// The sender keeps writing, counting its progress, while the
+	// receiver tries to read everything.
+	const total = 1 << 20
+	chunk := bytes.Repeat([]byte{7}, 1024)
+	var sent int64
+	writeErr := make(chan error, 1)
+	go func() {
+		for i := 0; i < total/len(chunk); i++ {
+			if _, err := remote.Write(chunk); err != nil {
+				writeErr <- err
+				return
+			}
+			atomic.AddInt64(&sent, int64(len(chunk)))
+		}
+		writeErr <- nil
+	}()
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(local, make([]byte, total))
+		readErr <- err
+	}()
+
+	// With nothing read, the sender stalls once the window is full.
+	var stalled int64
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		before := atomic.LoadInt64(&sent)
+		time.Sleep(50 * time.Millisecond)
+		if after := atomic.LoadInt64(&sent); after == before {
+			stalled = after
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the sender to block while paused")
+		}
+	}
+	if stalled >= total {
+		t.Fatalf("expected the sender to stall before writing %d "+
+			"bytes", total)
+	}
+	select {
+	case err := <-readErr:
+		t.Fatalf("expected reads to block while paused, got %v", err)
+	default:
+	}
+
+	// Once resumed, everything is drained.
+	local.ResumeReads()
+	if err := <-readErr; err != nil {
+		t.Fatalf("unable to read after resuming: %v", err)
+	}
+	if err := <-writeErr; err != nil {
+		t.Fatalf("unable to write after resuming: %v", err)
+	}
+}
+
+func TestConnPausedReadUnblocks(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer remote.Close()
+
+	// A paused read gives up at its deadline, even with data waiting.
+	if _, err := remote.Write([]byte("waiting")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	local.PauseReads()
+	local.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := local.Read(make([]byte, 64))
+	expectTimeout(t, err)
+
+	// Closing the connection fails a paused read.
+	local.SetReadDeadline(time.Time{})
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := local.Read(make([]byte, 64))
+		readErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	local.Close()
+	select {
+	case err := <-readErr:
+		if err != errConnClosed {
+			t.Fatalf("expected %v, got %v", errConnClosed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("paused read not unblocked by close")
+	}
+}
+
+func TestConnPausedReadDeadlineUpdated(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	// A deadline set while a read is blocked on the pause still applies
+	// to it.
+	local.PauseReads()
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := local.Read(make([]byte, 64))
+		readErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	local.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	select {
+	case err := <-readErr:
+		expectTimeout(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("paused read ignored its updated deadline")
+	}
+
+	// Likewise, a deadline cleared while a read is blocked no longer
+	// applies to it, so it waits for reads to resume.
+	local.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	go func() {
+		_, err := local.Read(make([]byte, 64))
+		readErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	local.SetReadDeadline(time.Time{})
+	select {
+	case err := <-readErr:
+		t.Fatalf("paused read failed despite its deadline being "+
+			"cleared: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if _, err := remote.Write([]byte("resumed")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	local.ResumeReads()
+	if err := <-readErr; err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package lndc
+
+import (
+	"fmt"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/lnutil"
+)
+
+// ErrRedirect is returned by a read from a connection which the remote peer
+// closed via Redirect, asking to be reconnected to another node instead.
+// Reads after it return the error of the closed underlying connection.
+type ErrRedirect struct {
+	// Pub is the static public key of the node to reconnect to.
+	Pub *koblitz.PublicKey
+
+	// Addr is the address of the node to reconnect to, either an IP
+	// address or torv3 onion service address along with a port.
+	Addr string
+}
+
+// Error returns a description of the redirect target.
+func (e ErrRedirect) Error() string {
+	return fmt.Sprintf("lndc: peer redirected to %x@%s",
+		e.Pub.SerializeCompressed(), e.Addr)
+}
+
+// PKH returns the hash of the redirect target's public key, as passed to
+// Dial to reconnect to it.
+func (e ErrRedirect) PKH() string {
+	var pub [33]byte
+	copy(pub[:], e.Pub.SerializeCompressed())
+
+	return lnutil.LitAdrFromPubkey(pub)
+}
+
+// Redirect closes the connection after asking the remote peer to reconnect
+// to the node with static public key pub at addr, such as to shed load
+// across a cluster. The target is sent within a final encrypted frame, which
+// the remote peer surfaces from its next read as an ErrRedirect. addr must
+// be an IP or torv3 onion service address along with a port.
+//
+// Frames are only used over connections established through the extended
+// handshake. Over any other connection the target can't be delivered, so the
+// connection is simply closed and ErrFramesUnsupported returned.
+func (c *Conn) Redirect(pub *koblitz.PublicKey, addr string) error {
+	if err := validateAdvertisedAddr(addr); err != nil {
+		return err
+	}
+
+	if !c.framed {
+		c.Close()
+		return ErrFramesUnsupported
+	}
+
+	payload := append(pub.SerializeCompressed(), addr...)
+
+	c.armWriteDeadline()
+	if err := c.writeFrame(frameRedirect, payload); err != nil {
+		c.Close()
+		return err
+	}
+
+	return c.Close()
+}
+
+// Redirect asks each of the listener's established connections, via the
+// connection's Redirect, to reconnect to the node with static public key pub
+// at addr, closing them all. The number of peers redirected is returned;
+// those which didn't negotiate frames, or whose redirect couldn't be
+// written, are closed without being told where to go.
+func (l *Listener) Redirect(pub *koblitz.PublicKey, addr string) (int, error) {
+	if err := validateAdvertisedAddr(addr); err != nil {
+		return 0, err
+	}
+
+	redirected := 0
+	for _, conn := range l.Conns() {
+		if err := conn.Redirect(pub, addr); err != nil {
+			l.cfg.log().Debugf("lndc listener %s: unable to redirect "+
+				"conn %d: %v", l.id, conn.seq, err)
+			continue
+		}
+		redirected++
+	}
+
+	return redirected, nil
+}
+
+// decodeRedirect parses the payload of a redirect frame into the ErrRedirect
+// to be returned to the reader.
+func decodeRedirect(payload []byte) error {
+	if len(payload) < 33 {
+		return ErrMalformedFrame
+	}
+
+	pub, err := koblitz.ParsePubKey(payload[:33], koblitz.S256())
+	if err != nil {
+		return fmt.Errorf("%v: bad redirect key: %v", ErrMalformedFrame,
+			err)
+	}
+	addr := string(payload[33:])
+	if err := validateAdvertisedAddr(addr); err != nil {
+		return fmt.Errorf("%v: %v", ErrMalformedFrame, err)
+	}
+
+	return ErrRedirect{Pub: pub, Addr: addr}
+}
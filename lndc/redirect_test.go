@@ -0,0 +1,125 @@
+package lndc
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+	target, targetPKH := newTestListener(t)
+	defer target.Close()
+
+	targetPub := target.localStatic.PubKey()
+	targetAddr := net.JoinHostPort("127.0.0.1",
+		strconv.Itoa(target.Addr().(*net.TCPAddr).Port))
+
+	dialerPriv := newKey(t)
+	local, remote := dialAndAcceptWithKey(t, listener, pkh, dialerPriv,
+		WithFlowWindow(1<<16))
+	defer remote.Close()
+
+	// An invalid target is refused without closing the connection.
+	if err := local.Redirect(targetPub, "node-y:2448"); err == nil {
+		t.Fatalf("expected a hostname target to be refused")
+	}
+	roundTrip(t, local, remote)
+
+	if err := local.Redirect(targetPub, targetAddr); err != nil {
+		t.Fatalf("unable to redirect: %v", err)
+	}
+
+	_, err := remote.Read(make([]byte, 1))
+	redirect, ok := err.(ErrRedirect)
+	if !ok {
+		t.Fatalf("expected ErrRedirect, got %T: %v", err, err)
+	}
+	if !redirect.Pub.IsEqual(targetPub) || redirect.Addr != targetAddr {
+		t.Fatalf("expected redirect to %x@%s, got %v",
+			targetPub.SerializeCompressed(), targetAddr, redirect)
+	}
+	if _, err := remote.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF after the redirect, got %v", err)
+	}
+	if remote.CloseReason() != ErrPeerClose {
+		t.Fatalf("expected close reason %v, got %v", ErrPeerClose,
+			remote.CloseReason())
+	}
+
+	// The dialer can reconnect to the target as directed.
+	if redirect.PKH() != targetPKH {
+		t.Fatalf("expected target PKH %s, got %s", targetPKH,
+			redirect.PKH())
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			conn = nil
+		}
+		accepted <- conn
+	}()
+	conn, err := Dial(dialerPriv, redirect.Addr, redirect.PKH(), net.Dial)
+	if err != nil {
+		t.Fatalf("unable to follow redirect: %v", err)
+	}
+	defer conn.Close()
+	targetConn := <-accepted
+	if targetConn == nil {
+		t.Fatalf("target didn't accept the redirected peer")
+	}
+	defer targetConn.Close()
+	roundTrip(t, targetConn.(*Conn), conn)
+}
+
+func TestListenerRedirect(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	targetPub := newKey(t).PubKey()
+	const targetAddr = "203.0.113.7:2448"
+
+	var peers []*Conn
+	for i := 0; i < 3; i++ {
+		local, remote := dialAndAccept(t, listener, pkh,
+			WithFlowWindow(1024))
+		defer local.Close()
+		defer remote.Close()
+		peers = append(peers, remote)
+	}
+
+	// A peer which didn't negotiate frames is closed without being told.
+	local, unframed := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer unframed.Close()
+
+	if _, err := listener.Redirect(targetPub, "bad"); err == nil {
+		t.Fatalf("expected an invalid target to be refused")
+	}
+	n, err := listener.Redirect(targetPub, targetAddr)
+	if err != nil {
+		t.Fatalf("unable to redirect: %v", err)
+	}
+	if n != len(peers) {
+		t.Fatalf("expected %d peers redirected, got %d", len(peers), n)
+	}
+
+	for i, peer := range peers {
+		_, err := peer.Read(make([]byte, 1))
+		redirect, ok := err.(ErrRedirect)
+		if !ok || !redirect.Pub.IsEqual(targetPub) ||
+			redirect.Addr != targetAddr {
+
+			t.Fatalf("peer %d: expected redirect, got %v", i, err)
+		}
+	}
+	if _, err := unframed.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	if conns := listener.Conns(); len(conns) != 0 {
+		t.Fatalf("expected all conns closed, %d remain", len(conns))
+	}
+}
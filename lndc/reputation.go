@@ -0,0 +1,79 @@
+package lndc
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// defaultReputationTimeout is how long a listener waits for the
+// ReputationCheck of each connection, unless overridden by
+// ReputationTimeout.
+const defaultReputationTimeout = 500 * time.Millisecond
+
+// ErrPoorReputation is returned when a connection is refused as the
+// ReputationCheck scored its IP below MinReputation.
+type ErrPoorReputation struct {
+	// IP is the address of the refused peer.
+	IP net.IP
+
+	// Score is the reputation it was given.
+	Score int
+}
+
+// Error returns a description of the refused peer.
+func (e ErrPoorReputation) Error() string {
+	return fmt.Sprintf("lndc: peer at %v has a reputation of %d", e.IP,
+		e.Score)
+}
+
+// checkReputation returns ErrPoorReputation if the configured
+// ReputationCheck scores the IP of addr below MinReputation. If the check
+// fails or doesn't answer within ReputationTimeout the connection is let
+// through, so that an outage of the reputation service doesn't lock every
+// peer out.
+func (c *Config) checkReputation(addr net.Addr) error {
+	if c.ReputationCheck == nil {
+		return nil
+	}
+	ip := remoteIP(addr)
+	if ip == nil {
+		return nil
+	}
+
+	timeout := c.ReputationTimeout
+	if timeout == 0 {
+		timeout = defaultReputationTimeout
+	}
+
+	type result struct {
+		score int
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		score, err := c.ReputationCheck(ip)
+		results <- result{score, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-results:
+		if r.err != nil {
+			c.log().Warnf("lndc: unable to check reputation of %v: %v",
+				ip, r.err)
+			return nil
+		}
+		if r.score < c.MinReputation {
+			return ErrPoorReputation{IP: ip, Score: r.score}
+		}
+		return nil
+
+	case <-timer.C:
+		c.log().Warnf("lndc: reputation check of %v timed out after %v",
+			ip, timeout)
+		return nil
+	}
+}
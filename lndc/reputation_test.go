@@ -0,0 +1,70 @@
+package lndc
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// mockReputation scores IPs from a fixed table, stalling on those it
+// doesn't know.
+type mockReputation map[string]int
+
+func (m mockReputation) check(ip net.IP) (int, error) {
+	score, ok := m[ip.String()]
+	if !ok {
+		time.Sleep(time.Second)
+		return 0, errors.New("unknown ip")
+	}
+
+	return score, nil
+}
+
+func TestListenerReputationCheck(t *testing.T) {
+	scores := mockReputation{"127.0.0.1": 80, "127.0.0.2": 10}
+	listener, pkh := newTestListener(t,
+		WithReputationCheck(scores.check, 50),
+		WithReputationTimeout(50*time.Millisecond))
+	defer listener.Close()
+
+	// A well scored IP is accepted.
+	local, remote := dialAndAccept(t, listener, pkh)
+	local.Close()
+	remote.Close()
+
+	// A poorly scored one is refused before the handshake.
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{
+		IP: net.ParseIP("127.0.0.2"),
+	}}
+	conn, err := dialer.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Skipf("unable to dial from 127.0.0.2: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = listener.Accept()
+	if refused, ok := err.(ErrPoorReputation); !ok || refused.Score != 10 {
+		t.Fatalf("expected a poor reputation of 10, got %v", err)
+	}
+
+	// An IP the service stalls on is let through once the check times
+	// out.
+	dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP("127.0.0.3")}
+	start := time.Now()
+	remoteConn, err := Dial(newKey(t), listener.Addr().String(), pkh,
+		dialer.Dial)
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	defer remoteConn.Close()
+	localConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("expected a timed out check to be let through: %v", err)
+	}
+	defer localConn.Close()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected the check to time out promptly, took %v",
+			elapsed)
+	}
+}
@@ -0,0 +1,43 @@
+package lndc
+
+import "time"
+
+const (
+	// defaultHandshakeTimeoutFloor is the shortest handshake read timeout
+	// derived from the time taken to connect, unless another is set.
+	defaultHandshakeTimeoutFloor = 500 * time.Millisecond
+
+	// defaultHandshakeTimeoutCeiling is the longest handshake read
+	// timeout derived from the time taken to connect, unless another is
+	// set. It's generous enough for a handshake carried over Tor.
+	defaultHandshakeTimeoutCeiling = 30 * time.Second
+)
+
+// handshakeTimeout returns the read timeout a dialer applies while waiting
+// on each act of the handshake, given rtt, the time taken to connect to the
+// remote peer. If HandshakeRTTMultiple isn't set or rtt is unknown, the
+// fixed handshakeReadTimeout is used.
+func (c *Config) handshakeTimeout(rtt time.Duration) time.Duration {
+	if c.HandshakeRTTMultiple == 0 || rtt <= 0 {
+		return handshakeReadTimeout
+	}
+
+	floor := c.HandshakeTimeoutFloor
+	if floor == 0 {
+		floor = defaultHandshakeTimeoutFloor
+	}
+	ceiling := c.HandshakeTimeoutCeiling
+	if ceiling == 0 {
+		ceiling = defaultHandshakeTimeoutCeiling
+	}
+
+	timeout := rtt * time.Duration(c.HandshakeRTTMultiple)
+	switch {
+	case timeout < floor:
+		return floor
+	case timeout > ceiling:
+		return ceiling
+	default:
+		return timeout
+	}
+}
@@ -0,0 +1,102 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshakeTimeoutScaling(t *testing.T) {
+	cfg := newConfig(WithAdaptiveHandshakeTimeout(4, time.Second,
+		10*time.Second))
+
+	tests := []struct {
+		rtt      time.Duration
+		expected time.Duration
+	}{
+		{0, handshakeReadTimeout},
+		{time.Millisecond, time.Second},
+		{time.Second, 4 * time.Second},
+		{time.Minute, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if got := cfg.handshakeTimeout(test.rtt); got != test.expected {
+			t.Fatalf("rtt %v: expected timeout %v, got %v", test.rtt,
+				test.expected, got)
+		}
+	}
+
+	got := newConfig().handshakeTimeout(time.Second)
+	if got != handshakeReadTimeout {
+		t.Fatalf("expected fixed timeout %v, got %v",
+			handshakeReadTimeout, got)
+	}
+}
+
+// silentListener accepts TCP connections but never responds on them, so
+// that a handshake over them times out.
+func silentListener(t *testing.T) (net.Listener, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+
+	var conns []net.Conn
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	return l, func() {
+		l.Close()
+		<-done
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+}
+
+func TestHandshakeTimeoutAdaptsToLatency(t *testing.T) {
+	l, cleanup := silentListener(t)
+	defer cleanup()
+
+	// dialTimeout returns how long the handshake waited on the silent
+	// listener, over a link whose connect time is delayed by latency.
+	dialTimeout := func(latency time.Duration) time.Duration {
+		var connected time.Time
+		dialer := func(network, addr string) (net.Conn, error) {
+			time.Sleep(latency)
+			conn, err := net.Dial(network, addr)
+			connected = time.Now()
+			return conn, err
+		}
+
+		_, err := Dial(newKey(t), l.Addr().String(), "unused", dialer,
+			WithAdaptiveHandshakeTimeout(4, 100*time.Millisecond,
+				5*time.Second))
+		if err == nil {
+			t.Fatalf("expected handshake to time out")
+		}
+
+		return time.Since(connected)
+	}
+
+	low := dialTimeout(0)
+	high := dialTimeout(250 * time.Millisecond)
+
+	if low > 500*time.Millisecond {
+		t.Fatalf("expected the floor to apply on a fast link, waited %v",
+			low)
+	}
+	if high < 900*time.Millisecond {
+		t.Fatalf("expected a timeout of 4x the connect time on a slow "+
+			"link, waited %v", high)
+	}
+}
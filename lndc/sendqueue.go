@@ -0,0 +1,187 @@
+package lndc
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// queuedSend is a message waiting in a Conn's send queue. Once it has been
+// written, n is set to the number of bytes written before the outcome is
+// sent on done.
+type queuedSend struct {
+	msg      []byte
+	priority int
+	seq      uint64
+	n        int
+	done     chan error
+}
+
+// sendHeap orders queued messages by descending priority, then in the order
+// they were queued.
+type sendHeap []*queuedSend
+
+func (h sendHeap) Len() int { return len(h) }
+
+func (h sendHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+
+	return h[i].seq < h[j].seq
+}
+
+func (h sendHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *sendHeap) Push(x interface{}) { *h = append(*h, x.(*queuedSend)) }
+
+func (h *sendHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+
+	return item
+}
+
+// sendQueue holds the messages queued by WritePriority, which a single
+// goroutine writes out highest priority first.
+type sendQueue struct {
+	mtx    sync.Mutex
+	items  sendHeap
+	seq    uint64
+	closed bool
+
+	// signal is notified whenever a message is queued or the queue is
+	// closed.
+	signal chan struct{}
+}
+
+// push queues a message, returning false if the queue has been closed.
+func (q *sendQueue) push(item *queuedSend) bool {
+	q.mtx.Lock()
+	if q.closed {
+		q.mtx.Unlock()
+		return false
+	}
+	item.seq = q.seq
+	q.seq++
+	heap.Push(&q.items, item)
+	q.mtx.Unlock()
+
+	q.notify()
+
+	return true
+}
+
+// pop removes the highest priority message, returning false once the queue
+// is closed.
+func (q *sendQueue) pop() (*queuedSend, bool) {
+	for {
+		q.mtx.Lock()
+		if q.closed {
+			q.mtx.Unlock()
+			return nil, false
+		}
+		if len(q.items) > 0 {
+			item := heap.Pop(&q.items).(*queuedSend)
+			q.mtx.Unlock()
+			return item, true
+		}
+		q.mtx.Unlock()
+
+		<-q.signal
+	}
+}
+
+// close closes the queue, failing every message still waiting in it.
+func (q *sendQueue) close() {
+	q.mtx.Lock()
+	items := q.items
+	q.items = nil
+	q.closed = true
+	q.mtx.Unlock()
+
+	for _, item := range items {
+		item.done <- errConnClosed
+	}
+	q.notify()
+}
+
+// notify wakes the goroutine waiting in pop.
+func (q *sendQueue) notify() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// WritePriority writes b to the connection through its send queue, blocking
+// until it has been written. While the connection is congested, messages
+// queue up and are written highest priority first, or in the order they
+// were queued among those of the same priority. This lets urgent messages,
+// such as pings and shutdowns, overtake bulk data.
+//
+// A message already being written isn't interrupted by a higher priority
+// one. Messages written with Write bypass the queue.
+func (c *Conn) WritePriority(b []byte, priority int) (int, error) {
+	q := c.startSendQueue()
+
+	item := &queuedSend{
+		msg:      b,
+		priority: priority,
+		done:     make(chan error, 1),
+	}
+	if !q.push(item) {
+		return 0, errConnClosed
+	}
+	err := <-item.done
+
+	return item.n, err
+}
+
+// startSendQueue returns the connection's send queue, creating it along
+// with the goroutine which drains it on first use.
+func (c *Conn) startSendQueue() *sendQueue {
+	c.queueMtx.Lock()
+	defer c.queueMtx.Unlock()
+
+	if c.sendQueue != nil {
+		return c.sendQueue
+	}
+
+	q := &sendQueue{signal: make(chan struct{}, 1)}
+	c.sendQueue = q
+	go c.drainSendQueue(q)
+	c.onClose(q.close)
+
+	return q
+}
+
+// stopSendQueue closes the connection's send queue, if it has one, so that
+// the goroutine draining it exits.
+func (c *Conn) stopSendQueue() {
+	c.queueMtx.Lock()
+	q := c.sendQueue
+	c.sendQueue = nil
+	c.queueMtx.Unlock()
+
+	if q != nil {
+		q.close()
+	}
+}
+
+// drainSendQueue writes out the messages queued in q until it's closed.
+//
+// NOTE: This method must be run as a goroutine.
+func (c *Conn) drainSendQueue(q *sendQueue) {
+	for {
+		item, ok := q.pop()
+		if !ok {
+			return
+		}
+
+		n, err := c.Write(item.msg)
+		item.n = n
+		item.done <- err
+	}
+}
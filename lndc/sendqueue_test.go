@@ -0,0 +1,142 @@
+package lndc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// waitQueued blocks until pushed messages have been queued on the
+// connection, of which n are still waiting in the queue.
+func waitQueued(t *testing.T, c *Conn, pushed uint64, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.queueMtx.Lock()
+		q := c.sendQueue
+		c.queueMtx.Unlock()
+
+		if q != nil {
+			q.mtx.Lock()
+			seq, queued := q.seq, len(q.items)
+			q.mtx.Unlock()
+			if seq == pushed && queued == n {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued messages", n)
+}
+
+func TestConnWritePriority(t *testing.T) {
+	const window = 1024
+
+	listener, pkh := newTestListener(t, WithFlowWindow(window))
+	defer listener.Close()
+	local, remote := dialAndAccept(t, listener, pkh, WithFlowWindow(window))
+	defer local.Close()
+	defer remote.Close()
+
+	// Credits are only received while the connection is being read.
+	go io.Copy(ioutil.Discard, remote)
+
+	// Congest the connection by filling the peer's window, so the first
+	// queued message blocks awaiting credits.
+	fill := bytes.Repeat([]byte{0}, window)
+	if _, err := remote.Write(fill); err != nil {
+		t.Fatalf("unable to fill window: %v", err)
+	}
+
+	errs := make(chan error, 4)
+	send := func(msg string, priority int) {
+		go func() {
+			_, err := remote.WritePriority([]byte(msg), priority)
+			errs <- err
+		}()
+	}
+	send("bulk 1", 0)
+	waitQueued(t, remote, 1, 0)
+	send("bulk 2", 0)
+	waitQueued(t, remote, 2, 1)
+	send("bulk 3", 0)
+	waitQueued(t, remote, 3, 2)
+	send("urgent", 10)
+	waitQueued(t, remote, 4, 3)
+
+	// Once the congestion clears, the urgent message overtakes the bulk
+	// messages queued before it.
+	expected := []string{"bulk 1", "urgent", "bulk 2", "bulk 3"}
+	if _, err := local.ReadNextMessage(); err != nil {
+		t.Fatalf("unable to read fill: %v", err)
+	}
+	for _, want := range expected {
+		msg, err := local.ReadNextMessage()
+		if err != nil {
+			t.Fatalf("unable to read message: %v", err)
+		}
+		if string(msg) != want {
+			t.Fatalf("expected %q, got %q", want, msg)
+		}
+	}
+	for range expected {
+		if err := <-errs; err != nil {
+			t.Fatalf("unable to write message: %v", err)
+		}
+	}
+}
+
+func TestConnWritePriorityPartial(t *testing.T) {
+	const window = 1024
+
+	listener, pkh := newTestListener(t, WithFlowWindow(window))
+	defer listener.Close()
+	local, remote := dialAndAccept(t, listener, pkh, WithFlowWindow(window))
+	defer local.Close()
+	defer remote.Close()
+
+	// With nothing crediting the window back, a message twice its size
+	// is only written in part before the deadline passes.
+	remote.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err := remote.WritePriority(make([]byte, 2*window), 0)
+	if err == nil {
+		t.Fatalf("expected the write to time out")
+	}
+	if n != window {
+		t.Fatalf("expected %d bytes written, got %d", window, n)
+	}
+}
+
+func TestConnResetStopsSendQueue(t *testing.T) {
+	pooled, peer, _, _ := upgradePipe(t)
+	defer peer.Close()
+
+	go io.Copy(ioutil.Discard, peer)
+	if _, err := pooled.WritePriority([]byte("queued"), 0); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	q := pooled.sendQueue
+	defer pooled.conn.Close()
+
+	// Resetting the Conn, which drops its close hooks, still stops the
+	// goroutine draining its queue.
+	second, secondPeer, _, _ := upgradePipe(t)
+	defer secondPeer.Close()
+	pooled.Reset(second.conn, second.noise)
+	defer pooled.Close()
+
+	done := make(chan struct{})
+	go func() {
+		q.pop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("send queue still open after reset")
+	}
+	if pooled.sendQueue != nil {
+		t.Fatalf("send queue survived the reset")
+	}
+}
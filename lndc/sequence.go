@@ -0,0 +1,97 @@
+package lndc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// sequenceSize is the number of bytes taken by the sequence number of each
+// data frame once sequence numbers have been negotiated.
+const sequenceSize = 8
+
+// ErrSequenceGap is returned when a data frame received from the remote peer
+// doesn't carry the next sequence number, as a message was lost or repeated.
+var ErrSequenceGap = errors.New("lndc: gap in message sequence numbers")
+
+// offerSequenceNumbers offers sequence numbers if the initiator has them
+// enabled. The record carries no value, as its presence alone signals
+// support.
+func offerSequenceNumbers(c *Conn, cfg *Config) []byte {
+	if !cfg.SequenceNumbers {
+		return nil
+	}
+
+	return []byte{}
+}
+
+// answerSequenceNumbers agrees to sequence numbers if they were offered by
+// the initiator and the responder has them enabled too.
+func answerSequenceNumbers(c *Conn, cfg *Config, offer []byte) ([]byte, error) {
+	if offer == nil || !cfg.SequenceNumbers {
+		return nil, nil
+	}
+	if err := acceptSequenceNumbers(c, cfg, offer); err != nil {
+		return nil, err
+	}
+
+	return []byte{}, nil
+}
+
+// acceptSequenceNumbers records that the remote peer agreed to sequence
+// numbers.
+func acceptSequenceNumbers(c *Conn, cfg *Config, answer []byte) error {
+	if answer == nil {
+		return nil
+	}
+	if len(answer) != 0 {
+		return ErrMalformedHello
+	}
+
+	c.sequenced = true
+
+	return nil
+}
+
+// sequenceOverhead returns the number of bytes each data frame spends on its
+// sequence number.
+func (c *Conn) sequenceOverhead() int {
+	if c.sequenced {
+		return sequenceSize
+	}
+
+	return 0
+}
+
+// stampSequence writes the next sequence number into msg if it's a data
+// frame and sequence numbers are in use. Sequence numbers are assigned as
+// messages are written, so that they follow the order on the wire.
+//
+// NOTE: This method must be called with writeMtx held.
+func (c *Conn) stampSequence(msg []byte) {
+	if !c.sequenced || len(msg) < 1+sequenceSize || msg[0] != frameData {
+		return
+	}
+
+	binary.BigEndian.PutUint64(msg[1:1+sequenceSize], c.sendSeq)
+	c.sendSeq++
+}
+
+// checkSequence ensures that the body of a data frame carries the next
+// sequence number if those are in use, returning the payload which follows
+// it.
+func (c *Conn) checkSequence(body []byte) ([]byte, error) {
+	if !c.sequenced {
+		return body, nil
+	}
+	if len(body) < sequenceSize {
+		return nil, ErrMalformedFrame
+	}
+
+	seq := binary.BigEndian.Uint64(body[:sequenceSize])
+	if seq != c.recvSeq {
+		return nil, ErrSequenceGap
+	}
+	c.recvSeq++
+
+	return body[sequenceSize:], nil
+}
@@ -0,0 +1,49 @@
+package lndc
+
+import (
+	"io"
+	"testing"
+)
+
+func TestSequenceNumbers(t *testing.T) {
+	listener, pkh := newTestListener(t, WithSequenceNumbers())
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh, WithSequenceNumbers())
+	defer local.Close()
+	defer remote.Close()
+
+	if !local.sequenced || !remote.sequenced {
+		t.Fatalf("expected sequence numbers to be negotiated")
+	}
+	roundTrip(t, local, remote)
+	roundTrip(t, local, remote)
+
+	// Skipping a sequence number, as if a message had been lost, fails
+	// the read on the other side.
+	remote.writeMtx.Lock()
+	remote.sendSeq++
+	remote.writeMtx.Unlock()
+	if _, err := remote.Write([]byte("after the gap")); err != nil {
+		t.Fatalf("unable to write message: %v", err)
+	}
+	if _, err := io.ReadFull(local, make([]byte, 13)); err != ErrSequenceGap {
+		t.Fatalf("expected %v, got %v", ErrSequenceGap, err)
+	}
+}
+
+func TestSequenceNumbersOneSided(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	// A peer which doesn't enable sequence numbers still speaks to one
+	// which does, without them.
+	local, remote := dialAndAccept(t, listener, pkh, WithSequenceNumbers())
+	defer local.Close()
+	defer remote.Close()
+
+	if local.sequenced || remote.sequenced {
+		t.Fatalf("expected sequence numbers not to be negotiated")
+	}
+	roundTrip(t, local, remote)
+}
@@ -0,0 +1,33 @@
+package lndc
+
+// connHandler is the type of the handler stored by a Listener for Serve.
+type connHandler func(*Conn)
+
+// Serve accepts connections from the listener, passing each to handler on a
+// goroutine of its own, until the listener is closed. The handler may be
+// swapped while Serve runs via SetHandler. Connections whose handshake
+// fails are skipped. Serve always returns a non-nil error, which is that of
+// the closed listener.
+func (l *Listener) Serve(handler func(*Conn)) error {
+	l.SetHandler(handler)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if l.isClosed() {
+				return err
+			}
+			continue
+		}
+
+		handler := l.handler.Load().(connHandler)
+		go handler(conn.(*Conn))
+	}
+}
+
+// SetHandler atomically swaps the handler used by a running Serve.
+// Connections accepted from then on are passed to the new handler, while
+// those already passed to the old one are unaffected.
+func (l *Listener) SetHandler(handler func(*Conn)) {
+	l.handler.Store(connHandler(handler))
+}
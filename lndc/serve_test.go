@@ -0,0 +1,53 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenerSetHandler(t *testing.T) {
+	listener, pkh := newTestListener(t)
+
+	first := make(chan *Conn, 1)
+	second := make(chan *Conn, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- listener.Serve(func(conn *Conn) { first <- conn })
+	}()
+
+	dial := func() *Conn {
+		conn, err := Dial(newKey(t), listener.Addr().String(), pkh,
+			net.Dial)
+		if err != nil {
+			t.Fatalf("unable to dial listener: %v", err)
+		}
+		return conn
+	}
+	expect := func(handled chan *Conn, name string) {
+		select {
+		case conn := <-handled:
+			conn.Close()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("conn not passed to the %s handler", name)
+		}
+	}
+
+	conn := dial()
+	defer conn.Close()
+	expect(first, "first")
+
+	// Connections accepted after the swap go to the new handler.
+	listener.SetHandler(func(conn *Conn) { second <- conn })
+	conn = dial()
+	defer conn.Close()
+	expect(second, "second")
+	if len(first) != 0 {
+		t.Fatalf("expected nothing more passed to the first handler")
+	}
+
+	listener.Close()
+	if err := <-served; err == nil {
+		t.Fatalf("expected Serve to return an error once closed")
+	}
+}
@@ -0,0 +1,197 @@
+package lndc
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// defaultSessionBuffer is the number of bytes of outbound messages a Session
+// buffers while reconnecting, unless overridden by SessionBuffer.
+const defaultSessionBuffer = 1 << 20
+
+// ErrSessionClosed is returned by the methods of a Session once it has been
+// closed.
+var ErrSessionClosed = errors.New("lndc: session closed")
+
+// ErrSessionBufferFull is returned by a write to a Session which is
+// reconnecting when its buffer has no room for the message.
+var ErrSessionBufferFull = errors.New("lndc: session buffer full")
+
+// Session is a logical connection to a single peer which persists while the
+// ConnManager beneath it replaces the transport, so that upper layers can
+// treat the peer as continuously present.
+//
+// Messages written while the peer is being reconnected are buffered, up to
+// SessionBuffer bytes, and flushed in order once the new connection is
+// established. A message may be lost if the connection drops after it was
+// written but before the peer read it. A read which fails as the
+// connection drops carries on from the next connection.
+type Session struct {
+	mgr   *ConnManager
+	limit int
+
+	// mtx guards pending, the messages waiting to be written to the
+	// next connection, pendingBytes, their total length, and closed.
+	mtx          sync.Mutex
+	pending      [][]byte
+	pendingBytes int
+	closed       bool
+
+	// readConn is the connection last read from, which is only accessed
+	// by Read.
+	readConn *Conn
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewSession creates a Session over the connections maintained by mgr,
+// starting it if it hasn't been already. The Session takes ownership of
+// mgr, stopping it once closed.
+func NewSession(mgr *ConnManager) *Session {
+	limit := mgr.cfg.SessionBuffer
+	if limit == 0 {
+		limit = defaultSessionBuffer
+	}
+
+	s := &Session{
+		mgr:   mgr,
+		limit: limit,
+		quit:  make(chan struct{}),
+	}
+	mgr.Start()
+
+	s.wg.Add(1)
+	go s.flushLoop()
+
+	return s
+}
+
+// RemotePub returns the static public key of the peer, which stays the same
+// across reconnections.
+func (s *Session) RemotePub() *koblitz.PublicKey {
+	return s.mgr.remotePub
+}
+
+// Conn returns the connection currently carrying the session, or nil if
+// it's reconnecting.
+func (s *Session) Conn() *Conn {
+	return s.mgr.Conn()
+}
+
+// Write writes b to the peer as a single message. If the peer is being
+// reconnected, the message is buffered to be written once it's connected
+// again, failing with ErrSessionBufferFull if the buffer has no room for
+// it. Messages are written in the order Write is called.
+func (s *Session) Write(b []byte) (int, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.closed {
+		return 0, ErrSessionClosed
+	}
+
+	// Messages may only be written straight away once all of those
+	// buffered before them have been flushed.
+	if conn := s.mgr.Conn(); conn != nil && len(s.pending) == 0 {
+		if _, err := conn.Write(b); err == nil {
+			return len(b), nil
+		}
+
+		// The connection has dropped, so it's closed for the manager
+		// to replace it and the message buffered.
+		conn.Close()
+	}
+
+	if s.pendingBytes+len(b) > s.limit {
+		return 0, ErrSessionBufferFull
+	}
+	s.pending = append(s.pending, append([]byte(nil), b...))
+	s.pendingBytes += len(b)
+
+	return len(b), nil
+}
+
+// Read reads data sent by the peer over the current connection, waiting for
+// the peer to be reconnected if it isn't. Data in flight when a connection
+// drops is lost.
+//
+// NOTE: Read must not be called concurrently with itself.
+func (s *Session) Read(b []byte) (int, error) {
+	for {
+		conn := s.readConn
+		if conn == nil || conn.isClosed() {
+			conn = s.mgr.nextConn(conn, s.quit)
+			if conn == nil {
+				return 0, ErrSessionClosed
+			}
+			s.readConn = conn
+		}
+
+		n, err := conn.Read(b)
+		if err == nil {
+			return n, nil
+		}
+
+		// Close the connection, so that the manager replaces it, and
+		// read from the next one.
+		conn.Close()
+	}
+}
+
+// Close closes the session along with its current connection, stopping its
+// ConnManager. Any messages still buffered are discarded.
+func (s *Session) Close() error {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return ErrSessionClosed
+	}
+	s.closed = true
+	s.pending = nil
+	s.pendingBytes = 0
+	s.mtx.Unlock()
+
+	close(s.quit)
+	s.mgr.Stop()
+	s.wg.Wait()
+
+	return nil
+}
+
+// flushLoop writes the messages buffered while reconnecting to each new
+// connection the manager establishes.
+//
+// NOTE: This method must be run as a goroutine.
+func (s *Session) flushLoop() {
+	defer s.wg.Done()
+
+	var conn *Conn
+	for {
+		conn = s.mgr.nextConn(conn, s.quit)
+		if conn == nil {
+			return
+		}
+		s.flush(conn)
+	}
+}
+
+// flush writes the buffered messages to conn in order, stopping at the
+// first which fails.
+func (s *Session) flush(conn *Conn) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for len(s.pending) > 0 {
+		msg := s.pending[0]
+		if _, err := conn.Write(msg); err != nil {
+			conn.Close()
+			return
+		}
+		s.pending = s.pending[1:]
+		s.pendingBytes -= len(msg)
+	}
+	s.pending = nil
+}
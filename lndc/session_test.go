@@ -0,0 +1,90 @@
+package lndc
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// acceptConn accepts the next connection to the listener.
+func acceptConn(t *testing.T, listener *Listener) *Conn {
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("unable to accept connection: %v", err)
+	}
+
+	return conn.(*Conn)
+}
+
+// readExactly reads len(expected) bytes from r, failing unless they match.
+func readExactly(t *testing.T, r io.Reader, expected string) {
+	got := make([]byte, len(expected))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatalf("unable to read %q: %v", expected, err)
+	}
+	if string(got) != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestSessionReconnect(t *testing.T) {
+	listener, _ := newTestListener(t)
+	defer listener.Close()
+
+	m, err := NewConnManager(newKey(t), listener.localStatic.PubKey(),
+		[]string{listener.Addr().String()}, net.Dial,
+		WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unable to create conn manager: %v", err)
+	}
+	session := NewSession(m)
+	defer session.Close()
+
+	first := acceptConn(t, listener)
+	defer first.Close()
+	waitForState(t, m, StateConnected)
+	if _, err := session.Write([]byte("one")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	readExactly(t, first, "one")
+
+	// Drop the underlying connection. Messages written while the peer
+	// is being reconnected are buffered.
+	session.Conn().Close()
+	for _, msg := range []string{"two", "three"} {
+		if _, err := session.Write([]byte(msg)); err != nil {
+			t.Fatalf("unable to write while reconnecting: %v", err)
+		}
+	}
+
+	// Once reconnected, the buffered messages are flushed in order, and
+	// the session carries on over the new connection.
+	second := acceptConn(t, listener)
+	defer second.Close()
+	readExactly(t, second, "twothree")
+
+	if _, err := second.Write([]byte("back")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	readExactly(t, session, "back")
+}
+
+func TestSessionBufferFull(t *testing.T) {
+	// The manager never connects, so every write is buffered.
+	m, err := NewConnManager(newKey(t), newKey(t).PubKey(),
+		[]string{closedAddr(t)}, net.Dial, WithSessionBuffer(8),
+		WithReconnectBackoff(time.Second, time.Second))
+	if err != nil {
+		t.Fatalf("unable to create conn manager: %v", err)
+	}
+	session := NewSession(m)
+	defer session.Close()
+
+	if _, err := session.Write([]byte("12345")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	if _, err := session.Write([]byte("6789")); err != ErrSessionBufferFull {
+		t.Fatalf("expected %v, got %v", ErrSessionBufferFull, err)
+	}
+}
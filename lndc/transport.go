@@ -0,0 +1,63 @@
+package lndc
+
+import (
+	"net"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+	"github.com/mit-dci/lit/lnutil"
+)
+
+// Transport holds the static key and options shared by a node's inbound and
+// outbound connections, so that settings such as timeouts, logging and
+// limits are configured in one place rather than duplicated between its
+// listeners and dials.
+type Transport struct {
+	localStatic *koblitz.PrivateKey
+	dialer      func(string, string) (net.Conn, error)
+	options     []func(*Config)
+}
+
+// NewTransport returns a Transport which listens and dials using the static
+// key localStatic, connecting out through dialer. The options are applied to
+// every listener and dial made through the Transport.
+func NewTransport(localStatic *koblitz.PrivateKey,
+	dialer func(string, string) (net.Conn, error),
+	options ...func(*Config)) *Transport {
+
+	t := &Transport{
+		localStatic: localStatic,
+		dialer:      dialer,
+	}
+	t.options = t.with(options)
+
+	return t
+}
+
+// Listen creates a Listener on the passed port as NewListener does, using
+// the Transport's options followed by any passed, which take precedence.
+func (t *Transport) Listen(port int, options ...func(*Config)) (*Listener,
+	error) {
+
+	return NewListener(t.localStatic, port, t.with(options)...)
+}
+
+// Dial connects to the peer with the static public key remotePub at addr as
+// Dial does, using the Transport's options followed by any passed, which
+// take precedence.
+func (t *Transport) Dial(addr string, remotePub *koblitz.PublicKey,
+	options ...func(*Config)) (*Conn, error) {
+
+	var idPub [33]byte
+	copy(idPub[:], remotePub.SerializeCompressed())
+
+	return Dial(t.localStatic, addr, lnutil.LitAdrFromPubkey(idPub),
+		t.dialer, t.with(options)...)
+}
+
+// with returns the Transport's options followed by the passed ones.
+func (t *Transport) with(options []func(*Config)) []func(*Config) {
+	all := make([]func(*Config), 0, len(t.options)+len(options))
+	all = append(all, t.options...)
+
+	return append(all, options...)
+}
@@ -0,0 +1,55 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTransport(t *testing.T) {
+	logger := &captureLogger{}
+	server := NewTransport(newKey(t), net.Dial, WithLogger(logger),
+		WithTimeouts(time.Minute, time.Minute), WithFlowWindow(1024))
+	client := NewTransport(newKey(t), net.Dial,
+		WithTimeouts(time.Minute, time.Minute), WithFlowWindow(1024))
+
+	listener, err := server.Listen(0, WithListenerID("inbound"))
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	if listener.ID() != "inbound" || listener.cfg.Logger != logger {
+		t.Fatalf("expected the listener to combine the transport's " +
+			"options with its own")
+	}
+
+	accepted := make(chan *Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		accepted <- conn.(*Conn)
+	}()
+
+	remote, err := client.Dial(listener.Addr().String(),
+		server.localStatic.PubKey())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer remote.Close()
+	local := <-accepted
+	if local == nil {
+		t.Fatalf("unable to accept connection")
+	}
+	defer local.Close()
+
+	// Both ends share the settings of their transports.
+	for _, conn := range []*Conn{local, remote} {
+		if conn.readTimeout != int64(time.Minute) || !conn.framed {
+			t.Fatalf("expected the transport's options to apply")
+		}
+	}
+	roundTrip(t, local, remote)
+}
@@ -0,0 +1,96 @@
+package lndc
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrWouldBlock is returned by TryWrite when the message can't be written
+// without blocking, as either the socket's send buffer is full or the remote
+// peer's flow control window is.
+var ErrWouldBlock = errors.New("lndc: write would block")
+
+// TryWrite attempts to write b to the connection without blocking, for
+// callers which manage many connections from a single goroutine. At most a
+// single message is written, so if b is larger than the maximum payload only
+// the leading bytes are written and the number written is returned, leaving
+// the caller to retry the rest.
+//
+// Once a message has been encrypted it must be written in full, so should
+// the send buffer fill part way through, the rest of the message is held
+// back and written ahead of the next message. TryWrite returns ErrWouldBlock
+// without writing anything while such a message is outstanding. ErrNotTCP is
+// returned if the connection doesn't wrap a TCP connection.
+func (c *Conn) TryWrite(b []byte) (int, error) {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	if c.writeClosed {
+		return 0, ErrWriteClosed
+	}
+
+	// Nothing may be committed to the connection before we know the
+	// message can be written without blocking.
+	if err := canRawWrite(c.conn); err != nil {
+		return 0, err
+	}
+	if len(c.pendingWrite) > 0 {
+		if err := c.flushPending(); err != nil {
+			return 0, err
+		}
+		if len(c.pendingWrite) > 0 {
+			return 0, ErrWouldBlock
+		}
+	}
+
+	chunk := b
+	if len(chunk) > c.maxPayload() {
+		chunk = chunk[:c.maxPayload()]
+	}
+	size, ok := c.takeCredits(len(chunk))
+	if !ok {
+		return 0, ErrWouldBlock
+	}
+	chunk = chunk[:size]
+
+	msg := chunk
+	if c.framed {
+		msg = c.dataFrame(chunk)
+	}
+	c.stampSequence(msg)
+	var cipherText bytes.Buffer
+	if err := c.noise.WriteMessage(&cipherText, msg); err != nil {
+		return 0, err
+	}
+	c.snapshotNonces()
+	c.touchWrite()
+	c.teeWrite(chunk)
+
+	// Should the write fail, the connection has failed with it, so the
+	// message is dropped rather than left to be written ahead of the
+	// next one.
+	c.pendingWrite = cipherText.Bytes()
+	if err := c.flushPending(); err != nil {
+		c.pendingWrite = nil
+		return 0, err
+	}
+
+	return len(chunk), nil
+}
+
+// flushPending writes as much of the outstanding ciphertext left by TryWrite
+// as the socket's send buffer has room for, without blocking.
+//
+// NOTE: This method must be called with writeMtx held.
+func (c *Conn) flushPending() error {
+	n, err := rawWrite(c.conn, c.pendingWrite)
+	c.pendingWrite = c.pendingWrite[n:]
+	if err == ErrWouldBlock {
+		return nil
+	}
+	if err != nil {
+		c.recordFailure(err, true)
+	}
+
+	return err
+}
@@ -0,0 +1,92 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package lndc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestTryWrite(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	// With nothing reading from the other end, the send buffers fill and
+	// TryWrite reports as much instead of blocking.
+	chunk := bytes.Repeat([]byte("backpressure"), 1024)
+	var sent bytes.Buffer
+	blocked := false
+	for i := 0; i < 100000; i++ {
+		n, err := remote.TryWrite(chunk)
+		if err == ErrWouldBlock {
+			blocked = true
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+		if n != len(chunk) {
+			t.Fatalf("expected %d bytes written, got %d", len(chunk), n)
+		}
+		sent.Write(chunk)
+	}
+	if !blocked {
+		t.Fatalf("send buffer never filled")
+	}
+
+	// A blocking write still goes through once the reader catches up,
+	// after everything accepted by TryWrite.
+	tail := []byte("after the backlog")
+	done := make(chan error, 1)
+	go func() {
+		_, err := remote.Write(tail)
+		done <- err
+	}()
+
+	got := make([]byte, sent.Len()+len(tail))
+	if _, err := io.ReadFull(local, got); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	if !bytes.Equal(got, append(sent.Bytes(), tail...)) {
+		t.Fatalf("stream corrupted by non-blocking writes")
+	}
+
+	// With room in the send buffer again, TryWrite succeeds.
+	if _, err := remote.TryWrite(tail); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	if _, err := io.ReadFull(local, got[:len(tail)]); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+}
+
+func TestTryWriteNotTCP(t *testing.T) {
+	// A conn over a pipe can't be written to without blocking, so is
+	// refused before the message is committed to the connection.
+	initiator, responder, _, _ := upgradePipe(t)
+	defer initiator.Close()
+	defer responder.Close()
+
+	if _, err := initiator.TryWrite([]byte("first")); err != ErrNotTCP {
+		t.Fatalf("expected %v, got %v", ErrNotTCP, err)
+	}
+
+	go initiator.Write([]byte("second"))
+	buf := make([]byte, 16)
+	n, err := responder.Read(buf)
+	if err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if string(buf[:n]) != "second" {
+		t.Fatalf("expected only the blocking write, got %q", buf[:n])
+	}
+}
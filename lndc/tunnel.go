@@ -0,0 +1,154 @@
+package lndc
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// ErrWriteClosed is returned by a write to a connection whose writing side
+// has been shut down by CloseWrite.
+var ErrWriteClosed = errors.New("lndc: write side of connection closed")
+
+// ErrHalfCloseUnsupported is returned by CloseWrite if the underlying
+// connection can't be half closed.
+var ErrHalfCloseUnsupported = errors.New("lndc: underlying connection " +
+	"can't be half closed")
+
+// closeWriter is implemented by connections which can shut down their
+// writing side alone, such as *net.TCPConn.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// CloseWrite shuts down the writing side of the connection, so that the
+// remote peer's reads return io.EOF once it has read everything written
+// before. The connection can still be read from, until Close is called.
+//
+// Over a connection established through the extended handshake, the end of
+// the data is marked in band, leaving control frames such as flow control
+// credits free to flow in both directions. Both sides must support this,
+// as an older peer fails its read on the unfamiliar frame. Over any other
+// connection the underlying connection itself is half closed, failing with
+// ErrHalfCloseUnsupported if it can't be.
+func (c *Conn) CloseWrite() error {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	if c.writeClosed {
+		return nil
+	}
+
+	// Any message left part written by TryWrite must be finished first.
+	if len(c.pendingWrite) > 0 {
+		n, err := c.conn.Write(c.pendingWrite)
+		c.pendingWrite = c.pendingWrite[n:]
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.framed {
+		err := c.noise.writeMessage(c.conn, []byte{frameEnd}, nil)
+		c.snapshotNonces()
+		if err != nil {
+			return err
+		}
+		c.writeClosed = true
+
+		return nil
+	}
+
+	cw, ok := c.conn.(closeWriter)
+	if !ok {
+		return ErrHalfCloseUnsupported
+	}
+	if err := cw.CloseWrite(); err != nil {
+		return err
+	}
+	c.writeClosed = true
+
+	return nil
+}
+
+// drainControl processes the control frames sent by the remote peer after
+// it has closed its writing side, so that credits keep arriving for our
+// writes, until the connection fails or is closed.
+func (c *Conn) drainControl() {
+	for {
+		msg, _, err := c.noise.readMessage(c.conn, nil)
+		c.snapshotRecvNonce()
+		if err != nil || len(msg) == 0 {
+			return
+		}
+
+		switch msg[0] {
+		case frameCredit:
+			if err := c.receivedCredit(msg[1:]); err != nil {
+				return
+			}
+
+		default:
+			return
+		}
+	}
+}
+
+// Tunnel bridges the connection with target, such as a connection to a
+// local service exposed to the remote peer, copying bytes in both
+// directions until each has reached EOF. The end of each direction is
+// passed on as a half close, so that protocols which rely on it work across
+// the tunnel. If the receiving side of a direction can't be half closed, it
+// is closed outright instead.
+//
+// Both connections are closed once Tunnel returns. The first error either
+// direction fails with is returned, or nil if both completed cleanly.
+func Tunnel(c *Conn, target net.Conn) error {
+	done := make(chan error, 2)
+	go func() {
+		done <- pipe(c, target)
+	}()
+	go func() {
+		// Once the remote peer has closed its side, its credits must
+		// still be read for the other direction to make progress.
+		err := pipe(target, c)
+		if err == nil && c.framed {
+			go c.drainControl()
+		}
+		done <- err
+	}()
+
+	// As soon as either direction fails, both connections are closed so
+	// that the other direction is unblocked too.
+	err := <-done
+	if err != nil {
+		c.Close()
+		target.Close()
+		<-done
+		return err
+	}
+	err = <-done
+
+	c.Close()
+	target.Close()
+
+	return err
+}
+
+// pipe copies from src to dst until src reaches EOF, then half closes dst.
+func pipe(dst, src net.Conn) error {
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+
+	cw, ok := dst.(closeWriter)
+	if !ok {
+		return dst.Close()
+	}
+	err := cw.CloseWrite()
+	if err == ErrHalfCloseUnsupported {
+		return dst.Close()
+	}
+
+	return err
+}
@@ -0,0 +1,143 @@
+package lndc
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// tcpPair returns both ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	server := <-accepted
+	if server == nil {
+		t.Fatalf("unable to accept")
+	}
+
+	return client.(*net.TCPConn), server.(*net.TCPConn)
+}
+
+func TestTunnelEcho(t *testing.T) {
+	// The echo service sends back everything it reads, half closing its
+	// side once it reaches EOF.
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		conn, err := echo.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+		conn.(*net.TCPConn).CloseWrite()
+	}()
+
+	listener, pkh := newTestListener(t, WithFlowWindow(4096))
+	defer listener.Close()
+	local, remote := dialAndAccept(t, listener, pkh, WithFlowWindow(4096))
+
+	// The listener's side exposes the echo service, while the dialer's
+	// side bridges a local client to it.
+	service, err := net.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial echo service: %v", err)
+	}
+	client, server := tcpPair(t)
+	defer client.Close()
+
+	results := make(chan error, 2)
+	go func() {
+		results <- Tunnel(local, service)
+	}()
+	go func() {
+		results <- Tunnel(remote, server)
+	}()
+
+	// Send more than a single window, so credits must flow across the
+	// tunnel while the client is still writing.
+	msg := bytes.Repeat([]byte("echo "), 10000)
+	go func() {
+		client.Write(msg)
+		client.CloseWrite()
+	}()
+
+	got, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("unable to read echo: %v", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("expected %d bytes echoed, got %d", len(msg), len(got))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("tunnel failed: %v", err)
+		}
+	}
+}
+
+func TestConnCloseWrite(t *testing.T) {
+	// The write side is half closed in band over framed connections,
+	// and through the underlying connection otherwise.
+	for _, framed := range []bool{false, true} {
+		var options []func(*Config)
+		if framed {
+			options = append(options, WithFlowWindow(1024))
+		}
+		testConnCloseWrite(t, options...)
+	}
+}
+
+func testConnCloseWrite(t *testing.T, options ...func(*Config)) {
+	listener, pkh := newTestListener(t, options...)
+	defer listener.Close()
+	local, remote := dialAndAccept(t, listener, pkh, options...)
+	defer local.Close()
+	defer remote.Close()
+
+	if _, err := remote.Write([]byte("last words")); err != nil {
+		t.Fatalf("unable to write message: %v", err)
+	}
+	if err := remote.CloseWrite(); err != nil {
+		t.Fatalf("unable to close write side: %v", err)
+	}
+	if _, err := remote.Write([]byte("more")); err != ErrWriteClosed {
+		t.Fatalf("expected %v, got %v", ErrWriteClosed, err)
+	}
+
+	// The peer reads everything written before EOF, and can still write
+	// back over its own side.
+	got, err := io.ReadAll(local)
+	if err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if string(got) != "last words" {
+		t.Fatalf("expected %q, got %q", "last words", got)
+	}
+	if _, err := local.Write([]byte("reply")); err != nil {
+		t.Fatalf("unable to write reply: %v", err)
+	}
+	reply := make([]byte, 5)
+	if _, err := io.ReadFull(remote, reply); err != nil {
+		t.Fatalf("unable to read reply: %v", err)
+	}
+}
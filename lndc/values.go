@@ -0,0 +1,29 @@
+package lndc
+
+// SetValue attaches val to the connection under key, replacing any value
+// already held under it, so that it's available to any code the connection
+// is handed to, such as a trace ID to correlate log lines with. As with
+// context.WithValue, key must be comparable and should be of an unexported
+// type of the caller's own to avoid collisions. A nil val removes the key.
+func (c *Conn) SetValue(key, val interface{}) {
+	c.valuesMtx.Lock()
+	defer c.valuesMtx.Unlock()
+
+	if val == nil {
+		delete(c.values, key)
+		return
+	}
+	if c.values == nil {
+		c.values = make(map[interface{}]interface{})
+	}
+	c.values[key] = val
+}
+
+// Value returns the value attached to the connection under key via
+// SetValue, or nil if there is none.
+func (c *Conn) Value(key interface{}) interface{} {
+	c.valuesMtx.Lock()
+	defer c.valuesMtx.Unlock()
+
+	return c.values[key]
+}
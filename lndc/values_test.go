@@ -0,0 +1,55 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// traceKey is the key under which the tests attach trace IDs.
+type traceKey struct{}
+
+func TestConnValues(t *testing.T) {
+	listener, pkh := newTestListener(t)
+	defer listener.Close()
+
+	// The accept loop tags each connection with a trace ID, which a
+	// downstream handler reads back.
+	traces := make(chan interface{}, 1)
+	downstream := func(conn *Conn) {
+		traces <- conn.Value(traceKey{})
+		conn.Close()
+	}
+	go listener.Serve(func(conn *Conn) {
+		conn.SetValue(traceKey{}, "trace-1")
+		go downstream(conn)
+	})
+
+	conn, err := Dial(newKey(t), listener.Addr().String(), pkh, net.Dial)
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+	defer conn.Close()
+
+	select {
+	case trace := <-traces:
+		if trace != "trace-1" {
+			t.Fatalf("expected trace-1, got %v", trace)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("conn not passed downstream")
+	}
+
+	// Values are scoped to their connection and can be removed.
+	if v := conn.Value(traceKey{}); v != nil {
+		t.Fatalf("expected no value on the dialer's conn, got %v", v)
+	}
+	conn.SetValue(traceKey{}, "trace-2")
+	if v := conn.Value(traceKey{}); v != "trace-2" {
+		t.Fatalf("expected trace-2, got %v", v)
+	}
+	conn.SetValue(traceKey{}, nil)
+	if v := conn.Value(traceKey{}); v != nil {
+		t.Fatalf("expected value removed, got %v", v)
+	}
+}
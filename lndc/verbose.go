@@ -0,0 +1,125 @@
+package lndc
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mit-dci/lit/crypto/koblitz"
+)
+
+// VerboseSet is the set of peers, by public key or IP, whose connections log
+// a detailed trace of their handshake and traffic. Peers can be flagged and
+// unflagged while the connections consulting the set run, taking effect from
+// their next logged event. A VerboseSet is safe for concurrent use.
+//
+// NOTE: A connection is only matched by public key once the peer's identity
+// has been learned, which for an accepted connection is after act three, so
+// a flagged IP is needed to trace the start of its handshake.
+type VerboseSet struct {
+	// flagged counts the flagged keys and IPs, allowing connections to
+	// skip the lookup while none are. It must only be accessed
+	// atomically.
+	flagged int32
+
+	mtx  sync.RWMutex
+	pubs map[[33]byte]struct{}
+	ips  map[string]struct{}
+}
+
+// NewVerboseSet returns an empty VerboseSet.
+func NewVerboseSet() *VerboseSet {
+	return &VerboseSet{
+		pubs: make(map[[33]byte]struct{}),
+		ips:  make(map[string]struct{}),
+	}
+}
+
+// update carries out fn with the set locked, then recounts its entries.
+func (s *VerboseSet) update(fn func()) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	fn()
+	atomic.StoreInt32(&s.flagged, int32(len(s.pubs)+len(s.ips)))
+}
+
+// Flag turns on verbose logging for the peer with the passed identity.
+func (s *VerboseSet) Flag(pub *koblitz.PublicKey) {
+	s.update(func() { s.pubs[pubKey(pub)] = struct{}{} })
+}
+
+// Unflag turns off verbose logging for the peer with the passed identity,
+// though it remains on if the peer's IP is flagged.
+func (s *VerboseSet) Unflag(pub *koblitz.PublicKey) {
+	s.update(func() { delete(s.pubs, pubKey(pub)) })
+}
+
+// FlagIP turns on verbose logging for all peers connecting from ip.
+func (s *VerboseSet) FlagIP(ip net.IP) {
+	s.update(func() { s.ips[ip.String()] = struct{}{} })
+}
+
+// UnflagIP turns off verbose logging for ip, though it remains on for those
+// of its peers whose identity is flagged.
+func (s *VerboseSet) UnflagIP(ip net.IP) {
+	s.update(func() { delete(s.ips, ip.String()) })
+}
+
+// IsVerbose reports whether either the peer's identity or its IP is flagged.
+// Either may be nil if unknown.
+func (s *VerboseSet) IsVerbose(pub *koblitz.PublicKey, ip net.IP) bool {
+	if atomic.LoadInt32(&s.flagged) == 0 {
+		return false
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if ip != nil {
+		if _, ok := s.ips[ip.String()]; ok {
+			return true
+		}
+	}
+	if pub != nil {
+		if _, ok := s.pubs[pubKey(pub)]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verbose reports whether the connection's peer is flagged in the
+// VerbosePeers it was created with.
+func (c *Conn) verbose() bool {
+	if c.verbosePeers == nil {
+		return false
+	}
+
+	return c.verbosePeers.IsVerbose(c.RemoteIdentity(),
+		remoteIP(c.conn.RemoteAddr()))
+}
+
+// tracef logs a line of the connection's detailed trace at the info level,
+// if its peer is flagged for verbose logging.
+func (c *Conn) tracef(format string, args ...interface{}) {
+	if !c.verbose() {
+		return
+	}
+
+	args = append([]interface{}{c.conn.RemoteAddr()}, args...)
+	c.logger.Infof("lndc conn %v: "+format, args...)
+}
+
+// traceHandshake traces the outcome of the connection's handshake.
+func (c *Conn) traceHandshake(err error) {
+	if err != nil {
+		c.tracef("handshake failed: %v", err)
+		return
+	}
+
+	c.tracef("handshake with %x complete in %v, version %d, suite %q",
+		c.RemoteIdentity().SerializeCompressed(), c.handshakeDuration,
+		c.noise.Version(), c.suite)
+}
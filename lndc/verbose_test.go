@@ -0,0 +1,80 @@
+package lndc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestVerbosePeers(t *testing.T) {
+	logger := &captureLogger{}
+	verbose := NewVerboseSet()
+	listener, pkh := newTestListener(t, WithLogger(logger),
+		WithVerbosePeers(verbose))
+	defer listener.Close()
+
+	flaggedPriv := newKey(t)
+	verbose.Flag(flaggedPriv.PubKey())
+
+	flaggedLocal, flaggedRemote := dialAndAcceptWithKey(t, listener, pkh,
+		flaggedPriv)
+	quietLocal, quietRemote := dialAndAccept(t, listener, pkh)
+	defer quietLocal.Close()
+	defer quietRemote.Close()
+
+	roundTrip(t, flaggedLocal, flaggedRemote)
+	roundTrip(t, quietLocal, quietRemote)
+	flaggedLocal.Close()
+	flaggedRemote.Close()
+
+	// Only the flagged peer's connection is traced, from the act which
+	// reveals its identity through to its close.
+	flagged := "lndc conn " + flaggedLocal.RemoteAddr().String() + ":"
+	for _, event := range []string{"received act three", "handshake",
+		"complete", "wrote 100 byte message", "read 100 byte message",
+		"closed: " + ErrLocalClose.Error()} {
+
+		if len(logger.matching(flagged, event)) == 0 {
+			t.Fatalf("flagged conn didn't trace %q: %v", event,
+				logger.lines)
+		}
+	}
+	if lines := logger.matching("received act one"); len(lines) != 0 {
+		t.Fatalf("act one traced before the peer was known: %v", lines)
+	}
+	quiet := "lndc conn " + quietLocal.RemoteAddr().String() + ":"
+	if lines := logger.matching(quiet); len(lines) != 0 {
+		t.Fatalf("unflagged conn was traced: %v", lines)
+	}
+
+	// Once unflagged, the peer's connections are quiet again.
+	verbose.Unflag(flaggedPriv.PubKey())
+	local, remote := dialAndAcceptWithKey(t, listener, pkh, flaggedPriv)
+	defer local.Close()
+	defer remote.Close()
+	roundTrip(t, local, remote)
+	unflagged := "lndc conn " + local.RemoteAddr().String() + ":"
+	if lines := logger.matching(unflagged); len(lines) != 0 {
+		t.Fatalf("unflagged conn was traced: %v", lines)
+	}
+}
+
+func TestVerbosePeersIP(t *testing.T) {
+	logger := &captureLogger{}
+	verbose := NewVerboseSet()
+	verbose.FlagIP(net.ParseIP("127.0.0.1"))
+	verbose.FlagIP(net.ParseIP("::1"))
+	listener, pkh := newTestListener(t, WithLogger(logger),
+		WithVerbosePeers(verbose))
+	defer listener.Close()
+
+	local, remote := dialAndAccept(t, listener, pkh)
+	defer local.Close()
+	defer remote.Close()
+
+	// A flagged IP is traced from the very start of the handshake.
+	traced := "lndc conn " + local.RemoteAddr().String() + ":"
+	if len(logger.matching(traced, "received act one")) == 0 {
+		t.Fatalf("flagged IP's handshake wasn't traced: %v",
+			logger.lines)
+	}
+}
@@ -0,0 +1,84 @@
+package lndc
+
+import (
+	"net"
+	"sync"
+)
+
+// weightedSema is a semaphore whose holders each take a number of units,
+// such that the total held never exceeds its capacity.
+type weightedSema struct {
+	mtx      sync.Mutex
+	capacity int
+	used     int
+
+	// released is signalled whenever units are released, waking a
+	// blocked acquire.
+	released chan struct{}
+}
+
+// newWeightedSema returns a semaphore of the passed capacity.
+func newWeightedSema(capacity int) *weightedSema {
+	return &weightedSema{
+		capacity: capacity,
+		released: make(chan struct{}, 1),
+	}
+}
+
+// clamp limits n to the range which can be acquired, so that a cost above
+// the capacity waits for the semaphore to be free rather than forever.
+func (s *weightedSema) clamp(n int) int {
+	switch {
+	case n < 1:
+		return 1
+	case n > s.capacity:
+		return s.capacity
+	default:
+		return n
+	}
+}
+
+// acquire waits for n units to be free and takes them, returning false if
+// quit is closed first.
+//
+// NOTE: acquire must only be called from a single goroutine, as waiters
+// aren't queued.
+func (s *weightedSema) acquire(n int, quit <-chan struct{}) bool {
+	for {
+		s.mtx.Lock()
+		if s.used+n <= s.capacity {
+			s.used += n
+			s.mtx.Unlock()
+			return true
+		}
+		s.mtx.Unlock()
+
+		select {
+		case <-s.released:
+		case <-quit:
+			return false
+		}
+	}
+}
+
+// release returns n units taken by acquire.
+func (s *weightedSema) release(n int) {
+	s.mtx.Lock()
+	s.used -= n
+	s.mtx.Unlock()
+
+	select {
+	case s.released <- struct{}{}:
+	default:
+	}
+}
+
+// handshakeCost returns the number of handshake slots the handshake with
+// the peer at remoteAddr is estimated to take, as set by HandshakeCost.
+func (c *Config) handshakeCost(remoteAddr net.Addr) int {
+	if c.HandshakeCost == nil {
+		return 1
+	}
+
+	return c.HandshakeCost(remoteAddr)
+}